@@ -8,6 +8,8 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Schedules recur in IANA time zones, the image has no zoneinfo.
+	_ "time/tzdata"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -16,18 +18,33 @@ import (
 	"github.com/zanzhit/studio_recorder/internal/config"
 	authhandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/auth"
 	camerahandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/cameras"
+	eventshandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/events"
+	layoutshandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/layouts"
+	profileshandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/profiles"
 	recordinghandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/recordings"
 	authmid "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
 	"github.com/zanzhit/studio_recorder/internal/http-server/middleware/logger"
 	"github.com/zanzhit/studio_recorder/internal/lib/sl"
 	authservice "github.com/zanzhit/studio_recorder/internal/services/auth"
 	cameraservice "github.com/zanzhit/studio_recorder/internal/services/cameras"
+	"github.com/zanzhit/studio_recorder/internal/services/eventbus"
+	layoutservice "github.com/zanzhit/studio_recorder/internal/services/layouts"
+	profileservice "github.com/zanzhit/studio_recorder/internal/services/profiles"
 	recordingservice "github.com/zanzhit/studio_recorder/internal/services/recordings"
 	"github.com/zanzhit/studio_recorder/internal/services/recordings/opencast"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/preroll"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/fake"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/ffmpeg"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/gstreamer"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/native"
+	scheduleservice "github.com/zanzhit/studio_recorder/internal/services/schedules"
 	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
 	authstorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/auth"
 	camerastorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/cameras"
+	layoutstorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/layouts"
+	profilestorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/profiles"
 	recordingstorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/recordings"
+	schedulestorage "github.com/zanzhit/studio_recorder/internal/storage/postgres/schedules"
 )
 
 const (
@@ -36,6 +53,13 @@ const (
 	envProd  = "prod"
 )
 
+const (
+	backendGStreamer = "gstreamer"
+	backendFFmpeg    = "ffmpeg"
+	backendNative    = "native"
+	backendFake      = "fake"
+)
+
 func main() {
 	cfg := config.MustLoad()
 
@@ -48,13 +72,6 @@ func main() {
 		panic(err)
 	}
 
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(logger.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-
 	authStorage := authstorage.New(storage)
 	authService := authservice.New(log, authStorage, authStorage, cfg.TokenTTL, cfg.Secret)
 	authHandler := authhandler.New(log, authService)
@@ -63,46 +80,61 @@ func main() {
 		panic(err)
 	}
 
+	bus := eventbus.New(log, cfg.Events.Buffer)
+	eventHandler := eventshandler.New(log, bus, cfg.Events.Heartbeat)
+
+	rec := setupRecorder(cfg.Recording.Backend)
+
 	cameraStorage := camerastorage.New(storage)
-	cameraService := cameraservice.New(log, cfg.VideosPath, cameraStorage)
+	cameraService := cameraservice.New(log, cfg.VideosPath, cameraStorage, cameraStorage, rec, bus)
 	cameraHandler := camerahandler.New(log, cameraService, cameraStorage)
 
-	opencast := opencast.MustLoad(cfg.VideoService)
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+
+	go cameraService.Monitor(monitorCtx, cfg.Events.CameraCheck)
+
+	layoutStorage := layoutstorage.New(storage)
+	layoutService := layoutservice.New(log, layoutStorage)
+	layoutHandler := layoutshandler.New(log, layoutService, layoutStorage)
+
+	profileStorage := profilestorage.New(storage)
+	profileService := profileservice.New(log, profileStorage)
+	profileHandler := profileshandler.New(log, profileService, profileStorage)
+
+	opencast := opencast.MustLoad(cfg.VideoService, bus)
+
+	preRoll := preroll.New(log, rec, cameraStorage, cfg.VideosPath, cfg.Recording.PreRoll)
+
+	preRollCtx, stopPreRoll := context.WithCancel(context.Background())
+	defer stopPreRoll()
+
+	go preRoll.Run(preRollCtx)
 
 	recordingStorage := recordingstorage.New(storage)
-	recordingService := recordingservice.New(log, recordingStorage, recordingStorage, cameraStorage, opencast, cfg.VideosPath)
-	recordingHandler := recordinghandler.New(log, recordingService, recordingService)
+	recordingService := recordingservice.New(log, recordingStorage, recordingStorage, cameraStorage, layoutStorage, profileStorage, opencast, rec, bus, preRoll, cfg.VideosPath, cfg.Recording)
+	scheduleStorage := schedulestorage.New(storage)
+	scheduleService := scheduleservice.New(log, scheduleStorage, scheduleStorage, scheduleStorage, scheduleStorage, cameraStorage, recordingService, bus, cfg.Schedule)
+	recordingService.SetBookings(scheduleService)
 
-	router.Post("/login", authHandler.Login)
+	recordingHandler := recordinghandler.New(log, recordingService, recordingService, scheduleService)
 
-	router.With(authmid.JWTAuth(cfg.Secret)).Group(func(r chi.Router) {
-		r.With(authmid.AdminRequired).Route("/users", func(r chi.Router) {
-			r.Post("/", authHandler.RegisterNewUser)
-			r.Patch("/", authHandler.UpdatePassword)
-			r.Delete("/", authHandler.DeleteUser)
-		})
+	go recordingService.WriteEvents()
 
-		r.Route("/cameras", func(r chi.Router) {
-			r.Get("/", cameraHandler.Cameras)
-			r.With(authmid.AdminRequired).Group(func(r chi.Router) {
-				r.Post("/", cameraHandler.SaveCamera)
-				r.Patch("/{cameraID}", cameraHandler.UpdateCamera)
-				r.Delete("/{cameraID}", cameraHandler.DeleteCamera)
-			})
-		})
+	if err := recordingService.Reconcile(); err != nil {
+		panic(err)
+	}
 
-		r.Route("/recordings", func(r chi.Router) {
-			r.Get("/{cameraID}", recordingHandler.Recordings)
-			r.Get("/{recordID}/download", recordingHandler.Download)
-			r.Post("/start", recordingHandler.Start)
-			r.Post("/schedule", recordingHandler.Schedule)
-			r.Post("/{recordID}/stop", recordingHandler.Stop)
-			r.Delete("/{recordID}", recordingHandler.Delete)
-			if cfg.VideoService != "" {
-				r.Post("/{recordID}/move", recordingHandler.Move)
-			}
-		})
-	})
+	go scheduleService.Run()
+
+	router := setupRouter(log, cfg, handlers{
+		auth:       authHandler,
+		events:     eventHandler,
+		cameras:    cameraHandler,
+		layouts:    layoutHandler,
+		profiles:   profileHandler,
+		recordings: recordingHandler,
+	}, authService)
 
 	log.Info("starting http server", slog.String("address", cfg.Address))
 
@@ -117,6 +149,9 @@ func main() {
 		IdleTimeout:  cfg.IdleTimeout,
 	}
 
+	// Event streams never end on their own, close them so Shutdown can finish.
+	srv.RegisterOnShutdown(bus.Close)
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
 			log.Error("failed to start server")
@@ -126,6 +161,8 @@ func main() {
 	<-done
 	log.Error("stopping server")
 
+	stopMonitor()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -135,6 +172,11 @@ func main() {
 		return
 	}
 
+	stopPreRoll()
+	preRoll.Close()
+
+	recordingService.Close()
+
 	if err := storage.Close(); err != nil {
 		log.Error("failed to close storage", sl.Err(err))
 
@@ -144,6 +186,132 @@ func main() {
 	log.Info("server stopped")
 }
 
+type handlers struct {
+	auth       *authhandler.AuthHandler
+	events     *eventshandler.EventHandler
+	cameras    *camerahandler.CameraHandler
+	layouts    *layoutshandler.LayoutHandler
+	profiles   *profileshandler.ProfileHandler
+	recordings *recordinghandler.RecordHandler
+}
+
+func setupRouter(log *slog.Logger, cfg *config.Config, h handlers, feedUsers authmid.FeedUserProvider) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(logger.New(log))
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.URLFormat)
+
+	router.Post("/login", h.auth.Login)
+
+	router.With(authmid.TokenFromQuery, authmid.JWTAuth(cfg.Secret)).Route("/events", func(r chi.Router) {
+		r.Get("/", h.events.Stream)
+		r.Get("/ws", h.events.WebSocket)
+	})
+
+	// URLFormat strips the extension of /schedules.ics, so the list serves
+	// the feed for it. The feed is opened by the feed token, everything else
+	// under /schedules by the JWT.
+	feed := authmid.FeedTokenAuth(feedUsers)(http.HandlerFunc(h.recordings.Feed))
+	list := authmid.JWTAuth(cfg.Secret)(http.HandlerFunc(h.recordings.Schedules))
+
+	router.Route("/schedules", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format == "ics" {
+				feed.ServeHTTP(w, r)
+
+				return
+			}
+
+			list.ServeHTTP(w, r)
+		})
+
+		r.With(authmid.JWTAuth(cfg.Secret)).Group(func(r chi.Router) {
+			r.Post("/import", h.recordings.Import)
+			r.Post("/feed-token", h.auth.IssueFeedToken)
+			r.Delete("/feed-token", h.auth.RevokeFeedToken)
+			r.Get("/{scheduleID}", h.recordings.Schedule)
+			r.Patch("/{scheduleID}", h.recordings.UpdateSchedule)
+			r.Delete("/{scheduleID}", h.recordings.DeleteSchedule)
+			r.Post("/series", h.recordings.SaveSeries)
+			r.Get("/series/{seriesID}", h.recordings.Series)
+			r.Delete("/series/{seriesID}", h.recordings.DeleteSeries)
+			r.Post("/series/{seriesID}/occurrences", h.recordings.Occurrence)
+		})
+	})
+
+	router.With(authmid.JWTAuth(cfg.Secret)).Group(func(r chi.Router) {
+		r.With(authmid.AdminRequired).Route("/users", func(r chi.Router) {
+			r.Post("/", h.auth.RegisterNewUser)
+			r.Patch("/", h.auth.UpdatePassword)
+			r.Delete("/", h.auth.DeleteUser)
+		})
+
+		r.Route("/cameras", func(r chi.Router) {
+			r.Get("/", h.cameras.Cameras)
+			r.With(authmid.AdminRequired).Group(func(r chi.Router) {
+				r.Post("/", h.cameras.SaveCamera)
+				r.Patch("/{cameraID}", h.cameras.UpdateCamera)
+				r.Delete("/{cameraID}", h.cameras.DeleteCamera)
+			})
+		})
+
+		r.Route("/layouts", func(r chi.Router) {
+			r.Get("/", h.layouts.Layouts)
+			r.Get("/{layoutID}", h.layouts.Layout)
+			r.With(authmid.AdminRequired).Group(func(r chi.Router) {
+				r.Post("/", h.layouts.SaveLayout)
+				r.Patch("/{layoutID}", h.layouts.UpdateLayout)
+				r.Delete("/{layoutID}", h.layouts.DeleteLayout)
+			})
+		})
+
+		r.Route("/profiles", func(r chi.Router) {
+			r.Get("/", h.profiles.Profiles)
+			r.Get("/{profileID}", h.profiles.Profile)
+			r.With(authmid.AdminRequired).Group(func(r chi.Router) {
+				r.Post("/", h.profiles.SaveProfile)
+				r.Patch("/{profileID}", h.profiles.UpdateProfile)
+				r.Delete("/{profileID}", h.profiles.DeleteProfile)
+			})
+		})
+
+		r.Route("/recordings", func(r chi.Router) {
+			r.Get("/active", h.recordings.Active)
+			r.Get("/{cameraID}", h.recordings.Recordings)
+			r.Get("/{recordID}/download", h.recordings.Download)
+			r.Get("/{recordID}/segments", h.recordings.Segments)
+			r.Get("/{recordID}/details", h.recordings.Details)
+			r.Get("/{recordID}/log", h.recordings.Log)
+			r.Get("/{recordID}/chapters", h.recordings.Chapters)
+			r.Get("/{recordID}/events", h.recordings.Events)
+			r.Get("/{recordID}/status", h.recordings.Status)
+			r.Post("/start", h.recordings.Start)
+			r.Post("/schedule", h.recordings.SaveSchedule)
+			r.Post("/{recordID}/stop", h.recordings.Stop)
+			r.Post("/{recordID}/pause", h.recordings.Pause)
+			r.Post("/{recordID}/resume", h.recordings.Resume)
+			r.Post("/{recordID}/markers", h.recordings.AddMarker)
+			r.Delete("/{recordID}", h.recordings.Delete)
+			if cfg.VideoService != "" {
+				r.Post("/{recordID}/move", h.recordings.Move)
+			}
+		})
+
+		r.Route("/sessions", func(r chi.Router) {
+			r.Post("/start", h.recordings.StartSession)
+			r.Get("/{sessionID}", h.recordings.Session)
+			r.Post("/{sessionID}/stop", h.recordings.StopSession)
+			if cfg.VideoService != "" {
+				r.Post("/{sessionID}/move", h.recordings.MoveSession)
+			}
+		})
+	})
+
+	return router
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
@@ -164,3 +332,18 @@ func setupLogger(env string) *slog.Logger {
 
 	return log
 }
+
+func setupRecorder(backend string) recordingservice.Recorder {
+	switch backend {
+	case backendGStreamer:
+		return gstreamer.New()
+	case backendFFmpeg:
+		return ffmpeg.New()
+	case backendNative:
+		return native.New(gstreamer.New())
+	case backendFake:
+		return fake.New()
+	default:
+		panic("unknown recording backend: " + backend)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	recordinghandler "github.com/zanzhit/studio_recorder/internal/http-server/handlers/recordings"
+	"github.com/zanzhit/studio_recorder/internal/lib/ical"
+)
+
+const feedToken = "feed-token"
+
+type feedUsers struct{}
+
+func (feedUsers) FeedUser(token string) (models.User, error) {
+	if token != feedToken {
+		return models.User{}, errs.ErrInvalidCredentials
+	}
+
+	return models.User{Id: 7, Email: "user@example.com"}, nil
+}
+
+type feedScheduler struct {
+	recordinghandler.Scheduler
+	userID int
+	room   string
+}
+
+func (s *feedScheduler) Feed(userID int, room string) (ical.Calendar, error) {
+	s.userID = userID
+	s.room = room
+
+	return ical.Calendar{Name: "Recordings"}, nil
+}
+
+func testRouter(t *testing.T) (http.Handler, *feedScheduler) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	scheduler := &feedScheduler{}
+
+	router := setupRouter(log, &config.Config{Secret: "secret"}, handlers{
+		recordings: recordinghandler.New(log, nil, nil, scheduler),
+	}, feedUsers{})
+
+	return router, scheduler
+}
+
+func TestFeedRoute(t *testing.T) {
+	router, scheduler := testRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/schedules.ics?room=101&token="+feedToken, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("content type = %q, want text/calendar", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "BEGIN:VCALENDAR") {
+		t.Errorf("body is not a calendar: %s", rec.Body.String())
+	}
+	if scheduler.userID != 7 || scheduler.room != "101" {
+		t.Errorf("feed of user %d room %q, want user 7 room 101", scheduler.userID, scheduler.room)
+	}
+}
+
+func TestFeedRouteRejectsWithoutFeedToken(t *testing.T) {
+	router, _ := testRouter(t)
+
+	for _, target := range []string{
+		"/schedules.ics",
+		"/schedules.ics?token=wrong",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestFeedTokenDoesNotOpenSchedules(t *testing.T) {
+	router, scheduler := testRouter(t)
+
+	for _, target := range []string{
+		"/schedules?token=" + feedToken,
+		"/schedules.json?token=" + feedToken,
+		"/schedules/series/1?token=" + feedToken,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if scheduler.userID != 0 {
+		t.Error("feed served without the feed route")
+	}
+}
@@ -15,9 +15,85 @@ type Config struct {
 	VideosPath   string        `yaml:"videos_path" env-required:"true"`
 	DB           DB            `yaml:"db"`
 	VideoService string        `yaml:"video_service" env-required:"true"`
+	Recording    Recording     `yaml:"recording"`
+	Events       Events        `yaml:"events"`
+	Schedule     Schedule      `yaml:"schedule"`
 	HTTPServer   `yaml:"http_server"`
 }
 
+type Events struct {
+	// Buffer is how many events a slow client may lag behind before it
+	// starts losing them.
+	Buffer    int           `yaml:"buffer" env-default:"64"`
+	Heartbeat time.Duration `yaml:"heartbeat" env-default:"15s"`
+	// CameraCheck is how often cameras are probed for offline events, 0
+	// disables the check.
+	CameraCheck time.Duration `yaml:"camera_check" env-default:"30s"`
+}
+
+type Schedule struct {
+	// Grace is how late a schedule may still be started, e.g. after a
+	// restart. Later ones are marked as missed.
+	Grace time.Duration `yaml:"grace" env-default:"5m"`
+	// Poll is how often schedules are reloaded when none is due sooner.
+	Poll time.Duration `yaml:"poll" env-default:"1m"`
+	// Horizon is how far ahead occurrences of recurring schedules are listed
+	// when the list has no end.
+	Horizon time.Duration `yaml:"horizon" env-default:"720h"`
+	// Lead is how long before a booking its cameras can no longer be
+	// recorded ad hoc.
+	Lead time.Duration `yaml:"lead" env-default:"15m"`
+	// TimeZone is the IANA time zone of the studio. Recurring schedules
+	// recur in it unless they name another, and floating times of imported
+	// calendars are read in it.
+	TimeZone string `yaml:"time_zone" env-default:"UTC"`
+}
+
+type Recording struct {
+	Backend     string        `yaml:"backend" env-default:"gstreamer"`
+	StaleAfter  time.Duration `yaml:"stale_after" env-default:"30s"`
+	StopTimeout time.Duration `yaml:"stop_timeout" env-default:"15s"`
+	Layout      string        `yaml:"layout" env-default:"grid"`
+	Width       int           `yaml:"width" env-default:"1280"`
+	Height      int           `yaml:"height" env-default:"720"`
+	// Container is the file format: mkv, mp4 (fragmented) or ts. Empty uses
+	// MPEG-TS for segmented recordings and Matroska otherwise.
+	Container string `yaml:"container"`
+	// Proxy is the low-resolution copy written next to the master.
+	Proxy Proxy `yaml:"proxy"`
+	// PreRoll buffers cameras that keep a pre-roll, see PreRoll.
+	PreRoll PreRoll `yaml:"pre_roll"`
+	// SegmentDuration splits every recording into segments, 0 keeps one file.
+	SegmentDuration time.Duration `yaml:"segment_duration" env-default:"0s"`
+	// A pipeline that exits mid-recording is restarted with a backoff that
+	// doubles from RestartMin up to RestartMax.
+	RestartMin time.Duration `yaml:"restart_min" env-default:"1s"`
+	RestartMax time.Duration `yaml:"restart_max" env-default:"30s"`
+	// Pipeline output is kept next to the recording in a file rotated at
+	// LogMaxSizeMB, with LogBackups older files.
+	LogMaxSizeMB int `yaml:"log_max_size_mb" env-default:"10"`
+	LogBackups   int `yaml:"log_backups" env-default:"3"`
+	// StatusWindow is the period the live bitrate is averaged over.
+	StatusWindow time.Duration `yaml:"status_window" env-default:"10s"`
+}
+
+type Proxy struct {
+	// Enabled records a proxy unless a request turns it off.
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	Width   int  `yaml:"width" env-default:"640"`
+	Height  int  `yaml:"height" env-default:"360"`
+	// Bitrates are in kbit/s.
+	VideoBitrate int `yaml:"video_bitrate" env-default:"800"`
+	AudioBitrate int `yaml:"audio_bitrate" env-default:"64"`
+}
+
+// PreRoll is the ring buffer of cameras with a pre-roll retention. The buffer
+// is cut into Segment long files, cameras are reloaded every Sync.
+type PreRoll struct {
+	Segment time.Duration `yaml:"segment" env-default:"2s"`
+	Sync    time.Duration `yaml:"sync" env-default:"30s"`
+}
+
 type DB struct {
 	Host     string `yaml:"host" env-required:"true"`
 	Port     string `yaml:"port" env-required:"true"`
@@ -48,6 +124,10 @@ func MustLoad() *Config {
 		panic("failed to read config: " + err.Error())
 	}
 
+	if _, err := time.LoadLocation(cfg.Schedule.TimeZone); err != nil {
+		panic("unknown schedule time zone: " + cfg.Schedule.TimeZone)
+	}
+
 	return &cfg
 }
 
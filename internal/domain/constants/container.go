@@ -0,0 +1,8 @@
+package constants
+
+// Containers double as file extensions.
+const (
+	ContainerMatroska = "mkv"
+	ContainerMP4      = "mp4"
+	ContainerMPEGTS   = "ts"
+)
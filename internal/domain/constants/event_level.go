@@ -0,0 +1,6 @@
+package constants
+
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
@@ -0,0 +1,21 @@
+package constants
+
+const (
+	EventRecordingStarted     = "recording.started"
+	EventRecordingStopped     = "recording.stopped"
+	EventRecordingFailed      = "recording.failed"
+	EventRecordingInterrupted = "recording.interrupted"
+	EventRecordingRestarted   = "recording.restarted"
+	EventRecordingPaused      = "recording.paused"
+	EventRecordingResumed     = "recording.resumed"
+	EventMarkerAdded          = "recording.marker"
+	EventUploadStarted        = "upload.started"
+	EventUploadProgress       = "upload.progress"
+	EventUploadFinished       = "upload.finished"
+	EventUploadFailed         = "upload.failed"
+	EventCameraAdded          = "camera.added"
+	EventCameraOffline        = "camera.offline"
+	EventCameraOnline         = "camera.online"
+	EventScheduleMissed       = "schedule.missed"
+	EventScheduleFailed       = "schedule.failed"
+)
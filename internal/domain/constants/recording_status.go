@@ -0,0 +1,13 @@
+package constants
+
+const (
+	StatusRecording   = "recording"
+	StatusPaused      = "paused"
+	StatusFinalizing  = "finalizing"
+	StatusStopped     = "stopped"
+	StatusInterrupted = "interrupted"
+	StatusFailed      = "failed"
+	StatusUploading   = "uploading"
+	StatusUploaded    = "uploaded"
+	StatusDeleted     = "deleted"
+)
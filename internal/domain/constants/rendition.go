@@ -0,0 +1,8 @@
+package constants
+
+const (
+	// RenditionMaster is the full-quality file of a recording.
+	RenditionMaster = "master"
+	// RenditionProxy is the low-resolution copy recorded next to the master.
+	RenditionProxy = "proxy"
+)
@@ -0,0 +1,16 @@
+package constants
+
+const (
+	SchedulePending   = "pending"
+	ScheduleStarted   = "started"
+	ScheduleCompleted = "completed"
+	ScheduleMissed    = "missed"
+	ScheduleFailed    = "failed"
+	ScheduleCanceled  = "canceled"
+)
+
+const (
+	SeriesActive    = "active"
+	SeriesCompleted = "completed"
+	SeriesCanceled  = "canceled"
+)
@@ -1,6 +1,11 @@
 package errs
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
 
 var (
 	ErrUserType           = errors.New("wrong user type")
@@ -11,11 +16,69 @@ var (
 	ErrCameraNotFound       = errors.New("camera not found")
 	ErrCameraAlreadyExists  = errors.New("camera already exists")
 	ErrCameraIsNotAvailable = errors.New("camera is not available")
+	ErrCameraHasNoAudio     = errors.New("camera has no audio")
 
-	ErrRecordNotFound   = errors.New("record not found")
-	ErrFileNotFound     = errors.New("file not found")
-	ErrInvalidStartTime = errors.New("invalid start time")
-	ErrFileAlreadyMoved = errors.New("file already moved")
+	ErrRecordNotFound     = errors.New("record not found")
+	ErrFileNotFound       = errors.New("file not found")
+	ErrInvalidStartTime   = errors.New("invalid start time")
+	ErrInvalidDuration    = errors.New("invalid duration")
+	ErrInvalidTimeZone    = errors.New("invalid time zone")
+	ErrFileAlreadyMoved   = errors.New("file already moved")
+	ErrSegmentNotFound    = errors.New("segment not found")
+	ErrLogNotFound        = errors.New("log not found")
+	ErrUnknownLayout      = errors.New("unknown layout")
+	ErrLayoutNotFound     = errors.New("layout not found")
+	ErrLayoutExists       = errors.New("layout already exists")
+	ErrInvalidLayout      = errors.New("invalid layout")
+	ErrNotInRecording     = errors.New("camera is not part of the recording")
+	ErrPiecesNotJoinable  = errors.New("recording pieces can not be joined")
+	ErrProfileNotFound    = errors.New("profile not found")
+	ErrProfileExists      = errors.New("profile already exists")
+	ErrInvalidProfile     = errors.New("invalid profile")
+	ErrUnknownContainer   = errors.New("unknown container")
+	ErrRenditionNotFound  = errors.New("rendition not found")
+	ErrInvalidMarker      = errors.New("invalid marker")
+	ErrChaptersNotFound   = errors.New("chapters not found")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrTooManyAngles      = errors.New("session has too many angles")
+	ErrNoPreRoll          = errors.New("camera has no pre-roll buffer")
+	ErrPreRollNotAllowed  = errors.New("pre-roll can not be used with these options")
+	ErrScheduleNotFound   = errors.New("schedule not found")
+	ErrScheduleChanged    = errors.New("schedule status was changed")
+	ErrScheduleNotPending = errors.New("schedule is not pending")
+	ErrInvalidRRule       = errors.New("invalid recurrence rule")
+	ErrSeriesNotFound     = errors.New("schedule series not found")
+	ErrSeriesNotActive    = errors.New("schedule series is not active")
+	ErrNotAnOccurrence    = errors.New("time is not an occurrence of the series")
+	ErrInvalidCalendar    = errors.New("invalid calendar")
+	ErrCameraBooked       = errors.New("camera is booked")
+
+	ErrInvalidStatusTransition = errors.New("invalid recording status transition")
+	ErrRecordingInProgress     = errors.New("recording is in progress")
+	ErrRecordingNotActive      = errors.New("recording is not active")
+	ErrRecordingDeleted        = errors.New("recording is deleted")
+	ErrRecordingNotPaused      = errors.New("recording is not paused")
+	ErrRecordingNotPausable    = errors.New("recording can not be paused")
 
 	ErrWriteToDB = errors.New("failed to write to database")
 )
+
+// ConflictError rejects a booking or a recording of cameras that are booked
+// or recorded at the same time. It matches ErrCameraBooked.
+type ConflictError struct {
+	Conflicts []models.Conflict
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) == 1 {
+		c := e.Conflicts[0]
+
+		return fmt.Sprintf("%s: camera %s from %s", ErrCameraBooked, c.CameraID, c.StartTime.Format("2006-01-02 15:04"))
+	}
+
+	return fmt.Sprintf("%s: %d conflicts", ErrCameraBooked, len(e.Conflicts))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrCameraBooked
+}
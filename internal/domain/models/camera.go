@@ -5,4 +5,10 @@ type Camera struct {
 	CameraIP string `json:"camera_ip" db:"camera_ip"`
 	Location string `json:"location" db:"location"`
 	HasAudio bool   `json:"has_audio" db:"has_audio"`
+	// ProfileID is the encoding profile used when a recording does not ask
+	// for one.
+	ProfileID *string `json:"profile_id,omitempty" db:"profile_id"`
+	// PreRollSeconds is how much of the camera stream is kept in the pre-roll
+	// buffer, 0 keeps none.
+	PreRollSeconds int `json:"pre_roll_seconds" db:"pre_roll_seconds"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Event is a lifecycle event pushed to clients. ID grows with every event
+// published by the service.
+type Event struct {
+	ID          uint64    `json:"id"`
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	CameraIDs   []string  `json:"camera_ids,omitempty"`
+	RecordingID string    `json:"recording_id,omitempty"`
+	// UserID is the owner of the recording or schedule the event is about,
+	// 0 for events every user may see.
+	UserID int         `json:"user_id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+type UploadProgress struct {
+	Sent    int64   `json:"sent"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+}
@@ -0,0 +1,20 @@
+package models
+
+type Layout struct {
+	LayoutID   string       `json:"layout_id" db:"layout_id"`
+	Name       string       `json:"name" db:"name"`
+	Width      int          `json:"width" db:"width"`
+	Height     int          `json:"height" db:"height"`
+	Background string       `json:"background" db:"background"`
+	Slots      []LayoutSlot `json:"slots" db:"-"`
+}
+
+type LayoutSlot struct {
+	X           int    `json:"x" db:"x"`
+	Y           int    `json:"y" db:"y"`
+	Width       int    `json:"width" db:"width"`
+	Height      int    `json:"height" db:"height"`
+	ZOrder      int    `json:"z_order" db:"z_order"`
+	Border      int    `json:"border,omitempty" db:"border"`
+	BorderColor string `json:"border_color,omitempty" db:"border_color"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// Profile is a named set of encoder settings. Bitrates are in kbit/s; zero
+// values keep the encoder default or the source size and framerate.
+type Profile struct {
+	ProfileID        string `json:"profile_id" db:"profile_id"`
+	Name             string `json:"name" db:"name"`
+	VideoCodec       string `json:"video_codec" db:"video_codec"`
+	VideoBitrate     int    `json:"video_bitrate" db:"video_bitrate"`
+	Preset           string `json:"preset,omitempty" db:"preset"`
+	KeyframeInterval int    `json:"keyframe_interval" db:"keyframe_interval"`
+	Width            int    `json:"width" db:"width"`
+	Height           int    `json:"height" db:"height"`
+	Framerate        int    `json:"framerate" db:"framerate"`
+	AudioCodec       string `json:"audio_codec" db:"audio_codec"`
+	AudioBitrate     int    `json:"audio_bitrate" db:"audio_bitrate"`
+}
@@ -4,10 +4,153 @@ import "time"
 
 type Recording struct {
 	RecordingID string    `json:"recording_id" db:"record_id"`
+	CameraID    string    `json:"camera_id" db:"camera_id"`
 	CameraIP    string    `json:"camera_ip" db:"camera_ip"`
+	Title       string    `json:"title,omitempty" db:"title"`
 	FilePath    string    `json:"-" db:"file_path"`
 	UserID      int       `json:"user_id" db:"user_id"`
 	StartTime   time.Time `json:"start_time" db:"start_time"`
 	StopTime    time.Time `json:"stop_time" db:"stop_time"`
 	IsMoved     bool      `json:"is_moved" db:"is_moved"`
+	Status      string    `json:"status" db:"status"`
+	ExitCode    *int      `json:"exit_code,omitempty" db:"exit_code"`
+	PID         int       `json:"-" db:"pid"`
+	Segmented   bool      `json:"segmented" db:"segmented"`
+	Container   string    `json:"container" db:"container"`
+	MimeType    string    `json:"mime_type" db:"mime_type"`
+	// SessionID links the recordings of one multi-angle session,
+	// SessionIndex is the place of the camera in it.
+	SessionID    string `json:"session_id,omitempty" db:"session_id"`
+	SessionIndex int    `json:"-" db:"session_index"`
+}
+
+// Session records several cameras at once, each to its own file. StartTime
+// is the clock the angles are aligned to.
+type Session struct {
+	SessionID string    `json:"session_id" db:"session_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	StartTime time.Time `json:"start_time" db:"start_time"`
+	Angles    []Angle   `json:"angles" db:"-"`
+}
+
+// Angle is the recording of one camera of a session. Offset is the seconds
+// from the session start to the start of the recording.
+type Angle struct {
+	Recording
+	Offset float64 `json:"offset"`
+}
+
+// Segment is one file of a segmented recording. Offsets are seconds from the
+// recording start.
+type Segment struct {
+	RecordingID string  `json:"-" db:"record_id"`
+	Index       int     `json:"index" db:"segment_index"`
+	FilePath    string  `json:"-" db:"file_path"`
+	StartOffset float64 `json:"start_offset" db:"start_offset"`
+	EndOffset   float64 `json:"end_offset" db:"end_offset"`
+	Size        int64   `json:"size" db:"size"`
+}
+
+// Rendition is one file of a recording written by the same pipeline, e.g.
+// the master and its proxy. FilePath follows the recording file path: it may
+// be a segment pattern and restarts add pieces next to it.
+type Rendition struct {
+	RecordingID string `json:"-" db:"record_id"`
+	Name        string `json:"rendition" db:"rendition"`
+	FilePath    string `json:"-" db:"file_path"`
+	Container   string `json:"container" db:"container"`
+	MimeType    string `json:"mime_type" db:"mime_type"`
+}
+
+// Gap is a period when the pipeline was down. To is zero while the gap is
+// still open.
+type Gap struct {
+	ID   int64     `json:"-" db:"id"`
+	From time.Time `json:"from" db:"gap_start"`
+	To   time.Time `json:"to" db:"gap_end"`
+}
+
+// Pause is a period when the recording was paused by hand. To is zero while
+// the recording is still paused.
+type Pause struct {
+	ID   int64     `json:"-" db:"id"`
+	From time.Time `json:"from" db:"pause_start"`
+	To   time.Time `json:"to" db:"pause_end"`
+}
+
+// Marker is a moment of the recording bookmarked by hand. Offset is in
+// seconds of recorded time, pauses are not counted.
+type Marker struct {
+	ID          int64     `json:"id" db:"id"`
+	RecordingID string    `json:"-" db:"record_id"`
+	Label       string    `json:"label" db:"label"`
+	Offset      float64   `json:"offset" db:"marker_offset"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// PipelineEvent is an error or warning reported by the recording pipeline.
+type PipelineEvent struct {
+	RecordingID string    `json:"-" db:"record_id"`
+	Time        time.Time `json:"time" db:"event_time"`
+	Level       string    `json:"level" db:"level"`
+	Source      string    `json:"source" db:"source"`
+	Message     string    `json:"message" db:"message"`
+}
+
+// RecordingStatus is a live view of a recording. Elapsed and Window are in
+// seconds, Bitrate is the average in bits per second over the last Window.
+type RecordingStatus struct {
+	RecordingID string    `json:"recording_id"`
+	CameraIP    string    `json:"camera_ip"`
+	UserID      int       `json:"user_id"`
+	Status      string    `json:"status"`
+	StartTime   time.Time `json:"start_time"`
+	Elapsed     float64   `json:"elapsed"`
+	Size        int64     `json:"size"`
+	Bitrate     float64   `json:"bitrate"`
+	Window      float64   `json:"window"`
+	Alive       bool      `json:"alive"`
+	// Stats counts the packets of the running pipeline. Only backends that
+	// see individual packets report it.
+	Stats *StreamStats `json:"stats,omitempty"`
+}
+
+type StreamStats struct {
+	RTPPackets   uint64 `json:"rtp_packets"`
+	LostPackets  uint64 `json:"lost_packets"`
+	DecodeErrors uint64 `json:"decode_errors"`
+	VideoFrames  uint64 `json:"video_frames"`
+	AudioFrames  uint64 `json:"audio_frames"`
+	Bytes        uint64 `json:"bytes"`
+}
+
+type RecordingDetails struct {
+	Recording
+	Renditions []Rendition `json:"renditions"`
+	Segments   []Segment   `json:"segments"`
+	Gaps       []Gap       `json:"gaps"`
+	Pauses     []Pause     `json:"pauses"`
+	Markers    []Marker    `json:"markers"`
+}
+
+type RecordingOptions struct {
+	Layout        string `json:"layout,omitempty"`
+	LayoutID      string `json:"layout_id,omitempty"`
+	AudioCameraID string `json:"audio_camera_id,omitempty"`
+	// ProfileID overrides the default encoding profile of the first camera.
+	ProfileID string `json:"profile_id,omitempty"`
+	// Container overrides the configured file format.
+	Container string `json:"container,omitempty"`
+	// Proxy records a low-resolution proxy next to the master, nil uses the
+	// default.
+	Proxy *bool `json:"proxy,omitempty"`
+	// SegmentMinutes splits the recording into segments, 0 uses the default.
+	SegmentMinutes int `json:"segment_minutes,omitempty"`
+	// PreRollSeconds prepends up to this much of the pre-roll buffer of the
+	// camera.
+	PreRollSeconds int `json:"pre_roll_seconds,omitempty"`
+	// Title names the recording in the video service.
+	Title string `json:"title,omitempty"`
+	// Force records even if the cameras are booked or recorded by others.
+	Force bool `json:"force,omitempty"`
 }
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Schedule books a recording of the cameras from StartTime to StopTime. The
+// recording is created when the schedule fires.
+type Schedule struct {
+	ScheduleID  string           `json:"schedule_id" db:"schedule_id"`
+	UserID      int              `json:"user_id" db:"user_id"`
+	CameraIDs   []string         `json:"camera_ids" db:"-"`
+	StartTime   time.Time        `json:"start_time" db:"start_time"`
+	StopTime    time.Time        `json:"stop_time" db:"stop_time"`
+	Options     RecordingOptions `json:"options" db:"-"`
+	Status      string           `json:"status" db:"status"`
+	RecordingID string           `json:"recording_id,omitempty" db:"record_id"`
+	// Error is why the recording could not be started.
+	Error string `json:"error,omitempty" db:"error"`
+	// SeriesID and Occurrence link an occurrence of a recurring schedule to
+	// its series. Occurrence is the start given by the rule, which is kept
+	// when the occurrence is moved.
+	SeriesID   string     `json:"series_id,omitempty" db:"series_id"`
+	Occurrence *time.Time `json:"occurrence,omitempty" db:"occurrence"`
+	// UID is the UID of the iCalendar event the schedule was imported from.
+	UID       string    `json:"uid,omitempty" db:"uid"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ScheduleSeries books recordings that recur by an iCalendar RRULE. StartTime
+// and StopTime are those of the first occurrence. Occurrences are created as
+// schedules as they become due, or earlier when one of them is changed.
+type ScheduleSeries struct {
+	SeriesID  string    `json:"series_id" db:"series_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	CameraIDs []string  `json:"camera_ids" db:"-"`
+	StartTime time.Time `json:"start_time" db:"start_time"`
+	StopTime  time.Time `json:"stop_time" db:"stop_time"`
+	// TimeZone is the IANA zone the series recurs in, keeping its wall clock
+	// across daylight saving changes.
+	TimeZone string           `json:"timezone" db:"timezone"`
+	RRule    string           `json:"rrule" db:"rrule"`
+	ExDates  []time.Time      `json:"exdates,omitempty" db:"-"`
+	Options  RecordingOptions `json:"options" db:"-"`
+	Status   string           `json:"status" db:"status"`
+	// ExpandedUntil is how far occurrences have been created as schedules.
+	ExpandedUntil time.Time `json:"-" db:"expanded_until"`
+	UID           string    `json:"uid,omitempty" db:"uid"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// Conflict is a booking or a running recording that holds a camera at the
+// time another one asks for it.
+type Conflict struct {
+	CameraID    string    `json:"camera_id"`
+	ScheduleID  string    `json:"schedule_id,omitempty"`
+	SeriesID    string    `json:"series_id,omitempty"`
+	RecordingID string    `json:"recording_id,omitempty"`
+	UserID      int       `json:"user_id"`
+	StartTime   time.Time `json:"start_time"`
+	// StopTime is empty for recordings that are stopped by hand.
+	StopTime *time.Time `json:"stop_time,omitempty"`
+}
+
+// ImportResult lists what an iCalendar import created, or would create on a
+// dry run, and the events it left out.
+type ImportResult struct {
+	DryRun    bool             `json:"dry_run"`
+	Schedules []Schedule       `json:"schedules"`
+	Series    []ScheduleSeries `json:"series"`
+	Skipped   []ImportSkip     `json:"skipped"`
+}
+
+type ImportSkip struct {
+	UID     string `json:"uid"`
+	Summary string `json:"summary"`
+	Reason  string `json:"reason"`
+}
+
+// ScheduleFilter narrows a list of schedules. Zero fields match everything;
+// From and To keep the schedules that overlap them.
+type ScheduleFilter struct {
+	CameraID string
+	SeriesID string
+	UserID   int
+	From     time.Time
+	To       time.Time
+}
+
+// ScheduleUpdate changes a pending schedule. Nil and empty fields are kept.
+type ScheduleUpdate struct {
+	CameraIDs []string
+	StartTime *time.Time
+	Duration  string
+	// Force keeps the schedule even if it overlaps others.
+	Force bool
+}
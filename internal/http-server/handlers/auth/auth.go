@@ -26,6 +26,8 @@ type User interface {
 	RegisterNewUser(email, password, userType string) (string, error)
 	UpdatePassword(email, password string) error
 	DeleteUser(email string) error
+	IssueFeedToken(userID int) (string, error)
+	RevokeFeedToken(userID int) error
 }
 
 func New(
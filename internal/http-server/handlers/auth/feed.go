@@ -0,0 +1,72 @@
+package authhandler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+)
+
+// IssueFeedToken creates the calendar feed token of the user, the one issued
+// before stops working.
+func (h *AuthHandler) IssueFeedToken(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.IssueFeedToken"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	token, err := h.user.IssueFeedToken(user.Id)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to issue feed token", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, map[string]string{"token": token})
+}
+
+func (h *AuthHandler) RevokeFeedToken(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.RevokeFeedToken"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if err := h.user.RevokeFeedToken(user.Id); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to revoke feed token", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
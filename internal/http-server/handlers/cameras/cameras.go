@@ -24,11 +24,11 @@ type CameraHandler struct {
 }
 
 type CameraSaver interface {
-	SaveCamera(cameraIP, location string, hasAudio bool) (models.Camera, error)
+	SaveCamera(cameraIP, location string, hasAudio bool, profileID string, preRollSeconds int) (models.Camera, error)
 }
 type CameraProvider interface {
 	Cameras() ([]models.Camera, error)
-	UpdateCamera(cameraID, location string, hasAudio bool) (models.Camera, error)
+	UpdateCamera(cameraID, location string, hasAudio bool, profileID string, preRollSeconds int) (models.Camera, error)
 	DeleteCamera(string) error
 }
 
@@ -45,9 +45,12 @@ func New(
 }
 
 type RequestSave struct {
-	CameraIP string `json:"camera_ip" validate:"required"`
-	Location string `json:"location" validate:"required"`
-	HasAudio *bool  `json:"has_audio" validate:"required"`
+	CameraIP  string `json:"camera_ip" validate:"required"`
+	Location  string `json:"location" validate:"required"`
+	HasAudio  *bool  `json:"has_audio" validate:"required"`
+	ProfileID string `json:"profile_id,omitempty"`
+	// PreRollSeconds keeps the last seconds of the camera in a ring buffer.
+	PreRollSeconds int `json:"pre_roll_seconds,omitempty" validate:"min=0"`
 }
 
 func (h *CameraHandler) SaveCamera(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +94,7 @@ func (h *CameraHandler) SaveCamera(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cam, err := h.cameraSaver.SaveCamera(req.CameraIP, req.Location, *req.HasAudio)
+	cam, err := h.cameraSaver.SaveCamera(req.CameraIP, req.Location, *req.HasAudio, req.ProfileID, req.PreRollSeconds)
 	if err != nil {
 		if errors.Is(err, errs.ErrCameraAlreadyExists) {
 			render.Status(r, http.StatusBadRequest)
@@ -99,6 +102,12 @@ func (h *CameraHandler) SaveCamera(w http.ResponseWriter, r *http.Request) {
 
 			return
 		}
+		if errors.Is(err, errs.ErrProfileNotFound) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("profile not found", ""))
+
+			return
+		}
 
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, response.Error("failed to save new camera", middleware.GetReqID(r.Context())))
@@ -135,6 +144,10 @@ func (h *CameraHandler) Cameras(w http.ResponseWriter, r *http.Request) {
 type RequestUpdate struct {
 	Location string `json:"location" validate:"required"`
 	HasAudio *bool  `json:"has_audio" validate:"required"`
+	// ProfileID replaces the default profile, empty clears it.
+	ProfileID string `json:"profile_id,omitempty"`
+	// PreRollSeconds replaces the pre-roll retention, 0 turns the buffer off.
+	PreRollSeconds int `json:"pre_roll_seconds,omitempty" validate:"min=0"`
 }
 
 func (h *CameraHandler) UpdateCamera(w http.ResponseWriter, r *http.Request) {
@@ -188,7 +201,7 @@ func (h *CameraHandler) UpdateCamera(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cam, err := h.cameraProvider.UpdateCamera(cameraID, req.Location, *req.HasAudio)
+	cam, err := h.cameraProvider.UpdateCamera(cameraID, req.Location, *req.HasAudio, req.ProfileID, req.PreRollSeconds)
 	if err != nil {
 		if errors.Is(err, errs.ErrCameraNotFound) {
 			log.Error("camera not found", sl.Err(err))
@@ -198,6 +211,14 @@ func (h *CameraHandler) UpdateCamera(w http.ResponseWriter, r *http.Request) {
 
 			return
 		}
+		if errors.Is(err, errs.ErrProfileNotFound) {
+			log.Error("profile not found", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("profile not found", ""))
+
+			return
+		}
 
 		log.Error("failed to update camera", sl.Err(err))
 
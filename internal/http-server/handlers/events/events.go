@@ -0,0 +1,193 @@
+package eventshandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/net/websocket"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type EventHandler struct {
+	log        *slog.Logger
+	subscriber Subscriber
+	heartbeat  time.Duration
+}
+
+type Subscriber interface {
+	Subscribe(cameraID, recordingID string, userID int) (<-chan models.Event, func())
+}
+
+func New(log *slog.Logger, subscriber Subscriber, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{
+		log:        log,
+		subscriber: subscriber,
+		heartbeat:  heartbeat,
+	}
+}
+
+// Stream sends events as Server-Sent Events until the client disconnects.
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.events.Stream"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	cameraID, recordingID := filters(r)
+
+	userID, ok := subscriber(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	log.Info("client subscribed", slog.String("camera_id", cameraID), slog.String("record_id", recordingID))
+
+	// The server timeouts are meant for requests, not for a stream.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Warn("failed to clear read deadline", sl.Err(err))
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("failed to clear write deadline", sl.Err(err))
+	}
+
+	events, cancel := h.subscriber.Subscribe(cameraID, recordingID, userID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		log.Error("streaming is not supported", sl.Err(err))
+
+		return
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Error("failed to marshal event", sl.Err(err))
+
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// WebSocket sends the same events as Stream, one JSON message per event.
+func (h *EventHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.events.WebSocket"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	cameraID, recordingID := filters(r)
+
+	userID, ok := subscriber(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	srv := websocket.Server{
+		// Clients are authenticated by token, so any origin is accepted.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			log.Info("client subscribed", slog.String("camera_id", cameraID), slog.String("record_id", recordingID))
+
+			if err := ws.SetDeadline(time.Time{}); err != nil {
+				log.Warn("failed to clear deadline", sl.Err(err))
+			}
+
+			events, cancel := h.subscriber.Subscribe(cameraID, recordingID, userID)
+			defer cancel()
+
+			// Clients don't send anything, reading only notices a disconnect.
+			gone := make(chan struct{})
+			go func() {
+				io.Copy(io.Discard, ws)
+				close(gone)
+			}()
+
+			for {
+				select {
+				case <-gone:
+					return
+				case ev, ok := <-events:
+					if !ok {
+						return
+					}
+
+					if err := websocket.JSON.Send(ws, ev); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+
+	srv.ServeHTTP(w, r)
+}
+
+func filters(r *http.Request) (cameraID, recordingID string) {
+	return r.URL.Query().Get("camera_id"), r.URL.Query().Get("recording_id")
+}
+
+// subscriber is the user whose events are sent, 0 for admins, who see the
+// events of every user.
+func subscriber(r *http.Request) (int, bool) {
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		return 0, false
+	}
+
+	if user.UserType == constants.Admin {
+		return 0, true
+	}
+
+	return user.Id, true
+}
@@ -0,0 +1,290 @@
+package layoutshandler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type LayoutHandler struct {
+	log            *slog.Logger
+	layoutSaver    LayoutSaver
+	layoutProvider LayoutProvider
+}
+
+type LayoutSaver interface {
+	SaveLayout(l models.Layout) (models.Layout, error)
+	UpdateLayout(l models.Layout) (models.Layout, error)
+}
+
+type LayoutProvider interface {
+	Layouts() ([]models.Layout, error)
+	Layout(layoutID string) (models.Layout, error)
+	DeleteLayout(layoutID string) error
+}
+
+func New(
+	log *slog.Logger,
+	layoutSaver LayoutSaver,
+	layoutProvider LayoutProvider,
+) *LayoutHandler {
+	return &LayoutHandler{
+		log:            log,
+		layoutSaver:    layoutSaver,
+		layoutProvider: layoutProvider,
+	}
+}
+
+type RequestSlot struct {
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Width       int    `json:"width" validate:"required,gt=0"`
+	Height      int    `json:"height" validate:"required,gt=0"`
+	ZOrder      int    `json:"z_order" validate:"min=0"`
+	Border      int    `json:"border" validate:"min=0"`
+	BorderColor string `json:"border_color"`
+}
+
+type RequestLayout struct {
+	Name       string        `json:"name" validate:"required"`
+	Width      int           `json:"width" validate:"required,gt=0"`
+	Height     int           `json:"height" validate:"required,gt=0"`
+	Background string        `json:"background"`
+	Slots      []RequestSlot `json:"slots" validate:"required,min=1,dive"`
+}
+
+func (req RequestLayout) layout(layoutID string) models.Layout {
+	l := models.Layout{
+		LayoutID:   layoutID,
+		Name:       req.Name,
+		Width:      req.Width,
+		Height:     req.Height,
+		Background: req.Background,
+	}
+
+	for _, slot := range req.Slots {
+		l.Slots = append(l.Slots, models.LayoutSlot(slot))
+	}
+
+	return l
+}
+
+func (h *LayoutHandler) SaveLayout(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.layouts.SaveLayout"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	req, ok := decodeLayout(w, r, log)
+	if !ok {
+		return
+	}
+
+	l, err := h.layoutSaver.SaveLayout(req.layout(""))
+	if err != nil {
+		if renderLayoutError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to save new layout", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, l)
+}
+
+func (h *LayoutHandler) Layouts(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.layouts.Layouts"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	log.Info("get layouts")
+
+	layouts, err := h.layoutProvider.Layouts()
+	if err != nil {
+		log.Error("failed to get layouts", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get layouts", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, layouts)
+}
+
+func (h *LayoutHandler) Layout(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.layouts.Layout"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	layoutID := chi.URLParam(r, "layoutID")
+
+	log.Info("get layout", slog.String("layout_id", layoutID))
+
+	l, err := h.layoutProvider.Layout(layoutID)
+	if err != nil {
+		if renderLayoutError(w, r, err) {
+			return
+		}
+
+		log.Error("failed to get layout", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get layout", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, l)
+}
+
+func (h *LayoutHandler) UpdateLayout(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.layouts.UpdateLayout"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	layoutID := chi.URLParam(r, "layoutID")
+	if layoutID == "" {
+		log.Error("layout_id is empty")
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("layout_id is empty", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	req, ok := decodeLayout(w, r, log)
+	if !ok {
+		return
+	}
+
+	l, err := h.layoutSaver.UpdateLayout(req.layout(layoutID))
+	if err != nil {
+		if renderLayoutError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to update layout", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, l)
+}
+
+func (h *LayoutHandler) DeleteLayout(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.layouts.DeleteLayout"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	layoutID := chi.URLParam(r, "layoutID")
+	if layoutID == "" {
+		log.Error("layout_id is empty")
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("layout_id is empty", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("delete layout", slog.String("layout_id", layoutID))
+
+	if err := h.layoutProvider.DeleteLayout(layoutID); err != nil {
+		if renderLayoutError(w, r, err) {
+			return
+		}
+
+		log.Error("failed to delete layout", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to delete layout", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func decodeLayout(w http.ResponseWriter, r *http.Request, log *slog.Logger) (RequestLayout, bool) {
+	var req RequestLayout
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return req, false
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return req, false
+	}
+
+	log.Info("request body decoded", slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return req, false
+	}
+
+	return req, true
+}
+
+func renderLayoutError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, errs.ErrLayoutNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("layout not found", ""))
+	case errors.Is(err, errs.ErrLayoutExists):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("layout already exists", ""))
+	case errors.Is(err, errs.ErrInvalidLayout):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("invalid layout", middleware.GetReqID(r.Context())))
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,285 @@
+package profileshandler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type ProfileHandler struct {
+	log             *slog.Logger
+	profileSaver    ProfileSaver
+	profileProvider ProfileProvider
+}
+
+type ProfileSaver interface {
+	SaveProfile(p models.Profile) (models.Profile, error)
+	UpdateProfile(p models.Profile) (models.Profile, error)
+}
+
+type ProfileProvider interface {
+	Profiles() ([]models.Profile, error)
+	Profile(profileID string) (models.Profile, error)
+	DeleteProfile(profileID string) error
+}
+
+func New(
+	log *slog.Logger,
+	profileSaver ProfileSaver,
+	profileProvider ProfileProvider,
+) *ProfileHandler {
+	return &ProfileHandler{
+		log:             log,
+		profileSaver:    profileSaver,
+		profileProvider: profileProvider,
+	}
+}
+
+type RequestProfile struct {
+	Name             string `json:"name" validate:"required"`
+	VideoCodec       string `json:"video_codec" validate:"required"`
+	VideoBitrate     int    `json:"video_bitrate" validate:"min=0"`
+	Preset           string `json:"preset"`
+	KeyframeInterval int    `json:"keyframe_interval" validate:"min=0"`
+	Width            int    `json:"width" validate:"min=0"`
+	Height           int    `json:"height" validate:"min=0"`
+	Framerate        int    `json:"framerate" validate:"min=0"`
+	AudioCodec       string `json:"audio_codec" validate:"required"`
+	AudioBitrate     int    `json:"audio_bitrate" validate:"min=0"`
+}
+
+func (req RequestProfile) profile(profileID string) models.Profile {
+	return models.Profile{
+		ProfileID:        profileID,
+		Name:             req.Name,
+		VideoCodec:       req.VideoCodec,
+		VideoBitrate:     req.VideoBitrate,
+		Preset:           req.Preset,
+		KeyframeInterval: req.KeyframeInterval,
+		Width:            req.Width,
+		Height:           req.Height,
+		Framerate:        req.Framerate,
+		AudioCodec:       req.AudioCodec,
+		AudioBitrate:     req.AudioBitrate,
+	}
+}
+
+func (h *ProfileHandler) SaveProfile(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.profiles.SaveProfile"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	req, ok := decodeProfile(w, r, log)
+	if !ok {
+		return
+	}
+
+	p, err := h.profileSaver.SaveProfile(req.profile(""))
+	if err != nil {
+		if renderProfileError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to save new profile", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, p)
+}
+
+func (h *ProfileHandler) Profiles(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.profiles.Profiles"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	log.Info("get profiles")
+
+	profiles, err := h.profileProvider.Profiles()
+	if err != nil {
+		log.Error("failed to get profiles", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get profiles", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, profiles)
+}
+
+func (h *ProfileHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.profiles.Profile"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	profileID := chi.URLParam(r, "profileID")
+
+	log.Info("get profile", slog.String("profile_id", profileID))
+
+	p, err := h.profileProvider.Profile(profileID)
+	if err != nil {
+		if renderProfileError(w, r, err) {
+			return
+		}
+
+		log.Error("failed to get profile", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get profile", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, p)
+}
+
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.profiles.UpdateProfile"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	profileID := chi.URLParam(r, "profileID")
+	if profileID == "" {
+		log.Error("profile_id is empty")
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("profile_id is empty", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	req, ok := decodeProfile(w, r, log)
+	if !ok {
+		return
+	}
+
+	p, err := h.profileSaver.UpdateProfile(req.profile(profileID))
+	if err != nil {
+		if renderProfileError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to update profile", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, p)
+}
+
+func (h *ProfileHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.profiles.DeleteProfile"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	profileID := chi.URLParam(r, "profileID")
+	if profileID == "" {
+		log.Error("profile_id is empty")
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("profile_id is empty", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("delete profile", slog.String("profile_id", profileID))
+
+	if err := h.profileProvider.DeleteProfile(profileID); err != nil {
+		if renderProfileError(w, r, err) {
+			return
+		}
+
+		log.Error("failed to delete profile", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to delete profile", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func decodeProfile(w http.ResponseWriter, r *http.Request, log *slog.Logger) (RequestProfile, bool) {
+	var req RequestProfile
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return req, false
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return req, false
+	}
+
+	log.Info("request body decoded", slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return req, false
+	}
+
+	return req, true
+}
+
+func renderProfileError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, errs.ErrProfileNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("profile not found", ""))
+	case errors.Is(err, errs.ErrProfileExists):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("profile already exists", ""))
+	case errors.Is(err, errs.ErrInvalidProfile):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("invalid profile", middleware.GetReqID(r.Context())))
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package recordinghandler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/ical"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// maxCalendarSize limits the calendar files that can be imported.
+const maxCalendarSize = 10 << 20
+
+// Import books the events of the iCalendar file in the request body. With
+// dry_run=true nothing is saved and the response previews the bookings.
+func (h *RecordHandler) Import(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Import"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Error("invalid dry_run", slog.String("dry_run", v))
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("invalid dry_run", middleware.GetReqID(r.Context())))
+
+			return
+		}
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	log.Info("import calendar", slog.Bool("dry_run", dryRun))
+
+	result, err := h.scheduler.Import(http.MaxBytesReader(w, r.Body, maxCalendarSize), user.Id, dryRun)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			render.Status(r, http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, response.Error("calendar file is too large", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to import calendar", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, result)
+}
+
+// Feed serves the schedules as an iCalendar feed calendar apps can
+// subscribe to, optionally only those of one room.
+func (h *RecordHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Feed"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	room := r.URL.Query().Get("room")
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	cal, err := h.scheduler.Feed(scheduleOwner(user), room)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get schedules", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+
+	if err := ical.Encode(w, cal); err != nil {
+		log.Error("failed to write calendar", sl.Err(err))
+	}
+}
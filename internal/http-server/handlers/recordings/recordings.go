@@ -1,18 +1,22 @@
 package recordinghandler
 
 import (
+	"archive/zip"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
 	"github.com/zanzhit/studio_recorder/internal/domain/errs"
 	"github.com/zanzhit/studio_recorder/internal/domain/models"
 	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
@@ -24,37 +28,69 @@ type RecordHandler struct {
 	log               *slog.Logger
 	recordingProvider RecordingProvider
 	recorder          Recorder
+	scheduler         Scheduler
 }
 
 type RecordingProvider interface {
 	CameraRecordings(camera string, limit, offset, userID int) ([]models.Recording, error)
 	Delete(recordID string) error
 	Move(recordID string) error
-	File(recordID string) (string, error)
+	Rendition(recordID, name string) (models.Rendition, error)
+	Files(recordID, rendition string) ([]string, error)
+	Segment(recordID, rendition string, index int) (string, error)
+	Segments(recordID string) ([]models.Segment, error)
+	Details(recordID string) (models.RecordingDetails, error)
+	Log(recordID string) ([]string, error)
+	Chapters(recordID string) (string, error)
+	Events(recordID, level string) ([]models.PipelineEvent, error)
+	Status(recordID string) (models.RecordingStatus, error)
+	Active() []models.RecordingStatus
+	Session(sessionID string) (models.Session, error)
+	MoveSession(sessionID string) error
 }
 
 type Recorder interface {
-	Start(cameraID []string, userID int) (string, error)
+	Start(cameraID []string, userID int, opts models.RecordingOptions) (string, error)
 	Stop(recordId string) error
-	Schedule(startTime time.Time, cameraID []string, duration string, userID int) error
+	Pause(recordID string) error
+	Resume(recordID string) error
+	AddMarker(recordID, label string, offset *float64) (models.Marker, error)
+	StartSession(cameraIDs []string, userID int, opts models.RecordingOptions) (models.Session, error)
+	StopSession(sessionID string) error
 }
 
-func New(log *slog.Logger, recordingProvider RecordingProvider, recorder Recorder) *RecordHandler {
+func New(log *slog.Logger, recordingProvider RecordingProvider, recorder Recorder, scheduler Scheduler) *RecordHandler {
 	return &RecordHandler{
 		log:               log,
 		recordingProvider: recordingProvider,
 		recorder:          recorder,
+		scheduler:         scheduler,
 	}
 }
 
 type RequestStart struct {
-	CameraIDs []string `json:"camera_ids" validate:"required"`
+	CameraIDs     []string `json:"camera_ids" validate:"required"`
+	Layout        string   `json:"layout,omitempty"`
+	LayoutID      string   `json:"layout_id,omitempty"`
+	AudioCameraID string   `json:"audio_camera_id,omitempty"`
+	ProfileID     string   `json:"profile_id,omitempty"`
+	Container     string   `json:"container,omitempty" validate:"omitempty,oneof=mkv mp4 ts"`
+	// Proxy records a low-resolution proxy next to the master.
+	Proxy *bool `json:"proxy,omitempty"`
+	// SegmentMinutes enables segmented recording.
+	SegmentMinutes int `json:"segment_minutes,omitempty" validate:"min=0"`
+	// PreRollSeconds prepends the last seconds buffered for the camera.
+	PreRollSeconds int `json:"pre_roll_seconds,omitempty" validate:"min=0"`
+	// Force records even if the cameras are recorded by others. Only admins
+	// can force.
+	Force bool `json:"force,omitempty"`
 }
 
-type RequestSchedule struct {
-	CameraID  []string  `json:"camera_id" validate:"required"`
-	Duration  string    `json:"duration" validate:"required"`
-	StartTime time.Time `json:"start_time" validate:"required"`
+type RequestMarker struct {
+	Label string `json:"label" validate:"required,max=255"`
+	// Offset is in seconds from the recording start, the current position
+	// when omitted.
+	Offset *float64 `json:"offset,omitempty" validate:"omitempty,min=0"`
 }
 
 type Response struct {
@@ -62,6 +98,11 @@ type Response struct {
 	response.Response
 }
 
+type ConflictResponse struct {
+	response.Response
+	Conflicts []models.Conflict `json:"conflicts"`
+}
+
 func (h *RecordHandler) Recordings(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.records.Record"
 
@@ -149,6 +190,9 @@ func (h *RecordHandler) Move(w http.ResponseWriter, r *http.Request) {
 	log.Info("record_id", slog.String("record_id", recordID))
 
 	if err := h.recordingProvider.Move(recordID); err != nil {
+		if renderStatusError(w, r, err) {
+			return
+		}
 		if errors.Is(err, errs.ErrRecordNotFound) {
 			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
@@ -156,6 +200,13 @@ func (h *RecordHandler) Move(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, errs.ErrPiecesNotJoinable) {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, response.Error("recording has several pieces that can't be uploaded as one file", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
 		if errors.Is(err, errs.ErrWriteToDB) {
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.Error("recording moved, but failed to write move data", middleware.GetReqID(r.Context())))
@@ -223,11 +274,30 @@ func (h *RecordHandler) Start(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	recordID, err := h.recorder.Start(req.CameraIDs, user.Id)
+	if forbidForce(w, r, user, req.Force) {
+		return
+	}
+
+	opts := models.RecordingOptions{
+		Layout:         req.Layout,
+		LayoutID:       req.LayoutID,
+		AudioCameraID:  req.AudioCameraID,
+		ProfileID:      req.ProfileID,
+		Container:      req.Container,
+		Proxy:          req.Proxy,
+		SegmentMinutes: req.SegmentMinutes,
+		PreRollSeconds: req.PreRollSeconds,
+		Force:          req.Force,
+	}
+
+	recordID, err := h.recorder.Start(req.CameraIDs, user.Id, opts)
 	if err != nil {
+		if renderOptionsError(w, r, err) || renderConflictError(w, r, err) {
+			return
+		}
 		if errors.Is(err, errs.ErrWriteToDB) {
 			render.Status(r, http.StatusInternalServerError)
-			render.JSON(w, r, Response{RecordID: recordID, Response: response.Error("failed to write start data", middleware.GetReqID(r.Context()))})
+			render.JSON(w, r, response.Error("failed to write start data", middleware.GetReqID(r.Context())))
 
 			return
 		}
@@ -268,6 +338,9 @@ func (h *RecordHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	log.Info("record_id", slog.String("record_id", recordID))
 
 	if err := h.recorder.Stop(recordID); err != nil {
+		if renderStatusError(w, r, err) {
+			return
+		}
 		if errors.Is(err, errs.ErrRecordNotFound) {
 			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
@@ -291,17 +364,64 @@ func (h *RecordHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *RecordHandler) Schedule(w http.ResponseWriter, r *http.Request) {
-	const op = "handlers.cameras.Schedule"
+func (h *RecordHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Pause"
+
+	h.pauseOrResume(w, r, op, h.recorder.Pause, "failed to pause recording")
+}
+
+func (h *RecordHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Resume"
+
+	h.pauseOrResume(w, r, op, h.recorder.Resume, "failed to resume recording")
+}
+
+func (h *RecordHandler) pauseOrResume(w http.ResponseWriter, r *http.Request, op string, action func(recordID string) error, failed string) {
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("record_id", slog.String("record_id", recordID))
+
+	if err := action(recordID); err != nil {
+		if renderStatusError(w, r, err) {
+			return
+		}
+
+		if errors.Is(err, errs.ErrRecordNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error(failed, middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *RecordHandler) AddMarker(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.AddMarker"
 
 	log := h.log.With(
 		slog.String("op", op),
 		slog.String("request_id", middleware.GetReqID(r.Context())),
 	)
 
-	var rec RequestSchedule
+	recordID := chi.URLParam(r, "recordID")
 
-	err := render.DecodeJSON(r.Body, &rec)
+	log.Info("record_id", slog.String("record_id", recordID))
+
+	var req RequestMarker
+
+	err := render.DecodeJSON(r.Body, &req)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			log.Error("request body is empty")
@@ -314,15 +434,13 @@ func (h *RecordHandler) Schedule(w http.ResponseWriter, r *http.Request) {
 
 		log.Error("failed to decode request body", sl.Err(err))
 
-		render.Status(r, http.StatusInternalServerError)
+		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
 
 		return
 	}
 
-	log.Info("request body decoded", slog.Any("request", rec))
-
-	if err := validator.New().Struct(rec); err != nil {
+	if err := validator.New().Struct(req); err != nil {
 		validateErr := err.(validator.ValidationErrors)
 
 		log.Error("invalid request", sl.Err(err))
@@ -333,24 +451,29 @@ func (h *RecordHandler) Schedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
-	if !ok {
-		log.Error("user not found in context")
-
-		render.Status(r, http.StatusUnauthorized)
-		render.JSON(w, r, response.Error("user not found", ""))
-
-		return
-	}
+	marker, err := h.recorder.AddMarker(recordID, req.Label, req.Offset)
+	if err != nil {
+		if renderStatusError(w, r, err) {
+			return
+		}
 
-	if err := h.recorder.Schedule(rec.StartTime, rec.CameraID, rec.Duration, user.Id); err != nil {
-		render.Status(r, http.StatusInternalServerError)
-		render.JSON(w, r, response.Error("failed to schedule recording", middleware.GetReqID(r.Context())))
+		switch {
+		case errors.Is(err, errs.ErrRecordNotFound):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+		case errors.Is(err, errs.ErrInvalidMarker):
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("offset is past the current position", middleware.GetReqID(r.Context())))
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.Error("failed to add marker", middleware.GetReqID(r.Context())))
+		}
 
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, marker)
 }
 
 func (h *RecordHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -374,6 +497,9 @@ func (h *RecordHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	log.Info("record_id", slog.String("record_id", recordID))
 
 	if err := h.recordingProvider.Delete(recordID); err != nil {
+		if renderStatusError(w, r, err) {
+			return
+		}
 		if errors.Is(err, errs.ErrRecordNotFound) {
 			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
@@ -410,7 +536,118 @@ func (h *RecordHandler) Download(w http.ResponseWriter, r *http.Request) {
 
 	log.Info("record_id", slog.String("record_id", recordID))
 
-	filePath, err := h.recordingProvider.File(recordID)
+	name := r.URL.Query().Get("rendition")
+	if name != "" && name != constants.RenditionMaster && name != constants.RenditionProxy {
+		log.Error("invalid rendition", slog.String("rendition", name))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("invalid rendition", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	rendition, err := h.recordingProvider.Rendition(recordID, name)
+	if renderFileError(w, r, err) {
+		return
+	}
+
+	var files []string
+	if segment := r.URL.Query().Get("segment"); segment != "" {
+		index, err := strconv.Atoi(segment)
+		if err != nil {
+			log.Error("invalid segment", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("invalid segment", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		filePath, err := h.recordingProvider.Segment(recordID, name, index)
+		if renderFileError(w, r, err) {
+			return
+		}
+
+		files = []string{filePath}
+	} else {
+		var err error
+		files, err = h.recordingProvider.Files(recordID, name)
+		if renderFileError(w, r, err) {
+			return
+		}
+	}
+
+	if len(files) == 1 {
+		w.Header().Set("Content-Type", rendition.MimeType)
+		http.ServeFile(w, r, files[0])
+
+		return
+	}
+
+	filename := recordID
+	if rendition.Name != constants.RenditionMaster {
+		filename += "_" + rendition.Name
+	}
+
+	if rendition.Container != constants.ContainerMPEGTS {
+		h.sendZip(w, log, filename, files)
+
+		return
+	}
+
+	// MPEG-TS plays back correctly when concatenated.
+	w.Header().Set("Content-Type", rendition.MimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, rendition.Container))
+
+	for _, path := range files {
+		if err := copyFile(w, path); err != nil {
+			log.Error("failed to send segment", slog.String("path", path), sl.Err(err))
+
+			return
+		}
+	}
+}
+
+// sendZip sends the pieces of a recording that was restarted after a dropout.
+// Unlike MPEG-TS they can't be joined by concatenation.
+func (h *RecordHandler) sendZip(w http.ResponseWriter, log *slog.Logger, filename string, files []string) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+	zw := zip.NewWriter(w)
+	for _, path := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.Base(path), Method: zip.Store})
+		if err != nil {
+			log.Error("failed to add piece to archive", slog.String("path", path), sl.Err(err))
+
+			return
+		}
+
+		if err := copyFile(f, path); err != nil {
+			log.Error("failed to send piece", slog.String("path", path), sl.Err(err))
+
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Error("failed to finish archive", sl.Err(err))
+	}
+}
+
+func (h *RecordHandler) Details(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Details"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("get recording details", slog.String("record_id", recordID))
+
+	details, err := h.recordingProvider.Details(recordID)
 	if err != nil {
 		if errors.Is(err, errs.ErrRecordNotFound) {
 			render.Status(r, http.StatusNotFound)
@@ -418,24 +655,324 @@ func (h *RecordHandler) Download(w http.ResponseWriter, r *http.Request) {
 
 			return
 		}
-		if errors.Is(err, errs.ErrFileNotFound) {
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get recording", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, details)
+}
+
+// Log sends the pipeline output of a recording, rotated files included.
+func (h *RecordHandler) Log(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Log"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("get pipeline log", slog.String("record_id", recordID))
+
+	files, err := h.recordingProvider.Log(recordID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordNotFound):
 			render.Status(r, http.StatusNotFound)
-			render.JSON(w, r, response.Error("recording file not found", middleware.GetReqID(r.Context())))
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+		case errors.Is(err, errs.ErrLogNotFound):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("log not found", middleware.GetReqID(r.Context())))
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.Error("failed to get log", middleware.GetReqID(r.Context())))
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, path := range files {
+		if err := copyFile(w, path); err != nil {
+			log.Error("failed to send log", slog.String("path", path), sl.Err(err))
 
 			return
 		}
-		if errors.Is(err, errs.ErrFileAlreadyMoved) {
+	}
+}
+
+func (h *RecordHandler) Chapters(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Chapters"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("get chapters", slog.String("record_id", recordID))
+
+	path, err := h.recordingProvider.Chapters(recordID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordNotFound):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+		case errors.Is(err, errs.ErrChaptersNotFound):
 			render.Status(r, http.StatusNotFound)
-			render.JSON(w, r, response.Error("recording file already moved", middleware.GetReqID(r.Context())))
+			render.JSON(w, r, response.Error("chapters not found", middleware.GetReqID(r.Context())))
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.Error("failed to get chapters", middleware.GetReqID(r.Context())))
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+
+	if err := copyFile(w, path); err != nil {
+		log.Error("failed to send chapters", slog.String("path", path), sl.Err(err))
+	}
+}
+
+func (h *RecordHandler) Events(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Events"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	level := r.URL.Query().Get("level")
+	if level != "" && level != constants.LevelError && level != constants.LevelWarning {
+		log.Error("invalid level", slog.String("level", level))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("level must be error or warning", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("get pipeline events", slog.String("record_id", recordID))
+
+	events, err := h.recordingProvider.Events(recordID, level)
+	if err != nil {
+		if errors.Is(err, errs.ErrRecordNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
 
 			return
 		}
 
 		render.Status(r, http.StatusInternalServerError)
-		render.JSON(w, r, response.Error("failed to get recording", middleware.GetReqID(r.Context())))
+		render.JSON(w, r, response.Error("failed to get events", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, events)
+}
+
+func (h *RecordHandler) Status(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Status"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("get recording status", slog.String("record_id", recordID))
+
+	status, err := h.recordingProvider.Status(recordID)
+	if err != nil {
+		if errors.Is(err, errs.ErrRecordNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get recording status", middleware.GetReqID(r.Context())))
 
 		return
 	}
 
-	http.ServeFile(w, r, filePath)
+	render.JSON(w, r, status)
+}
+
+func (h *RecordHandler) Active(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Active"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	log.Info("get active recordings")
+
+	render.JSON(w, r, h.recordingProvider.Active())
+}
+
+func (h *RecordHandler) Segments(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Segments"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	recordID := chi.URLParam(r, "recordID")
+
+	log.Info("get segments", slog.String("record_id", recordID))
+
+	segs, err := h.recordingProvider.Segments(recordID)
+	if err != nil {
+		if errors.Is(err, errs.ErrRecordNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get segments", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, segs)
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+
+	return err
+}
+
+func renderFileError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch {
+	case errors.Is(err, errs.ErrRecordNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("recording not found", middleware.GetReqID(r.Context())))
+	case errors.Is(err, errs.ErrSegmentNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("segment not found", middleware.GetReqID(r.Context())))
+	case errors.Is(err, errs.ErrRenditionNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("rendition not found", middleware.GetReqID(r.Context())))
+	case errors.Is(err, errs.ErrFileNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("recording file not found", middleware.GetReqID(r.Context())))
+	case errors.Is(err, errs.ErrFileAlreadyMoved):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("recording file already moved", middleware.GetReqID(r.Context())))
+	default:
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get recording", middleware.GetReqID(r.Context())))
+	}
+
+	return true
+}
+
+func renderStatusError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var msg string
+
+	switch {
+	case errors.Is(err, errs.ErrRecordingInProgress):
+		msg = "recording is in progress"
+	case errors.Is(err, errs.ErrRecordingNotActive):
+		msg = "recording is not running"
+	case errors.Is(err, errs.ErrRecordingDeleted):
+		msg = "recording is deleted"
+	case errors.Is(err, errs.ErrRecordingNotPaused):
+		msg = "recording is not paused"
+	case errors.Is(err, errs.ErrRecordingNotPausable):
+		msg = "recording can not be paused"
+	case errors.Is(err, errs.ErrInvalidStatusTransition):
+		msg = "action is not allowed in current recording status"
+	default:
+		return false
+	}
+
+	render.Status(r, http.StatusConflict)
+	render.JSON(w, r, response.Error(msg, middleware.GetReqID(r.Context())))
+
+	return true
+}
+
+// renderConflictError answers 409 with the bookings and recordings that hold
+// the cameras.
+func renderConflictError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+
+	render.Status(r, http.StatusConflict)
+	render.JSON(w, r, ConflictResponse{
+		Response:  response.Error("camera is booked or recorded at this time", middleware.GetReqID(r.Context())),
+		Conflicts: conflict.Conflicts,
+	})
+
+	return true
+}
+
+func renderOptionsError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var msg string
+
+	switch {
+	case errors.Is(err, errs.ErrLayoutNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("layout not found", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrProfileNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("profile not found", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrInvalidProfile):
+		msg = "profile can not be used for this recording"
+	case errors.Is(err, errs.ErrUnknownContainer):
+		msg = "unknown container"
+	case errors.Is(err, errs.ErrInvalidLayout):
+		msg = "layout does not fit the cameras"
+	case errors.Is(err, errs.ErrUnknownLayout):
+		msg = "unknown layout"
+	case errors.Is(err, errs.ErrNotInRecording):
+		msg = "audio camera is not part of the recording"
+	case errors.Is(err, errs.ErrCameraHasNoAudio):
+		msg = "audio camera has no audio"
+	case errors.Is(err, errs.ErrPreRollNotAllowed):
+		msg = "pre-roll needs a single camera recorded as is in MPEG-TS"
+	default:
+		return false
+	}
+
+	render.Status(r, http.StatusBadRequest)
+	render.JSON(w, r, response.Error(msg, middleware.GetReqID(r.Context())))
+
+	return true
 }
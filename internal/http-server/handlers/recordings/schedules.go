@@ -0,0 +1,448 @@
+package recordinghandler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/ical"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type Scheduler interface {
+	SaveSchedule(startTime time.Time, cameraIDs []string, duration string, userID int, opts models.RecordingOptions) (models.Schedule, error)
+	Schedules(filter models.ScheduleFilter) ([]models.Schedule, error)
+	Schedule(scheduleID string, userID int) (models.Schedule, error)
+	UpdateSchedule(scheduleID string, userID int, update models.ScheduleUpdate) (models.Schedule, error)
+	CancelSchedule(scheduleID string, userID int) error
+	SaveSeries(startTime time.Time, timezone string, cameraIDs []string, duration, rule string, exdates []time.Time, userID int, opts models.RecordingOptions) (models.ScheduleSeries, error)
+	Series(seriesID string, userID int) (models.ScheduleSeries, error)
+	CancelSeries(seriesID string, userID int) error
+	Occurrence(seriesID string, start time.Time, userID int) (models.Schedule, error)
+	Import(r io.Reader, userID int, dryRun bool) (models.ImportResult, error)
+	Feed(userID int, room string) (ical.Calendar, error)
+}
+
+type RequestSchedule struct {
+	CameraID      []string  `json:"camera_id" validate:"required"`
+	Duration      string    `json:"duration" validate:"required"`
+	StartTime     time.Time `json:"start_time" validate:"required"`
+	Layout        string    `json:"layout,omitempty"`
+	LayoutID      string    `json:"layout_id,omitempty"`
+	AudioCameraID string    `json:"audio_camera_id,omitempty"`
+	ProfileID     string    `json:"profile_id,omitempty"`
+	Container     string    `json:"container,omitempty" validate:"omitempty,oneof=mkv mp4 ts"`
+	// Proxy records a low-resolution proxy next to the master.
+	Proxy *bool `json:"proxy,omitempty"`
+	// SegmentMinutes enables segmented recording.
+	SegmentMinutes int `json:"segment_minutes,omitempty" validate:"min=0"`
+	// Title names the recording in the video service.
+	Title string `json:"title,omitempty"`
+	// Force books the cameras even if they are booked by others. Only
+	// admins can force.
+	Force bool `json:"force,omitempty"`
+}
+
+func (req RequestSchedule) options() models.RecordingOptions {
+	return models.RecordingOptions{
+		Layout:         req.Layout,
+		LayoutID:       req.LayoutID,
+		AudioCameraID:  req.AudioCameraID,
+		ProfileID:      req.ProfileID,
+		Container:      req.Container,
+		Proxy:          req.Proxy,
+		SegmentMinutes: req.SegmentMinutes,
+		Title:          req.Title,
+		Force:          req.Force,
+	}
+}
+
+// RequestUpdateSchedule changes the given fields of a pending schedule. The
+// duration is kept when only the start time moves.
+type RequestUpdateSchedule struct {
+	CameraIDs []string   `json:"camera_ids,omitempty" validate:"omitempty,min=1"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	Duration  string     `json:"duration,omitempty"`
+	Force     bool       `json:"force,omitempty"`
+}
+
+func (h *RecordHandler) SaveSchedule(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.SaveSchedule"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	var rec RequestSchedule
+
+	err := render.DecodeJSON(r.Body, &rec)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("request body decoded", slog.Any("request", rec))
+
+	if err := validator.New().Struct(rec); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if forbidForce(w, r, user, rec.Force) {
+		return
+	}
+
+	sch, err := h.scheduler.SaveSchedule(rec.StartTime, rec.CameraID, rec.Duration, user.Id, rec.options())
+	if err != nil {
+		if renderOptionsError(w, r, err) || renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to schedule recording", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, sch)
+}
+
+func (h *RecordHandler) Schedules(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Schedules"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := models.ScheduleFilter{
+		CameraID: query.Get("camera_id"),
+		UserID:   scheduleOwner(user),
+	}
+
+	if userIDStr := query.Get("user_id"); userIDStr != "" && filter.UserID == 0 {
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			log.Error("invalid user_id", slog.String("user_id", userIDStr))
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("invalid user_id", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		filter.UserID = userID
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			log.Error("invalid time", slog.String(param, value))
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error(fmt.Sprintf("invalid %s, want RFC 3339", param), middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		*t = parsed
+	}
+
+	log.Info("list schedules", slog.Any("filter", filter))
+
+	schedules, err := h.scheduler.Schedules(filter)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get schedules", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, schedules)
+}
+
+func (h *RecordHandler) Schedule(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Schedule"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	scheduleID := chi.URLParam(r, "scheduleID")
+
+	log.Info("get schedule", slog.String("schedule_id", scheduleID))
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	sch, err := h.scheduler.Schedule(scheduleID, scheduleOwner(user))
+	if err != nil {
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get schedule", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, sch)
+}
+
+func (h *RecordHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.UpdateSchedule"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	scheduleID := chi.URLParam(r, "scheduleID")
+
+	var req RequestUpdateSchedule
+
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("request body decoded", slog.String("schedule_id", scheduleID), slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if forbidForce(w, r, user, req.Force) {
+		return
+	}
+
+	update := models.ScheduleUpdate{
+		CameraIDs: req.CameraIDs,
+		StartTime: req.StartTime,
+		Duration:  req.Duration,
+		Force:     req.Force,
+	}
+
+	sch, err := h.scheduler.UpdateSchedule(scheduleID, scheduleOwner(user), update)
+	if err != nil {
+		if renderOptionsError(w, r, err) || renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to update schedule", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, sch)
+}
+
+func (h *RecordHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.DeleteSchedule"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	scheduleID := chi.URLParam(r, "scheduleID")
+
+	log.Info("cancel schedule", slog.String("schedule_id", scheduleID))
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if err := h.scheduler.CancelSchedule(scheduleID, scheduleOwner(user)); err != nil {
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to cancel schedule", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// scheduleOwner limits users to their own schedules. Admins manage all of
+// them.
+func scheduleOwner(user models.User) int {
+	if user.UserType == constants.Admin {
+		return 0
+	}
+
+	return user.Id
+}
+
+// forbidForce rejects the force flag of users that are not admins.
+func forbidForce(w http.ResponseWriter, r *http.Request, user models.User, force bool) bool {
+	if !force || user.UserType == constants.Admin {
+		return false
+	}
+
+	render.Status(r, http.StatusForbidden)
+	render.JSON(w, r, response.Error("only admins can force a booking", middleware.GetReqID(r.Context())))
+
+	return true
+}
+
+func renderScheduleError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if renderConflictError(w, r, err) {
+		return true
+	}
+
+	var msg string
+
+	switch {
+	case errors.Is(err, errs.ErrScheduleNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("schedule not found", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrSeriesNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, response.Error("series not found", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrScheduleNotPending):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, response.Error("schedule has already started or ended", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrSeriesNotActive):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, response.Error("series is over or canceled", middleware.GetReqID(r.Context())))
+
+		return true
+	case errors.Is(err, errs.ErrInvalidCalendar):
+		msg = "invalid calendar file"
+	case errors.Is(err, errs.ErrInvalidRRule):
+		msg = "invalid or unsupported rrule"
+	case errors.Is(err, errs.ErrNotAnOccurrence):
+		msg = "time is not an occurrence of the series"
+	case errors.Is(err, errs.ErrInvalidStartTime):
+		msg = "start time is in the past"
+	case errors.Is(err, errs.ErrInvalidDuration):
+		msg = "invalid duration"
+	case errors.Is(err, errs.ErrInvalidTimeZone):
+		msg = "unknown time zone"
+	default:
+		return false
+	}
+
+	render.Status(r, http.StatusBadRequest)
+	render.JSON(w, r, response.Error(msg, middleware.GetReqID(r.Context())))
+
+	return true
+}
@@ -0,0 +1,248 @@
+package recordinghandler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type RequestSeries struct {
+	RequestSchedule
+	// RRule is an iCalendar recurrence rule, e.g. FREQ=WEEKLY;BYDAY=TU;UNTIL=20241231T235959Z.
+	RRule   string      `json:"rrule" validate:"required"`
+	ExDates []time.Time `json:"exdates,omitempty"`
+	// TimeZone is the IANA zone the series recurs in, e.g. Europe/Berlin.
+	// Without it the zone of the studio is used.
+	TimeZone string `json:"timezone,omitempty"`
+}
+
+type RequestOccurrence struct {
+	StartTime time.Time `json:"start_time" validate:"required"`
+}
+
+func (h *RecordHandler) SaveSeries(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.SaveSeries"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	var req RequestSeries
+
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("request body decoded", slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if forbidForce(w, r, user, req.Force) {
+		return
+	}
+
+	series, err := h.scheduler.SaveSeries(req.StartTime, req.TimeZone, req.CameraID, req.Duration, req.RRule, req.ExDates, user.Id, req.options())
+	if err != nil {
+		if renderOptionsError(w, r, err) || renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to schedule recordings", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, series)
+}
+
+func (h *RecordHandler) Series(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Series"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	seriesID := chi.URLParam(r, "seriesID")
+
+	log.Info("get series", slog.String("series_id", seriesID))
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	series, err := h.scheduler.Series(seriesID, scheduleOwner(user))
+	if err != nil {
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get series", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, series)
+}
+
+func (h *RecordHandler) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.DeleteSeries"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	seriesID := chi.URLParam(r, "seriesID")
+
+	log.Info("cancel series", slog.String("series_id", seriesID))
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if err := h.scheduler.CancelSeries(seriesID, scheduleOwner(user)); err != nil {
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to cancel series", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Occurrence returns the schedule of one occurrence of a series, so it can be
+// changed or canceled through /schedules/{scheduleID}.
+func (h *RecordHandler) Occurrence(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Occurrence"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	seriesID := chi.URLParam(r, "seriesID")
+
+	var req RequestOccurrence
+
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("request body decoded", slog.String("series_id", seriesID), slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	sch, err := h.scheduler.Occurrence(seriesID, req.StartTime, scheduleOwner(user))
+	if err != nil {
+		if renderScheduleError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get occurrence", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, sch)
+}
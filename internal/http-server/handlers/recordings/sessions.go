@@ -0,0 +1,221 @@
+package recordinghandler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	authmiddleware "github.com/zanzhit/studio_recorder/internal/http-server/middleware/auth"
+	"github.com/zanzhit/studio_recorder/internal/lib/api/response"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+type RequestSession struct {
+	CameraIDs []string `json:"camera_ids" validate:"required,min=2,unique"`
+	ProfileID string   `json:"profile_id,omitempty"`
+	Container string   `json:"container,omitempty" validate:"omitempty,oneof=mkv mp4 ts"`
+	// Proxy records a low-resolution proxy next to every angle.
+	Proxy *bool `json:"proxy,omitempty"`
+	// SegmentMinutes enables segmented recording.
+	SegmentMinutes int `json:"segment_minutes,omitempty" validate:"min=0"`
+	// PreRollSeconds prepends the last seconds buffered for every camera.
+	PreRollSeconds int `json:"pre_roll_seconds,omitempty" validate:"min=0"`
+	// Force records even if the cameras are recorded by others. Only admins
+	// can force.
+	Force bool `json:"force,omitempty"`
+}
+
+func (h *RecordHandler) StartSession(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.StartSession"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	var req RequestSession
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, response.Error("empty request", ""))
+
+			return
+		}
+
+		log.Error("failed to decode request body", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.Error("failed to decode request", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	log.Info("request body decoded", slog.Any("request", req))
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+
+		log.Error("invalid request", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, response.ValidationError(validateErr))
+
+		return
+	}
+
+	user, ok := r.Context().Value(authmiddleware.UserContextKey).(models.User)
+	if !ok {
+		log.Error("user not found in context")
+
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, response.Error("user not found", ""))
+
+		return
+	}
+
+	if forbidForce(w, r, user, req.Force) {
+		return
+	}
+
+	opts := models.RecordingOptions{
+		ProfileID:      req.ProfileID,
+		Container:      req.Container,
+		Proxy:          req.Proxy,
+		SegmentMinutes: req.SegmentMinutes,
+		PreRollSeconds: req.PreRollSeconds,
+		Force:          req.Force,
+	}
+
+	session, err := h.recorder.StartSession(req.CameraIDs, user.Id, opts)
+	if err != nil {
+		if renderOptionsError(w, r, err) || renderConflictError(w, r, err) {
+			return
+		}
+		if errors.Is(err, errs.ErrCameraIsNotAvailable) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response.Error("camera is not available", middleware.GetReqID(r.Context())))
+
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to start session", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, session)
+}
+
+func (h *RecordHandler) StopSession(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.StopSession"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	sessionID := chi.URLParam(r, "sessionID")
+
+	log.Info("stop session", slog.String("session_id", sessionID))
+
+	if err := h.recorder.StopSession(sessionID); err != nil {
+		if renderSessionError(w, r, err) || renderStatusError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to stop session", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *RecordHandler) Session(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.Session"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	sessionID := chi.URLParam(r, "sessionID")
+
+	log.Info("get session", slog.String("session_id", sessionID))
+
+	session, err := h.recordingProvider.Session(sessionID)
+	if err != nil {
+		if renderSessionError(w, r, err) {
+			return
+		}
+
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, response.Error("failed to get session", middleware.GetReqID(r.Context())))
+
+		return
+	}
+
+	render.JSON(w, r, session)
+}
+
+func (h *RecordHandler) MoveSession(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.recordings.MoveSession"
+
+	log := h.log.With(
+		slog.String("op", op),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	sessionID := chi.URLParam(r, "sessionID")
+
+	log.Info("move session", slog.String("session_id", sessionID))
+
+	if err := h.recordingProvider.MoveSession(sessionID); err != nil {
+		if renderSessionError(w, r, err) || renderStatusError(w, r, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, errs.ErrTooManyAngles):
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, response.Error("video service takes at most two angles", middleware.GetReqID(r.Context())))
+		case errors.Is(err, errs.ErrPiecesNotJoinable):
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, response.Error("recording has several pieces that can't be uploaded as one file", middleware.GetReqID(r.Context())))
+		case errors.Is(err, errs.ErrWriteToDB):
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.Error("session moved, but failed to write move data", middleware.GetReqID(r.Context())))
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.Error("failed to move session", middleware.GetReqID(r.Context())))
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func renderSessionError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, errs.ErrSessionNotFound) {
+		return false
+	}
+
+	render.Status(r, http.StatusNotFound)
+	render.JSON(w, r, response.Error("session not found", middleware.GetReqID(r.Context())))
+
+	return true
+}
@@ -53,6 +53,40 @@ func JWTAuth(secret string) func(http.Handler) http.Handler {
 	}
 }
 
+// TokenFromQuery lets clients that can't set headers, like the browser
+// EventSource and WebSocket, pass the token as the access_token parameter.
+func TokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type FeedUserProvider interface {
+	FeedUser(token string) (models.User, error)
+}
+
+// FeedTokenAuth authenticates a calendar subscription by the feed token in
+// the token parameter. It doesn't accept a JWT, so the feed URL never holds
+// a token that opens the rest of the API.
+func FeedTokenAuth(users FeedUserProvider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := users.FeedUser(r.URL.Query().Get("token"))
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func AdminRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, ok := r.Context().Value(UserContextKey).(models.User)
@@ -0,0 +1,243 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const prodID = "-//studio_recorder//schedules//EN"
+
+// maxLine is the length in octets lines are folded at.
+const maxLine = 75
+
+// Encode writes the calendar. Times of an event are written in the zone of
+// its start, described by a VTIMEZONE, so recurring events keep their wall
+// clock across daylight saving changes. Zones without an IANA name are
+// written in UTC.
+func Encode(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+
+	line := func(s string) {
+		fold(bw, s)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + prodID)
+	line("CALSCALE:GREGORIAN")
+	if cal.Name != "" {
+		line("X-WR-CALNAME:" + escape(cal.Name))
+	}
+
+	// Each zone is described from the year of its first event on.
+	first := make(map[string]time.Time)
+	locs := make(map[string]*time.Location)
+	for _, ev := range cal.Events {
+		loc := ev.Start.Location()
+		id := tzid(loc)
+		if id == "" {
+			continue
+		}
+
+		if t, ok := first[id]; !ok || ev.Start.Before(t) {
+			first[id] = ev.Start
+		}
+		locs[id] = loc
+	}
+
+	ids := make([]string, 0, len(first))
+	for id := range first {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		writeZone(line, id, locs[id], first[id])
+	}
+
+	stamp := time.Now().UTC().Format(dateTimeUTC)
+
+	for _, ev := range cal.Events {
+		loc := ev.Start.Location()
+
+		line("BEGIN:VEVENT")
+		line("UID:" + ev.UID)
+		line("DTSTAMP:" + stamp)
+		if !ev.RecurrenceID.IsZero() {
+			line("RECURRENCE-ID" + formatTime(ev.RecurrenceID, loc))
+		}
+		line("DTSTART" + formatTime(ev.Start, loc))
+		line("DTEND" + formatTime(ev.End, loc))
+		if ev.RRule != "" {
+			line("RRULE:" + ev.RRule)
+		}
+		for _, ex := range ev.ExDates {
+			line("EXDATE" + formatTime(ex, loc))
+		}
+		if ev.Summary != "" {
+			line("SUMMARY:" + escape(ev.Summary))
+		}
+		if ev.Location != "" {
+			line("LOCATION:" + escape(ev.Location))
+		}
+		if ev.Status != "" {
+			line("STATUS:" + ev.Status)
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// writeZone writes the VTIMEZONE of loc. The changes of its offset in the
+// year of from become yearly rules, a zone without them gets one fixed
+// offset.
+func writeZone(line func(string), id string, loc *time.Location, from time.Time) {
+	line("BEGIN:VTIMEZONE")
+	line("TZID:" + id)
+
+	changes := transitions(loc, from.In(loc).Year())
+	if len(changes) == 0 {
+		name, off := from.In(loc).Zone()
+
+		line("BEGIN:STANDARD")
+		line("DTSTART:19700101T000000")
+		line("TZOFFSETFROM:" + offset(off))
+		line("TZOFFSETTO:" + offset(off))
+		line("TZNAME:" + name)
+		line("END:STANDARD")
+	}
+
+	for _, t := range changes {
+		_, before := t.Add(-time.Second).In(loc).Zone()
+		name, after := t.In(loc).Zone()
+		// The onset is given in the wall clock before the change.
+		onset := t.In(time.FixedZone("", before))
+
+		kind := "STANDARD"
+		if t.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+
+		line("BEGIN:" + kind)
+		line("DTSTART:" + onset.Format(dateTimeLocal))
+		line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", onset.Month(), weekdayOfMonth(onset)))
+		line("TZOFFSETFROM:" + offset(before))
+		line("TZOFFSETTO:" + offset(after))
+		line("TZNAME:" + name)
+		line("END:" + kind)
+	}
+
+	line("END:VTIMEZONE")
+}
+
+// transitions returns when the offset of loc changes during a year.
+func transitions(loc *time.Location, year int) []time.Time {
+	var changes []time.Time
+
+	day := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	end := day.AddDate(1, 0, 0)
+	for ; day.Before(end); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+
+		_, a := day.Zone()
+		_, b := next.Zone()
+		if a == b {
+			continue
+		}
+
+		// The change is the first second with the new offset.
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, off := mid.Zone(); off == a {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		changes = append(changes, hi)
+	}
+
+	return changes
+}
+
+var weekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// weekdayOfMonth returns the BYDAY of t: its weekday counted from the end of
+// the month when it is the last one, as daylight saving rules mostly are.
+func weekdayOfMonth(t time.Time) string {
+	lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	n := (t.Day()-1)/7 + 1
+	if t.Day()+7 > lastDay {
+		n = -1
+	}
+
+	return fmt.Sprintf("%d%s", n, weekdays[t.Weekday()])
+}
+
+// formatTime returns the parameters and value of a time property, starting
+// at the separator after its name.
+func formatTime(t time.Time, loc *time.Location) string {
+	id := tzid(loc)
+	if id == "" {
+		return ":" + t.UTC().Format(dateTimeUTC)
+	}
+
+	return ";TZID=" + id + ":" + t.In(loc).Format(dateTimeLocal)
+}
+
+// tzid returns the IANA name times in loc are written with, or "" to write
+// them in UTC.
+func tzid(loc *time.Location) string {
+	id := loc.String()
+	if id == "" || id == "UTC" || id == "Local" {
+		return ""
+	}
+
+	if _, err := time.LoadLocation(id); err != nil {
+		return ""
+	}
+
+	return id
+}
+
+func offset(off int) string {
+	sign := '+'
+	if off < 0 {
+		sign, off = '-', -off
+	}
+
+	return fmt.Sprintf("%c%02d%02d", sign, off/3600, off%3600/60)
+}
+
+// fold writes a content line, continuing it on the next line after
+// maxLine octets without splitting a UTF-8 sequence.
+func fold(w *bufio.Writer, s string) {
+	// Continuation lines start with a space.
+	for limit := maxLine; len(s) > limit; limit = maxLine - 1 {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+
+		w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+	}
+
+	w.WriteString(s + "\r\n")
+}
+
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+	return r.Replace(s)
+}
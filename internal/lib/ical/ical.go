@@ -0,0 +1,292 @@
+// Package ical reads and writes the events of iCalendar files (RFC 5545).
+// It covers what timetables use for bookings: VEVENTs with a start, an end
+// or duration, a recurrence rule and exception dates.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateTimeUTC   = "20060102T150405Z"
+	dateTimeLocal = "20060102T150405"
+)
+
+var (
+	ErrNotCalendar = errors.New("not an iCalendar file")
+	ErrAllDay      = errors.New("all-day events are not supported")
+)
+
+var durationRe = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+type Event struct {
+	UID      string
+	Summary  string
+	Location string
+	// Status is CONFIRMED, TENTATIVE or CANCELLED.
+	Status  string
+	Start   time.Time
+	End     time.Time
+	RRule   string
+	ExDates []time.Time
+	// RecurrenceID is set on an event that changes one occurrence of
+	// another.
+	RecurrenceID time.Time
+	// Err is why the event could not be read. The rest of the calendar is
+	// still read.
+	Err error
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Parse reads the events of a calendar. Floating times are read in loc.
+// A TZID is an IANA or a Windows zone name, a zone described by a VTIMEZONE
+// of the file, or a UTC offset.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	zones := readZones(lines)
+
+	var events []Event
+	var ev *Event
+	var duration string
+	// depth counts the components nested in an event, e.g. VALARM, whose
+	// properties are not the event's.
+	depth := 0
+
+	for _, line := range lines {
+		name, params, value, ok := split(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT") && ev == nil:
+			ev, duration = &Event{}, ""
+
+			continue
+		case name == "BEGIN" && ev != nil:
+			depth++
+
+			continue
+		case name == "END" && ev != nil && depth > 0:
+			depth--
+
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT") && ev != nil:
+			if ev.Err == nil && ev.End.IsZero() && duration != "" {
+				d, err := parseDuration(duration)
+				if err != nil {
+					ev.Err = err
+				}
+				ev.End = ev.Start.Add(d)
+			}
+
+			if ev.Err == nil && ev.Start.IsZero() {
+				ev.Err = errors.New("event has no start")
+			}
+
+			events = append(events, *ev)
+			ev = nil
+
+			continue
+		}
+
+		if ev == nil || depth > 0 {
+			continue
+		}
+
+		var err error
+
+		switch name {
+		case "UID":
+			ev.UID = value
+		case "SUMMARY":
+			ev.Summary = unescape(value)
+		case "LOCATION":
+			ev.Location = unescape(value)
+		case "STATUS":
+			ev.Status = strings.ToUpper(value)
+		case "DTSTART":
+			ev.Start, err = parseTime(value, params, loc, zones)
+		case "DTEND":
+			ev.End, err = parseTime(value, params, loc, zones)
+		case "DURATION":
+			duration = value
+		case "RRULE":
+			ev.RRule = value
+		case "RECURRENCE-ID":
+			ev.RecurrenceID, err = parseTime(value, params, loc, zones)
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, exErr := parseTime(v, params, loc, zones)
+				if exErr != nil {
+					err = exErr
+
+					break
+				}
+				ev.ExDates = append(ev.ExDates, t)
+			}
+		}
+
+		if err != nil && ev.Err == nil {
+			ev.Err = fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return events, nil
+}
+
+// unfold joins the lines that continue on the next one, which starts with
+// a space or a tab.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// split parses a content line "NAME;PARAM=value:value". Colons and
+// semicolons in quoted parameter values are kept.
+func split(line string) (string, map[string]string, string, bool) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ':' && !quoted {
+			colon = i
+
+			break
+		}
+	}
+
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		key, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(key)] = strings.Trim(v, `"`)
+	}
+
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+func parseTime(value string, params map[string]string, loc *time.Location, zones map[string]vtimezone) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		return time.Time{}, ErrAllDay
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeUTC, value)
+	}
+
+	if tzid := params["TZID"]; tzid != "" {
+		tz, ok := location(tzid)
+		if !ok {
+			if zone, ok := zones[tzid]; ok {
+				wall, err := time.Parse(dateTimeLocal, value)
+				if err != nil {
+					return time.Time{}, err
+				}
+
+				off := zone.offset(wall)
+
+				return wall.Add(-time.Duration(off) * time.Second).In(time.FixedZone(tzid, off)), nil
+			}
+
+			var err error
+			if tz, err = parseOffsetZone(tzid); err != nil {
+				return time.Time{}, fmt.Errorf("unknown time zone %s", tzid)
+			}
+		}
+		loc = tz
+	}
+
+	return time.ParseInLocation(dateTimeLocal, value, loc)
+}
+
+// parseOffsetZone reads zones named by their UTC offset, e.g. UTC+03:00.
+func parseOffsetZone(id string) (*time.Location, error) {
+	t, err := time.Parse("UTC-07:00", id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, off := t.Zone()
+
+	return time.FixedZone(id, off), nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	m := durationRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		d += time.Duration(n) * unit
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+
+	return r.Replace(s)
+}
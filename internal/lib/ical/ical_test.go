@@ -0,0 +1,244 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const timetable = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:lecture-1\r\n" +
+	"SUMMARY:Linear algebra\\, lecture\r\n" +
+	"LOCATION:Room 101\r\n" +
+	"DTSTART;TZID=\"UTC+03:00\":20240903T100000\r\n" +
+	"DTEND;TZID=\"UTC+03:00\":20240903T113000\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=TU;UNTIL=20241224T235959Z\r\n" +
+	"EXDATE;TZID=\"UTC+03:00\":20241105T100000,20241112T100000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"DESCRIPTION:Not the event's\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:seminar-1\r\n" +
+	"SUMMARY:A seminar with a very long title that does not fit on one line of th\r\n" +
+	" e calendar file\r\n" +
+	"LOCATION:Room 202\r\n" +
+	"DTSTART:20240904T120000Z\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday\r\n" +
+	"DTSTART;VALUE=DATE:20241104\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(timetable), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Parse() = %d events, want 3", len(events))
+	}
+
+	msk := time.FixedZone("", 3*60*60)
+
+	lecture := events[0]
+	if lecture.Err != nil {
+		t.Fatalf("lecture error = %v", lecture.Err)
+	}
+	if lecture.Summary != "Linear algebra, lecture" || lecture.Location != "Room 101" {
+		t.Errorf("lecture = %q at %q, want the text unescaped", lecture.Summary, lecture.Location)
+	}
+	if !lecture.Start.Equal(time.Date(2024, 9, 3, 10, 0, 0, 0, msk)) || lecture.End.Sub(lecture.Start) != 90*time.Minute {
+		t.Errorf("lecture = %v..%v, want 10:00-11:30 MSK", lecture.Start, lecture.End)
+	}
+	if lecture.RRule != "FREQ=WEEKLY;BYDAY=TU;UNTIL=20241224T235959Z" || len(lecture.ExDates) != 2 {
+		t.Errorf("lecture rule = %s with %d exdates, want the rule and 2 exdates", lecture.RRule, len(lecture.ExDates))
+	}
+
+	seminar := events[1]
+	if seminar.Err != nil || !strings.HasSuffix(seminar.Summary, "of the calendar file") {
+		t.Errorf("seminar = %q (%v), want the folded summary joined", seminar.Summary, seminar.Err)
+	}
+	if seminar.End.Sub(seminar.Start) != 90*time.Minute {
+		t.Errorf("seminar lasts %v, want the duration", seminar.End.Sub(seminar.Start))
+	}
+
+	if !errors.Is(events[2].Err, ErrAllDay) {
+		t.Errorf("all-day event error = %v, want %v", events[2].Err, ErrAllDay)
+	}
+
+	if _, err := Parse(strings.NewReader("UID:x\r\n"), time.UTC); !errors.Is(err, ErrNotCalendar) {
+		t.Errorf("Parse() of a non-calendar error = %v, want %v", err, ErrNotCalendar)
+	}
+}
+
+// outlook is how Outlook writes events: a Windows zone name, or a display
+// name described by a VTIMEZONE.
+const outlook = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:windows\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20240703T100000\r\n" +
+	"DTEND;TZID=W. Europe Standard Time:20240703T113000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:summer\r\n" +
+	"DTSTART;TZID=\"(UTC+01:00) Amsterdam, Berlin\":20240703T100000\r\n" +
+	"DURATION:PT1H\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:winter\r\n" +
+	"DTSTART;TZID=\"(UTC+01:00) Amsterdam, Berlin\":20241105T100000\r\n" +
+	"DURATION:PT1H\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:(UTC+01:00) Amsterdam, Berlin\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T030000\r\n" +
+	"TZOFFSETFROM:+0200\r\n" +
+	"TZOFFSETTO:+0100\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\n" +
+	"END:STANDARD\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"DTSTART:16010101T020000\r\n" +
+	"TZOFFSETFROM:+0100\r\n" +
+	"TZOFFSETTO:+0200\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseZones(t *testing.T) {
+	events, err := Parse(strings.NewReader(outlook), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Parse() = %d events, want 3", len(events))
+	}
+
+	tests := []struct {
+		uid  string
+		want time.Time
+	}{
+		{"windows", time.Date(2024, 7, 3, 8, 0, 0, 0, time.UTC)},
+		{"summer", time.Date(2024, 7, 3, 8, 0, 0, 0, time.UTC)},
+		{"winter", time.Date(2024, 11, 5, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for i, tt := range tests {
+		ev := events[i]
+		if ev.Err != nil {
+			t.Errorf("%s error = %v", tt.uid, ev.Err)
+
+			continue
+		}
+		if !ev.Start.Equal(tt.want) {
+			t.Errorf("%s start = %v, want %v", tt.uid, ev.Start, tt.want)
+		}
+	}
+
+	if events[0].Start.Location().String() != "Europe/Berlin" {
+		t.Errorf("windows zone = %s, want Europe/Berlin", events[0].Start.Location())
+	}
+}
+
+func TestWindowsZones(t *testing.T) {
+	for windows, name := range windowsZones {
+		if _, err := time.LoadLocation(name); err != nil {
+			t.Errorf("%s: LoadLocation(%s) error = %v", windows, name, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 9, 3, 10, 0, 0, 0, berlin)
+
+	cal := Calendar{
+		Name: "Room 101",
+		Events: []Event{
+			{
+				UID:      "series@recorder",
+				Summary:  strings.Repeat("Лекция; ", 20),
+				Location: "Room 101",
+				Start:    start,
+				End:      start.Add(90 * time.Minute),
+				RRule:    "FREQ=WEEKLY;BYDAY=TU",
+				ExDates:  []time.Time{start.AddDate(0, 0, 7).UTC()},
+			},
+			{
+				UID:          "series@recorder",
+				Start:        start.AddDate(0, 0, 14).Add(time.Hour),
+				End:          start.AddDate(0, 0, 14).Add(150 * time.Minute),
+				RecurrenceID: start.AddDate(0, 0, 14),
+			},
+			{
+				UID:   "once@recorder",
+				Start: start.UTC(),
+				End:   start.Add(time.Hour).UTC(),
+			},
+			{
+				UID:   "fixed@recorder",
+				Start: start.In(time.FixedZone("", 3*60*60)),
+				End:   start.Add(time.Hour),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, cal); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"TZID:Europe/Berlin\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240331T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20241027T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n",
+		"DTSTART;TZID=Europe/Berlin:20240903T100000\r\n",
+		"EXDATE;TZID=Europe/Berlin:20240910T100000\r\n",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20240917T100000\r\n",
+		"DTSTART:20240903T080000Z\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Encode() has no %q", strings.TrimSpace(want))
+		}
+	}
+
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > maxLine {
+			t.Errorf("line of %d octets, want it folded: %s", len(line), line)
+		}
+	}
+
+	if strings.Count(out, "BEGIN:VTIMEZONE") != 1 {
+		t.Errorf("Encode() = %s, want one VTIMEZONE, the fixed zone written in UTC", out)
+	}
+
+	events, err := Parse(&buf, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(events) != 4 || events[0].Summary != cal.Events[0].Summary || !events[0].Start.Equal(start) {
+		t.Errorf("Parse(Encode()) = %+v, want the events back", events)
+	}
+	if events[0].Start.Location().String() != "Europe/Berlin" {
+		t.Errorf("start zone = %s, want Europe/Berlin", events[0].Start.Location())
+	}
+	if !events[1].RecurrenceID.Equal(cal.Events[1].RecurrenceID) {
+		t.Errorf("recurrence ID = %v, want %v", events[1].RecurrenceID, cal.Events[1].RecurrenceID)
+	}
+}
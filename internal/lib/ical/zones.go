@@ -0,0 +1,362 @@
+package ical
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// observance is a STANDARD or DAYLIGHT block of a VTIMEZONE: the offset
+// that starts at start, and every year on the day of the rule if it has one.
+type observance struct {
+	// start is the wall clock time the offset starts, read as UTC.
+	start  time.Time
+	offset int
+	yearly bool
+	month  time.Month
+	// week is the BYDAY ordinal, -1 for the last weekday of the month.
+	week  int
+	day   time.Weekday
+	until time.Time
+}
+
+// vtimezone is a zone described in the calendar file itself, e.g. by Outlook
+// with a display name for TZID.
+type vtimezone []observance
+
+// readZones collects the VTIMEZONE blocks of a calendar by TZID. Blocks it
+// can't read are left out, times in them fail as an unknown zone.
+func readZones(lines []string) map[string]vtimezone {
+	zones := make(map[string]vtimezone)
+
+	var tzid string
+	var zone vtimezone
+	var ob *observance
+	inZone := false
+
+	for _, line := range lines {
+		name, _, value, ok := split(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTIMEZONE"):
+			inZone, tzid, zone = true, "", nil
+		case !inZone:
+		case name == "END" && strings.EqualFold(value, "VTIMEZONE"):
+			if tzid != "" && len(zone) > 0 {
+				zones[tzid] = zone
+			}
+			inZone = false
+		case name == "BEGIN" && (strings.EqualFold(value, "STANDARD") || strings.EqualFold(value, "DAYLIGHT")):
+			ob = &observance{}
+		case name == "END" && ob != nil:
+			if !ob.start.IsZero() {
+				zone = append(zone, *ob)
+			}
+			ob = nil
+		case name == "TZID" && ob == nil:
+			tzid = value
+		case ob == nil:
+		case name == "DTSTART":
+			if t, err := time.Parse(dateTimeLocal, strings.TrimSpace(value)); err == nil {
+				ob.start = t
+			}
+		case name == "TZOFFSETTO":
+			if off, ok := parseOffset(value); ok {
+				ob.offset = off
+			} else {
+				ob.start = time.Time{}
+			}
+		case name == "RRULE":
+			ob.readRule(value)
+		}
+	}
+
+	return zones
+}
+
+// readRule reads the yearly rules calendar apps write for DST changes, e.g.
+// FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU. Other rules are ignored, and the offset
+// only starts once.
+func (ob *observance) readRule(rule string) {
+	var freq, byday string
+	var month int
+	var until time.Time
+
+	for _, part := range strings.Split(strings.ToUpper(rule), ";") {
+		key, value, _ := strings.Cut(part, "=")
+
+		switch key {
+		case "FREQ":
+			freq = value
+		case "BYMONTH":
+			month, _ = strconv.Atoi(value)
+		case "BYDAY":
+			byday = value
+		case "UNTIL":
+			until, _ = time.Parse(dateTimeUTC, value)
+		}
+	}
+
+	if freq != "YEARLY" || month < 1 || month > 12 || len(byday) < 3 {
+		return
+	}
+
+	day := -1
+	for wd, name := range weekdays {
+		if name == byday[len(byday)-2:] {
+			day = wd
+		}
+	}
+	if day < 0 {
+		return
+	}
+
+	week, err := strconv.Atoi(byday[:len(byday)-2])
+	if err != nil || week == 0 || week < -5 || week > 5 {
+		return
+	}
+
+	ob.yearly, ob.month, ob.week, ob.day, ob.until = true, time.Month(month), week, time.Weekday(day), until
+}
+
+// onset is when the observance starts in a year.
+func (ob observance) onset(year int) time.Time {
+	h, m, s := ob.start.Clock()
+
+	if ob.week > 0 {
+		t := time.Date(year, ob.month, 1, h, m, s, 0, time.UTC)
+		t = t.AddDate(0, 0, (int(ob.day)-int(t.Weekday())+7)%7)
+
+		return t.AddDate(0, 0, 7*(ob.week-1))
+	}
+
+	t := time.Date(year, ob.month+1, 0, h, m, s, 0, time.UTC)
+	t = t.AddDate(0, 0, -((int(t.Weekday()) - int(ob.day) + 7) % 7))
+
+	return t.AddDate(0, 0, 7*(ob.week+1))
+}
+
+// offset is the UTC offset of a wall clock time, read as UTC: that of the
+// observance that started last before it.
+func (z vtimezone) offset(wall time.Time) int {
+	var last time.Time
+	offset := z[0].offset
+	first := z[0].start
+
+	for _, ob := range z {
+		if ob.start.Before(first) {
+			first, offset = ob.start, ob.offset
+		}
+	}
+
+	for _, ob := range z {
+		starts := []time.Time{ob.start}
+		if ob.yearly {
+			starts = []time.Time{ob.onset(wall.Year() - 1), ob.onset(wall.Year())}
+		}
+
+		for _, t := range starts {
+			if t.Before(ob.start) || t.After(wall) || (!ob.until.IsZero() && t.After(ob.until)) {
+				continue
+			}
+
+			if t.After(last) {
+				last, offset = t, ob.offset
+			}
+		}
+	}
+
+	return offset
+}
+
+// parseOffset reads a UTC offset like +0300 or -053000.
+func parseOffset(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) != 5 && len(value) != 7 {
+		return 0, false
+	}
+
+	sign := 1
+	switch value[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(value[1:])
+	if err != nil {
+		return 0, false
+	}
+
+	if len(value) == 5 {
+		n *= 100
+	}
+
+	return sign * (n/10000*3600 + n/100%100*60 + n%100), true
+}
+
+// location finds a zone by its IANA name or by its Windows name, which
+// Outlook and Exchange use.
+func location(tzid string) (*time.Location, bool) {
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return loc, true
+	}
+
+	if name, ok := windowsZones[tzid]; ok {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, true
+		}
+	}
+
+	return nil, false
+}
+
+// windowsZones maps Windows time zone names to IANA zones, as the Unicode
+// CLDR windowsZones table does for the zone's main territory.
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"UTC-11":                          "Etc/GMT+11",
+	"Aleutian Standard Time":          "America/Adak",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Marquesas Standard Time":         "Pacific/Marquesas",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"UTC-09":                          "Etc/GMT+9",
+	"Pacific Standard Time (Mexico)":  "America/Tijuana",
+	"UTC-08":                          "Etc/GMT+8",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Mountain Standard Time (Mexico)": "America/Mazatlan",
+	"Mountain Standard Time":          "America/Denver",
+	"Yukon Standard Time":             "America/Whitehorse",
+	"Central America Standard Time":   "America/Guatemala",
+	"Central Standard Time":           "America/Chicago",
+	"Easter Island Standard Time":     "Pacific/Easter",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Canada Central Standard Time":    "America/Regina",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Eastern Standard Time (Mexico)":  "America/Cancun",
+	"Eastern Standard Time":           "America/New_York",
+	"Haiti Standard Time":             "America/Port-au-Prince",
+	"Cuba Standard Time":              "America/Havana",
+	"US Eastern Standard Time":        "America/Indiana/Indianapolis",
+	"Turks And Caicos Standard Time":  "America/Grand_Turk",
+	"Paraguay Standard Time":          "America/Asuncion",
+	"Atlantic Standard Time":          "America/Halifax",
+	"Venezuela Standard Time":         "America/Caracas",
+	"Central Brazilian Standard Time": "America/Cuiaba",
+	"SA Western Standard Time":        "America/La_Paz",
+	"Pacific SA Standard Time":        "America/Santiago",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"Tocantins Standard Time":         "America/Araguaina",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"SA Eastern Standard Time":        "America/Cayenne",
+	"Argentina Standard Time":         "America/Argentina/Buenos_Aires",
+	"Greenland Standard Time":         "America/Nuuk",
+	"Montevideo Standard Time":        "America/Montevideo",
+	"Magallanes Standard Time":        "America/Punta_Arenas",
+	"Saint Pierre Standard Time":      "America/Miquelon",
+	"Bahia Standard Time":             "America/Bahia",
+	"UTC-02":                          "Etc/GMT+2",
+	"Mid-Atlantic Standard Time":      "Etc/GMT+2",
+	"Azores Standard Time":            "Atlantic/Azores",
+	"Cape Verde Standard Time":        "Atlantic/Cape_Verde",
+	"UTC":                             "Etc/UTC",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"Sao Tome Standard Time":          "Africa/Sao_Tome",
+	"Morocco Standard Time":           "Africa/Casablanca",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Romance Standard Time":           "Europe/Paris",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+	"Jordan Standard Time":            "Asia/Amman",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Middle East Standard Time":       "Asia/Beirut",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"Syria Standard Time":             "Asia/Damascus",
+	"West Bank Standard Time":         "Asia/Hebron",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"FLE Standard Time":               "Europe/Kiev",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"South Sudan Standard Time":       "Africa/Juba",
+	"Kaliningrad Standard Time":       "Europe/Kaliningrad",
+	"Sudan Standard Time":             "Africa/Khartoum",
+	"Libya Standard Time":             "Africa/Tripoli",
+	"Namibia Standard Time":           "Africa/Windhoek",
+	"Arabic Standard Time":            "Asia/Baghdad",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Arab Standard Time":              "Asia/Riyadh",
+	"Belarus Standard Time":           "Europe/Minsk",
+	"Russian Standard Time":           "Europe/Moscow",
+	"E. Africa Standard Time":         "Africa/Nairobi",
+	"Volgograd Standard Time":         "Europe/Volgograd",
+	"Iran Standard Time":              "Asia/Tehran",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Astrakhan Standard Time":         "Europe/Astrakhan",
+	"Azerbaijan Standard Time":        "Asia/Baku",
+	"Russia Time Zone 3":              "Europe/Samara",
+	"Mauritius Standard Time":         "Indian/Mauritius",
+	"Saratov Standard Time":           "Europe/Saratov",
+	"Georgian Standard Time":          "Asia/Tbilisi",
+	"Caucasus Standard Time":          "Asia/Yerevan",
+	"Afghanistan Standard Time":       "Asia/Kabul",
+	"West Asia Standard Time":         "Asia/Tashkent",
+	"Ekaterinburg Standard Time":      "Asia/Yekaterinburg",
+	"Pakistan Standard Time":          "Asia/Karachi",
+	"Qyzylorda Standard Time":         "Asia/Qyzylorda",
+	"India Standard Time":             "Asia/Kolkata",
+	"Sri Lanka Standard Time":         "Asia/Colombo",
+	"Nepal Standard Time":             "Asia/Kathmandu",
+	"Central Asia Standard Time":      "Asia/Almaty",
+	"Bangladesh Standard Time":        "Asia/Dhaka",
+	"Omsk Standard Time":              "Asia/Omsk",
+	"Myanmar Standard Time":           "Asia/Yangon",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"Altai Standard Time":             "Asia/Barnaul",
+	"W. Mongolia Standard Time":       "Asia/Hovd",
+	"North Asia Standard Time":        "Asia/Krasnoyarsk",
+	"N. Central Asia Standard Time":   "Asia/Novosibirsk",
+	"Tomsk Standard Time":             "Asia/Tomsk",
+	"China Standard Time":             "Asia/Shanghai",
+	"North Asia East Standard Time":   "Asia/Irkutsk",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"Taipei Standard Time":            "Asia/Taipei",
+	"Ulaanbaatar Standard Time":       "Asia/Ulaanbaatar",
+	"Aus Central W. Standard Time":    "Australia/Eucla",
+	"Transbaikal Standard Time":       "Asia/Chita",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"North Korea Standard Time":       "Asia/Pyongyang",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Yakutsk Standard Time":           "Asia/Yakutsk",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"AUS Central Standard Time":       "Australia/Darwin",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"West Pacific Standard Time":      "Pacific/Port_Moresby",
+	"Tasmania Standard Time":          "Australia/Hobart",
+	"Vladivostok Standard Time":       "Asia/Vladivostok",
+	"Lord Howe Standard Time":         "Australia/Lord_Howe",
+	"Bougainville Standard Time":      "Pacific/Bougainville",
+	"Russia Time Zone 10":             "Asia/Srednekolymsk",
+	"Magadan Standard Time":           "Asia/Magadan",
+	"Norfolk Standard Time":           "Pacific/Norfolk",
+	"Sakhalin Standard Time":          "Asia/Sakhalin",
+	"Central Pacific Standard Time":   "Pacific/Guadalcanal",
+	"Russia Time Zone 11":             "Asia/Kamchatka",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"UTC+12":                          "Etc/GMT-12",
+	"Fiji Standard Time":              "Pacific/Fiji",
+	"Chatham Islands Standard Time":   "Pacific/Chatham",
+	"UTC+13":                          "Etc/GMT-13",
+	"Tonga Standard Time":             "Pacific/Tongatapu",
+	"Samoa Standard Time":             "Pacific/Apia",
+	"Line Islands Standard Time":      "Pacific/Kiritimati",
+}
@@ -0,0 +1,302 @@
+// Package rrule expands the part of iCalendar recurrence rules (RFC 5545)
+// that recurring schedules need: daily and weekly rules with INTERVAL, BYDAY,
+// UNTIL and COUNT.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+)
+
+const (
+	Daily  = "DAILY"
+	Weekly = "WEEKLY"
+)
+
+// maxPeriods bounds the expansion of rules that never yield an occurrence,
+// e.g. a daily rule with an interval of 7 and BYDAY of another weekday.
+const maxPeriods = 10000
+
+const (
+	untilUTC   = "20060102T150405Z"
+	untilLocal = "20060102T150405"
+	untilDate  = "20060102"
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+type Rule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	// Until is the last moment an occurrence may start. A floating UNTIL is
+	// read in the time zone of the series, so it is kept as wall clock.
+	Until      time.Time
+	untilLocal bool
+}
+
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, fmt.Errorf("%w: empty", errs.ErrInvalidRRule)
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("%w: %s", errs.ErrInvalidRRule, part)
+		}
+
+		value = strings.ToUpper(value)
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			if value != Daily && value != Weekly {
+				return Rule{}, fmt.Errorf("%w: unsupported frequency %s", errs.ErrInvalidRRule, value)
+			}
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return Rule{}, fmt.Errorf("%w: %s", errs.ErrInvalidRRule, part)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return Rule{}, fmt.Errorf("%w: %s", errs.ErrInvalidRRule, part)
+			}
+			r.Count = n
+		case "UNTIL":
+			if err := r.parseUntil(value); err != nil {
+				return Rule{}, fmt.Errorf("%w: %s", errs.ErrInvalidRRule, part)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return Rule{}, fmt.Errorf("%w: unsupported day %s", errs.ErrInvalidRRule, day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			// Weeks start on Monday, which is the default.
+			if value != "MO" {
+				return Rule{}, fmt.Errorf("%w: unsupported week start %s", errs.ErrInvalidRRule, value)
+			}
+		default:
+			return Rule{}, fmt.Errorf("%w: unsupported part %s", errs.ErrInvalidRRule, key)
+		}
+	}
+
+	if r.Freq == "" {
+		return Rule{}, fmt.Errorf("%w: FREQ is required", errs.ErrInvalidRRule)
+	}
+
+	if r.Count > 0 && !r.Until.IsZero() {
+		return Rule{}, fmt.Errorf("%w: UNTIL and COUNT are exclusive", errs.ErrInvalidRRule)
+	}
+
+	sort.Slice(r.ByDay, func(i, j int) bool { return fromMonday(r.ByDay[i]) < fromMonday(r.ByDay[j]) })
+
+	return r, nil
+}
+
+func (r *Rule) parseUntil(value string) error {
+	if t, err := time.Parse(untilUTC, value); err == nil {
+		r.Until = t
+
+		return nil
+	}
+
+	if t, err := time.Parse(untilLocal, value); err == nil {
+		r.Until, r.untilLocal = t, true
+
+		return nil
+	}
+
+	t, err := time.Parse(untilDate, value)
+	if err != nil {
+		return err
+	}
+
+	// A date includes the whole day.
+	r.Until, r.untilLocal = t.Add(24*time.Hour-time.Second), true
+
+	return nil
+}
+
+// String formats the rule back as an RRULE value.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			days = append(days, strings.ToUpper(wd.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	switch {
+	case r.untilLocal:
+		parts = append(parts, "UNTIL="+r.Until.Format(untilLocal))
+	case !r.Until.IsZero():
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilUTC))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of a series first starting at dtstart that
+// start in [from, to). Occurrences at exdates are left out, though they still
+// count towards COUNT.
+func (r Rule) Between(dtstart, from, to time.Time, exdates []time.Time) []time.Time {
+	var occurrences []time.Time
+
+	r.each(dtstart, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+
+		if !t.Before(from) && !excluded(t, exdates) {
+			occurrences = append(occurrences, t)
+		}
+
+		return true
+	})
+
+	return occurrences
+}
+
+// After returns the first occurrence starting after t. It is false once the
+// series is over.
+func (r Rule) After(dtstart, t time.Time, exdates []time.Time) (time.Time, bool) {
+	var next time.Time
+
+	r.each(dtstart, func(occurrence time.Time) bool {
+		if !occurrence.After(t) || excluded(occurrence, exdates) {
+			return true
+		}
+
+		next = occurrence
+
+		return false
+	})
+
+	return next, !next.IsZero()
+}
+
+// Includes reports whether a series has an occurrence starting at t.
+func (r Rule) Includes(dtstart, t time.Time, exdates []time.Time) bool {
+	occurrences := r.Between(dtstart, t, t.Add(time.Nanosecond), exdates)
+
+	return len(occurrences) == 1
+}
+
+// each calls fn with the occurrences in order until fn returns false or the
+// rule ends. Times keep the wall clock of dtstart in its location.
+func (r Rule) each(dtstart time.Time, fn func(time.Time) bool) {
+	loc := dtstart.Location()
+	year, month, day := dtstart.Date()
+	hour, min, sec := dtstart.Clock()
+	nsec := dtstart.Nanosecond()
+
+	until := r.Until
+	if r.untilLocal {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, loc)
+	}
+
+	n := 0
+	emit := func(t time.Time) bool {
+		if t.Before(dtstart) {
+			return true
+		}
+
+		if (!until.IsZero() && t.After(until)) || (r.Count > 0 && n >= r.Count) {
+			return false
+		}
+		n++
+
+		return fn(t)
+	}
+
+	switch r.Freq {
+	case Daily:
+		for i := 0; i < maxPeriods; i++ {
+			t := time.Date(year, month, day+i*r.Interval, hour, min, sec, nsec, loc)
+			if len(r.ByDay) > 0 && !contains(r.ByDay, t.Weekday()) {
+				continue
+			}
+
+			if !emit(t) {
+				return
+			}
+		}
+	case Weekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{dtstart.Weekday()}
+		}
+
+		// Weeks are counted from the Monday of the first one.
+		monday := day - fromMonday(dtstart.Weekday())
+
+		for i := 0; i < maxPeriods; i++ {
+			for _, wd := range days {
+				t := time.Date(year, month, monday+i*7*r.Interval+fromMonday(wd), hour, min, sec, nsec, loc)
+				if !emit(t) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func fromMonday(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+func contains(days []time.Weekday, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == wd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func excluded(t time.Time, exdates []time.Time) bool {
+	for _, ex := range exdates {
+		if t.Equal(ex) {
+			return true
+		}
+	}
+
+	return false
+}
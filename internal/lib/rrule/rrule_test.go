@@ -0,0 +1,149 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+)
+
+var msk = time.FixedZone("MSK", 3*60*60)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+		err  bool
+	}{
+		{"FREQ=WEEKLY;BYDAY=TH,TU", "FREQ=WEEKLY;BYDAY=TU,TH", false},
+		{"RRULE:freq=daily;interval=2;count=5", "FREQ=DAILY;INTERVAL=2;COUNT=5", false},
+		{"FREQ=WEEKLY;UNTIL=20241231T235959Z", "FREQ=WEEKLY;UNTIL=20241231T235959Z", false},
+		{"FREQ=WEEKLY;UNTIL=20241231", "FREQ=WEEKLY;UNTIL=20241231T235959", false},
+		{"FREQ=MONTHLY", "", true},
+		{"FREQ=WEEKLY;BYDAY=1TU", "", true},
+		{"FREQ=WEEKLY;COUNT=2;UNTIL=20241231T235959Z", "", true},
+		{"BYDAY=TU", "", true},
+		{"FREQ=WEEKLY;BYSETPOS=1", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if tt.err {
+				if !errors.Is(err, errs.ErrInvalidRRule) {
+					t.Errorf("Parse() error = %v, want %v", err, errs.ErrInvalidRRule)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	// Tuesday.
+	dtstart := time.Date(2024, 9, 3, 10, 0, 0, 0, msk)
+	day := func(d int) time.Time { return time.Date(2024, 9, d, 10, 0, 0, 0, msk) }
+
+	tests := []struct {
+		name    string
+		rule    string
+		exdates []time.Time
+		want    []time.Time
+	}{
+		{"weekly", "FREQ=WEEKLY", nil, []time.Time{day(3), day(10), day(17), day(24)}},
+		{"by day", "FREQ=WEEKLY;BYDAY=MO,TU,TH", nil, []time.Time{day(3), day(5), day(9), day(10), day(12), day(16), day(17), day(19), day(23), day(24), day(26)}},
+		{"interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,FR", nil, []time.Time{day(3), day(6), day(17), day(20)}},
+		{"count", "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=3", nil, []time.Time{day(3), day(5), day(10)}},
+		{"count with exdate", "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=3", []time.Time{day(5)}, []time.Time{day(3), day(10)}},
+		{"until", "FREQ=WEEKLY;UNTIL=20240917T070000Z", nil, []time.Time{day(3), day(10), day(17)}},
+		{"floating until", "FREQ=WEEKLY;UNTIL=20240916", nil, []time.Time{day(3), day(10)}},
+		{"daily by day", "FREQ=DAILY;BYDAY=SA,SU", nil, []time.Time{day(7), day(8), day(14), day(15), day(21), day(22), day(28), day(29)}},
+		{"exdates", "FREQ=WEEKLY", []time.Time{day(10), day(24)}, []time.Time{day(3), day(17)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			got := r.Between(dtstart, day(1), day(30), tt.exdates)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Between() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("Between()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAfter(t *testing.T) {
+	dtstart := time.Date(2024, 9, 3, 10, 0, 0, 0, msk)
+
+	r, err := Parse("FREQ=WEEKLY;BYDAY=TU;COUNT=2")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	next, ok := r.After(dtstart, dtstart, nil)
+	if !ok || !next.Equal(dtstart.AddDate(0, 0, 7)) {
+		t.Errorf("After() = %v, %v, want the second Tuesday", next, ok)
+	}
+
+	if _, ok := r.After(dtstart, next, nil); ok {
+		t.Error("After() the last occurrence is true, want the series to be over")
+	}
+
+	if !r.Includes(dtstart, next, nil) || r.Includes(dtstart, next.Add(time.Hour), nil) {
+		t.Error("Includes() does not match the occurrences")
+	}
+}
+
+func TestBetweenAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clocks go forward on 31 March 2024 and back on 27 October 2024.
+	dtstart := time.Date(2024, 3, 19, 10, 0, 0, 0, berlin)
+
+	r, err := Parse("FREQ=WEEKLY;BYDAY=TU;COUNT=3")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got := r.Between(dtstart, dtstart, dtstart.AddDate(0, 1, 0), nil)
+	want := []time.Time{
+		time.Date(2024, 3, 19, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 26, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 2, 8, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Between() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) || got[i].In(berlin).Hour() != 10 {
+			t.Errorf("Between()[%d] = %v, want %v at 10:00 in Berlin", i, got[i], want[i])
+		}
+	}
+
+	autumn := time.Date(2024, 10, 22, 10, 0, 0, 0, berlin)
+	if next, ok := r.After(autumn, autumn, nil); !ok || !next.Equal(time.Date(2024, 10, 29, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("After() = %v, %v, want 10:00 in Berlin after the clocks go back", next, ok)
+	}
+}
@@ -28,10 +28,13 @@ type UserSaver interface {
 	SaveUser(email, userType string, passHash []byte) (string, error)
 	UpdatePassword(email string, passHash []byte) error
 	DeleteUser(email string) error
+	SaveFeedToken(userID int, tokenHash []byte) error
+	DeleteFeedToken(userID int) error
 }
 
 type UserProvider interface {
 	User(email string) (models.User, error)
+	FeedUser(tokenHash []byte) (models.User, error)
 }
 
 func New(log *slog.Logger, userSaver UserSaver, userProvider UserProvider, tokenTTL time.Duration, secret string) *AuthService {
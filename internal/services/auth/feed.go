@@ -0,0 +1,87 @@
+package authservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+const feedTokenBytes = 32
+
+// IssueFeedToken creates a calendar feed token for the user, replacing the
+// previous one. Unlike the JWT it doesn't expire and only opens the feed, so
+// it can be left in a calendar subscription URL. Only its hash is stored.
+func (s *AuthService) IssueFeedToken(userID int) (string, error) {
+	const op = "service.auth.IssueFeedToken"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("user_id", userID),
+	)
+
+	b := make([]byte, feedTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		log.Error("failed to generate feed token", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token := hex.EncodeToString(b)
+
+	if err := s.userSaver.SaveFeedToken(userID, feedTokenHash(token)); err != nil {
+		log.Error("failed to save feed token", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("feed token issued")
+
+	return token, nil
+}
+
+func (s *AuthService) RevokeFeedToken(userID int) error {
+	const op = "service.auth.RevokeFeedToken"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("user_id", userID),
+	)
+
+	if err := s.userSaver.DeleteFeedToken(userID); err != nil {
+		log.Error("failed to delete feed token", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("feed token revoked")
+
+	return nil
+}
+
+// FeedUser returns the owner of a calendar feed token.
+func (s *AuthService) FeedUser(token string) (models.User, error) {
+	const op = "service.auth.FeedUser"
+
+	if token == "" {
+		return models.User{}, fmt.Errorf("%s: %w", op, errs.ErrInvalidCredentials)
+	}
+
+	user, err := s.userProvider.FeedUser(feedTokenHash(token))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func feedTokenHash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+
+	return sum[:]
+}
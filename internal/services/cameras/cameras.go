@@ -1,34 +1,56 @@
 package cameraservice
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/lithammer/shortuuid/v3"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
 	"github.com/zanzhit/studio_recorder/internal/domain/models"
 	"github.com/zanzhit/studio_recorder/internal/lib/sl"
 )
 
 type CameraService struct {
-	log         *slog.Logger
-	videosPath  string
-	cameraSaver CameraSaver
+	log            *slog.Logger
+	videosPath     string
+	cameraSaver    CameraSaver
+	cameraProvider CameraProvider
+	prober         Prober
+	events         Publisher
 }
 
 type CameraSaver interface {
 	SaveCamera(cam models.Camera) (models.Camera, error)
 }
 
-func New(log *slog.Logger, videosPath string, cameraSaver CameraSaver) *CameraService {
+type CameraProvider interface {
+	Cameras() ([]models.Camera, error)
+}
+
+type Prober interface {
+	Probe(uri string) (audio bool, err error)
+}
+
+type Publisher interface {
+	Publish(event models.Event)
+}
+
+func New(log *slog.Logger, videosPath string, cameraSaver CameraSaver, cameraProvider CameraProvider, prober Prober, events Publisher) *CameraService {
 	return &CameraService{
-		log:         log,
-		videosPath:  videosPath,
-		cameraSaver: cameraSaver,
+		log:            log,
+		videosPath:     videosPath,
+		cameraSaver:    cameraSaver,
+		cameraProvider: cameraProvider,
+		prober:         prober,
+		events:         events,
 	}
 }
 
-func (s *CameraService) SaveCamera(cameraIP, location string, hasAudio bool) (models.Camera, error) {
+func (s *CameraService) SaveCamera(cameraIP, location string, hasAudio bool, profileID string, preRollSeconds int) (models.Camera, error) {
 	const op = "service.cameras.SaveCamera"
 
 	log := s.log.With(
@@ -39,10 +61,14 @@ func (s *CameraService) SaveCamera(cameraIP, location string, hasAudio bool) (mo
 	log.Info("save camera", slog.String("camera_ip", cameraIP))
 
 	cam := models.Camera{
-		CameraID: shortuuid.New(),
-		CameraIP: cameraIP,
-		Location: location,
-		HasAudio: hasAudio,
+		CameraID:       shortuuid.New(),
+		CameraIP:       cameraIP,
+		Location:       location,
+		HasAudio:       hasAudio,
+		PreRollSeconds: preRollSeconds,
+	}
+	if profileID != "" {
+		cam.ProfileID = &profileID
 	}
 
 	cam, err := s.cameraSaver.SaveCamera(cam)
@@ -60,5 +86,95 @@ func (s *CameraService) SaveCamera(cameraIP, location string, hasAudio bool) (mo
 		return models.Camera{}, err
 	}
 
+	s.events.Publish(models.Event{Type: constants.EventCameraAdded, CameraIDs: []string{cam.CameraID}, Data: cam})
+
 	return cam, nil
 }
+
+// maxProbes bounds the cameras probed at once, so a slow camera doesn't
+// delay the check of the others and a large site doesn't open a connection
+// to every camera together.
+const maxProbes = 8
+
+// Monitor probes every camera once per interval and publishes an event when a
+// camera goes offline or comes back. It runs until ctx is done.
+func (s *CameraService) Monitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	online := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		online = s.check(ctx, online)
+	}
+}
+
+func (s *CameraService) check(ctx context.Context, online map[string]bool) map[string]bool {
+	const op = "service.cameras.check"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	cams, err := s.cameraProvider.Cameras()
+	if err != nil {
+		log.Error("failed to get cameras", sl.Err(err))
+
+		return online
+	}
+
+	probeErrs := make([]error, len(cams))
+	sem := make(chan struct{}, maxProbes)
+
+	var wg sync.WaitGroup
+	for i, cam := range cams {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+
+			return online
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, uri string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, probeErrs[i] = s.prober.Probe(uri)
+		}(i, cam.CameraIP)
+	}
+	wg.Wait()
+
+	next := make(map[string]bool, len(cams))
+	for i, cam := range cams {
+		up := probeErrs[i] == nil
+		next[cam.CameraID] = up
+
+		// Cameras seen for the first time are only reported when offline.
+		was, known := online[cam.CameraID]
+		if (known && was == up) || (!known && up) {
+			continue
+		}
+
+		eventType := constants.EventCameraOnline
+		if !up {
+			eventType = constants.EventCameraOffline
+
+			log.Warn("camera is offline", slog.String("camera_id", cam.CameraID), sl.Err(probeErrs[i]))
+		}
+
+		s.events.Publish(models.Event{Type: eventType, CameraIDs: []string{cam.CameraID}})
+	}
+
+	return next
+}
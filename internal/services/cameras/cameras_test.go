@@ -0,0 +1,111 @@
+package cameraservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+type stubCameras []models.Camera
+
+func (c stubCameras) Cameras() ([]models.Camera, error) {
+	return c, nil
+}
+
+// slowProber takes a while per camera and records how many probes ran at
+// once.
+type slowProber struct {
+	offline map[string]bool
+
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (p *slowProber) Probe(uri string) (bool, error) {
+	p.mu.Lock()
+	p.running++
+	p.peak = max(p.peak, p.running)
+	p.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	p.mu.Lock()
+	p.running--
+	p.mu.Unlock()
+
+	if p.offline[uri] {
+		return false, errors.New("connection refused")
+	}
+
+	return false, nil
+}
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []models.Event
+}
+
+func (r *recordedEvents) Publish(ev models.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, ev)
+}
+
+func TestCheckProbesConcurrently(t *testing.T) {
+	var cams stubCameras
+	for i := 0; i < 3*maxProbes; i++ {
+		cams = append(cams, models.Camera{CameraID: fmt.Sprintf("cam%d", i), CameraIP: fmt.Sprintf("rtsp://cam%d", i)})
+	}
+
+	prober := &slowProber{offline: map[string]bool{"rtsp://cam5": true}}
+	events := &recordedEvents{}
+	s := New(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir(), nil, cams, prober, events)
+
+	started := time.Now()
+	online := s.check(context.Background(), make(map[string]bool))
+
+	// Three rounds of probes, not one per camera.
+	if elapsed := time.Since(started); elapsed > time.Duration(len(cams))*20*time.Millisecond/2 {
+		t.Errorf("check() took %v, want the cameras probed concurrently", elapsed)
+	}
+	if prober.peak > maxProbes {
+		t.Errorf("probes at once = %d, want at most %d", prober.peak, maxProbes)
+	}
+
+	if len(online) != len(cams) || online["cam5"] || !online["cam0"] {
+		t.Errorf("check() = %v, want every camera but cam5 online", online)
+	}
+
+	if len(events.events) != 1 || events.events[0].Type != constants.EventCameraOffline || events.events[0].CameraIDs[0] != "cam5" {
+		t.Errorf("events = %+v, want cam5 offline", events.events)
+	}
+}
+
+func TestMonitorStops(t *testing.T) {
+	s := New(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir(), nil, stubCameras{}, &slowProber{}, &recordedEvents{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Monitor(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Monitor() did not return after the context was canceled")
+	}
+}
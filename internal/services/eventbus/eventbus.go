@@ -0,0 +1,122 @@
+package eventbus
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber
+// that doesn't keep up loses events instead of stalling the publisher.
+type Bus struct {
+	log    *slog.Logger
+	buffer int
+
+	mu     sync.Mutex
+	lastID uint64
+	subs   map[chan models.Event]filter
+	closed bool
+}
+
+type filter struct {
+	cameraID    string
+	recordingID string
+	userID      int
+}
+
+func (f filter) match(ev models.Event) bool {
+	if f.userID != 0 && ev.UserID != 0 && ev.UserID != f.userID {
+		return false
+	}
+
+	if f.recordingID != "" && ev.RecordingID != f.recordingID {
+		return false
+	}
+
+	if f.cameraID == "" {
+		return true
+	}
+
+	for _, id := range ev.CameraIDs {
+		if id == f.cameraID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func New(log *slog.Logger, buffer int) *Bus {
+	return &Bus{
+		log:    log,
+		buffer: buffer,
+		subs:   make(map[chan models.Event]filter),
+	}
+}
+
+func (b *Bus) Publish(ev models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev.ID = b.lastID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	for ch, f := range b.subs {
+		if !f.match(ev) {
+			continue
+		}
+
+		select {
+		case ch <- ev:
+		default:
+			b.log.Warn("subscriber is too slow, event dropped", slog.String("type", ev.Type), slog.Uint64("id", ev.ID))
+		}
+	}
+}
+
+// Subscribe returns the events of a camera and/or a recording, all events when
+// both are empty. A userID other than 0 leaves out the events of other users.
+// The channel is closed by cancel or when the bus is closed.
+func (b *Bus) Subscribe(cameraID, recordingID string, userID int) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, b.buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+
+		return ch, func() {}
+	}
+
+	b.subs[ch] = filter{cameraID: cameraID, recordingID: recordingID, userID: userID}
+
+	return ch, func() { b.unsubscribe(ch) }
+}
+
+func (b *Bus) unsubscribe(ch chan models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Close ends all subscriptions, so streaming clients disconnect on shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,92 @@
+package eventbus
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func newTestBus(buffer int) *Bus {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), buffer)
+}
+
+func TestFilters(t *testing.T) {
+	bus := newTestBus(8)
+
+	all, cancelAll := bus.Subscribe("", "", 0)
+	defer cancelAll()
+	camera, cancelCamera := bus.Subscribe("cam2", "", 0)
+	defer cancelCamera()
+	recording, cancelRecording := bus.Subscribe("", "rec1", 0)
+	defer cancelRecording()
+	user, cancelUser := bus.Subscribe("", "", 7)
+	defer cancelUser()
+
+	bus.Publish(models.Event{Type: constants.EventRecordingStarted, RecordingID: "rec1", UserID: 7, CameraIDs: []string{"cam1", "cam2"}})
+	bus.Publish(models.Event{Type: constants.EventRecordingStarted, RecordingID: "rec2", UserID: 8, CameraIDs: []string{"cam1"}})
+	bus.Publish(models.Event{Type: constants.EventCameraOffline, CameraIDs: []string{"cam2"}})
+
+	tests := []struct {
+		name string
+		ch   <-chan models.Event
+		want []uint64
+	}{
+		{name: "all", ch: all, want: []uint64{1, 2, 3}},
+		{name: "camera", ch: camera, want: []uint64{1, 3}},
+		{name: "recording", ch: recording, want: []uint64{1}},
+		// Camera events belong to no user.
+		{name: "user", ch: user, want: []uint64{1, 3}},
+	}
+
+	for _, tt := range tests {
+		var got []uint64
+		for len(tt.ch) > 0 {
+			ev := <-tt.ch
+			if ev.Time.IsZero() {
+				t.Errorf("%s: event %d has no time", tt.name, ev.ID)
+			}
+			got = append(got, ev.ID)
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSlowSubscriberAndClose(t *testing.T) {
+	bus := newTestBus(1)
+
+	slow, cancel := bus.Subscribe("", "", 0)
+
+	bus.Publish(models.Event{Type: constants.EventCameraOffline})
+	bus.Publish(models.Event{Type: constants.EventCameraOnline})
+
+	if ev := <-slow; ev.Type != constants.EventCameraOffline {
+		t.Errorf("first event = %s, want %s", ev.Type, constants.EventCameraOffline)
+	}
+
+	bus.Close()
+
+	if _, ok := <-slow; ok {
+		t.Error("channel is open after Close()")
+	}
+
+	cancel()
+
+	if ch, _ := bus.Subscribe("", "", 0); ch != nil {
+		if _, ok := <-ch; ok {
+			t.Error("subscription after Close() is open")
+		}
+	}
+}
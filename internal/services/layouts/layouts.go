@@ -0,0 +1,82 @@
+package layoutservice
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/lithammer/shortuuid/v3"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+)
+
+type LayoutService struct {
+	log         *slog.Logger
+	layoutSaver LayoutSaver
+}
+
+type LayoutSaver interface {
+	SaveLayout(l models.Layout) (models.Layout, error)
+	UpdateLayout(l models.Layout) (models.Layout, error)
+}
+
+func New(log *slog.Logger, layoutSaver LayoutSaver) *LayoutService {
+	return &LayoutService{
+		log:         log,
+		layoutSaver: layoutSaver,
+	}
+}
+
+func (s *LayoutService) SaveLayout(l models.Layout) (models.Layout, error) {
+	const op = "service.layouts.SaveLayout"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("name", l.Name),
+	)
+
+	log.Info("save layout")
+
+	if err := layout.Validate(l); err != nil {
+		log.Error("invalid layout", sl.Err(err))
+
+		return models.Layout{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.LayoutID = shortuuid.New()
+
+	l, err := s.layoutSaver.SaveLayout(l)
+	if err != nil {
+		log.Error("failed to save layout", sl.Err(err))
+
+		return models.Layout{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return l, nil
+}
+
+func (s *LayoutService) UpdateLayout(l models.Layout) (models.Layout, error) {
+	const op = "service.layouts.UpdateLayout"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("layout_id", l.LayoutID),
+	)
+
+	log.Info("update layout")
+
+	if err := layout.Validate(l); err != nil {
+		log.Error("invalid layout", sl.Err(err))
+
+		return models.Layout{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	l, err := s.layoutSaver.UpdateLayout(l)
+	if err != nil {
+		log.Error("failed to update layout", sl.Err(err))
+
+		return models.Layout{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return l, nil
+}
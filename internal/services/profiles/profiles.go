@@ -0,0 +1,82 @@
+package profileservice
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/lithammer/shortuuid/v3"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+)
+
+type ProfileService struct {
+	log          *slog.Logger
+	profileSaver ProfileSaver
+}
+
+type ProfileSaver interface {
+	SaveProfile(p models.Profile) (models.Profile, error)
+	UpdateProfile(p models.Profile) (models.Profile, error)
+}
+
+func New(log *slog.Logger, profileSaver ProfileSaver) *ProfileService {
+	return &ProfileService{
+		log:          log,
+		profileSaver: profileSaver,
+	}
+}
+
+func (s *ProfileService) SaveProfile(p models.Profile) (models.Profile, error) {
+	const op = "service.profiles.SaveProfile"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("name", p.Name),
+	)
+
+	log.Info("save profile")
+
+	if err := profile.Validate(p); err != nil {
+		log.Error("invalid profile", sl.Err(err))
+
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.ProfileID = shortuuid.New()
+
+	p, err := s.profileSaver.SaveProfile(p)
+	if err != nil {
+		log.Error("failed to save profile", sl.Err(err))
+
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p, nil
+}
+
+func (s *ProfileService) UpdateProfile(p models.Profile) (models.Profile, error) {
+	const op = "service.profiles.UpdateProfile"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("profile_id", p.ProfileID),
+	)
+
+	log.Info("update profile")
+
+	if err := profile.Validate(p); err != nil {
+		log.Error("invalid profile", sl.Err(err))
+
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p, err := s.profileSaver.UpdateProfile(p)
+	if err != nil {
+		log.Error("failed to update profile", sl.Err(err))
+
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,286 @@
+package recordingservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// StartSession records every camera to its own file instead of mixing them.
+// The recordings share the session and its start as their clock reference.
+// If one camera fails, the angles already started are stopped. A session
+// none of whose angles started is deleted.
+func (s *RecordingService) StartSession(cameraIDs []string, userID int, opts models.RecordingOptions) (models.Session, error) {
+	const op = "service.recordings.StartSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("camera_id", strings.Join(cameraIDs, ", ")),
+		slog.Int("user_id", userID),
+	)
+
+	// Every angle is a single camera, there is nothing to mix.
+	opts.Layout, opts.LayoutID, opts.AudioCameraID = "", "", ""
+
+	for _, cameraID := range cameraIDs {
+		if err := s.checkOptions([]string{cameraID}, opts); err != nil {
+			return models.Session{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Checked up front, so no angle is started when one camera is busy.
+	if err := s.checkFree(cameraIDs, opts.Force); err != nil {
+		log.Error("cameras are busy", sl.Err(err))
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := models.Session{
+		SessionID: uuid.New().String(),
+		UserID:    userID,
+		StartTime: time.Now(),
+	}
+
+	log = log.With(slog.String("session_id", session.SessionID))
+
+	if err := s.recordingSaver.SaveSession(session); err != nil {
+		log.Error("failed to save session", sl.Err(err))
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	// The angles are started together, so that probing one camera does not
+	// delay the others.
+	recordIDs := make([]string, len(cameraIDs))
+	startErrs := make([]error, len(cameraIDs))
+
+	var wg sync.WaitGroup
+	for i, cameraID := range cameraIDs {
+		rec := models.Recording{
+			RecordingID:  uuid.New().String(),
+			UserID:       userID,
+			SessionID:    session.SessionID,
+			SessionIndex: i,
+		}
+		recordIDs[i] = rec.RecordingID
+
+		wg.Add(1)
+		go func(i int, rec models.Recording, cameraID string) {
+			defer wg.Done()
+
+			startErrs[i] = s.start(rec, []string{cameraID}, opts, time.Time{})
+		}(i, rec, cameraID)
+	}
+	wg.Wait()
+
+	if err := errors.Join(startErrs...); err != nil {
+		log.Error("failed to start session", sl.Err(err))
+
+		var started int
+		for i, recordID := range recordIDs {
+			if startErrs[i] != nil {
+				continue
+			}
+
+			started++
+
+			if err := s.Stop(recordID); err != nil {
+				log.Error("failed to stop angle", slog.String("record_id", recordID), sl.Err(err))
+			}
+		}
+
+		if started == 0 {
+			if err := s.recordingSaver.DeleteSession(session.SessionID); err != nil {
+				log.Error("failed to delete session", sl.Err(err))
+			}
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session, err := s.Session(session.SessionID)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// StopSession stops every angle of the session that is still running.
+func (s *RecordingService) StopSession(sessionID string) error {
+	const op = "service.recordings.StopSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("session_id", sessionID),
+	)
+
+	session, err := s.Session(sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var stopped int
+	var stopErr error
+	for _, angle := range session.Angles {
+		if angle.Status != constants.StatusRecording && angle.Status != constants.StatusPaused {
+			continue
+		}
+
+		if err := s.Stop(angle.RecordingID); err != nil {
+			log.Error("failed to stop angle", slog.String("record_id", angle.RecordingID), sl.Err(err))
+
+			stopErr = errors.Join(stopErr, err)
+
+			continue
+		}
+
+		stopped++
+	}
+
+	if stopErr != nil {
+		return fmt.Errorf("%s: %w", op, stopErr)
+	}
+
+	if stopped == 0 {
+		log.Error("session is not running")
+
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotActive)
+	}
+
+	return nil
+}
+
+// Session returns the session with its angles in camera order.
+func (s *RecordingService) Session(sessionID string) (models.Session, error) {
+	const op = "service.recordings.Session"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("session_id", sessionID),
+	)
+
+	session, err := s.recordingProvider.Session(sessionID)
+	if err != nil {
+		log.Error("failed to get session", sl.Err(err))
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	recs, err := s.recordingProvider.SessionRecordings(sessionID)
+	if err != nil {
+		log.Error("failed to get session recordings", sl.Err(err))
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.Angles = make([]models.Angle, 0, len(recs))
+	for _, rec := range recs {
+		session.Angles = append(session.Angles, models.Angle{
+			Recording: rec,
+			Offset:    rec.StartTime.Sub(session.StartTime).Seconds(),
+		})
+	}
+
+	return session, nil
+}
+
+// MoveSession uploads all angles of a finished session as one event of the
+// video service.
+func (s *RecordingService) MoveSession(sessionID string) error {
+	const op = "service.recordings.MoveSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("session_id", sessionID),
+	)
+
+	log.Info("move session")
+
+	session, err := s.Session(sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(session.Angles) == 0 {
+		log.Error("session has no recordings")
+
+		return fmt.Errorf("%s: %w", op, errs.ErrSessionNotFound)
+	}
+
+	// restore puts back the status of the angles already marked as
+	// uploading.
+	restore := func(angles []models.Angle) {
+		for _, angle := range angles {
+			if err := s.recordingSaver.SetStatus(angle.RecordingID, constants.StatusUploading, angle.Status); err != nil {
+				log.Error("failed to restore recording status", slog.String("record_id", angle.RecordingID), sl.Err(err))
+			}
+		}
+	}
+
+	// The event lasts as long as the longest angle.
+	var duration time.Duration
+	for _, angle := range session.Angles {
+		recorded, err := s.recorded(angle.Recording)
+		if err != nil {
+			log.Error("failed to get recording duration", slog.String("record_id", angle.RecordingID), sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		duration = max(duration, recorded)
+	}
+
+	files := make([][]string, len(session.Angles))
+	cameraIDs := make([]string, len(session.Angles))
+	for i, angle := range session.Angles {
+		if err := s.setStatus(angle.Recording, constants.StatusUploading); err != nil {
+			log.Error("recording can't be moved", slog.String("record_id", angle.RecordingID), slog.String("status", angle.Status), sl.Err(err))
+
+			restore(session.Angles[:i])
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		files[i] = s.files(angle.Recording)
+		cameraIDs[i] = angle.CameraID
+	}
+
+	for _, angle := range session.Angles {
+		s.publish(constants.EventUploadStarted, angle.RecordingID, angle.UserID, cameraIDs, nil)
+	}
+
+	if err := s.videoService.MoveSession(session, files, duration); err != nil {
+		log.Error("failed to move session", sl.Err(err))
+
+		for _, angle := range session.Angles {
+			s.publish(constants.EventUploadFailed, angle.RecordingID, angle.UserID, cameraIDs, nil)
+		}
+
+		restore(session.Angles)
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var moveErr error
+	for _, angle := range session.Angles {
+		s.publish(constants.EventUploadFinished, angle.RecordingID, angle.UserID, cameraIDs, nil)
+
+		if err := s.recordingProvider.Move(angle.RecordingID, constants.StatusUploading, constants.StatusUploaded); err != nil {
+			log.Error("failed to write move data", slog.String("record_id", angle.RecordingID), sl.Err(err))
+
+			moveErr = errs.ErrWriteToDB
+		}
+	}
+
+	return moveErr
+}
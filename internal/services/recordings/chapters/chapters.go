@@ -0,0 +1,76 @@
+package chapters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+// Chapter is the part of the recording between a marker and the next one.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// FromMarkers turns markers into chapters of a recording of the given
+// duration. The last chapter ends with the recording, markers past its end
+// and chapters without length are left out.
+func FromMarkers(markers []models.Marker, duration time.Duration) []Chapter {
+	sorted := make([]models.Marker, len(markers))
+	copy(sorted, markers)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	var chapters []Chapter
+	for i, m := range sorted {
+		start := seconds(m.Offset)
+		end := duration
+		if i+1 < len(sorted) {
+			end = min(seconds(sorted[i+1].Offset), duration)
+		}
+
+		if end <= start {
+			continue
+		}
+
+		chapters = append(chapters, Chapter{Title: m.Label, Start: start, End: end})
+	}
+
+	return chapters
+}
+
+// WriteWebVTT writes the chapters as a WebVTT chapter track.
+func WriteWebVTT(w io.Writer, chapters []Chapter) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprint(bw, "WEBVTT\n")
+	for i, ch := range chapters {
+		fmt.Fprintf(bw, "\n%d\n%s --> %s\n%s\n", i+1, timestamp(ch.Start), timestamp(ch.End), cueText(ch.Title))
+	}
+
+	return bw.Flush()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+// timestamp formats d as hh:mm:ss.ttt.
+func timestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// cueText keeps the title on one line, a blank line or an arrow would end
+// the cue early.
+func cueText(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+
+	return strings.ReplaceAll(title, "-->", "->")
+}
@@ -0,0 +1,54 @@
+package chapters
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func TestFromMarkers(t *testing.T) {
+	markers := []models.Marker{
+		{Label: "slide 12", Offset: 90.5},
+		{Label: "intro", Offset: 0},
+		{Label: "same moment", Offset: 90.5},
+		{Label: "after the end", Offset: 700},
+	}
+
+	got := FromMarkers(markers, 10*time.Minute)
+
+	want := []Chapter{
+		{Title: "intro", Start: 0, End: 90500 * time.Millisecond},
+		{Title: "same moment", Start: 90500 * time.Millisecond, End: 10 * time.Minute},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("FromMarkers() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chapter %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteWebVTT(t *testing.T) {
+	chapters := []Chapter{
+		{Title: "intro", Start: 0, End: 90500 * time.Millisecond},
+		{Title: "question\n\nfrom --> audience", Start: 90500 * time.Millisecond, End: time.Hour + 2*time.Second},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWebVTT(&buf, chapters); err != nil {
+		t.Fatalf("WriteWebVTT() error = %v", err)
+	}
+
+	want := "WEBVTT\n" +
+		"\n1\n00:00:00.000 --> 00:01:30.500\nintro\n" +
+		"\n2\n00:01:30.500 --> 01:00:02.000\nquestion from -> audience\n"
+
+	if buf.String() != want {
+		t.Errorf("WriteWebVTT() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,145 @@
+package recordingservice
+
+import (
+	"slices"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+// reserve claims the cameras in s.starting for a recording that is being
+// started, so two pipelines never pull the same stream. Cameras of a running recording, or
+// of one being started, are a conflict unless the recording is forced. An
+// ad-hoc recording must not run into a booking either. The bookings are
+// looked up before s.mu is taken, and looked up again if they changed before
+// the claim, so a booking saved in between is not missed.
+func (s *RecordingService) reserve(recordID string, cameraIDs []string, force, adHoc bool) error {
+	for {
+		version, err := s.checkBookings(cameraIDs, force || !adHoc)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if !force {
+			if conflicts := s.busy(cameraIDs); len(conflicts) > 0 {
+				s.mu.Unlock()
+
+				return &errs.ConflictError{Conflicts: conflicts}
+			}
+		}
+
+		if s.bookingsChanged(version, force || !adHoc) {
+			s.mu.Unlock()
+
+			continue
+		}
+
+		s.starting[recordID] = cameraIDs
+		s.mu.Unlock()
+
+		return nil
+	}
+}
+
+// release drops the claim of reserve. A recording that started is held by
+// its session from then on.
+func (s *RecordingService) release(recordID string) {
+	s.mu.Lock()
+	delete(s.starting, recordID)
+	s.mu.Unlock()
+}
+
+// checkFree rejects cameras that are recorded or booked, unless forced.
+func (s *RecordingService) checkFree(cameraIDs []string, force bool) error {
+	if force {
+		return nil
+	}
+
+	if _, err := s.checkBookings(cameraIDs, false); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conflicts := s.busy(cameraIDs); len(conflicts) > 0 {
+		return &errs.ConflictError{Conflicts: conflicts}
+	}
+
+	return nil
+}
+
+// checkBookings rejects cameras that are booked for now, unless skip is set,
+// and returns the version of the bookings it saw. It queries the database,
+// so s.mu must not be held.
+func (s *RecordingService) checkBookings(cameraIDs []string, skip bool) (uint64, error) {
+	if skip || s.bookings == nil {
+		return 0, nil
+	}
+
+	version := s.bookings.BookingsVersion()
+
+	return version, s.bookings.CheckBookings(cameraIDs)
+}
+
+// bookingsChanged reports whether a booking was saved since checkBookings
+// saw version.
+func (s *RecordingService) bookingsChanged(version uint64, skip bool) bool {
+	if skip || s.bookings == nil {
+		return false
+	}
+
+	return s.bookings.BookingsVersion() != version
+}
+
+// Running returns the recordings of the cameras that run or are being
+// started, one conflict per camera. Recordings without a stop time run until
+// they are stopped.
+func (s *RecordingService) Running(cameraIDs []string) []models.Conflict {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.busy(cameraIDs)
+}
+
+// busy returns the recordings of the cameras that run or are being started.
+// s.mu must be held.
+func (s *RecordingService) busy(cameraIDs []string) []models.Conflict {
+	var conflicts []models.Conflict
+
+	for recordID, sess := range s.commands {
+		for _, cameraID := range sess.cameraIDs {
+			if !slices.Contains(cameraIDs, cameraID) {
+				continue
+			}
+
+			c := models.Conflict{
+				CameraID:    cameraID,
+				RecordingID: recordID,
+				UserID:      sess.rec.UserID,
+				StartTime:   sess.rec.StartTime,
+			}
+			if !sess.until.IsZero() {
+				until := sess.until
+				c.StopTime = &until
+			}
+
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	for recordID, ids := range s.starting {
+		if _, started := s.commands[recordID]; started {
+			continue
+		}
+
+		for _, cameraID := range ids {
+			if slices.Contains(cameraIDs, cameraID) {
+				conflicts = append(conflicts, models.Conflict{CameraID: cameraID, RecordingID: recordID})
+			}
+		}
+	}
+
+	return conflicts
+}
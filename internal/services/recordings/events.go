@@ -0,0 +1,27 @@
+package recordingservice
+
+import (
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func (s *RecordingService) publish(eventType, recordID string, userID int, cameraIDs []string, data interface{}) {
+	s.events.Publish(models.Event{
+		Type:        eventType,
+		RecordingID: recordID,
+		UserID:      userID,
+		CameraIDs:   cameraIDs,
+		Data:        data,
+	})
+}
+
+func finishEvent(status string) string {
+	switch status {
+	case constants.StatusStopped:
+		return constants.EventRecordingStopped
+	case constants.StatusInterrupted:
+		return constants.EventRecordingInterrupted
+	default:
+		return constants.EventRecordingFailed
+	}
+}
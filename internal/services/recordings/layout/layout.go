@@ -0,0 +1,170 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+const (
+	Grid             = "grid"
+	SideBySide       = "side_by_side"
+	PictureInPicture = "pip"
+	MainStrip        = "main_strip"
+)
+
+const DefaultBorderColor = "#FFFFFF"
+
+type Slot = models.LayoutSlot
+
+type Layout struct {
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Background string `json:"background,omitempty"`
+	Slots      []Slot `json:"slots"`
+}
+
+// Named places n sources on a width x height canvas using one of the built-in
+// layouts. Sources keep their order: slot i shows camera i.
+func Named(name string, n, width, height int) (Layout, error) {
+	if n < 1 {
+		return Layout{}, fmt.Errorf("layout %s: no sources", name)
+	}
+
+	l := Layout{Width: width, Height: height}
+
+	switch name {
+	case Grid:
+		cols := int(math.Ceil(math.Sqrt(float64(n))))
+		rows := (n + cols - 1) / cols
+		l.Slots = grid(n, cols, rows, 0, 0, width, height)
+	case SideBySide:
+		l.Slots = grid(n, n, 1, 0, 0, width, height)
+	case PictureInPicture:
+		l.Slots = append(l.Slots, Slot{Width: width, Height: height})
+
+		// Insets fill the bottom row from the right, then the rows above.
+		w, h := width/4, height/4
+		margin := height / 40
+		cols := max((width-margin)/(w+margin), 1)
+		rows := max((height-margin)/(h+margin), 1)
+		if n-1 > cols*rows {
+			return Layout{}, fmt.Errorf("%w: %s fits %d cameras", errs.ErrInvalidLayout, name, cols*rows+1)
+		}
+
+		for i := 0; i < n-1; i++ {
+			l.Slots = append(l.Slots, Slot{
+				X:      width - (i%cols+1)*(w+margin),
+				Y:      height - (i/cols+1)*(h+margin),
+				Width:  w,
+				Height: h,
+				ZOrder: 1,
+			})
+		}
+	case MainStrip:
+		if n == 1 {
+			l.Slots = []Slot{{Width: width, Height: height}}
+
+			break
+		}
+
+		stripWidth := width / 4
+		l.Slots = append(l.Slots, Slot{Width: width - stripWidth, Height: height})
+		l.Slots = append(l.Slots, grid(n-1, 1, n-1, width-stripWidth, 0, stripWidth, height)...)
+	default:
+		return Layout{}, fmt.Errorf("%w: %s", errs.ErrUnknownLayout, name)
+	}
+
+	return l, nil
+}
+
+func grid(n, cols, rows, x, y, width, height int) []Slot {
+	w, h := width/cols, height/rows
+
+	slots := make([]Slot, 0, n)
+	for i := 0; i < n; i++ {
+		slots = append(slots, Slot{
+			X:      x + (i%cols)*w,
+			Y:      y + (i/cols)*h,
+			Width:  w,
+			Height: h,
+		})
+	}
+
+	return slots
+}
+
+// Custom places n sources into the first n slots of a stored layout.
+func Custom(m models.Layout, n int) (Layout, error) {
+	if err := Validate(m); err != nil {
+		return Layout{}, err
+	}
+
+	if len(m.Slots) < n {
+		return Layout{}, fmt.Errorf("%w: %s has %d slots for %d cameras", errs.ErrInvalidLayout, m.Name, len(m.Slots), n)
+	}
+
+	return Layout{
+		Width:      m.Width,
+		Height:     m.Height,
+		Background: m.Background,
+		Slots:      m.Slots[:n],
+	}, nil
+}
+
+func Validate(m models.Layout) error {
+	if m.Width <= 0 || m.Height <= 0 {
+		return fmt.Errorf("%w: size must be positive", errs.ErrInvalidLayout)
+	}
+
+	if len(m.Slots) == 0 {
+		return fmt.Errorf("%w: no slots", errs.ErrInvalidLayout)
+	}
+
+	if m.Background != "" {
+		if _, err := Color(m.Background); err != nil {
+			return err
+		}
+	}
+
+	for i, slot := range m.Slots {
+		if slot.Width <= 0 || slot.Height <= 0 || slot.ZOrder < 0 || slot.Border < 0 {
+			return fmt.Errorf("%w: slot %d has negative or empty size", errs.ErrInvalidLayout, i)
+		}
+
+		if slot.X < 0 || slot.Y < 0 || slot.X+slot.Width > m.Width || slot.Y+slot.Height > m.Height {
+			return fmt.Errorf("%w: slot %d is outside the %dx%d canvas", errs.ErrInvalidLayout, i, m.Width, m.Height)
+		}
+
+		if slot.BorderColor != "" {
+			if _, err := Color(slot.BorderColor); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Color parses a "#RRGGBB" or "#RGB" colour into 0xRRGGBB.
+func Color(s string) (uint32, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) != 6 || !strings.HasPrefix(s, "#") {
+		return 0, fmt.Errorf("%w: bad colour %q", errs.ErrInvalidLayout, s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad colour %q", errs.ErrInvalidLayout, s)
+	}
+
+	return uint32(v), nil
+}
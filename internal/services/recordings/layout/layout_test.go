@@ -0,0 +1,131 @@
+package layout
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func TestNamed(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		n      int
+		want   []Slot
+	}{
+		{
+			name:   "grid of three",
+			layout: Grid,
+			n:      3,
+			want: []Slot{
+				{X: 0, Y: 0, Width: 640, Height: 360},
+				{X: 640, Y: 0, Width: 640, Height: 360},
+				{X: 0, Y: 360, Width: 640, Height: 360},
+			},
+		},
+		{
+			name:   "main with side strip",
+			layout: MainStrip,
+			n:      3,
+			want: []Slot{
+				{X: 0, Y: 0, Width: 960, Height: 720},
+				{X: 960, Y: 0, Width: 320, Height: 360},
+				{X: 960, Y: 360, Width: 320, Height: 360},
+			},
+		},
+		{
+			name:   "picture in picture wraps insets",
+			layout: PictureInPicture,
+			n:      6,
+			want: []Slot{
+				{X: 0, Y: 0, Width: 1280, Height: 720},
+				{X: 942, Y: 522, Width: 320, Height: 180, ZOrder: 1},
+				{X: 604, Y: 522, Width: 320, Height: 180, ZOrder: 1},
+				{X: 266, Y: 522, Width: 320, Height: 180, ZOrder: 1},
+				{X: 942, Y: 324, Width: 320, Height: 180, ZOrder: 1},
+				{X: 604, Y: 324, Width: 320, Height: 180, ZOrder: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := Named(tt.layout, tt.n, 1280, 720)
+			if err != nil {
+				t.Fatalf("Named() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(l.Slots, tt.want) {
+				t.Errorf("Named() slots = %+v, want %+v", l.Slots, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamedUnknown(t *testing.T) {
+	if _, err := Named("mosaic", 2, 1280, 720); !errors.Is(err, errs.ErrUnknownLayout) {
+		t.Fatalf("Named() error = %v, want %v", err, errs.ErrUnknownLayout)
+	}
+}
+
+func TestNamedTooManyInsets(t *testing.T) {
+	if _, err := Named(PictureInPicture, 11, 1280, 720); !errors.Is(err, errs.ErrInvalidLayout) {
+		t.Fatalf("Named() error = %v, want %v", err, errs.ErrInvalidLayout)
+	}
+}
+
+func TestCustom(t *testing.T) {
+	m := models.Layout{
+		Name:       "lecture",
+		Width:      1920,
+		Height:     1080,
+		Background: "#102030",
+		Slots: []Slot{
+			{Width: 1440, Height: 1080},
+			{X: 1440, Width: 480, Height: 270, Border: 2},
+			{X: 1440, Y: 270, Width: 480, Height: 270},
+		},
+	}
+
+	l, err := Custom(m, 2)
+	if err != nil {
+		t.Fatalf("Custom() error = %v", err)
+	}
+	if len(l.Slots) != 2 || l.Background != m.Background {
+		t.Errorf("Custom() = %+v", l)
+	}
+
+	if _, err := Custom(m, 4); !errors.Is(err, errs.ErrInvalidLayout) {
+		t.Errorf("Custom() with too many cameras error = %v, want %v", err, errs.ErrInvalidLayout)
+	}
+
+	for _, slot := range []Slot{
+		{X: -10, Width: 480, Height: 270},
+		{Y: -1, Width: 480, Height: 270},
+		{X: 1500, Width: 480, Height: 270},
+		{Y: 900, Width: 480, Height: 270},
+	} {
+		outside := m
+		outside.Slots = []Slot{m.Slots[0], slot}
+		if err := Validate(outside); !errors.Is(err, errs.ErrInvalidLayout) {
+			t.Errorf("Validate() with slot %+v error = %v, want %v", slot, err, errs.ErrInvalidLayout)
+		}
+	}
+
+	m.Slots[1].BorderColor = "red"
+	if _, err := Custom(m, 2); !errors.Is(err, errs.ErrInvalidLayout) {
+		t.Errorf("Custom() with bad colour error = %v, want %v", err, errs.ErrInvalidLayout)
+	}
+}
+
+func TestColor(t *testing.T) {
+	for in, want := range map[string]uint32{"#000000": 0, "#FF8000": 0xff8000, "#fff": 0xffffff} {
+		got, err := Color(in)
+		if err != nil || got != want {
+			t.Errorf("Color(%q) = %06x, %v, want %06x", in, got, err, want)
+		}
+	}
+}
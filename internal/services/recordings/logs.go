@@ -0,0 +1,174 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/pipelog"
+)
+
+const sourceSupervisor = "supervisor"
+
+const (
+	eventQueueSize     = 1024
+	eventBatchSize     = 100
+	eventFlushInterval = 500 * time.Millisecond
+)
+
+// logPath is the pipeline log of a recording, kept next to its files.
+func logPath(rec models.Recording) string {
+	return filepath.Join(filepath.Dir(rec.FilePath), rec.RecordingID+".log")
+}
+
+func (s *RecordingService) openLog(rec models.Recording) (*pipelog.Writer, error) {
+	return pipelog.Open(logPath(rec), s.logMaxSize, s.logBackups, func(ev pipelog.Event) {
+		s.saveEvent(rec.RecordingID, ev)
+	})
+}
+
+// saveEvent queues a pipeline event for WriteEvents. It is called for every
+// error line of the pipeline output, so it never waits: events that don't
+// fit in the queue are dropped.
+func (s *RecordingService) saveEvent(recordID string, ev pipelog.Event) {
+	s.log.Debug("pipeline event",
+		slog.String("record_id", recordID),
+		slog.String("level", ev.Level),
+		slog.String("source", ev.Source),
+		slog.String("message", ev.Message),
+	)
+
+	event := models.PipelineEvent{
+		RecordingID: recordID,
+		Time:        time.Now(),
+		Level:       ev.Level,
+		Source:      ev.Source,
+		Message:     ev.Message,
+	}
+
+	select {
+	case s.pipelineEvents <- event:
+	default:
+		s.droppedEvents.Add(1)
+	}
+}
+
+// WriteEvents saves queued pipeline events in batches. It runs until Close.
+func (s *RecordingService) WriteEvents() {
+	defer close(s.closed)
+
+	ticker := time.NewTicker(eventFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.PipelineEvent, 0, eventBatchSize)
+	for {
+		select {
+		case ev := <-s.pipelineEvents:
+			batch = append(batch, ev)
+			if len(batch) < eventBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-s.closing:
+			for {
+				select {
+				case ev := <-s.pipelineEvents:
+					batch = append(batch, ev)
+				default:
+					s.writeEvents(batch)
+
+					return
+				}
+			}
+		}
+
+		s.writeEvents(batch)
+		batch = batch[:0]
+	}
+}
+
+func (s *RecordingService) writeEvents(events []models.PipelineEvent) {
+	log := s.log.With(
+		slog.String("op", "service.recordings.writeEvents"),
+	)
+
+	if dropped := s.droppedEvents.Swap(0); dropped > 0 {
+		log.Warn("pipeline events dropped, queue is full", slog.Int64("dropped", dropped))
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	if err := s.recordingSaver.SaveEvents(events); err != nil {
+		log.Error("failed to save pipeline events", slog.Int("events", len(events)), sl.Err(err))
+	}
+}
+
+// Close saves the queued pipeline events and stops WriteEvents.
+func (s *RecordingService) Close() {
+	s.closeOnce.Do(func() { close(s.closing) })
+	<-s.closed
+}
+
+// Log returns the pipeline log files of a recording, oldest first.
+func (s *RecordingService) Log(recordID string) ([]string, error) {
+	const op = "service.recordings.Log"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rec.FilePath == "" {
+		log.Error("recording was not started")
+
+		return nil, fmt.Errorf("%s: %w", op, errs.ErrLogNotFound)
+	}
+
+	files := pipelog.Files(logPath(rec))
+	if len(files) == 0 {
+		log.Error("log not found")
+
+		return nil, fmt.Errorf("%s: %w", op, errs.ErrLogNotFound)
+	}
+
+	return files, nil
+}
+
+// Events returns the errors and warnings of the recording pipeline, only those
+// of the given level unless it is empty.
+func (s *RecordingService) Events(recordID, level string) ([]models.PipelineEvent, error) {
+	const op = "service.recordings.Events"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	if _, err := s.recordingProvider.Recording(recordID); err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events, err := s.recordingProvider.Events(recordID, level)
+	if err != nil {
+		log.Error("failed to get events", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,208 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/chapters"
+)
+
+// AddMarker bookmarks a moment of a running recording. Without an offset the
+// marker is set at the current position, pauses and gaps are not counted.
+func (s *RecordingService) AddMarker(recordID, label string, offset *float64) (models.Marker, error) {
+	const op = "service.recordings.AddMarker"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return models.Marker{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rec.Status != constants.StatusRecording && rec.Status != constants.StatusPaused {
+		log.Error("recording is not running", slog.String("status", rec.Status))
+
+		return models.Marker{}, fmt.Errorf("%s: %w", op, errs.ErrRecordingNotActive)
+	}
+
+	pauses, err := s.recordingProvider.Pauses(recordID)
+	if err != nil {
+		log.Error("failed to get pauses", sl.Err(err))
+
+		return models.Marker{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	gaps, err := s.recordingProvider.Gaps(recordID)
+	if err != nil {
+		log.Error("failed to get gaps", sl.Err(err))
+
+		return models.Marker{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	position := recordedAt(rec.StartTime, pauses, gaps, now).Seconds()
+
+	marker := models.Marker{
+		RecordingID: recordID,
+		Label:       label,
+		Offset:      position,
+		CreatedAt:   now,
+	}
+
+	if offset != nil {
+		if *offset < 0 || *offset > position {
+			log.Error("marker is out of the recording", slog.Float64("offset", *offset), slog.Float64("position", position))
+
+			return models.Marker{}, fmt.Errorf("%s: %w", op, errs.ErrInvalidMarker)
+		}
+
+		marker.Offset = *offset
+	}
+
+	if marker.ID, err = s.recordingSaver.SaveMarker(marker); err != nil {
+		log.Error("failed to save marker", sl.Err(err))
+
+		return models.Marker{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	s.publish(constants.EventMarkerAdded, recordID, rec.UserID, []string{rec.CameraID}, marker)
+
+	return marker, nil
+}
+
+// Chapters returns the path of the WebVTT chapter track of a recording. It is
+// written when a recording with markers stops.
+func (s *RecordingService) Chapters(recordID string) (string, error) {
+	const op = "service.recordings.Chapters"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rec.FilePath == "" {
+		log.Error("recording was not started")
+
+		return "", fmt.Errorf("%s: %w", op, errs.ErrChaptersNotFound)
+	}
+
+	path := chaptersPath(rec)
+	if _, err := os.Stat(path); err != nil {
+		log.Error("chapters not found", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, errs.ErrChaptersNotFound)
+	}
+
+	return path, nil
+}
+
+// chaptersPath is the WebVTT chapter track of a recording, kept next to its
+// files.
+func chaptersPath(rec models.Recording) string {
+	return filepath.Join(filepath.Dir(rec.FilePath), rec.RecordingID+".chapters.vtt")
+}
+
+// writeChapters writes the markers of a finished recording as a sidecar
+// chapter track. A recording without markers gets none.
+func (s *RecordingService) writeChapters(recordID string) error {
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		return err
+	}
+
+	markers, err := s.recordingProvider.Markers(recordID)
+	if err != nil || len(markers) == 0 || rec.FilePath == "" {
+		return err
+	}
+
+	duration, err := s.recorded(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(chaptersPath(rec))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := chapters.WriteWebVTT(f, chapters.FromMarkers(markers, duration)); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// recorded is how long a stopped recording runs once its pauses and gaps are
+// left out, the duration of its joined files.
+func (s *RecordingService) recorded(rec models.Recording) (time.Duration, error) {
+	pauses, err := s.recordingProvider.Pauses(rec.RecordingID)
+	if err != nil {
+		return 0, err
+	}
+
+	gaps, err := s.recordingProvider.Gaps(rec.RecordingID)
+	if err != nil {
+		return 0, err
+	}
+
+	return recordedAt(rec.StartTime, pauses, gaps, rec.StopTime), nil
+}
+
+// recordedAt is how much was recorded from start until at. Nothing is written
+// during pauses and gaps, so they are left out, counting overlaps once. Those
+// still open end at at.
+func recordedAt(start time.Time, pauses []models.Pause, gaps []models.Gap, at time.Time) time.Duration {
+	type span struct{ from, to time.Time }
+
+	spans := make([]span, 0, len(pauses)+len(gaps))
+	for _, p := range pauses {
+		spans = append(spans, span{p.From, p.To})
+	}
+	for _, g := range gaps {
+		spans = append(spans, span{g.From, g.To})
+	}
+
+	slices.SortFunc(spans, func(a, b span) int { return a.from.Compare(b.from) })
+
+	recorded := at.Sub(start)
+	end := start
+	for _, sp := range spans {
+		to := sp.to
+		if to.IsZero() || to.After(at) {
+			to = at
+		}
+
+		from := sp.from
+		if from.Before(end) {
+			from = end
+		}
+
+		if to.After(from) {
+			recorded -= to.Sub(from)
+			end = to
+		}
+	}
+
+	return max(recorded, 0)
+}
@@ -7,14 +7,19 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
 	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/chapters"
 )
 
 type Opencast struct {
+	events          Publisher
 	AclBytes        []byte
 	ProcessingBytes []byte
 	Address         string `yaml:"address" env-required:"true"`
@@ -22,6 +27,10 @@ type Opencast struct {
 	Password        string `yaml:"password" env-required:"true"`
 }
 
+type Publisher interface {
+	Publish(event models.Event)
+}
+
 type Config struct {
 	Address    string     `yaml:"address"`
 	Login      string     `yaml:"login"`
@@ -51,9 +60,14 @@ type Field struct {
 	Value interface{} `json:"value"`
 }
 
-const fileExtension = 3
+// trackFlavors are the tracks the angles of a session are uploaded as, in
+// camera order.
+var trackFlavors = []string{"presenter", "presentation"}
 
-func MustLoad(configPath string) *Opencast {
+// progressStep is the upload share between two progress events, in percent.
+const progressStep = 5
+
+func MustLoad(configPath string, events Publisher) *Opencast {
 	if configPath == "" {
 		panic("CONFIG_PATH is required")
 	}
@@ -67,7 +81,12 @@ func MustLoad(configPath string) *Opencast {
 		panic("failed to read config: " + err.Error())
 	}
 
+	return New(cfg, events)
+}
+
+func New(cfg Config, events Publisher) *Opencast {
 	opencast := &Opencast{
+		events:   events,
 		Address:  cfg.Address,
 		Login:    cfg.Login,
 		Password: cfg.Password,
@@ -87,27 +106,105 @@ func marshalToBytes(v interface{}) []byte {
 	return bytes
 }
 
-func (o *Opencast) Move(rec models.Recording) error {
+// Move uploads the recording files as one presenter track. MPEG-TS pieces
+// are simply concatenated. Markers go along as an MPEG-7 segments catalog.
+func (o *Opencast) Move(rec models.Recording, files []string, duration time.Duration, markers []models.Marker) error {
 	const op = "opencast.Move"
 
-	videoFile, err := os.ReadFile(rec.FilePath)
+	videoFile, err := join(rec, files)
 	if err != nil {
-		return fmt.Errorf("%s: failed to read video file: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tracks := map[string][]byte{
+		"presenter": videoFile,
+	}
+
+	if chs := chapters.FromMarkers(markers, duration); len(chs) > 0 {
+		catalog, err := segmentsCatalog(chs, duration)
+		if err != nil {
+			return fmt.Errorf("%s: failed to marshal segments: %w", op, err)
+		}
+
+		tracks[segmentsField] = catalog
+	}
+
+	if err := o.create(rec, []string{rec.CameraID}, duration, tracks); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MoveSession uploads the angles of a session as separate tracks of one
+// event, the first camera as presenter and the second as presentation.
+func (o *Opencast) MoveSession(session models.Session, files [][]string, duration time.Duration) error {
+	const op = "opencast.MoveSession"
+
+	if len(session.Angles) > len(trackFlavors) {
+		return fmt.Errorf("%s: %w", op, errs.ErrTooManyAngles)
+	}
+
+	tracks := make(map[string][]byte, len(session.Angles))
+	cameraIDs := make([]string, 0, len(session.Angles))
+
+	for i, angle := range session.Angles {
+		videoFile, err := join(angle.Recording, files[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		tracks[trackFlavors[i]] = videoFile
+		cameraIDs = append(cameraIDs, angle.CameraID)
+	}
+
+	if err := o.create(session.Angles[0].Recording, cameraIDs, duration, tracks); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// join reads the pieces of a recording as one file. Only MPEG-TS pieces make
+// a playable file when joined.
+func join(rec models.Recording, files []string) ([]byte, error) {
+	if len(files) > 1 && rec.Container != constants.ContainerMPEGTS {
+		return nil, errs.ErrPiecesNotJoinable
+	}
+
+	var videoFile []byte
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read video file: %w", err)
+		}
+
+		videoFile = append(videoFile, data...)
 	}
 
-	duration := rec.StopTime.Sub(rec.StartTime)
+	return videoFile, nil
+}
+
+// create posts a new event with the given tracks and catalogs. The episode
+// metadata is taken from rec.
+func (o *Opencast) create(rec models.Recording, cameraIDs []string, duration time.Duration, tracks map[string][]byte) error {
 	hours := int(duration.Hours())
 	minutes := int(duration.Minutes()) % 60
 	seconds := int(duration.Seconds()) % 60
 	formattedDuration := fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
 
+	title := rec.Title
+	if title == "" {
+		title = rec.CameraIP
+	}
+
 	md := []Metadata{
 		{
 			Flavor: "dublincore/episode",
 			Fields: []Field{
 				{
 					ID:    "title",
-					Value: rec.CameraIP,
+					Value: title,
 				},
 				{
 					ID:    "startDate",
@@ -131,50 +228,100 @@ func (o *Opencast) Move(rec models.Recording) error {
 
 	metadata, err := json.Marshal(md)
 	if err != nil {
-		return fmt.Errorf("%s: failed to marshal metadata: %w", op, err)
+		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
 	data := map[string][]byte{
-		"presenter":  videoFile,
 		"metadata":   metadata,
 		"acl":        o.AclBytes,
 		"processing": o.ProcessingBytes,
 	}
+	for field, track := range tracks {
+		data[field] = track
+	}
 
 	body := &bytes.Buffer{}
 	contentType, err := createForm(data, body, rec)
 	if err != nil {
-		return fmt.Errorf("%s: failed to create form: %w", op, err)
+		return fmt.Errorf("failed to create form: %w", err)
 	}
 
 	opencastVideos := fmt.Sprintf("%s/api/events", o.Address)
-	req, err := http.NewRequest("POST", opencastVideos, body)
+	progress := &progressReader{
+		r:     body,
+		total: int64(body.Len()),
+		report: func(p models.UploadProgress) {
+			o.events.Publish(models.Event{
+				Type:        constants.EventUploadProgress,
+				RecordingID: rec.RecordingID,
+				UserID:      rec.UserID,
+				CameraIDs:   cameraIDs,
+				Data:        p,
+			})
+		},
+	}
+
+	req, err := http.NewRequest("POST", opencastVideos, progress)
 	if err != nil {
-		return fmt.Errorf("%s: failed to create request: %w", op, err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = progress.total
 
 	req.Header.Set("Content-Type", contentType)
 	req.SetBasicAuth(o.Login, o.Password)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("%s: failed to send request: %w", op, err)
+		return fmt.Errorf("failed to send request: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s: failed to move video: %s", op, resp.Status)
+		return fmt.Errorf("failed to move video: %s", resp.Status)
 	}
 
 	return nil
 }
 
+// progressReader reports how much of the request body was sent, every
+// progressStep percent.
+type progressReader struct {
+	r      io.Reader
+	sent   int64
+	total  int64
+	last   float64
+	report func(models.UploadProgress)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent += int64(n)
+
+	if p.total > 0 && n > 0 {
+		percent := float64(p.sent) * 100 / float64(p.total)
+		if percent-p.last >= progressStep || p.sent == p.total {
+			p.last = percent
+			p.report(models.UploadProgress{Sent: p.sent, Total: p.total, Percent: percent})
+		}
+	}
+
+	return n, err
+}
+
 func createForm(data map[string][]byte, body *bytes.Buffer, rec models.Recording) (string, error) {
 	writer := multipart.NewWriter(body)
 	defer writer.Close()
 
 	for fieldName, fieldData := range data {
-		if fieldName == "presenter" {
-			part, err := writer.CreateFormFile(fieldName, fmt.Sprintf("%s.%s", fieldName, rec.FilePath[len(rec.FilePath)-fileExtension:]))
+		var header textproto.MIMEHeader
+		switch fieldName {
+		case "presenter", "presentation":
+			header = fileHeader(fieldName, rec)
+		case segmentsField:
+			header = catalogHeader(fieldName)
+		}
+
+		if header != nil {
+			part, err := writer.CreatePart(header)
 			if err != nil {
 				return "", err
 			}
@@ -196,3 +343,18 @@ func createForm(data map[string][]byte, body *bytes.Buffer, rec models.Recording
 
 	return writer.FormDataContentType(), nil
 }
+
+// fileHeader names the file after the recording container and sends its
+// MIME type, so Opencast does not have to guess the format.
+func fileHeader(fieldName string, rec models.Recording) textproto.MIMEHeader {
+	mimeType := rec.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s.%s"`, fieldName, fieldName, rec.Container))
+	h.Set("Content-Type", mimeType)
+
+	return h
+}
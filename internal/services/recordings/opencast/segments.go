@@ -0,0 +1,115 @@
+package opencast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/textproto"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/chapters"
+)
+
+// segmentsField carries the markers as an MPEG-7 catalog, the format
+// Opencast keeps video segments in (flavor mpeg-7/segments).
+const segmentsField = "segments"
+
+type mpeg7 struct {
+	XMLName     xml.Name         `xml:"urn:mpeg:mpeg7:schema:2001 Mpeg7"`
+	XSI         string           `xml:"xmlns:xsi,attr"`
+	Description mpeg7Description `xml:"Description"`
+}
+
+type mpeg7Description struct {
+	Type    string       `xml:"xsi:type,attr"`
+	Content mpeg7Content `xml:"MultimediaContent"`
+}
+
+type mpeg7Content struct {
+	Type  string     `xml:"xsi:type,attr"`
+	Video mpeg7Video `xml:"Video"`
+}
+
+type mpeg7Video struct {
+	ID            string             `xml:"id,attr"`
+	MediaTime     mpeg7MediaTime     `xml:"MediaTime"`
+	Decomposition mpeg7Decomposition `xml:"TemporalDecomposition"`
+}
+
+type mpeg7Decomposition struct {
+	Criteria string         `xml:"criteria,attr"`
+	Gap      bool           `xml:"gap,attr"`
+	Overlap  bool           `xml:"overlap,attr"`
+	Segments []mpeg7Segment `xml:"VideoSegment"`
+}
+
+type mpeg7Segment struct {
+	ID         string          `xml:"id,attr"`
+	MediaTime  mpeg7MediaTime  `xml:"MediaTime"`
+	Annotation mpeg7Annotation `xml:"TextAnnotation"`
+}
+
+type mpeg7MediaTime struct {
+	TimePoint string `xml:"MediaTimePoint"`
+	Duration  string `xml:"MediaDuration"`
+}
+
+type mpeg7Annotation struct {
+	Text string `xml:"FreeTextAnnotation"`
+}
+
+// segmentsCatalog describes the chapters of a recording of the given duration
+// as MPEG-7 video segments.
+func segmentsCatalog(chs []chapters.Chapter, duration time.Duration) ([]byte, error) {
+	doc := mpeg7{
+		XSI: "http://www.w3.org/2001/XMLSchema-instance",
+		Description: mpeg7Description{
+			Type: "ContentEntityType",
+			Content: mpeg7Content{
+				Type: "VideoType",
+				Video: mpeg7Video{
+					ID:        "episode",
+					MediaTime: mediaTime(0, duration),
+					Decomposition: mpeg7Decomposition{
+						Criteria: "temporal",
+						Gap:      true,
+					},
+				},
+			},
+		},
+	}
+
+	for i, ch := range chs {
+		doc.Description.Content.Video.Decomposition.Segments = append(doc.Description.Content.Video.Decomposition.Segments, mpeg7Segment{
+			ID:         fmt.Sprintf("segment-%d", i),
+			MediaTime:  mediaTime(ch.Start, ch.End-ch.Start),
+			Annotation: mpeg7Annotation{Text: ch.Title},
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// mediaTime writes times in milliseconds, as T00:01:30:500F1000 and
+// PT0H1M30S500N1000F.
+func mediaTime(start, duration time.Duration) mpeg7MediaTime {
+	s := start.Milliseconds()
+	d := duration.Milliseconds()
+
+	return mpeg7MediaTime{
+		TimePoint: fmt.Sprintf("T%02d:%02d:%02d:%dF1000", s/3600000, s/60000%60, s/1000%60, s%1000),
+		Duration:  fmt.Sprintf("PT%dH%dM%dS%dN1000F", d/3600000, d/60000%60, d/1000%60, d%1000),
+	}
+}
+
+func catalogHeader(fieldName string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s.xml"`, fieldName, fieldName))
+	h.Set("Content-Type", "text/xml")
+
+	return h
+}
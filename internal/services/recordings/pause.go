@@ -0,0 +1,191 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// Pause finishes the current piece and keeps the recording open without a
+// pipeline. Resume continues it in the next piece, like a restart after a
+// dropout.
+func (s *RecordingService) Pause(recordID string) error {
+	const op = "service.recordings.Pause"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	log.Info("pause recording")
+
+	sess, err := s.session(recordID, constants.StatusPaused)
+	if err != nil {
+		log.Error("recording is not running", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The spec of an adopted pipeline is unknown, so it could not be resumed.
+	if !sess.canRestart() {
+		log.Error("adopted recording can not be paused")
+
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotPausable)
+	}
+
+	// The piece written after the pause has to be joined to the ones before
+	// it, so the video service gets one file.
+	if !sess.rec.Segmented && sess.rec.Container != constants.ContainerMPEGTS {
+		log.Error("recording can not be paused", slog.String("container", sess.rec.Container))
+
+		return fmt.Errorf("%s: %w: pieces in %s can't be joined", op, errs.ErrRecordingNotPausable, sess.rec.Container)
+	}
+
+	sess.pipeline.Lock()
+	defer sess.pipeline.Unlock()
+
+	sess.mu.Lock()
+	if sess.stopped || sess.paused {
+		sess.mu.Unlock()
+
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotActive)
+	}
+
+	// Marked before the status is written, so the supervisor doesn't take
+	// the pipeline that is stopped for a dropout.
+	sess.paused = true
+	proc := sess.proc
+	sess.mu.Unlock()
+
+	if err := s.recordingSaver.SetStatus(recordID, constants.StatusRecording, constants.StatusPaused); err != nil {
+		sess.mu.Lock()
+		sess.paused = false
+		sess.mu.Unlock()
+
+		// A pipeline that exited meanwhile is restarted by the supervisor.
+		select {
+		case sess.resumed <- struct{}{}:
+		default:
+		}
+
+		log.Error("failed to write pause data", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.recordingSaver.OpenPause(recordID, time.Now()); err != nil {
+		log.Error("failed to save pause", sl.Err(err))
+	}
+
+	if proc.Status().Running {
+		if err := proc.Stop(); err != nil {
+			log.Error("failed to stop pipeline", sl.Err(err))
+		}
+
+		if _, killed := proc.Wait(s.stopTimeout); killed {
+			log.Warn("pipeline did not finish in time, killed", slog.Duration("timeout", s.stopTimeout))
+		}
+	}
+
+	if err := s.indexSegments(sess.rec, true); err != nil {
+		log.Error("failed to index segments", sl.Err(err))
+	}
+
+	s.publish(constants.EventRecordingPaused, recordID, sess.rec.UserID, sess.cameraIDs, nil)
+
+	return nil
+}
+
+func (s *RecordingService) Resume(recordID string) error {
+	const op = "service.recordings.Resume"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	log.Info("resume recording")
+
+	sess, err := s.session(recordID, constants.StatusRecording)
+	if err != nil {
+		log.Error("recording is not running", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The status is written and the pipeline started under sess.pipeline
+	// only, so the status and the supervisor don't wait for them.
+	sess.pipeline.Lock()
+	defer sess.pipeline.Unlock()
+
+	sess.mu.Lock()
+	stopped, paused := sess.stopped, sess.paused
+	sess.mu.Unlock()
+
+	if stopped {
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotActive)
+	}
+
+	if !paused {
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotPaused)
+	}
+
+	if err := s.recordingSaver.SetStatus(recordID, constants.StatusPaused, constants.StatusRecording); err != nil {
+		log.Error("failed to write resume data", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	next, err := s.nextPiece(sess)
+	if err != nil {
+		if err := s.recordingSaver.SetStatus(recordID, constants.StatusRecording, constants.StatusPaused); err != nil {
+			log.Error("failed to restore recording status", sl.Err(err))
+		}
+
+		log.Error("failed to start pipeline", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	select {
+	case sess.resumed <- struct{}{}:
+	default:
+	}
+
+	if err := s.recordingSaver.ClosePauses(recordID, time.Now()); err != nil {
+		log.Error("failed to close pause", sl.Err(err))
+	}
+
+	log.Info("recording resumed", slog.Int("piece", next))
+
+	s.publish(constants.EventRecordingResumed, recordID, sess.rec.UserID, sess.cameraIDs, map[string]int{"piece": next})
+
+	return nil
+}
+
+// session returns the running session of a recording. For a recording that
+// is not running it returns why it can't move to status to.
+func (s *RecordingService) session(recordID, to string) (*session, error) {
+	s.mu.Lock()
+	sess, ok := s.commands[recordID]
+	s.mu.Unlock()
+
+	if ok {
+		return sess, nil
+	}
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTransition(rec.Status, to); err != nil {
+		return nil, err
+	}
+
+	return nil, errs.ErrRecordingNotActive
+}
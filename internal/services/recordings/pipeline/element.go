@@ -0,0 +1,232 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+)
+
+type Node interface {
+	args() []string
+}
+
+type Property struct {
+	Key   string
+	Value string
+}
+
+func Prop(key string, value interface{}) Property {
+	return Property{Key: key, Value: fmt.Sprint(value)}
+}
+
+func (p Property) String() string {
+	return p.Key + "=" + p.Value
+}
+
+type Element struct {
+	Factory string
+	Name    string
+	Props   []Property
+}
+
+func (e Element) With(props ...Property) Element {
+	e.Props = append(append([]Property(nil), e.Props...), props...)
+
+	return e
+}
+
+func (e Element) args() []string {
+	args := []string{e.Factory}
+	if e.Name != "" {
+		args = append(args, "name="+e.Name)
+	}
+
+	for _, p := range e.Props {
+		args = append(args, p.String())
+	}
+
+	return args
+}
+
+type Caps struct {
+	Media  string
+	Fields []Property
+}
+
+func (c Caps) args() []string {
+	parts := []string{c.Media}
+	for _, f := range c.Fields {
+		parts = append(parts, f.String())
+	}
+
+	return []string{strings.Join(parts, ",")}
+}
+
+// Ref points to an element or one of its pads declared elsewhere in the
+// pipeline, e.g. "mux." or "mix.sink_0".
+type Ref struct {
+	Element string
+	Pad     string
+}
+
+func (r Ref) args() []string {
+	return []string{r.Element + "." + r.Pad}
+}
+
+func SolidColor(rgb uint32) Element {
+	return Element{Factory: "videotestsrc", Props: []Property{
+		Prop("pattern", "solid-color"),
+		Prop("foreground-color", fmt.Sprintf("0xff%06x", rgb)),
+		Prop("is-live", true),
+	}}
+}
+
+func RTSPSrc(location, name string) Element {
+	return Element{Factory: "rtspsrc", Name: name, Props: []Property{Prop("location", location)}}
+}
+
+func URIDecodeBin(uri, name string) Element {
+	return Element{Factory: "uridecodebin", Name: name, Props: []Property{Prop("uri", uri)}}
+}
+
+func RTPH264Depay() Element {
+	return Element{Factory: "rtph264depay"}
+}
+
+func H264Parse() Element {
+	return Element{Factory: "h264parse"}
+}
+
+func RTPMP4GDepay() Element {
+	return Element{Factory: "rtpmp4gdepay"}
+}
+
+func AACParse() Element {
+	return Element{Factory: "aacparse"}
+}
+
+func AVDecH264() Element {
+	return Element{Factory: "avdec_h264"}
+}
+
+func Queue() Element {
+	return Element{Factory: "queue"}
+}
+
+func VideoConvert() Element {
+	return Element{Factory: "videoconvert"}
+}
+
+func AudioConvert() Element {
+	return Element{Factory: "audioconvert"}
+}
+
+func AudioResample() Element {
+	return Element{Factory: "audioresample"}
+}
+
+func VideoScale() Element {
+	return Element{Factory: "videoscale"}
+}
+
+func VideoRate() Element {
+	return Element{Factory: "videorate"}
+}
+
+func Tee(name string) Element {
+	return Element{Factory: "tee", Name: name}
+}
+
+func FakeSink() Element {
+	return Element{Factory: "fakesink", Props: []Property{Prop("sync", false)}}
+}
+
+func RawVideo(width, height int) Caps {
+	return Caps{Media: "video/x-raw", Fields: []Property{Prop("width", width), Prop("height", height)}}
+}
+
+// Compositor scales and places every sink pad according to the slot with the
+// same index.
+func Compositor(name string, pads []layout.Slot) Element {
+	e := Element{Factory: "compositor", Name: name, Props: []Property{Prop("background", "black")}}
+	for i, slot := range pads {
+		pad := fmt.Sprintf("sink_%d::", i)
+		e.Props = append(e.Props,
+			Prop(pad+"xpos", slot.X),
+			Prop(pad+"ypos", slot.Y),
+			Prop(pad+"width", slot.Width),
+			Prop(pad+"height", slot.Height),
+			Prop(pad+"zorder", slot.ZOrder),
+			Prop(pad+"sizing-policy", "keep-aspect-ratio"),
+		)
+	}
+
+	return e
+}
+
+func X264Enc() Element {
+	return Element{Factory: "x264enc"}
+}
+
+func X265Enc() Element {
+	return Element{Factory: "x265enc"}
+}
+
+func VP9Enc() Element {
+	return Element{Factory: "vp9enc"}
+}
+
+func AV1Enc() Element {
+	return Element{Factory: "av1enc"}
+}
+
+func LameMP3Enc() Element {
+	return Element{Factory: "lamemp3enc"}
+}
+
+func AACEnc() Element {
+	return Element{Factory: "avenc_aac"}
+}
+
+func OpusEnc() Element {
+	return Element{Factory: "opusenc"}
+}
+
+func MatroskaMux(name string) Element {
+	return Element{Factory: "matroskamux", Name: name}
+}
+
+// FragmentedMP4Mux writes a new fragment every second without seeking back,
+// so the file can be played while it is still being written.
+func FragmentedMP4Mux(name string) Element {
+	return Element{Factory: "mp4mux", Name: name, Props: []Property{
+		Prop("fragment-duration", 1000),
+		Prop("streamable", true),
+	}}
+}
+
+func MPEGTSMux(name string) Element {
+	return Element{Factory: "mpegtsmux", Name: name}
+}
+
+// SplitMuxSink writes segments of about maxSize length with the muxer
+// factory, numbered from startIndex. Location must contain the segment index
+// placeholder.
+func SplitMuxSink(name, location, muxer string, maxSize time.Duration, startIndex int) Element {
+	e := Element{Factory: "splitmuxsink", Name: name, Props: []Property{
+		Prop("location", location),
+		Prop("max-size-time", maxSize.Nanoseconds()),
+		Prop("muxer-factory", muxer),
+	}}
+	if startIndex > 0 {
+		e.Props = append(e.Props, Prop("start-index", startIndex))
+	}
+
+	return e
+}
+
+func FileSink(location string) Element {
+	return Element{Factory: "filesink", Props: []Property{Prop("location", location)}}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+)
+
+// encodeVideo appends the video encoder of the profile and then tail to
+// chain.
+func encodeVideo(chain Chain, p *models.Profile, tail ...Node) Chain {
+	chain = append(chain, videoEncoder(p)...)
+
+	return append(chain, tail...)
+}
+
+func encodeAudio(chain Chain, p *models.Profile) Chain {
+	return append(chain, audioEncoder(p)...)
+}
+
+// videoEncoder returns the nodes that take raw video to the encoded stream.
+// Without a profile the stream is encoded with x264 defaults.
+func videoEncoder(p *models.Profile) []Node {
+	if p == nil {
+		return []Node{X264Enc()}
+	}
+
+	var nodes []Node
+	caps := Caps{Media: "video/x-raw"}
+	if p.Width > 0 {
+		nodes = append(nodes, VideoScale())
+		caps.Fields = append(caps.Fields, Prop("width", p.Width), Prop("height", p.Height))
+	}
+	if p.Framerate > 0 {
+		nodes = append(nodes, VideoRate())
+		caps.Fields = append(caps.Fields, Prop("framerate", fmt.Sprintf("%d/1", p.Framerate)))
+	}
+	if len(caps.Fields) > 0 {
+		nodes = append(nodes, caps)
+	}
+
+	return append(nodes, encoder(p))
+}
+
+// encoder sets up the software encoder of the profile codec. The encoders
+// disagree on units: vp9enc takes bits per second, the others kbit/s.
+func encoder(p *models.Profile) Element {
+	var props []Property
+
+	switch p.VideoCodec {
+	case profile.VP9, profile.AV1:
+		if p.VideoBitrate > 0 {
+			bitrate := p.VideoBitrate
+			if p.VideoCodec == profile.VP9 {
+				bitrate *= 1000
+			}
+			props = append(props, Prop("target-bitrate", bitrate))
+		}
+		if p.Preset != "" {
+			props = append(props, Prop("cpu-used", profile.CPUUsed(p.Preset)))
+		}
+		if p.KeyframeInterval > 0 {
+			props = append(props, Prop("keyframe-max-dist", p.KeyframeInterval))
+		}
+
+		if p.VideoCodec == profile.VP9 {
+			return VP9Enc().With(props...)
+		}
+
+		return AV1Enc().With(props...)
+	default:
+		if p.VideoBitrate > 0 {
+			props = append(props, Prop("bitrate", p.VideoBitrate))
+		}
+		if p.Preset != "" {
+			props = append(props, Prop("speed-preset", p.Preset))
+		}
+		if p.KeyframeInterval > 0 {
+			props = append(props, Prop("key-int-max", p.KeyframeInterval))
+		}
+
+		if p.VideoCodec == profile.H265 {
+			return X265Enc().With(props...)
+		}
+
+		return X264Enc().With(props...)
+	}
+}
+
+// audioEncoder returns the nodes that take raw audio to the encoded stream,
+// mp3 with encoder defaults when there is no profile.
+func audioEncoder(p *models.Profile) []Node {
+	if p == nil {
+		return []Node{LameMP3Enc()}
+	}
+
+	switch p.AudioCodec {
+	case profile.AAC:
+		if p.AudioBitrate > 0 {
+			return []Node{AACEnc().With(Prop("bitrate", p.AudioBitrate*1000))}
+		}
+
+		return []Node{AACEnc()}
+	case profile.Opus:
+		// Opus only takes a few sample rates, 48 kHz among them.
+		if p.AudioBitrate > 0 {
+			return []Node{AudioResample(), OpusEnc().With(Prop("bitrate", p.AudioBitrate*1000))}
+		}
+
+		return []Node{AudioResample(), OpusEnc()}
+	default:
+		if p.AudioBitrate > 0 {
+			return []Node{LameMP3Enc().With(Prop("target", "bitrate"), Prop("bitrate", p.AudioBitrate))}
+		}
+
+		return []Node{LameMP3Enc()}
+	}
+}
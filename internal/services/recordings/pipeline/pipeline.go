@@ -0,0 +1,318 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+const Launcher = "gst-launch-1.0"
+
+var ErrNoSources = errors.New("no sources to record")
+
+type Chain []Node
+
+type Pipeline struct {
+	// EOS makes gst-launch send EOS on interrupt, so muxers can finish the file.
+	EOS    bool
+	Chains []Chain
+}
+
+// Argv renders the pipeline as gst-launch arguments. Every property is a
+// separate argument, so values containing spaces need no quoting.
+func (p Pipeline) Argv() []string {
+	argv := []string{Launcher}
+	if p.EOS {
+		argv = append(argv, "-e")
+	}
+
+	for _, chain := range p.Chains {
+		for i, node := range chain {
+			if i > 0 {
+				argv = append(argv, "!")
+			}
+			argv = append(argv, node.args()...)
+		}
+	}
+
+	return argv
+}
+
+func Build(spec recorder.Spec) (Pipeline, error) {
+	if container := recorder.DefaultContainer(spec); recorder.MIMEType(container) == "" {
+		return Pipeline{}, fmt.Errorf("%w: %s", errs.ErrUnknownContainer, container)
+	}
+
+	switch len(spec.Sources) {
+	case 0:
+		return Pipeline{}, ErrNoSources
+	case 1:
+		switch {
+		case spec.Audio == 0:
+			return SingleWithAudio(spec), nil
+		case spec.Profile != nil:
+			return SingleEncoded(spec), nil
+		default:
+			return Single(spec), nil
+		}
+	default:
+		if len(spec.Layout.Slots) != len(spec.Sources) {
+			return Pipeline{}, fmt.Errorf("layout has %d slots for %d sources", len(spec.Layout.Slots), len(spec.Sources))
+		}
+
+		return Mixed(spec)
+	}
+}
+
+// outputs are the files the pipeline writes: the master and, when the spec
+// has one, the proxy. With a proxy, video and audio are split with a tee and
+// encoded once for each file.
+type outputs struct {
+	sinks      []Chain
+	video      Ref
+	audio      Ref
+	proxy      *models.Profile
+	proxyVideo Ref
+	proxyAudio Ref
+}
+
+func newOutputs(spec recorder.Spec) outputs {
+	sink, video, audio := output(spec, "mux", spec.FilePath)
+	o := outputs{sinks: []Chain{sink}, video: video, audio: audio}
+
+	if spec.Proxy != nil {
+		sink, video, audio := output(spec, "proxymux", spec.Proxy.FilePath)
+		o.sinks = append(o.sinks, sink)
+		o.proxy = &spec.Proxy.Profile
+		o.proxyVideo, o.proxyAudio = video, audio
+	}
+
+	return o
+}
+
+// encodeVideo links the raw video of chain to the master file, encoded with
+// p and followed by tail, and to the proxy file.
+func (o outputs) encodeVideo(chain Chain, p *models.Profile, tail ...Node) []Chain {
+	if o.proxy == nil {
+		return []Chain{append(encodeVideo(chain, p, tail...), o.video)}
+	}
+
+	return []Chain{
+		append(chain, Tee("vtee")),
+		append(encodeVideo(Chain{Ref{Element: "vtee"}, Queue()}, p, tail...), o.video),
+		append(encodeVideo(Chain{Ref{Element: "vtee"}, Queue()}, o.proxy, tail...), o.proxyVideo),
+	}
+}
+
+// encodeAudio links the raw audio of chain to the master file and, unless the
+// proxy profile drops audio, to the proxy file.
+func (o outputs) encodeAudio(chain Chain, p *models.Profile) []Chain {
+	if o.proxy == nil || o.proxy.AudioCodec == profile.NoAudio {
+		return []Chain{append(encodeAudio(chain, p), o.audio)}
+	}
+
+	return []Chain{
+		append(chain, Tee("atee")),
+		append(encodeAudio(Chain{Ref{Element: "atee"}, Queue()}, p), o.audio),
+		append(encodeAudio(Chain{Ref{Element: "atee"}, Queue()}, o.proxy), o.proxyAudio),
+	}
+}
+
+// output returns the chain that writes the file at location with the muxer
+// called name, and the pads that the video and audio branches link to.
+func output(spec recorder.Spec, name, location string) (Chain, Ref, Ref) {
+	container := recorder.DefaultContainer(spec)
+
+	if spec.SegmentDuration > 0 {
+		// Every segment is a finished file, so MP4 segments need no fragments.
+		muxer := map[string]string{
+			constants.ContainerMatroska: "matroskamux",
+			constants.ContainerMP4:      "mp4mux",
+			constants.ContainerMPEGTS:   "mpegtsmux",
+		}[container]
+
+		return Chain{SplitMuxSink(name, location, muxer, spec.SegmentDuration, spec.SegmentStart)},
+			Ref{Element: name, Pad: "video"}, Ref{Element: name, Pad: "audio_%u"}
+	}
+
+	var mux Element
+	switch container {
+	case constants.ContainerMP4:
+		mux = FragmentedMP4Mux(name)
+	case constants.ContainerMPEGTS:
+		mux = MPEGTSMux(name)
+	default:
+		mux = MatroskaMux(name)
+	}
+
+	return Chain{mux, FileSink(location)}, Ref{Element: name}, Ref{Element: name}
+}
+
+// Single records the camera stream as is. A proxy is decoded from the same
+// stream, so only the proxy is encoded.
+func Single(spec recorder.Spec) Pipeline {
+	o := newOutputs(spec)
+	src := Chain{RTSPSrc(spec.Sources[0].URI, ""), RTPH264Depay(), H264Parse()}
+
+	p := Pipeline{EOS: true}
+	if o.proxy == nil {
+		p.Chains = append(p.Chains, append(src, o.video))
+	} else {
+		p.Chains = append(p.Chains,
+			append(src, Tee("vtee")),
+			Chain{Ref{Element: "vtee"}, Queue(), o.video},
+			append(encodeVideo(Chain{Ref{Element: "vtee"}, Queue(), AVDecH264(), VideoConvert()}, o.proxy), o.proxyVideo),
+		)
+	}
+
+	p.Chains = append(p.Chains, o.sinks...)
+
+	return p
+}
+
+// SingleEncoded re-encodes the video of a single camera with the spec
+// profile. Camera audio is not recorded.
+func SingleEncoded(spec recorder.Spec) Pipeline {
+	o := newOutputs(spec)
+
+	p := Pipeline{
+		EOS:    true,
+		Chains: o.encodeVideo(Chain{URIDecodeBin(spec.Sources[0].URI, "dec"), Queue(), VideoConvert()}, spec.Profile),
+	}
+
+	if spec.Sources[0].Audio {
+		p.Chains = append(p.Chains, Chain{Ref{Element: "dec"}, Queue(), AudioConvert(), FakeSink()})
+	}
+
+	p.Chains = append(p.Chains, o.sinks...)
+
+	return p
+}
+
+func SingleWithAudio(spec recorder.Spec) Pipeline {
+	o := newOutputs(spec)
+
+	p := Pipeline{
+		EOS:    true,
+		Chains: o.encodeVideo(Chain{URIDecodeBin(spec.Sources[0].URI, "dec"), Queue(), VideoConvert()}, spec.Profile),
+	}
+
+	p.Chains = append(p.Chains, o.encodeAudio(Chain{Ref{Element: "dec"}, Queue(), AudioConvert()}, spec.Profile)...)
+	p.Chains = append(p.Chains, o.sinks...)
+
+	return p
+}
+
+// Mixed composes all sources into one picture. Audio of the selected source
+// is recorded; audio pads of the other sources are drained into fakesinks so
+// they don't stop the pipeline with not-linked errors.
+func Mixed(spec recorder.Spec) (Pipeline, error) {
+	pads, boxes, err := decorate(spec.Layout)
+	if err != nil {
+		return Pipeline{}, err
+	}
+
+	for _, b := range boxes {
+		pads = append(pads, b.slot)
+	}
+
+	o := newOutputs(spec)
+
+	p := Pipeline{
+		EOS: true,
+		Chains: o.encodeVideo(Chain{
+			Compositor("mix", pads), RawVideo(spec.Layout.Width, spec.Layout.Height), VideoConvert(),
+		}, spec.Profile, Queue()),
+	}
+
+	for i, src := range spec.Sources {
+		name := fmt.Sprintf("src%d", i)
+		p.Chains = append(p.Chains, Chain{
+			URIDecodeBin(src.URI, name), VideoConvert(), Queue(), Ref{Element: "mix", Pad: fmt.Sprintf("sink_%d", i)},
+		})
+
+		switch {
+		case i == spec.Audio:
+			p.Chains = append(p.Chains, o.encodeAudio(Chain{Ref{Element: name}, Queue(), AudioConvert()}, spec.Profile)...)
+		case src.Audio:
+			p.Chains = append(p.Chains, Chain{Ref{Element: name}, Queue(), AudioConvert(), FakeSink()})
+		}
+	}
+
+	for i, b := range boxes {
+		p.Chains = append(p.Chains, Chain{
+			SolidColor(b.color), RawVideo(b.slot.Width, b.slot.Height), Ref{Element: "mix", Pad: fmt.Sprintf("sink_%d", len(spec.Sources)+i)},
+		})
+	}
+
+	p.Chains = append(p.Chains, o.sinks...)
+
+	return p, nil
+}
+
+// box is a solid colour rectangle drawn under the cameras.
+type box struct {
+	slot  layout.Slot
+	color uint32
+}
+
+// decorate returns the camera pads and the boxes for the layout background
+// and slot borders. When there are boxes, camera z-orders are spread out so
+// that every border stays right under its own camera.
+func decorate(l layout.Layout) ([]layout.Slot, []box, error) {
+	var boxes []box
+
+	if l.Background != "" {
+		color, err := layout.Color(l.Background)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		boxes = append(boxes, box{slot: layout.Slot{Width: l.Width, Height: l.Height}, color: color})
+	}
+
+	for _, slot := range l.Slots {
+		if slot.Border == 0 {
+			continue
+		}
+
+		borderColor := slot.BorderColor
+		if borderColor == "" {
+			borderColor = layout.DefaultBorderColor
+		}
+
+		color, err := layout.Color(borderColor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		boxes = append(boxes, box{
+			slot: layout.Slot{
+				X:      slot.X - slot.Border,
+				Y:      slot.Y - slot.Border,
+				Width:  slot.Width + 2*slot.Border,
+				Height: slot.Height + 2*slot.Border,
+				ZOrder: 2*slot.ZOrder + 1,
+			},
+			color: color,
+		})
+	}
+
+	if len(boxes) == 0 {
+		return l.Slots, nil, nil
+	}
+
+	pads := make([]layout.Slot, 0, len(l.Slots)+len(boxes))
+	for _, slot := range l.Slots {
+		slot.ZOrder = 2*slot.ZOrder + 2
+		pads = append(pads, slot)
+	}
+
+	return pads, boxes, nil
+}
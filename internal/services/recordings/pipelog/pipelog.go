@@ -0,0 +1,220 @@
+package pipelog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+)
+
+// maxLine bounds a line kept for parsing, so output without newlines can't
+// grow the buffer without limit.
+const maxLine = 64 * 1024
+
+type Event struct {
+	Level   string
+	Source  string
+	Message string
+}
+
+// Writer appends pipeline output to a file, rotating it once it grows past
+// maxSize, and calls onEvent for every error or warning line.
+type Writer struct {
+	path    string
+	maxSize int64
+	backups int
+	onEvent func(Event)
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	line []byte
+}
+
+func Open(path string, maxSize int64, backups int, onEvent func(Event)) (*Writer, error) {
+	w := &Writer{
+		path:    path,
+		maxSize: maxSize,
+		backups: backups,
+		onEvent: onEvent,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	w.file, w.size = f, info.Size()
+
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	w.scan(p[:n])
+
+	return n, err
+}
+
+func (w *Writer) scan(p []byte) {
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if len(w.line)+len(p) <= maxLine {
+				w.line = append(w.line, p...)
+			}
+
+			return
+		}
+
+		w.line = append(w.line, p[:i]...)
+		if ev, ok := Parse(string(w.line)); ok && w.onEvent != nil {
+			w.onEvent(ev)
+		}
+
+		w.line = w.line[:0]
+		p = p[i+1:]
+	}
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(Backup(w.path, w.backups))
+	for i := w.backups - 1; i >= 1; i-- {
+		os.Rename(Backup(w.path, i), Backup(w.path, i+1))
+	}
+
+	if w.backups > 0 {
+		if err := os.Rename(w.path, Backup(w.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.line) > 0 {
+		if ev, ok := Parse(string(w.line)); ok && w.onEvent != nil {
+			w.onEvent(ev)
+		}
+		w.line = nil
+	}
+
+	return w.file.Close()
+}
+
+// Backup is the path of the i-th rotated file, 1 being the newest.
+func Backup(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Files lists the log files of path that exist, oldest first.
+func Files(path string) []string {
+	var files []string
+
+	backups, _ := filepath.Glob(path + ".*")
+	for i := len(backups); i >= 1; i-- {
+		if _, err := os.Stat(Backup(path, i)); err == nil {
+			files = append(files, Backup(path, i))
+		}
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	return files
+}
+
+var (
+	// ERROR: from element /GstPipeline:pipeline0/GstRTSPSrc:src0: Could not read from resource.
+	launchLine = regexp.MustCompile(`^(ERROR|WARNING): (?:from element (\S+?): )?(.+)$`)
+	// 0:00:01.2 12 0x5566 ERROR rtspsrc gstrtspsrc.c:6066:gst_rtspsrc_try_send:<src0> could not receive any UDP packets
+	debugLine = regexp.MustCompile(`\s(ERROR|WARN)\s+(\S+)\s+\S+:\d+:\S+?:(?:<([^>]+)>)?\s*(.+)$`)
+	// [rtsp @ 0x55d0] [error] method DESCRIBE failed: 404 Not Found
+	ffmpegLine = regexp.MustCompile(`^(?:\[(\w+) @ 0x[0-9a-f]+\] )?\[(error|warning|fatal|panic)\] (.+)$`)
+	ansiCodes  = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// Parse recognises the error and warning lines of gst-launch, of GStreamer
+// debug output and of ffmpeg run with -loglevel level+warning.
+func Parse(line string) (Event, bool) {
+	line = strings.TrimSpace(ansiCodes.ReplaceAllString(line, ""))
+
+	if m := launchLine.FindStringSubmatch(line); m != nil {
+		return Event{Level: level(m[1]), Source: element(m[2]), Message: m[3]}, true
+	}
+
+	if m := debugLine.FindStringSubmatch(line); m != nil {
+		source := m[3]
+		if source == "" {
+			source = m[2]
+		}
+
+		return Event{Level: level(m[1]), Source: source, Message: m[4]}, true
+	}
+
+	if m := ffmpegLine.FindStringSubmatch(line); m != nil {
+		return Event{Level: level(m[2]), Source: m[1], Message: m[3]}, true
+	}
+
+	return Event{}, false
+}
+
+func level(s string) string {
+	switch strings.ToLower(s) {
+	case "warn", "warning":
+		return constants.LevelWarning
+	default:
+		return constants.LevelError
+	}
+}
+
+// element shortens a GStreamer element path to the element name.
+func element(path string) string {
+	if i := strings.LastIndexAny(path, ":/"); i >= 0 {
+		return path[i+1:]
+	}
+
+	return path
+}
@@ -0,0 +1,99 @@
+package pipelog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Event
+		ok   bool
+	}{
+		{
+			line: "ERROR: from element /GstPipeline:pipeline0/GstRTSPSrc:src0: Could not read from resource.",
+			want: Event{Level: constants.LevelError, Source: "src0", Message: "Could not read from resource."},
+			ok:   true,
+		},
+		{
+			line: "WARNING: from element /GstPipeline:pipeline0/GstMatroskaMux:mux: Unexpected timestamp",
+			want: Event{Level: constants.LevelWarning, Source: "mux", Message: "Unexpected timestamp"},
+			ok:   true,
+		},
+		{
+			line: `ERROR: pipeline could not be constructed: no element "rtspsrcx".`,
+			want: Event{Level: constants.LevelError, Message: `pipeline could not be constructed: no element "rtspsrcx".`},
+			ok:   true,
+		},
+		{
+			line: "0:00:05.012345678 4242 0x55d0c8 \x1b[33;01mWARN   \x1b[00m rtspsrc gstrtspsrc.c:6066:gst_rtspsrc_try_send:<src0> could not receive any UDP packets",
+			want: Event{Level: constants.LevelWarning, Source: "src0", Message: "could not receive any UDP packets"},
+			ok:   true,
+		},
+		{
+			line: "[rtsp @ 0x55d0c8a0] [error] method DESCRIBE failed: 404 Not Found",
+			want: Event{Level: constants.LevelError, Source: "rtsp", Message: "method DESCRIBE failed: 404 Not Found"},
+			ok:   true,
+		},
+		{
+			line: "[warning] Past duration 0.999 too large",
+			want: Event{Level: constants.LevelWarning, Message: "Past duration 0.999 too large"},
+			ok:   true,
+		},
+		{line: "Setting pipeline to PLAYING ..."},
+		{line: "Additional debug info:"},
+	}
+
+	for _, tt := range tests {
+		got, ok := Parse(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriterRotatesAndReportsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.log")
+
+	var events []Event
+	w, err := Open(path, 64, 2, func(ev Event) { events = append(events, ev) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("Setting pipeline to PLAYING ...\n"))
+	}
+	w.Write([]byte("ERROR: from element /GstPipeline:pipeline0/GstRTSPSrc:src0: "))
+	w.Write([]byte("Could not read from resource.\nWARNING: unterminated"))
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[0].Source != "src0" || events[1].Level != constants.LevelWarning {
+		t.Errorf("events = %+v, want the split error line and the unterminated warning", events)
+	}
+
+	files := Files(path)
+	if len(files) != 3 || files[0] != Backup(path, 2) || files[2] != path {
+		t.Fatalf("Files() = %v, want two backups and the current file", files)
+	}
+
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || info.Size() > 64+int64(len("Could not read from resource.\nWARNING: unterminated")) {
+			t.Errorf("%s is not rotated: %v", f, err)
+		}
+	}
+
+	last, _ := os.ReadFile(path)
+	if !strings.Contains(string(last), "unterminated") {
+		t.Errorf("current file = %q, want the last write", last)
+	}
+}
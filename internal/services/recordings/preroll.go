@@ -0,0 +1,97 @@
+package recordingservice
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/preroll"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+type PreRoll interface {
+	Take(cameraID string, d time.Duration) (preroll.Clip, error)
+}
+
+// checkPreRoll rejects options the buffer can't be prepended to. The buffer
+// holds a single camera as it streams in MPEG-TS, so the recording has to be
+// the same. Without a container it is recorded in MPEG-TS, see
+// chooseContainer.
+func checkPreRoll(cameraIDs []string, opts models.RecordingOptions) error {
+	if opts.PreRollSeconds <= 0 {
+		return nil
+	}
+
+	if len(cameraIDs) > 1 || opts.ProfileID != "" || (opts.Proxy != nil && *opts.Proxy) {
+		return errs.ErrPreRollNotAllowed
+	}
+
+	if opts.Container != "" && opts.Container != constants.ContainerMPEGTS {
+		return errs.ErrPreRollNotAllowed
+	}
+
+	return nil
+}
+
+// checkPreRollSpec rejects a pre-roll for a recording that doesn't store the
+// stream as is in MPEG-TS. It catches what the options alone don't show: the
+// default profile of the camera and the container the recorder settles on.
+func checkPreRollSpec(spec recorder.Spec) error {
+	if spec.Profile != nil || spec.Container != constants.ContainerMPEGTS {
+		return errs.ErrPreRollNotAllowed
+	}
+
+	return nil
+}
+
+// takePreRoll returns the buffered media of the camera to prepend to a
+// recording, if its buffer has any.
+func (s *RecordingService) takePreRoll(cameraID string, seconds int) (preroll.Clip, error) {
+	if s.preRoll == nil {
+		return preroll.Clip{}, errs.ErrNoPreRoll
+	}
+
+	return s.preRoll.Take(cameraID, time.Duration(seconds)*time.Second)
+}
+
+// writePreRoll joins the chunks of the clip into path. MPEG-TS chunks play
+// back correctly when concatenated. The file gets the end of the clip as its
+// modification time, so it is indexed like any other segment.
+func writePreRoll(clip preroll.Clip, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, chunk := range clip.Chunks {
+		if err := appendFile(f, chunk.Path); err != nil {
+			os.Remove(path)
+
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+
+		return err
+	}
+
+	return os.Chtimes(path, clip.To(), clip.To())
+}
+
+func appendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+
+	return err
+}
@@ -0,0 +1,392 @@
+package preroll
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+const (
+	dirName    = "preroll"
+	filePrefix = "preroll_"
+
+	// restartDelay is the pause before a buffer pipeline that exited is
+	// started again.
+	restartDelay = 5 * time.Second
+	stopTimeout  = 5 * time.Second
+)
+
+type Recorder interface {
+	Start(spec recorder.Spec) (recorder.Process, error)
+}
+
+type CameraProvider interface {
+	Cameras() ([]models.Camera, error)
+}
+
+// Chunk is one file of the buffer. It ends at End, where the next one
+// starts.
+type Chunk struct {
+	Path string
+	End  time.Time
+}
+
+// Clip is the buffered media of a camera from From on, oldest chunk first.
+type Clip struct {
+	Chunks []Chunk
+	From   time.Time
+}
+
+// To is when the newest chunk was last written.
+func (c Clip) To() time.Time {
+	if len(c.Chunks) == 0 {
+		return c.From
+	}
+
+	return c.Chunks[len(c.Chunks)-1].End
+}
+
+// Buffer keeps the last minutes of every camera with a pre-roll retention as
+// rolling MPEG-TS segments next to its recordings. The camera stream is
+// stored as is.
+type Buffer struct {
+	log        *slog.Logger
+	recorder   Recorder
+	cameras    CameraProvider
+	videosPath string
+	segment    time.Duration
+	sync       time.Duration
+
+	mu    sync.Mutex
+	rings map[string]*ring
+	// closed keeps a sync that raced with Close from starting buffers
+	// again.
+	closed bool
+}
+
+type ring struct {
+	cam  models.Camera
+	dir  string
+	stop chan struct{}
+	done chan struct{}
+
+	mu        sync.Mutex
+	retention time.Duration
+}
+
+func New(log *slog.Logger, rec Recorder, cameras CameraProvider, videosPath string, cfg config.PreRoll) *Buffer {
+	return &Buffer{
+		log:        log,
+		recorder:   rec,
+		cameras:    cameras,
+		videosPath: videosPath,
+		segment:    cfg.Segment,
+		sync:       cfg.Sync,
+		rings:      make(map[string]*ring),
+	}
+}
+
+// Run follows camera changes every sync interval until ctx is done. The
+// buffers keep running until Close.
+func (b *Buffer) Run(ctx context.Context) {
+	b.Sync()
+
+	if b.sync <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(b.sync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Sync()
+		}
+	}
+}
+
+// Sync starts buffers of cameras that got a retention and stops those of
+// cameras that lost it or were deleted. A camera whose stream changed is
+// buffered anew.
+func (b *Buffer) Sync() {
+	const op = "service.preroll.Sync"
+
+	log := b.log.With(
+		slog.String("op", op),
+	)
+
+	cams, err := b.cameras.Cameras()
+	if err != nil {
+		log.Error("failed to get cameras", sl.Err(err))
+
+		return
+	}
+
+	want := make(map[string]models.Camera, len(cams))
+	for _, cam := range cams {
+		if cam.PreRollSeconds > 0 {
+			want[cam.CameraID] = cam
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	for cameraID, r := range b.rings {
+		cam, ok := want[cameraID]
+		if ok && cam.CameraIP == r.cam.CameraIP && cam.HasAudio == r.cam.HasAudio {
+			r.setRetention(seconds(cam.PreRollSeconds))
+
+			continue
+		}
+
+		r.close()
+		delete(b.rings, cameraID)
+
+		if !ok {
+			log.Info("pre-roll buffer stopped", slog.String("camera_id", cameraID))
+
+			if err := os.RemoveAll(r.dir); err != nil {
+				log.Error("failed to remove pre-roll buffer", slog.String("camera_id", cameraID), sl.Err(err))
+			}
+		}
+	}
+
+	for cameraID, cam := range want {
+		if _, ok := b.rings[cameraID]; ok {
+			continue
+		}
+
+		r := &ring{
+			cam:       cam,
+			dir:       filepath.Join(b.videosPath, cameraID, dirName),
+			stop:      make(chan struct{}),
+			done:      make(chan struct{}),
+			retention: seconds(cam.PreRollSeconds),
+		}
+		b.rings[cameraID] = r
+
+		log.Info("pre-roll buffer started", slog.String("camera_id", cameraID), slog.Duration("retention", r.retention))
+
+		go b.run(r)
+	}
+}
+
+// Close stops every buffer and waits for their pipelines to exit. No buffer
+// is started after it.
+func (b *Buffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for cameraID, r := range b.rings {
+		r.close()
+		delete(b.rings, cameraID)
+	}
+}
+
+// Take returns the buffered media of the last d of a camera. It is shorter
+// when the buffer does not reach that far back.
+func (b *Buffer) Take(cameraID string, d time.Duration) (Clip, error) {
+	const op = "service.preroll.Take"
+
+	b.mu.Lock()
+	r, ok := b.rings[cameraID]
+	b.mu.Unlock()
+
+	if !ok {
+		return Clip{}, fmt.Errorf("%s: %w", op, errs.ErrNoPreRoll)
+	}
+
+	chunks := r.chunks()
+	since := time.Now().Add(-d)
+
+	var clip Clip
+	for i, chunk := range chunks {
+		if !chunk.End.After(since) {
+			continue
+		}
+
+		clip.Chunks = chunks[i:]
+		clip.From = chunk.End.Add(-b.segment)
+		if i > 0 {
+			clip.From = chunks[i-1].End
+		}
+
+		break
+	}
+
+	if len(clip.Chunks) == 0 {
+		return Clip{}, fmt.Errorf("%s: %w", op, errs.ErrNoPreRoll)
+	}
+
+	clip.From = maxTime(clip.From, since)
+
+	return clip, nil
+}
+
+func (b *Buffer) run(r *ring) {
+	defer close(r.done)
+
+	log := b.log.With(
+		slog.String("op", "service.preroll.run"),
+		slog.String("camera_id", r.cam.CameraID),
+	)
+
+	if err := os.RemoveAll(r.dir); err != nil {
+		log.Error("failed to clear pre-roll buffer", sl.Err(err))
+	}
+	if err := os.MkdirAll(r.dir, os.ModePerm); err != nil {
+		log.Error("failed to create pre-roll buffer", sl.Err(err))
+
+		return
+	}
+
+	spec := recorder.Spec{
+		Sources:         []recorder.Source{{URI: r.cam.CameraIP, Audio: r.cam.HasAudio}},
+		Audio:           recorder.NoAudio,
+		Container:       constants.ContainerMPEGTS,
+		SegmentDuration: b.segment,
+		FilePath:        filepath.Join(r.dir, filePrefix+recorder.SegmentIndex+".ts"),
+	}
+	if r.cam.HasAudio {
+		spec.Audio = 0
+	}
+
+	for {
+		if chunks := r.chunks(); len(chunks) > 0 {
+			spec.SegmentStart = index(chunks[len(chunks)-1].Path) + 1
+		}
+
+		proc, err := b.recorder.Start(spec)
+		if err != nil {
+			log.Error("failed to start pre-roll buffer", sl.Err(err))
+		} else if stopped := b.watch(r, proc); stopped {
+			return
+		} else {
+			log.Warn("pre-roll pipeline exited, restarting", slog.Int("exit_code", proc.Status().ExitCode))
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// watch prunes the buffer while its pipeline runs. It reports whether the
+// buffer was stopped rather than the pipeline exiting on its own.
+func (b *Buffer) watch(r *ring, proc recorder.Process) bool {
+	ticker := time.NewTicker(b.segment)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			proc.Stop()
+			proc.Wait(stopTimeout)
+
+			return true
+		case <-proc.Done():
+			return false
+		case <-ticker.C:
+			r.prune(b.segment)
+		}
+	}
+}
+
+func (r *ring) close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *ring) setRetention(d time.Duration) {
+	r.mu.Lock()
+	r.retention = d
+	r.mu.Unlock()
+}
+
+// prune removes chunks that ended before the retention, keeping the one
+// that is being written.
+func (r *ring) prune(segment time.Duration) {
+	r.mu.Lock()
+	cutoff := time.Now().Add(-r.retention - segment)
+	r.mu.Unlock()
+
+	chunks := r.chunks()
+	for _, chunk := range chunks[:max(len(chunks)-1, 0)] {
+		if chunk.End.Before(cutoff) {
+			os.Remove(chunk.Path)
+		}
+	}
+}
+
+// chunks lists the buffer files in the order they were written.
+func (r *ring) chunks() []Chunk {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil
+	}
+
+	var chunks []Chunk
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), filePrefix) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		chunks = append(chunks, Chunk{Path: filepath.Join(r.dir, e.Name()), End: info.ModTime()})
+	}
+
+	// Indexes outgrow their padding, so they are compared as numbers.
+	sort.Slice(chunks, func(i, j int) bool { return index(chunks[i].Path) < index(chunks[j].Path) })
+
+	return chunks
+}
+
+func index(path string) int {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filePrefix), filepath.Ext(path))
+
+	i, _ := strconv.Atoi(name)
+
+	return i
+}
+
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,146 @@
+package preroll
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/fake"
+)
+
+type stubCameras struct {
+	mu   sync.Mutex
+	cams []models.Camera
+}
+
+func (c *stubCameras) Cameras() ([]models.Camera, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cams, nil
+}
+
+func (c *stubCameras) set(cams ...models.Camera) {
+	c.mu.Lock()
+	c.cams = cams
+	c.mu.Unlock()
+}
+
+func newTestBuffer(t *testing.T) (*Buffer, *stubCameras, string) {
+	t.Helper()
+
+	rec := fake.New()
+	rec.Interval = 2 * time.Millisecond
+
+	cameras := &stubCameras{}
+	videos := t.TempDir()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	b := New(log, rec, cameras, videos, config.PreRoll{Segment: 20 * time.Millisecond})
+	t.Cleanup(b.Close)
+
+	return b, cameras, videos
+}
+
+func TestTake(t *testing.T) {
+	b, cameras, videos := newTestBuffer(t)
+
+	cameras.set(
+		models.Camera{CameraID: "cam", CameraIP: "rtsp://cam", PreRollSeconds: 10},
+		models.Camera{CameraID: "off", CameraIP: "rtsp://off"},
+	)
+	b.Sync()
+
+	time.Sleep(150 * time.Millisecond)
+
+	if _, err := b.Take("off", time.Second); !errors.Is(err, errs.ErrNoPreRoll) {
+		t.Errorf("Take() of a camera without buffer error = %v, want %v", err, errs.ErrNoPreRoll)
+	}
+
+	clip, err := b.Take("cam", time.Second)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	if len(clip.Chunks) < 3 {
+		t.Fatalf("Take() = %d chunks, want the whole buffer", len(clip.Chunks))
+	}
+
+	for i, chunk := range clip.Chunks {
+		if index(chunk.Path) != i {
+			t.Errorf("chunk %d = %s, want chunks in order", i, chunk.Path)
+		}
+		if i > 0 && chunk.End.Before(clip.Chunks[i-1].End) {
+			t.Errorf("chunk %d ends before the previous one", i)
+		}
+	}
+
+	if !clip.From.Before(clip.Chunks[0].End) || clip.To().After(time.Now()) {
+		t.Errorf("clip = %v..%v, want it to end before now", clip.From, clip.To())
+	}
+
+	short, err := b.Take("cam", 30*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if len(short.Chunks) >= len(clip.Chunks) || short.From.Before(time.Now().Add(-time.Second)) {
+		t.Errorf("Take(30ms) = %d chunks from %v, want only the newest", len(short.Chunks), short.From)
+	}
+
+	cameras.set()
+	b.Sync()
+
+	if _, err := os.Stat(filepath.Join(videos, "cam", dirName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("buffer of a camera without retention still exists: %v", err)
+	}
+	if _, err := b.Take("cam", time.Second); !errors.Is(err, errs.ErrNoPreRoll) {
+		t.Errorf("Take() after the buffer was stopped error = %v, want %v", err, errs.ErrNoPreRoll)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	b, cameras, _ := newTestBuffer(t)
+
+	cameras.set(models.Camera{CameraID: "cam", CameraIP: "rtsp://cam", PreRollSeconds: 10})
+	b.Sync()
+
+	time.Sleep(100 * time.Millisecond)
+
+	r := b.rings["cam"]
+	if n := len(r.chunks()); n < 3 {
+		t.Fatalf("buffer has %d chunks, want several", n)
+	}
+
+	r.setRetention(0)
+	time.Sleep(100 * time.Millisecond)
+
+	// Only the chunk being written and the one before it are left.
+	if n := len(r.chunks()); n > 3 {
+		t.Errorf("buffer has %d chunks after the retention was cut, want at most 3", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b, cameras, _ := newTestBuffer(t)
+
+	cameras.set(models.Camera{CameraID: "cam", CameraIP: "rtsp://cam", PreRollSeconds: 10})
+	b.Sync()
+
+	b.Close()
+	b.Sync()
+
+	if n := len(b.rings); n != 0 {
+		t.Errorf("%d buffers running after Close, want none", n)
+	}
+	if _, err := b.Take("cam", time.Second); !errors.Is(err, errs.ErrNoPreRoll) {
+		t.Errorf("Take() after Close error = %v, want %v", err, errs.ErrNoPreRoll)
+	}
+}
@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+const (
+	H264 = "h264"
+	H265 = "h265"
+	VP9  = "vp9"
+	AV1  = "av1"
+)
+
+const (
+	MP3  = "mp3"
+	AAC  = "aac"
+	Opus = "opus"
+	// NoAudio drops the audio even when a camera with audio is selected.
+	NoAudio = "none"
+)
+
+// presets are the x264 speed presets from fastest to slowest. They are used
+// for every codec; libvpx and libaom get a matching cpu-used value.
+var presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+
+// CPUUsed maps a speed preset to the libvpx/libaom cpu-used scale, where 8
+// is the fastest. An empty preset returns -1 to keep the encoder default.
+func CPUUsed(preset string) int {
+	for i, p := range presets {
+		if p == preset {
+			return max(8-i, 0)
+		}
+	}
+
+	return -1
+}
+
+func Validate(p models.Profile) error {
+	switch p.VideoCodec {
+	case H264, H265, VP9, AV1:
+	default:
+		return fmt.Errorf("%w: unknown video codec %q", errs.ErrInvalidProfile, p.VideoCodec)
+	}
+
+	switch p.AudioCodec {
+	case MP3, AAC, Opus, NoAudio:
+	default:
+		return fmt.Errorf("%w: unknown audio codec %q", errs.ErrInvalidProfile, p.AudioCodec)
+	}
+
+	if p.Preset != "" && CPUUsed(p.Preset) < 0 {
+		return fmt.Errorf("%w: unknown preset %q", errs.ErrInvalidProfile, p.Preset)
+	}
+
+	if p.VideoBitrate < 0 || p.AudioBitrate < 0 || p.KeyframeInterval < 0 || p.Framerate < 0 {
+		return fmt.Errorf("%w: values can not be negative", errs.ErrInvalidProfile)
+	}
+
+	if p.Width < 0 || p.Height < 0 || (p.Width == 0) != (p.Height == 0) {
+		return fmt.Errorf("%w: width and height must be set together", errs.ErrInvalidProfile)
+	}
+
+	// Encoders need even dimensions for 4:2:0 video.
+	if p.Width%2 != 0 || p.Height%2 != 0 {
+		return fmt.Errorf("%w: width and height must be even", errs.ErrInvalidProfile)
+	}
+
+	return nil
+}
+
+// CheckContainer returns an error when the codecs of p can not be written to
+// the container. VP9 and AV1 have no MPEG-TS mapping in GStreamer and ffmpeg.
+func CheckContainer(p models.Profile, container string) error {
+	if container != constants.ContainerMPEGTS {
+		return nil
+	}
+
+	switch p.VideoCodec {
+	case VP9, AV1:
+		return fmt.Errorf("%w: %s can not be written to MPEG-TS", errs.ErrInvalidProfile, p.VideoCodec)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func TestValidate(t *testing.T) {
+	valid := models.Profile{VideoCodec: H265, Preset: "fast", VideoBitrate: 4000, Width: 1920, Height: 1080, AudioCodec: AAC}
+
+	tests := []struct {
+		name   string
+		modify func(p *models.Profile)
+		ok     bool
+	}{
+		{name: "valid", modify: func(p *models.Profile) {}, ok: true},
+		{name: "source size", modify: func(p *models.Profile) { p.Width, p.Height = 0, 0 }, ok: true},
+		{name: "unknown video codec", modify: func(p *models.Profile) { p.VideoCodec = "mpeg2" }},
+		{name: "unknown audio codec", modify: func(p *models.Profile) { p.AudioCodec = "" }},
+		{name: "unknown preset", modify: func(p *models.Profile) { p.Preset = "turbo" }},
+		{name: "negative bitrate", modify: func(p *models.Profile) { p.VideoBitrate = -1 }},
+		{name: "only width", modify: func(p *models.Profile) { p.Height = 0 }},
+		{name: "odd height", modify: func(p *models.Profile) { p.Height = 1079 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+
+			err := Validate(p)
+			if tt.ok && err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, errs.ErrInvalidProfile) {
+				t.Fatalf("Validate() error = %v, want %v", err, errs.ErrInvalidProfile)
+			}
+		})
+	}
+}
+
+func TestCPUUsed(t *testing.T) {
+	tests := map[string]int{"ultrafast": 8, "medium": 3, "veryslow": 0, "placebo": 0, "": -1}
+
+	for preset, want := range tests {
+		if got := CPUUsed(preset); got != want {
+			t.Errorf("CPUUsed(%q) = %d, want %d", preset, got, want)
+		}
+	}
+}
+
+func TestCheckContainer(t *testing.T) {
+	tests := []struct {
+		codec     string
+		container string
+		ok        bool
+	}{
+		{codec: H264, container: constants.ContainerMPEGTS, ok: true},
+		{codec: VP9, container: constants.ContainerMatroska, ok: true},
+		{codec: AV1, container: constants.ContainerMP4, ok: true},
+		{codec: VP9, container: constants.ContainerMPEGTS},
+		{codec: AV1, container: constants.ContainerMPEGTS},
+	}
+
+	for _, tt := range tests {
+		err := CheckContainer(models.Profile{VideoCodec: tt.codec}, tt.container)
+		if tt.ok && err != nil {
+			t.Errorf("CheckContainer(%s, %s) error = %v", tt.codec, tt.container, err)
+		}
+		if !tt.ok && !errors.Is(err, errs.ErrInvalidProfile) {
+			t.Errorf("CheckContainer(%s, %s) error = %v, want %v", tt.codec, tt.container, err, errs.ErrInvalidProfile)
+		}
+	}
+}
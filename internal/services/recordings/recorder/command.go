@@ -0,0 +1,115 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Command is a Process backed by an external binary that finishes its output
+// file on SIGINT, like gst-launch-1.0 -e or ffmpeg.
+type Command struct {
+	proc     *os.Process
+	done     chan struct{}
+	exitCode int
+}
+
+func StartCommand(argv []string, log io.Writer) (*Command, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if log != nil {
+		cmd.Stdout, cmd.Stderr = log, log
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &Command{
+		proc: cmd.Process,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		cmd.Wait()
+		c.exitCode = cmd.ProcessState.ExitCode()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// AdoptCommand tracks a process started by a previous run of the service if it
+// is still alive and writing to filePath. It is not our child, so its exit
+// code can't be collected.
+func AdoptCommand(pid int, filePath string) (*Command, bool) {
+	if pid <= 0 {
+		return nil, false
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, false
+	}
+
+	if err := proc.Signal(syscall.Signal(0)); err != nil {
+		return nil, false
+	}
+
+	// pid may have been reused by an unrelated process after a restart
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err == nil && !strings.Contains(string(cmdline), filePath) {
+		return nil, false
+	}
+
+	c := &Command{
+		proc:     proc,
+		done:     make(chan struct{}),
+		exitCode: ExitCodeUnknown,
+	}
+
+	go func() {
+		for proc.Signal(syscall.Signal(0)) == nil {
+			time.Sleep(time.Second)
+		}
+		close(c.done)
+	}()
+
+	return c, true
+}
+
+func (c *Command) PID() int {
+	return c.proc.Pid
+}
+
+func (c *Command) Stop() error {
+	return c.proc.Signal(os.Interrupt)
+}
+
+func (c *Command) Status() Status {
+	select {
+	case <-c.done:
+		return Status{PID: c.proc.Pid, ExitCode: c.exitCode}
+	default:
+		return Status{PID: c.proc.Pid, Running: true, ExitCode: ExitCodeUnknown}
+	}
+}
+
+func (c *Command) Wait(timeout time.Duration) (Status, bool) {
+	select {
+	case <-c.done:
+		return c.Status(), false
+	case <-time.After(timeout):
+	}
+
+	c.proc.Kill()
+	<-c.done
+
+	return c.Status(), true
+}
+
+func (c *Command) Done() <-chan struct{} {
+	return c.done
+}
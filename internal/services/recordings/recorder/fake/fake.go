@@ -0,0 +1,224 @@
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+// Recorder writes a synthetic file instead of capturing a camera, so the
+// recording flow can run without GStreamer and a live RTSP source.
+type Recorder struct {
+	Interval time.Duration
+	Audio    bool
+	// Failures is the number of started processes that exit with an error
+	// after FailAfter, to simulate a camera dropping out.
+	Failures  int
+	FailAfter time.Duration
+	// StopErrors is the number of Stop calls that fail, to simulate a
+	// pipeline that can't be interrupted.
+	StopErrors int
+	// Stats reports packet statistics like the native backend, one packet
+	// per written frame.
+	Stats bool
+
+	mu sync.Mutex
+}
+
+func New() *Recorder {
+	return &Recorder{Interval: 100 * time.Millisecond}
+}
+
+func (r *Recorder) Probe(uri string) (bool, error) {
+	return r.Audio, nil
+}
+
+func (r *Recorder) Container(spec recorder.Spec) string {
+	return recorder.DefaultContainer(spec)
+}
+
+func (r *Recorder) Start(spec recorder.Spec) (recorder.Process, error) {
+	p := &process{
+		recorder: r,
+		spec:     spec,
+		segment:  spec.SegmentStart,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	if r.Failures > 0 {
+		r.Failures--
+		p.failAt = time.Now().Add(r.FailAfter)
+	}
+	r.mu.Unlock()
+
+	f, err := p.create()
+	if err != nil {
+		return nil, err
+	}
+
+	go p.run(f, r.Interval)
+
+	return p, nil
+}
+
+func (r *Recorder) Adopt(pid int, filePath string) (recorder.Process, bool) {
+	return nil, false
+}
+
+type process struct {
+	recorder *Recorder
+	spec     recorder.Spec
+	segment  int
+	opened   time.Time
+	failAt   time.Time
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	exitCode int
+
+	statsMu sync.Mutex
+	stats   recorder.Stats
+}
+
+// create opens the output file, or the next segment of a segmented
+// recording. The proxy is only created, frames go to the master.
+func (p *process) create() (*os.File, error) {
+	path := p.spec.FilePath
+	if p.spec.SegmentDuration > 0 {
+		path = recorder.SegmentPath(path, p.segment)
+	}
+
+	if p.spec.Proxy != nil {
+		proxyPath := p.spec.Proxy.FilePath
+		if p.spec.SegmentDuration > 0 {
+			proxyPath = recorder.SegmentPath(proxyPath, p.segment)
+		}
+
+		if err := os.WriteFile(proxyPath, []byte("proxy\n"), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.spec.SegmentDuration > 0 {
+		p.segment++
+	}
+
+	p.opened = time.Now()
+
+	return os.Create(path)
+}
+
+func (p *process) run(f *os.File, interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		if !p.failAt.IsZero() && time.Now().After(p.failAt) {
+			if p.spec.Log != nil {
+				fmt.Fprintln(p.spec.Log, "ERROR: from element /GstPipeline:pipeline0/GstRTSPSrc:src0: Could not read from resource.")
+			}
+
+			p.exitCode = 1
+			f.Close()
+
+			return
+		}
+
+		if p.spec.SegmentDuration > 0 && time.Since(p.opened) >= p.spec.SegmentDuration {
+			f.Close()
+
+			var err error
+			if f, err = p.create(); err != nil {
+				p.exitCode = 1
+
+				return
+			}
+		}
+
+		n, err := fmt.Fprintf(f, "frame %d sources %d\n", frame, len(p.spec.Sources))
+		if err != nil {
+			p.exitCode = 1
+			f.Close()
+
+			return
+		}
+
+		p.statsMu.Lock()
+		p.stats.RTPPackets++
+		p.stats.VideoFrames++
+		p.stats.Bytes += uint64(n)
+		p.statsMu.Unlock()
+
+		select {
+		case <-p.stop:
+			if err := f.Close(); err != nil {
+				p.exitCode = 1
+			}
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *process) PID() int {
+	return 0
+}
+
+func (p *process) Stop() error {
+	p.recorder.mu.Lock()
+	if p.recorder.StopErrors > 0 {
+		p.recorder.StopErrors--
+		p.recorder.mu.Unlock()
+
+		return errors.New("failed to interrupt pipeline")
+	}
+	p.recorder.mu.Unlock()
+
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	return nil
+}
+
+func (p *process) Status() recorder.Status {
+	var stats *recorder.Stats
+	if p.recorder.Stats {
+		p.statsMu.Lock()
+		s := p.stats
+		p.statsMu.Unlock()
+
+		stats = &s
+	}
+
+	select {
+	case <-p.done:
+		return recorder.Status{ExitCode: p.exitCode, Stats: stats}
+	default:
+		return recorder.Status{Running: true, ExitCode: recorder.ExitCodeUnknown, Stats: stats}
+	}
+}
+
+func (p *process) Wait(timeout time.Duration) (recorder.Status, bool) {
+	select {
+	case <-p.done:
+		return p.Status(), false
+	case <-time.After(timeout):
+	}
+
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+
+	return recorder.Status{ExitCode: recorder.ExitCodeUnknown}, true
+}
+
+func (p *process) Done() <-chan struct{} {
+	return p.done
+}
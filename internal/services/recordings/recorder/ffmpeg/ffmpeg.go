@@ -0,0 +1,299 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+const binary = "ffmpeg"
+
+var ErrNoSources = errors.New("no sources to record")
+
+var formats = map[string]string{
+	constants.ContainerMatroska: "matroska",
+	constants.ContainerMP4:      "mp4",
+	constants.ContainerMPEGTS:   "mpegts",
+}
+
+// fragmented makes the MP4 muxer write the header first and then a fragment
+// per keyframe, so the file plays while it is being written.
+const fragmented = "frag_keyframe+empty_moov+default_base_moof"
+
+type Recorder struct{}
+
+func New() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Probe(uri string) (bool, error) {
+	return recorder.ProbeRTSP(uri)
+}
+
+func (r *Recorder) Container(spec recorder.Spec) string {
+	return recorder.DefaultContainer(spec)
+}
+
+func (r *Recorder) Start(spec recorder.Spec) (recorder.Process, error) {
+	argv, err := Argv(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := recorder.StartCommand(argv, spec.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func (r *Recorder) Adopt(pid int, filePath string) (recorder.Process, bool) {
+	return recorder.AdoptCommand(pid, filePath)
+}
+
+// Argv mirrors the gst-launch recording modes: passthrough video for a single
+// camera, mp3 audio when the camera's audio is selected, and a layout mix of
+// all cameras otherwise. A profile replaces the default encoders. A proxy is
+// written as a second output from the same inputs.
+func Argv(spec recorder.Spec) ([]string, error) {
+	if len(spec.Sources) == 0 {
+		return nil, ErrNoSources
+	}
+
+	argv := []string{binary, "-nostdin", "-loglevel", "level+warning"}
+	for _, src := range spec.Sources {
+		argv = append(argv, "-rtsp_transport", "tcp", "-i", src.URI)
+	}
+
+	video, proxyVideo, audio := "0:v", "0:v", ""
+	var master []string
+	switch {
+	case len(spec.Sources) == 1 && spec.Audio == 0:
+		audio = "0:a"
+		master = streams(video, audio, videoArgs(spec.Profile), audioArgs(spec.Profile))
+	case len(spec.Sources) == 1 && spec.Profile != nil:
+		master = streams(video, audio, videoArgs(spec.Profile), nil)
+	case len(spec.Sources) == 1:
+		master = streams(video, audio, []string{"-c:v", "copy"}, nil)
+	default:
+		if len(spec.Layout.Slots) != len(spec.Sources) {
+			return nil, fmt.Errorf("layout has %d slots for %d sources", len(spec.Layout.Slots), len(spec.Sources))
+		}
+
+		graph, err := filter(spec.Layout)
+		if err != nil {
+			return nil, err
+		}
+
+		// A filter output can be mapped only once, the proxy gets a copy.
+		video = "[v]"
+		if spec.Proxy != nil {
+			graph += ";[v]split[vm][vp]"
+			video, proxyVideo = "[vm]", "[vp]"
+		}
+
+		if spec.Audio != recorder.NoAudio {
+			audio = fmt.Sprintf("%d:a", spec.Audio)
+		}
+
+		argv = append(argv, "-filter_complex", graph)
+		master = streams(video, audio, videoArgs(spec.Profile), audioArgs(spec.Profile))
+	}
+
+	out, err := output(spec, spec.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	argv = append(argv, master...)
+	argv = append(argv, out...)
+
+	if spec.Proxy == nil {
+		return argv, nil
+	}
+
+	p := &spec.Proxy.Profile
+	if p.AudioCodec == profile.NoAudio {
+		audio = ""
+	}
+
+	out, err = output(spec, spec.Proxy.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	argv = append(argv, streams(proxyVideo, audio, videoArgs(p), audioArgs(p))...)
+
+	return append(argv, out...), nil
+}
+
+// streams maps the video and, if set, the audio stream with their encoder
+// options.
+func streams(video, audio string, vargs, aargs []string) []string {
+	args := append([]string{"-map", video}, vargs...)
+	if audio != "" {
+		args = append(args, "-map", audio)
+		args = append(args, aargs...)
+	}
+
+	return args
+}
+
+// output returns the muxer options followed by the file path.
+func output(spec recorder.Spec, path string) ([]string, error) {
+	container := recorder.DefaultContainer(spec)
+	format, ok := formats[container]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errs.ErrUnknownContainer, container)
+	}
+
+	if spec.SegmentDuration > 0 {
+		segmentTime := strconv.FormatFloat(spec.SegmentDuration.Seconds(), 'f', -1, 64)
+
+		args := []string{"-f", "segment", "-segment_time", segmentTime, "-segment_format", format,
+			"-segment_start_number", strconv.Itoa(spec.SegmentStart)}
+		if container == constants.ContainerMP4 {
+			args = append(args, "-segment_format_options", "movflags="+fragmented)
+		}
+
+		return append(args, path), nil
+	}
+
+	var args []string
+	if container == constants.ContainerMP4 {
+		args = append(args, "-movflags", fragmented)
+	}
+
+	return append(args, "-f", format, path), nil
+}
+
+// videoArgs returns the encoder options of the profile, libx264 defaults when
+// there is none.
+func videoArgs(p *models.Profile) []string {
+	if p == nil {
+		return []string{"-c:v", "libx264"}
+	}
+
+	var args []string
+	switch p.VideoCodec {
+	case profile.H265:
+		args = []string{"-c:v", "libx265"}
+	case profile.VP9:
+		args = []string{"-c:v", "libvpx-vp9"}
+	case profile.AV1:
+		args = []string{"-c:v", "libaom-av1"}
+	default:
+		args = []string{"-c:v", "libx264"}
+	}
+
+	if p.VideoBitrate > 0 {
+		args = append(args, "-b:v", fmt.Sprintf("%dk", p.VideoBitrate))
+	}
+
+	if p.Preset != "" {
+		switch p.VideoCodec {
+		case profile.VP9, profile.AV1:
+			args = append(args, "-cpu-used", strconv.Itoa(profile.CPUUsed(p.Preset)))
+		default:
+			args = append(args, "-preset", p.Preset)
+		}
+	}
+
+	if p.KeyframeInterval > 0 {
+		args = append(args, "-g", strconv.Itoa(p.KeyframeInterval))
+	}
+
+	if p.Width > 0 {
+		args = append(args, "-s", fmt.Sprintf("%dx%d", p.Width, p.Height))
+	}
+
+	if p.Framerate > 0 {
+		args = append(args, "-r", strconv.Itoa(p.Framerate))
+	}
+
+	return args
+}
+
+func audioArgs(p *models.Profile) []string {
+	if p == nil {
+		return []string{"-c:a", "libmp3lame"}
+	}
+
+	var args []string
+	switch p.AudioCodec {
+	case profile.AAC:
+		args = []string{"-c:a", "aac"}
+	case profile.Opus:
+		args = []string{"-c:a", "libopus"}
+	default:
+		args = []string{"-c:a", "libmp3lame"}
+	}
+
+	if p.AudioBitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", p.AudioBitrate))
+	}
+
+	return args
+}
+
+// filter scales every input into its slot, pads it with the slot border and
+// overlays the results on the layout background from the lowest z-order to
+// the highest.
+func filter(l layout.Layout) (string, error) {
+	order := make([]int, len(l.Slots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return l.Slots[order[a]].ZOrder < l.Slots[order[b]].ZOrder
+	})
+
+	background := uint32(0)
+	if l.Background != "" {
+		var err error
+		if background, err = layout.Color(l.Background); err != nil {
+			return "", err
+		}
+	}
+
+	parts := []string{fmt.Sprintf("color=c=0x%06x:s=%dx%d[base0]", background, l.Width, l.Height)}
+	for i, slot := range l.Slots {
+		borderColor := slot.BorderColor
+		if borderColor == "" {
+			borderColor = layout.DefaultBorderColor
+		}
+
+		color, err := layout.Color(borderColor)
+		if err != nil {
+			return "", err
+		}
+
+		if slot.Border == 0 {
+			color = background
+		}
+
+		parts = append(parts, fmt.Sprintf("[%[1]d:v]scale=%[2]d:%[3]d:force_original_aspect_ratio=decrease,pad=%[4]d:%[5]d:(ow-iw)/2:(oh-ih)/2:color=0x%06[6]x[v%[1]d]",
+			i, slot.Width, slot.Height, slot.Width+2*slot.Border, slot.Height+2*slot.Border, color))
+	}
+
+	for n, i := range order {
+		out := fmt.Sprintf("[base%d]", n+1)
+		if n == len(order)-1 {
+			out = "[v]"
+		}
+		slot := l.Slots[i]
+		parts = append(parts, fmt.Sprintf("[base%d][v%d]overlay=%d:%d:shortest=1%s", n, i, slot.X-slot.Border, slot.Y-slot.Border, out))
+	}
+
+	return strings.Join(parts, ";"), nil
+}
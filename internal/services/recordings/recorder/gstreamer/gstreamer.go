@@ -0,0 +1,38 @@
+package gstreamer
+
+import (
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/pipeline"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+type Recorder struct{}
+
+func New() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Probe(uri string) (bool, error) {
+	return recorder.ProbeRTSP(uri)
+}
+
+func (r *Recorder) Container(spec recorder.Spec) string {
+	return recorder.DefaultContainer(spec)
+}
+
+func (r *Recorder) Start(spec recorder.Spec) (recorder.Process, error) {
+	p, err := pipeline.Build(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := recorder.StartCommand(p.Argv(), spec.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func (r *Recorder) Adopt(pid int, filePath string) (recorder.Process, bool) {
+	return recorder.AdoptCommand(pid, filePath)
+}
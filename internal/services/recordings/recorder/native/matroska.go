@@ -0,0 +1,355 @@
+package native
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+)
+
+// Matroska element IDs, with their marker bits.
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment        = 0x18538067
+	idInfo           = 0x1549A966
+	idTimestampScale = 0x2AD7B1
+	idMuxingApp      = 0x4D80
+	idWritingApp     = 0x5741
+
+	idTracks            = 0x1654AE6B
+	idTrackEntry        = 0xAE
+	idTrackNumber       = 0xD7
+	idTrackUID          = 0x73C5
+	idTrackType         = 0x83
+	idCodecID           = 0x86
+	idCodecPrivate      = 0x63A2
+	idVideo             = 0xE0
+	idPixelWidth        = 0xB0
+	idPixelHeight       = 0xBA
+	idAudio             = 0xE1
+	idSamplingFrequency = 0xB5
+	idChannels          = 0x9F
+
+	idCluster     = 0x1F43B675
+	idTimestamp   = 0xE7
+	idSimpleBlock = 0xA3
+)
+
+const (
+	videoTrackNumber = 1
+	audioTrackNumber = 2
+
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+
+	// unknownSize marks the segment and the clusters as running until the
+	// next element of their level, so the file is written in one pass.
+	unknownSize = 0x01FFFFFFFFFFFFFF
+
+	keyframeFlag = 0x80
+)
+
+// matroskaMuxer writes H264 and AAC to Matroska, timestamps in
+// milliseconds. The segment and the clusters have no size, like a live
+// stream, so a recording that is cut off stays playable. There is no seek
+// index.
+type matroskaMuxer struct {
+	w *bufio.Writer
+
+	sps []byte
+	pps []byte
+
+	audio *mpeg4audio.Config
+
+	firstIDRReceived bool
+	startPTS         time.Duration
+	// cluster is the timestamp of the open cluster, -1 before the first.
+	cluster int64
+}
+
+func newMatroskaMuxer(w io.Writer, sps, pps []byte, audio *mpeg4audio.Config) *matroskaMuxer {
+	return &matroskaMuxer{
+		w:       bufio.NewWriter(w),
+		sps:     sps,
+		pps:     pps,
+		audio:   audio,
+		cluster: -1,
+	}
+}
+
+func (m *matroskaMuxer) flush() error {
+	return m.w.Flush()
+}
+
+// writeH264 writes one access unit. Everything before the first IDR is
+// dropped, the header is written with its parameter sets and timestamps are
+// shifted so the file starts at zero.
+func (m *matroskaMuxer) writeH264(nalus [][]byte, pts time.Duration) (bool, error) {
+	var frame [][]byte
+
+	idrPresent := false
+	nonIDRPresent := false
+
+	for _, nalu := range nalus {
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			m.sps = append([]byte(nil), nalu...)
+			continue
+		case h264.NALUTypePPS:
+			m.pps = append([]byte(nil), nalu...)
+			continue
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+		case h264.NALUTypeIDR:
+			idrPresent = true
+		case h264.NALUTypeNonIDR:
+			nonIDRPresent = true
+		}
+
+		frame = append(frame, nalu)
+	}
+
+	if !idrPresent && !nonIDRPresent {
+		return false, nil
+	}
+
+	if !m.firstIDRReceived {
+		// The header needs the parameter sets, a camera that only sends
+		// them in band has them with a later IDR.
+		if !idrPresent || m.sps == nil || m.pps == nil {
+			return false, nil
+		}
+
+		if err := m.writeHeader(); err != nil {
+			return false, err
+		}
+
+		m.firstIDRReceived = true
+		m.startPTS = pts
+	}
+
+	ts := (pts - m.startPTS).Milliseconds()
+	if ts < 0 {
+		return false, nil
+	}
+
+	// Parameter sets are repeated in front of every IDR, in case the camera
+	// changes them.
+	if idrPresent {
+		frame = append([][]byte{m.sps, m.pps}, frame...)
+	}
+
+	avcc, err := h264.AVCCMarshal(frame)
+	if err != nil {
+		return false, err
+	}
+
+	if err := m.writeBlock(videoTrackNumber, ts, idrPresent, avcc); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// writeAAC writes access units that start at pts. Audio that arrives before
+// the first video IDR is dropped to keep both tracks aligned.
+func (m *matroskaMuxer) writeAAC(aus [][]byte, pts time.Duration) (int, error) {
+	if m.audio == nil || !m.firstIDRReceived {
+		return 0, nil
+	}
+
+	written := 0
+	for i, au := range aus {
+		auPTS := pts + time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*time.Second/time.Duration(m.audio.SampleRate) - m.startPTS
+		if auPTS < 0 {
+			continue
+		}
+
+		if err := m.writeBlock(audioTrackNumber, auPTS.Milliseconds(), true, au); err != nil {
+			return written, err
+		}
+
+		written++
+	}
+
+	return written, nil
+}
+
+// writeBlock writes a frame, opening a cluster at every video keyframe and
+// when the timestamp no longer fits the block.
+func (m *matroskaMuxer) writeBlock(track uint64, ts int64, keyframe bool, data []byte) error {
+	rel := ts - m.cluster
+	if m.cluster < 0 || (track == videoTrackNumber && keyframe) || rel < math.MinInt16 || rel > math.MaxInt16 {
+		cluster := element(idTimestamp, uintData(uint64(ts)))
+		if _, err := m.w.Write(append(elementHeader(idCluster, unknownSize), cluster...)); err != nil {
+			return err
+		}
+
+		m.cluster, rel = ts, 0
+	}
+
+	var flags byte
+	if keyframe {
+		flags = keyframeFlag
+	}
+
+	block := make([]byte, 0, len(data)+4)
+	block = append(block, byte(0x80|track))
+	block = binary.BigEndian.AppendUint16(block, uint16(int16(rel)))
+	block = append(block, flags)
+	block = append(block, data...)
+
+	_, err := m.w.Write(element(idSimpleBlock, block))
+
+	return err
+}
+
+func (m *matroskaMuxer) writeHeader() error {
+	var sps h264.SPS
+	if err := sps.Unmarshal(m.sps); err != nil {
+		return err
+	}
+
+	header := element(idEBML, concat(
+		element(idEBMLVersion, uintData(1)),
+		element(idEBMLReadVersion, uintData(1)),
+		element(idEBMLMaxIDLength, uintData(4)),
+		element(idEBMLMaxSizeLength, uintData(8)),
+		element(idDocType, []byte("matroska")),
+		element(idDocTypeVersion, uintData(4)),
+		element(idDocTypeReadVersion, uintData(2)),
+	))
+
+	info := element(idInfo, concat(
+		element(idTimestampScale, uintData(uint64(time.Millisecond))),
+		element(idMuxingApp, []byte("studio_recorder")),
+		element(idWritingApp, []byte("studio_recorder")),
+	))
+
+	tracks := element(idTrackEntry, concat(
+		element(idTrackNumber, uintData(videoTrackNumber)),
+		element(idTrackUID, uintData(videoTrackNumber)),
+		element(idTrackType, uintData(trackTypeVideo)),
+		element(idCodecID, []byte("V_MPEG4/ISO/AVC")),
+		element(idCodecPrivate, avcConfig(m.sps, m.pps)),
+		element(idVideo, concat(
+			element(idPixelWidth, uintData(uint64(sps.Width()))),
+			element(idPixelHeight, uintData(uint64(sps.Height()))),
+		)),
+	))
+
+	if m.audio != nil {
+		config, err := m.audio.Marshal()
+		if err != nil {
+			return err
+		}
+
+		tracks = append(tracks, element(idTrackEntry, concat(
+			element(idTrackNumber, uintData(audioTrackNumber)),
+			element(idTrackUID, uintData(audioTrackNumber)),
+			element(idTrackType, uintData(trackTypeAudio)),
+			element(idCodecID, []byte("A_AAC")),
+			element(idCodecPrivate, config),
+			element(idAudio, concat(
+				element(idSamplingFrequency, floatData(float64(m.audio.SampleRate))),
+				element(idChannels, uintData(uint64(m.audio.ChannelCount))),
+			)),
+		))...)
+	}
+
+	_, err := m.w.Write(concat(
+		header,
+		elementHeader(idSegment, unknownSize),
+		info,
+		element(idTracks, tracks),
+	))
+
+	return err
+}
+
+// avcConfig is the AVCDecoderConfigurationRecord of the parameter sets,
+// with 4 byte NALU lengths.
+func avcConfig(sps, pps []byte) []byte {
+	b := []byte{1, sps[1], sps[2], sps[3], 0xFF, 0xE1}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(sps)))
+	b = append(b, sps...)
+	b = append(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(pps)))
+
+	return append(b, pps...)
+}
+
+func element(id uint32, data []byte) []byte {
+	return append(elementHeader(id, uint64(len(data))), data...)
+}
+
+func elementHeader(id uint32, size uint64) []byte {
+	var b []byte
+	switch {
+	case id > 0xFFFFFF:
+		b = binary.BigEndian.AppendUint32(b, id)
+	case id > 0xFFFF:
+		b = append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFF:
+		b = binary.BigEndian.AppendUint16(b, uint16(id))
+	default:
+		b = append(b, byte(id))
+	}
+
+	if size == unknownSize {
+		return binary.BigEndian.AppendUint64(b, unknownSize)
+	}
+
+	// The shortest length whose all-ones value, which means unknown, is
+	// still above the size.
+	n := 1
+	for size >= 1<<(7*n)-1 {
+		n++
+	}
+
+	v := size | 1<<(7*n)
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+
+	return b
+}
+
+func uintData(v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+
+	return b
+}
+
+func floatData(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+
+	return b
+}
@@ -0,0 +1,221 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+)
+
+type mkvElement struct {
+	id   uint32
+	data []byte
+}
+
+// masterIDs are the elements whose children are read in line.
+var masterIDs = map[uint32]bool{
+	idEBML: true, idSegment: true, idInfo: true, idTracks: true, idTrackEntry: true,
+	idVideo: true, idAudio: true, idCluster: true,
+}
+
+// readElements flattens a Matroska file into its leaf elements.
+func readElements(t *testing.T, b []byte) []mkvElement {
+	t.Helper()
+
+	var elements []mkvElement
+	for len(b) > 0 {
+		idLen := bits.LeadingZeros8(b[0]) + 1
+		var id uint32
+		for _, c := range b[:idLen] {
+			id = id<<8 | uint32(c)
+		}
+		b = b[idLen:]
+
+		sizeLen := bits.LeadingZeros8(b[0]) + 1
+		size := uint64(b[0] & (0xFF >> sizeLen))
+		unknown := size == uint64(0xFF>>sizeLen)
+		for _, c := range b[1:sizeLen] {
+			size = size<<8 | uint64(c)
+			unknown = unknown && c == 0xFF
+		}
+		b = b[sizeLen:]
+
+		if masterIDs[id] {
+			if unknown && id != idSegment && id != idCluster {
+				t.Fatalf("element %x has an unknown size", id)
+			}
+
+			elements = append(elements, mkvElement{id: id})
+
+			continue
+		}
+
+		if unknown || size > uint64(len(b)) {
+			t.Fatalf("element %x of size %d overruns the file", id, size)
+		}
+
+		elements = append(elements, mkvElement{id: id, data: b[:size]})
+		b = b[size:]
+	}
+
+	return elements
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return v
+}
+
+type mkvBlock struct {
+	track    int
+	ts       int64
+	keyframe bool
+	data     []byte
+}
+
+func TestMatroskaMuxer(t *testing.T) {
+	var buf bytes.Buffer
+	audio := &mpeg4audio.Config{Type: mpeg4audio.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	m := newMatroskaMuxer(&buf, testSPS, testPPS, audio)
+
+	if written, err := m.writeH264([][]byte{nonIDR}, time.Second); err != nil || written {
+		t.Fatalf("writeH264() before the first IDR = %v, %v, want it dropped", written, err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}}, time.Second); err != nil || written != 0 {
+		t.Fatalf("writeAAC() before the first IDR = %d, %v, want it dropped", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{idr}, 2*time.Second); err != nil || !written {
+		t.Fatalf("writeH264() of an IDR = %v, %v, want it written", written, err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}, {0x21, 0x11}}, 2*time.Second); err != nil || written != 2 {
+		t.Fatalf("writeAAC() = %d, %v, want 2 access units written", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{nonIDR}, 2*time.Second+40*time.Millisecond); err != nil || !written {
+		t.Fatalf("writeH264() after the IDR = %v, %v, want it written", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{testSPS, testPPS, idr}, 3*time.Second); err != nil || !written {
+		t.Fatalf("writeH264() of the next IDR = %v, %v, want it written", written, err)
+	}
+
+	if err := m.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var docType, codecs []string
+	var codecPrivate [][]byte
+	var clusters []int64
+	var blocks []mkvBlock
+
+	for _, e := range readElements(t, buf.Bytes()) {
+		switch e.id {
+		case idDocType:
+			docType = append(docType, string(e.data))
+		case idCodecID:
+			codecs = append(codecs, string(e.data))
+		case idCodecPrivate:
+			codecPrivate = append(codecPrivate, e.data)
+		case idTimestamp:
+			clusters = append(clusters, int64(readUint(e.data)))
+		case idSimpleBlock:
+			blocks = append(blocks, mkvBlock{
+				track:    int(e.data[0] & 0x7F),
+				ts:       clusters[len(clusters)-1] + int64(int16(binary.BigEndian.Uint16(e.data[1:3]))),
+				keyframe: e.data[3]&keyframeFlag != 0,
+				data:     e.data[4:],
+			})
+		}
+	}
+
+	if len(docType) != 1 || docType[0] != "matroska" {
+		t.Errorf("doc type = %v, want matroska", docType)
+	}
+	if len(codecs) != 2 || codecs[0] != "V_MPEG4/ISO/AVC" || codecs[1] != "A_AAC" {
+		t.Errorf("codecs = %v, want H264 and AAC", codecs)
+	}
+
+	wantConfig, _ := audio.Marshal()
+	if len(codecPrivate) != 2 || !bytes.Contains(codecPrivate[0], testSPS) || !bytes.Contains(codecPrivate[0], testPPS) ||
+		!bytes.Equal(codecPrivate[1], wantConfig) {
+		t.Errorf("codec private = %x, want the parameter sets and the audio config", codecPrivate)
+	}
+
+	// Every IDR opens a cluster.
+	if len(clusters) != 2 || clusters[0] != 0 || clusters[1] != 1000 {
+		t.Errorf("clusters = %v, want [0 1000]", clusters)
+	}
+
+	want := []mkvBlock{
+		{track: videoTrackNumber, ts: 0, keyframe: true},
+		{track: audioTrackNumber, ts: 0, keyframe: true},
+		{track: audioTrackNumber, ts: 21, keyframe: true},
+		{track: videoTrackNumber, ts: 40},
+		{track: videoTrackNumber, ts: 1000, keyframe: true},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i, b := range blocks {
+		if b.track != want[i].track || b.ts != want[i].ts || b.keyframe != want[i].keyframe {
+			t.Errorf("block %d = track %d at %d keyframe %v, want %+v", i, b.track, b.ts, b.keyframe, want[i])
+		}
+	}
+
+	// Video is stored with NALU lengths, parameter sets in front of IDRs.
+	nalus, err := h264.AVCCUnmarshal(blocks[0].data)
+	if err != nil || len(nalus) != 3 || !bytes.Equal(nalus[2], idr) {
+		t.Errorf("first frame = %x, %v, want SPS, PPS and the IDR", nalus, err)
+	}
+	if !bytes.Equal(blocks[2].data, []byte{0x21, 0x11}) {
+		t.Errorf("second audio frame = %x, want the raw access unit", blocks[2].data)
+	}
+}
+
+func TestMatroskaMuxerWaitsForParameterSets(t *testing.T) {
+	var buf bytes.Buffer
+	m := newMatroskaMuxer(&buf, nil, nil, nil)
+
+	if written, err := m.writeH264([][]byte{idr}, 0); err != nil || written {
+		t.Fatalf("writeH264() of an IDR without parameter sets = %v, %v, want it dropped", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{testSPS, testPPS, idr}, time.Second); err != nil || !written {
+		t.Fatalf("writeH264() of an IDR with parameter sets = %v, %v, want it written", written, err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}}, time.Second); err != nil || written != 0 {
+		t.Errorf("writeAAC() without an audio track = %d, %v, want it dropped", written, err)
+	}
+}
+
+func TestElementHeaderSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want []byte
+	}{
+		{size: 0, want: []byte{0x80}},
+		{size: 126, want: []byte{0xFE}},
+		// 127 is the unknown size of one byte.
+		{size: 127, want: []byte{0x40, 0x7F}},
+		{size: 300, want: []byte{0x41, 0x2C}},
+		{size: unknownSize, want: []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		if got := elementHeader(idSimpleBlock, tt.size)[1:]; !bytes.Equal(got, tt.want) {
+			t.Errorf("size %d = %x, want %x", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package native
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"time"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+	"github.com/asticode/go-astits"
+)
+
+const (
+	videoPID = 256
+	audioPID = 257
+
+	clockRate = 90000
+)
+
+type mpegtsMuxer struct {
+	w   *bufio.Writer
+	mux *astits.Muxer
+
+	sps []byte
+	pps []byte
+
+	audio *mpeg4audio.Config
+
+	dtsExtractor     *h264.DTSExtractor
+	firstIDRReceived bool
+	startDTS         time.Duration
+}
+
+func newMPEGTSMuxer(w io.Writer, sps, pps []byte, audio *mpeg4audio.Config) *mpegtsMuxer {
+	b := bufio.NewWriter(w)
+
+	mux := astits.NewMuxer(context.Background(), b)
+	mux.AddElementaryStream(astits.PMTElementaryStream{
+		ElementaryPID: videoPID,
+		StreamType:    astits.StreamTypeH264Video,
+	})
+	if audio != nil {
+		mux.AddElementaryStream(astits.PMTElementaryStream{
+			ElementaryPID: audioPID,
+			StreamType:    astits.StreamTypeAACAudio,
+		})
+	}
+	mux.SetPCRPID(videoPID)
+
+	return &mpegtsMuxer{
+		w:     b,
+		mux:   mux,
+		sps:   sps,
+		pps:   pps,
+		audio: audio,
+	}
+}
+
+func (m *mpegtsMuxer) flush() error {
+	return m.w.Flush()
+}
+
+// writeH264 writes one access unit. Everything before the first IDR is
+// dropped, and timestamps are shifted so the file starts at zero.
+func (m *mpegtsMuxer) writeH264(nalus [][]byte, pts time.Duration) (bool, error) {
+	filtered := [][]byte{
+		{byte(h264.NALUTypeAccessUnitDelimiter), 240},
+	}
+
+	idrPresent := false
+	nonIDRPresent := false
+
+	for _, nalu := range nalus {
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			m.sps = append([]byte(nil), nalu...)
+			continue
+		case h264.NALUTypePPS:
+			m.pps = append([]byte(nil), nalu...)
+			continue
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+		case h264.NALUTypeIDR:
+			idrPresent = true
+		case h264.NALUTypeNonIDR:
+			nonIDRPresent = true
+		}
+
+		filtered = append(filtered, nalu)
+	}
+
+	if !idrPresent && !nonIDRPresent {
+		return false, nil
+	}
+
+	if idrPresent {
+		filtered = append([][]byte{filtered[0], m.sps, m.pps}, filtered[1:]...)
+	}
+
+	var dts time.Duration
+
+	if !m.firstIDRReceived {
+		if !idrPresent {
+			return false, nil
+		}
+
+		m.firstIDRReceived = true
+		m.dtsExtractor = h264.NewDTSExtractor()
+
+		var err error
+		dts, err = m.dtsExtractor.Extract(filtered, pts)
+		if err != nil {
+			return false, err
+		}
+
+		m.startDTS = dts
+	} else {
+		var err error
+		dts, err = m.dtsExtractor.Extract(filtered, pts)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	dts -= m.startDTS
+	pts -= m.startDTS
+
+	annexb, err := h264.AnnexBMarshal(filtered)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = m.mux.WriteData(&astits.MuxerData{
+		PID: videoPID,
+		AdaptationField: &astits.PacketAdaptationField{
+			RandomAccessIndicator: idrPresent,
+		},
+		PES: &astits.PESData{
+			Header: &astits.PESHeader{
+				OptionalHeader: timestamps(pts, dts),
+				StreamID:       224,
+			},
+			Data: annexb,
+		},
+	})
+
+	return err == nil, err
+}
+
+// writeAAC writes access units that start at pts. Audio that arrives before
+// the first video IDR is dropped to keep both tracks aligned.
+func (m *mpegtsMuxer) writeAAC(aus [][]byte, pts time.Duration) (int, error) {
+	if m.audio == nil || !m.firstIDRReceived {
+		return 0, nil
+	}
+
+	written := 0
+	for i, au := range aus {
+		auPTS := pts + time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*time.Second/time.Duration(m.audio.SampleRate) - m.startDTS
+		if auPTS < 0 {
+			continue
+		}
+
+		enc, err := mpeg4audio.ADTSPackets{{
+			Type:         m.audio.Type,
+			SampleRate:   m.audio.SampleRate,
+			ChannelCount: m.audio.ChannelCount,
+			AU:           au,
+		}}.Marshal()
+		if err != nil {
+			return written, err
+		}
+
+		_, err = m.mux.WriteData(&astits.MuxerData{
+			PID: audioPID,
+			AdaptationField: &astits.PacketAdaptationField{
+				RandomAccessIndicator: true,
+			},
+			PES: &astits.PESData{
+				Header: &astits.PESHeader{
+					OptionalHeader: timestamps(auPTS, auPTS),
+					PacketLength:   uint16(len(enc) + 8),
+					StreamID:       192,
+				},
+				Data: enc,
+			},
+		})
+		if err != nil {
+			return written, err
+		}
+
+		written++
+	}
+
+	return written, nil
+}
+
+func timestamps(pts, dts time.Duration) *astits.PESOptionalHeader {
+	oh := &astits.PESOptionalHeader{
+		MarkerBits: 2,
+	}
+
+	if dts == pts {
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorOnlyPTS
+		oh.PTS = &astits.ClockReference{Base: int64(pts.Seconds() * clockRate)}
+	} else {
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorBothPresent
+		oh.DTS = &astits.ClockReference{Base: int64(dts.Seconds() * clockRate)}
+		oh.PTS = &astits.ClockReference{Base: int64(pts.Seconds() * clockRate)}
+	}
+
+	return oh
+}
@@ -0,0 +1,109 @@
+package native
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+	"github.com/asticode/go-astits"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+		0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+		0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+	}
+	testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+
+	idr    = []byte{byte(h264.NALUTypeIDR), 0x88, 0x84}
+	nonIDR = []byte{byte(h264.NALUTypeNonIDR), 0x9a, 0x02}
+)
+
+func TestMuxerStartsAtIDR(t *testing.T) {
+	var buf bytes.Buffer
+	audio := &mpeg4audio.Config{Type: mpeg4audio.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	m := newMPEGTSMuxer(&buf, testSPS, testPPS, audio)
+
+	if written, err := m.writeH264([][]byte{nonIDR}, time.Second); err != nil || written {
+		t.Fatalf("writeH264() before the first IDR = %v, %v, want it dropped", written, err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}}, time.Second); err != nil || written != 0 {
+		t.Fatalf("writeAAC() before the first IDR = %d, %v, want it dropped", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{testSPS, testPPS, idr}, 2*time.Second); err != nil || !written {
+		t.Fatalf("writeH264() of an IDR = %v, %v, want it written", written, err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}, {0x21, 0x10}}, 2*time.Second); err != nil || written != 2 {
+		t.Fatalf("writeAAC() = %d, %v, want 2 access units written", written, err)
+	}
+
+	if written, err := m.writeH264([][]byte{nonIDR}, 2*time.Second+40*time.Millisecond); err != nil || !written {
+		t.Fatalf("writeH264() after the IDR = %v, %v, want it written", written, err)
+	}
+
+	if err := m.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var videoPTS, audioPTS []int64
+	var keyframes []bool
+
+	dmx := astits.NewDemuxer(context.Background(), &buf)
+	for {
+		d, err := dmx.NextData()
+		if errors.Is(err, astits.ErrNoMorePackets) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextData() error = %v", err)
+		}
+
+		if d.PES == nil {
+			continue
+		}
+
+		pts := d.PES.Header.OptionalHeader.PTS.Base
+		switch d.PID {
+		case videoPID:
+			videoPTS = append(videoPTS, pts)
+			keyframes = append(keyframes, d.FirstPacket.AdaptationField != nil && d.FirstPacket.AdaptationField.RandomAccessIndicator)
+		case audioPID:
+			audioPTS = append(audioPTS, pts)
+		}
+	}
+
+	// Timestamps start at the first IDR.
+	if len(videoPTS) != 2 || videoPTS[0] != 0 || videoPTS[1] != 3600 {
+		t.Errorf("video PTS = %v, want [0 3600]", videoPTS)
+	}
+	if len(keyframes) != 2 || !keyframes[0] || keyframes[1] {
+		t.Errorf("random access = %v, want only the IDR", keyframes)
+	}
+
+	// An AAC access unit holds 1024 samples, 1920 ticks at 48 kHz, less
+	// what is lost to nanoseconds.
+	if len(audioPTS) != 2 || audioPTS[0] != 0 || audioPTS[1] < 1919 || audioPTS[1] > 1920 {
+		t.Errorf("audio PTS = %v, want [0 1920]", audioPTS)
+	}
+}
+
+func TestMuxerWithoutAudio(t *testing.T) {
+	var buf bytes.Buffer
+	m := newMPEGTSMuxer(&buf, testSPS, testPPS, nil)
+
+	if _, err := m.writeH264([][]byte{idr}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if written, err := m.writeAAC([][]byte{{0x21, 0x10}}, 0); err != nil || written != 0 {
+		t.Errorf("writeAAC() without an audio track = %d, %v, want it dropped", written, err)
+	}
+}
@@ -0,0 +1,375 @@
+package native
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+	"github.com/aler9/gortsplib/pkg/rtpcodecs/rtph264"
+	"github.com/aler9/gortsplib/pkg/rtpcodecs/rtpmpeg4audio"
+	"github.com/aler9/gortsplib/pkg/url"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+var (
+	ErrNoH264Track      = errors.New("camera has no H264 track")
+	ErrUnsupportedAudio = errors.New("camera audio is not AAC")
+)
+
+type Fallback interface {
+	Container(spec recorder.Spec) string
+	Start(spec recorder.Spec) (recorder.Process, error)
+	Adopt(pid int, filePath string) (recorder.Process, bool)
+}
+
+// Recorder records a single H264/AAC camera in-process by remuxing RTP into
+// MPEG-TS or Matroska without re-encoding. Mixed, segmented and encoded
+// recordings, MP4 and cameras with other codecs are passed to the fallback.
+type Recorder struct {
+	fallback Fallback
+}
+
+func New(fallback Fallback) *Recorder {
+	return &Recorder{fallback: fallback}
+}
+
+func (r *Recorder) Probe(uri string) (bool, error) {
+	return recorder.ProbeRTSP(uri)
+}
+
+func (r *Recorder) Container(spec recorder.Spec) string {
+	if !remuxable(spec) {
+		return r.fallback.Container(spec)
+	}
+
+	if spec.Container == "" {
+		return constants.ContainerMPEGTS
+	}
+
+	return spec.Container
+}
+
+func (r *Recorder) Adopt(pid int, filePath string) (recorder.Process, bool) {
+	return r.fallback.Adopt(pid, filePath)
+}
+
+func (r *Recorder) Start(spec recorder.Spec) (recorder.Process, error) {
+	if !remuxable(spec) {
+		return r.fallback.Start(spec)
+	}
+
+	u, err := url.Parse(spec.Sources[0].URI)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &process{log: spec.Log, done: make(chan struct{})}
+	p.client = &gortsplib.Client{
+		OnPacketRTP:   p.onPacketRTP,
+		OnDecodeError: p.onDecodeError,
+	}
+
+	if err := p.client.Start(u.Scheme, u.Host); err != nil {
+		return nil, err
+	}
+
+	if err := p.setup(u, spec.FilePath, spec.Container, spec.Audio == 0); err != nil {
+		p.client.Close()
+
+		// The fallback writes the same container, so the file is as the
+		// service expects.
+		if errors.Is(err, ErrNoH264Track) || errors.Is(err, ErrUnsupportedAudio) {
+			return r.fallback.Start(spec)
+		}
+
+		return nil, err
+	}
+
+	go p.run()
+
+	return p, nil
+}
+
+func remuxable(spec recorder.Spec) bool {
+	return len(spec.Sources) == 1 && spec.SegmentDuration == 0 && spec.Profile == nil && spec.Proxy == nil &&
+		(spec.Container == "" || spec.Container == constants.ContainerMPEGTS || spec.Container == constants.ContainerMatroska)
+}
+
+// muxer writes the remuxed access units to the recording file.
+type muxer interface {
+	writeH264(nalus [][]byte, pts time.Duration) (bool, error)
+	writeAAC(aus [][]byte, pts time.Duration) (int, error)
+	flush() error
+}
+
+type process struct {
+	client *gortsplib.Client
+	file   *os.File
+	log    io.Writer
+
+	mu       sync.Mutex
+	muxer    muxer
+	videoDec *rtph264.Decoder
+	audioDec *rtpmpeg4audio.Decoder
+	lastSeq  map[int]uint16
+	stats    recorder.Stats
+	stopping bool
+	writeErr error
+
+	done     chan struct{}
+	exitCode int
+}
+
+const (
+	videoTrack = 0
+	audioTrack = 1
+)
+
+func (p *process) setup(u *url.URL, filePath, container string, withAudio bool) error {
+	tracks, baseURL, _, err := p.client.Describe(u)
+	if err != nil {
+		return err
+	}
+
+	video, audio, err := selectTracks(tracks, withAudio)
+	if err != nil {
+		return err
+	}
+
+	p.file, err = os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	selected := gortsplib.Tracks{video}
+	p.videoDec = video.CreateDecoder()
+	p.lastSeq = make(map[int]uint16)
+
+	var audioConfig *mpeg4audio.Config
+	if audio != nil {
+		selected = append(selected, audio)
+		p.audioDec = audio.CreateDecoder()
+		audioConfig = audio.Config
+	}
+
+	w := &countingWriter{w: p.file, n: &p.stats.Bytes}
+	if container == constants.ContainerMatroska {
+		p.muxer = newMatroskaMuxer(w, video.SafeSPS(), video.SafePPS(), audioConfig)
+	} else {
+		p.muxer = newMPEGTSMuxer(w, video.SafeSPS(), video.SafePPS(), audioConfig)
+	}
+
+	if err := p.client.SetupAndPlay(selected, baseURL); err != nil {
+		p.file.Close()
+
+		return err
+	}
+
+	return nil
+}
+
+// selectTracks picks the tracks to remux. A camera whose video is not H264,
+// or whose recorded audio is not AAC, can't be remuxed.
+func selectTracks(tracks gortsplib.Tracks, withAudio bool) (*gortsplib.TrackH264, *gortsplib.TrackMPEG4Audio, error) {
+	var video *gortsplib.TrackH264
+	var audio *gortsplib.TrackMPEG4Audio
+	otherAudio := false
+
+	for _, track := range tracks {
+		switch t := track.(type) {
+		case *gortsplib.TrackH264:
+			if video == nil {
+				video = t
+			}
+		case *gortsplib.TrackMPEG4Audio:
+			if withAudio && audio == nil {
+				audio = t
+			}
+		case *gortsplib.TrackOpus, *gortsplib.TrackVorbis, *gortsplib.TrackG711, *gortsplib.TrackG722, *gortsplib.TrackMPEG2Audio, *gortsplib.TrackLPCM:
+			otherAudio = withAudio
+		}
+	}
+
+	if video == nil {
+		return nil, nil, ErrNoH264Track
+	}
+
+	if audio == nil && otherAudio {
+		return nil, nil, ErrUnsupportedAudio
+	}
+
+	return video, audio, nil
+}
+
+func (p *process) run() {
+	err := p.client.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.stopping || p.writeErr != nil {
+		p.exitCode = 1
+	}
+
+	if !p.stopping && err != nil {
+		p.logf("ERROR: from element rtsp: %v", err)
+	}
+
+	if err := p.muxer.flush(); err != nil {
+		p.exitCode = 1
+	}
+
+	if err := p.file.Close(); err != nil {
+		p.exitCode = 1
+	}
+
+	close(p.done)
+}
+
+func (p *process) onPacketRTP(ctx *gortsplib.ClientOnPacketRTPCtx) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr != nil {
+		return
+	}
+
+	p.stats.RTPPackets++
+
+	seq := ctx.Packet.SequenceNumber
+	if last, ok := p.lastSeq[ctx.TrackID]; !ok {
+		p.lastSeq[ctx.TrackID] = seq
+	} else if gap := seqGap(last, seq); gap >= 0 {
+		p.stats.LostPackets += uint64(gap)
+		p.lastSeq[ctx.TrackID] = seq
+	}
+
+	switch ctx.TrackID {
+	case videoTrack:
+		nalus, pts, err := p.videoDec.Decode(ctx.Packet)
+		if err != nil {
+			if !errors.Is(err, rtph264.ErrMorePacketsNeeded) {
+				p.stats.DecodeErrors++
+			}
+
+			return
+		}
+
+		written, err := p.muxer.writeH264(nalus, pts)
+		if err != nil {
+			p.fail(err)
+
+			return
+		}
+		if written {
+			p.stats.VideoFrames++
+		}
+	case audioTrack:
+		aus, pts, err := p.audioDec.Decode(ctx.Packet)
+		if err != nil {
+			if !errors.Is(err, rtpmpeg4audio.ErrMorePacketsNeeded) {
+				p.stats.DecodeErrors++
+			}
+
+			return
+		}
+
+		written, err := p.muxer.writeAAC(aus, pts)
+		p.stats.AudioFrames += uint64(written)
+		if err != nil {
+			p.fail(err)
+		}
+	}
+}
+
+// seqGap returns the number of packets missing between the last sequence
+// number and seq, across the wrap of the counter. Duplicated and reordered
+// packets give a negative gap.
+func seqGap(last, seq uint16) int {
+	return int(int16(seq-last)) - 1
+}
+
+func (p *process) onDecodeError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.DecodeErrors++
+}
+
+// fail stops the client after a write error; the caller holds p.mu.
+func (p *process) fail(err error) {
+	p.writeErr = fmt.Errorf("failed to write recording: %w", err)
+	p.logf("ERROR: from element mux: %v", p.writeErr)
+
+	go p.client.Close()
+}
+
+// logf writes a line in the gst-launch format, so the output of both
+// backends is parsed the same way.
+func (p *process) logf(format string, args ...interface{}) {
+	if p.log != nil {
+		fmt.Fprintf(p.log, format+"\n", args...)
+	}
+}
+
+func (p *process) PID() int {
+	return 0
+}
+
+func (p *process) Stop() error {
+	p.mu.Lock()
+	p.stopping = true
+	p.mu.Unlock()
+
+	go p.client.Close()
+
+	return nil
+}
+
+func (p *process) Status() recorder.Status {
+	p.mu.Lock()
+	stats := p.stats
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return recorder.Status{ExitCode: p.exitCode, Stats: &stats}
+	default:
+		return recorder.Status{Running: true, ExitCode: recorder.ExitCodeUnknown, Stats: &stats}
+	}
+}
+
+func (p *process) Wait(timeout time.Duration) (recorder.Status, bool) {
+	select {
+	case <-p.done:
+		return p.Status(), false
+	case <-time.After(timeout):
+	}
+
+	p.Stop()
+	<-p.done
+
+	return p.Status(), true
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += uint64(n)
+
+	return n, err
+}
+
+func (p *process) Done() <-chan struct{} {
+	return p.done
+}
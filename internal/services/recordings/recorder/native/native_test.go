@@ -0,0 +1,122 @@
+package native
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/mpeg4audio"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+func TestSeqGap(t *testing.T) {
+	tests := []struct {
+		last, seq uint16
+		want      int
+	}{
+		{last: 10, seq: 11, want: 0},
+		{last: 10, seq: 14, want: 3},
+		{last: 65535, seq: 0, want: 0},
+		{last: 65534, seq: 2, want: 3},
+		// Duplicated and reordered packets are not losses.
+		{last: 10, seq: 10, want: -1},
+		{last: 10, seq: 9, want: -2},
+		{last: 0, seq: 65535, want: -2},
+	}
+
+	for _, tt := range tests {
+		if got := seqGap(tt.last, tt.seq); got != tt.want {
+			t.Errorf("seqGap(%d, %d) = %d, want %d", tt.last, tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestSelectTracks(t *testing.T) {
+	h264 := &gortsplib.TrackH264{PayloadType: 96, SPS: testSPS, PPS: testPPS}
+	h265 := &gortsplib.TrackH265{PayloadType: 96}
+	aac := &gortsplib.TrackMPEG4Audio{
+		PayloadType: 97,
+		Config:      &mpeg4audio.Config{Type: mpeg4audio.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2},
+		SizeLength:  13,
+	}
+	g711 := &gortsplib.TrackG711{}
+
+	tests := []struct {
+		name      string
+		tracks    gortsplib.Tracks
+		withAudio bool
+		audio     bool
+		err       error
+	}{
+		{name: "h264 and aac", tracks: gortsplib.Tracks{h264, aac}, withAudio: true, audio: true},
+		{name: "audio not recorded", tracks: gortsplib.Tracks{h264, aac}},
+		{name: "no audio", tracks: gortsplib.Tracks{h264}, withAudio: true},
+		{name: "h265", tracks: gortsplib.Tracks{h265, aac}, withAudio: true, err: ErrNoH264Track},
+		{name: "mjpeg", tracks: gortsplib.Tracks{&gortsplib.TrackJPEG{}}, err: ErrNoH264Track},
+		{name: "g711", tracks: gortsplib.Tracks{h264, g711}, withAudio: true, err: ErrUnsupportedAudio},
+		{name: "g711 not recorded", tracks: gortsplib.Tracks{h264, g711}},
+		{name: "aac next to g711", tracks: gortsplib.Tracks{h264, g711, aac}, withAudio: true, audio: true},
+	}
+
+	for _, tt := range tests {
+		video, audio, err := selectTracks(tt.tracks, tt.withAudio)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: selectTracks() error = %v, want %v", tt.name, err, tt.err)
+
+			continue
+		}
+
+		if tt.err != nil {
+			continue
+		}
+
+		if video != h264 {
+			t.Errorf("%s: video = %v, want the H264 track", tt.name, video)
+		}
+		if (audio != nil) != tt.audio {
+			t.Errorf("%s: audio = %v, want selected %v", tt.name, audio, tt.audio)
+		}
+	}
+}
+
+type stubFallback struct{}
+
+func (stubFallback) Container(spec recorder.Spec) string {
+	return recorder.DefaultContainer(spec)
+}
+
+func (stubFallback) Start(spec recorder.Spec) (recorder.Process, error) {
+	return nil, errors.New("not started")
+}
+
+func (stubFallback) Adopt(pid int, filePath string) (recorder.Process, bool) {
+	return nil, false
+}
+
+func TestContainer(t *testing.T) {
+	r := New(stubFallback{})
+	camera := []recorder.Source{{URI: "rtsp://camera/stream"}}
+
+	tests := []struct {
+		name string
+		spec recorder.Spec
+		want string
+	}{
+		{name: "default", spec: recorder.Spec{Sources: camera}, want: constants.ContainerMPEGTS},
+		{name: "mpeg-ts", spec: recorder.Spec{Sources: camera, Container: constants.ContainerMPEGTS}, want: constants.ContainerMPEGTS},
+		{name: "matroska", spec: recorder.Spec{Sources: camera, Container: constants.ContainerMatroska}, want: constants.ContainerMatroska},
+		// MP4 and mixed recordings are left to the fallback.
+		{name: "mp4", spec: recorder.Spec{Sources: camera, Container: constants.ContainerMP4}, want: constants.ContainerMP4},
+		{name: "mixed", spec: recorder.Spec{Sources: append(camera, camera...)}, want: constants.ContainerMatroska},
+	}
+
+	for _, tt := range tests {
+		if got := r.Container(tt.spec); got != tt.want {
+			t.Errorf("%s: Container() = %q, want %q", tt.name, got, tt.want)
+		}
+		if remuxable(tt.spec) != (tt.name != "mp4" && tt.name != "mixed") {
+			t.Errorf("%s: remuxable() = %v", tt.name, remuxable(tt.spec))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/url"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+)
+
+const ExitCodeUnknown = -1
+
+const NoAudio = -1
+
+var mimeTypes = map[string]string{
+	constants.ContainerMatroska: "video/x-matroska",
+	constants.ContainerMP4:      "video/mp4",
+	constants.ContainerMPEGTS:   "video/mp2t",
+}
+
+// MIMEType returns the MIME type of a container, or "" for an unknown one.
+func MIMEType(container string) string {
+	return mimeTypes[container]
+}
+
+// DefaultContainer returns the container of the spec, or the one used when
+// none is chosen: MPEG-TS for segments, so they can be joined, and Matroska
+// otherwise.
+func DefaultContainer(spec Spec) string {
+	switch {
+	case spec.Container != "":
+		return spec.Container
+	case spec.SegmentDuration > 0:
+		return constants.ContainerMPEGTS
+	default:
+		return constants.ContainerMatroska
+	}
+}
+
+// SegmentIndex is the placeholder for the segment number in the file path of
+// a segmented recording. Both splitmuxsink and ffmpeg expand it.
+const SegmentIndex = "%05d"
+
+func SegmentPath(pattern string, index int) string {
+	return strings.Replace(pattern, SegmentIndex, fmt.Sprintf("%05d", index), 1)
+}
+
+// ProxyPath is the path of the proxy written next to the master file. A
+// segment pattern stays a pattern.
+func ProxyPath(path string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "_proxy" + ext
+}
+
+type Source struct {
+	URI   string
+	Audio bool
+}
+
+type Spec struct {
+	Sources []Source
+	// Audio is the index of the source whose audio is recorded, or NoAudio.
+	Audio int
+	// Layout places the sources when more than one is recorded.
+	Layout layout.Layout
+	// Container is the file format, empty lets the backend choose.
+	Container string
+	// Profile sets the encoders. Without one a single camera is recorded
+	// as is and anything that has to be encoded uses x264 and mp3 defaults.
+	Profile *models.Profile
+	// SegmentDuration splits the recording into files of about this length.
+	// FilePath then contains SegmentIndex.
+	SegmentDuration time.Duration
+	// SegmentStart is the index of the first segment, so a restarted pipeline
+	// continues the numbering instead of overwriting earlier segments.
+	SegmentStart int
+	FilePath     string
+	// Proxy, if set, is a low-resolution copy written by the same pipeline
+	// in the same container and with the same segments.
+	Proxy *Proxy
+	// Log receives the output of the pipeline, if set.
+	Log io.Writer
+}
+
+type Proxy struct {
+	Profile  models.Profile
+	FilePath string
+}
+
+type Status struct {
+	PID      int
+	Running  bool
+	ExitCode int
+	// Stats is only reported by backends that see individual packets.
+	Stats *Stats
+}
+
+type Stats struct {
+	RTPPackets   uint64 `json:"rtp_packets"`
+	LostPackets  uint64 `json:"lost_packets"`
+	DecodeErrors uint64 `json:"decode_errors"`
+	VideoFrames  uint64 `json:"video_frames"`
+	AudioFrames  uint64 `json:"audio_frames"`
+	Bytes        uint64 `json:"bytes"`
+}
+
+type Process interface {
+	PID() int
+	// Stop asks the backend to finish the file and exit. It does not wait.
+	Stop() error
+	Status() Status
+	// Wait blocks until the process exits, killing it once timeout passes.
+	Wait(timeout time.Duration) (status Status, killed bool)
+	// Done is closed when the process exits.
+	Done() <-chan struct{}
+}
+
+func ProbeRTSP(rtspURL string) (bool, error) {
+	u, err := url.Parse(rtspURL)
+	if err != nil {
+		return false, err
+	}
+
+	conn := gortsplib.Client{ReadTimeout: 3 * time.Second, WriteTimeout: 3 * time.Second}
+
+	err = conn.Start(u.Scheme, u.Host)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	tracks, _, _, err := conn.Describe(u)
+	if err != nil {
+		return false, err
+	}
+
+	audioFound := false
+
+	for _, track := range tracks {
+		switch track.(type) {
+		case *gortsplib.TrackOpus, *gortsplib.TrackVorbis, *gortsplib.TrackG711, *gortsplib.TrackG722, *gortsplib.TrackMPEG2Audio, *gortsplib.TrackMPEG4Audio:
+			audioFound = true
+
+			return audioFound, nil
+		}
+	}
+
+	return audioFound, nil
+}
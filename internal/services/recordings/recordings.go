@@ -1,19 +1,26 @@
 package recordingservice
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aler9/gortsplib"
-	"github.com/aler9/gortsplib/pkg/url"
 	"github.com/google/uuid"
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
 	"github.com/zanzhit/studio_recorder/internal/domain/errs"
 	"github.com/zanzhit/studio_recorder/internal/domain/models"
 	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/layout"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/pipelog"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/preroll"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
 )
 
 type RecordingService struct {
@@ -21,112 +28,619 @@ type RecordingService struct {
 	recordingSaver    RecordingSaver
 	recordingProvider RecordingProvider
 	cameraProvider    CameraProvider
+	layoutProvider    LayoutProvider
+	profileProvider   ProfileProvider
 	videoService      VideoService
-	commands          map[string]*exec.Cmd
+	recorder          Recorder
+	events            Publisher
+	preRoll           PreRoll
+	bookings          Bookings
+	mu                sync.Mutex
+	commands          map[string]*session
+	starting          map[string][]string
+	segmentsMu        sync.Mutex
 	videosPath        string
+	staleAfter        time.Duration
+	stopTimeout       time.Duration
+	restartMin        time.Duration
+	restartMax        time.Duration
+	logMaxSize        int64
+	logBackups        int
+	statusWindow      time.Duration
+	layout            string
+	container         string
+	proxy             config.Proxy
+	width             int
+	height            int
+	segmentDuration   time.Duration
+	pipelineEvents    chan models.PipelineEvent
+	droppedEvents     atomic.Int64
+	closing           chan struct{}
+	closed            chan struct{}
+	closeOnce         sync.Once
 }
 
 type CameraProvider interface {
-	CameraIP(cameraID string) (string, error)
+	Camera(cameraID string) (models.Camera, error)
+}
+
+type LayoutProvider interface {
+	Layout(layoutID string) (models.Layout, error)
+}
+
+type ProfileProvider interface {
+	Profile(profileID string) (models.Profile, error)
 }
 
 type RecordingSaver interface {
 	Start(recording models.Recording, cameraID string) error
-	Stop(recordID string, stopTime time.Time) error
+	Stop(recordID string, stopTime time.Time, from, to string) error
+	Finish(recordID string, exitCode int, from, to string) error
+	SetStatus(recordID, from, to string) error
+	SaveSegment(segment models.Segment) error
+	SaveRendition(rendition models.Rendition) error
+	SetPID(recordID string, pid int) error
+	SaveEvents(events []models.PipelineEvent) error
+	OpenGap(recordID string, from time.Time) (int64, error)
+	CloseGaps(recordID string, to time.Time) error
+	OpenPause(recordID string, from time.Time) (int64, error)
+	ClosePauses(recordID string, to time.Time) error
+	SaveMarker(marker models.Marker) (int64, error)
+	SaveSession(session models.Session) error
+	DeleteSession(sessionID string) error
 }
 
 type RecordingProvider interface {
 	CameraRecordings(cameraID string, limit, offset, userID int) ([]models.Recording, error)
 	Recording(recordID string) (models.Recording, error)
-	Move(recordID string) error
-	Delete(recordID string) error
+	OpenRecordings() ([]models.Recording, error)
+	Segments(recordID string) ([]models.Segment, error)
+	Renditions(recordID string) ([]models.Rendition, error)
+	Gaps(recordID string) ([]models.Gap, error)
+	Pauses(recordID string) ([]models.Pause, error)
+	Markers(recordID string) ([]models.Marker, error)
+	Session(sessionID string) (models.Session, error)
+	SessionRecordings(sessionID string) ([]models.Recording, error)
+	Events(recordID, level string) ([]models.PipelineEvent, error)
+	Move(recordID string, from, to string) error
 }
 
 type VideoService interface {
-	Move(models.Recording) error
+	// Move uploads the files of the recording, duration is how long they
+	// play. Markers are sent as its segments.
+	Move(rec models.Recording, files []string, duration time.Duration, markers []models.Marker) error
+	// MoveSession uploads the angles of a session as separate tracks of one
+	// event, files are given per angle.
+	MoveSession(session models.Session, files [][]string, duration time.Duration) error
 }
 
-func New(log *slog.Logger, recordingSaver RecordingSaver, recordingProvider RecordingProvider, cameraProvider CameraProvider, videoService VideoService, videosPath string) *RecordingService {
+type Publisher interface {
+	Publish(event models.Event)
+}
+
+// Bookings rejects ad-hoc recordings of cameras that are booked.
+type Bookings interface {
+	CheckBookings(cameraIDs []string) error
+	// BookingsVersion changes whenever a booking is saved or changed. It
+	// is read under the service lock, so it must not block.
+	BookingsVersion() uint64
+}
+
+type Recorder interface {
+	Probe(uri string) (audio bool, err error)
+	Container(spec recorder.Spec) string
+	Start(spec recorder.Spec) (recorder.Process, error)
+	Adopt(pid int, filePath string) (recorder.Process, bool)
+}
+
+func New(log *slog.Logger, recordingSaver RecordingSaver, recordingProvider RecordingProvider, cameraProvider CameraProvider, layoutProvider LayoutProvider, profileProvider ProfileProvider, videoService VideoService, rec Recorder, events Publisher, preRoll PreRoll, videosPath string, cfg config.Recording) *RecordingService {
 	return &RecordingService{
 		log:               log,
 		recordingSaver:    recordingSaver,
 		recordingProvider: recordingProvider,
 		cameraProvider:    cameraProvider,
+		layoutProvider:    layoutProvider,
+		profileProvider:   profileProvider,
 		videoService:      videoService,
-		commands:          make(map[string]*exec.Cmd),
+		recorder:          rec,
+		events:            events,
+		preRoll:           preRoll,
+		commands:          make(map[string]*session),
+		pipelineEvents:    make(chan models.PipelineEvent, eventQueueSize),
+		closing:           make(chan struct{}),
+		closed:            make(chan struct{}),
+		starting:          make(map[string][]string),
 		videosPath:        videosPath,
+		staleAfter:        cfg.StaleAfter,
+		stopTimeout:       cfg.StopTimeout,
+		restartMin:        cfg.RestartMin,
+		restartMax:        cfg.RestartMax,
+		logMaxSize:        int64(cfg.LogMaxSizeMB) << 20,
+		logBackups:        cfg.LogBackups,
+		statusWindow:      cfg.StatusWindow,
+		layout:            cfg.Layout,
+		container:         cfg.Container,
+		proxy:             cfg.Proxy,
+		width:             cfg.Width,
+		height:            cfg.Height,
+		segmentDuration:   cfg.SegmentDuration,
 	}
 }
 
-type camera struct {
-	cameraIP string
-	audio    bool
+// SetBookings makes ad-hoc recordings respect the bookings of the cameras.
+// The schedules start recordings through the service, so they can only be
+// set once both exist.
+func (s *RecordingService) SetBookings(bookings Bookings) {
+	s.bookings = bookings
 }
 
-func (s *RecordingService) Start(cameraIDs []string, userID int) (string, error) {
+func (s *RecordingService) Start(cameraIDs []string, userID int, opts models.RecordingOptions) (string, error) {
 	const op = "service.recordings.Start"
 
+	rec := models.Recording{
+		RecordingID: uuid.New().String(),
+		UserID:      userID,
+	}
+
+	if err := s.checkOptions(cameraIDs, opts); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.start(rec, cameraIDs, opts, time.Time{}); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rec.RecordingID, nil
+}
+
+// StartUntil starts a recording that is planned to end at until. A pipeline
+// that drops out is not restarted past it; stopping the recording is left to
+// the caller.
+func (s *RecordingService) StartUntil(cameraIDs []string, userID int, opts models.RecordingOptions, until time.Time) (string, error) {
+	const op = "service.recordings.StartUntil"
+
+	rec := models.Recording{
+		RecordingID: uuid.New().String(),
+		UserID:      userID,
+	}
+
+	if err := s.checkOptions(cameraIDs, opts); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.start(rec, cameraIDs, opts, until); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rec.RecordingID, nil
+}
+
+// CheckOptions rejects recording options that can't be used with the
+// cameras, before anything is started.
+func (s *RecordingService) CheckOptions(cameraIDs []string, opts models.RecordingOptions) error {
+	const op = "service.recordings.CheckOptions"
+
+	if err := s.checkOptions(cameraIDs, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingService) start(rec models.Recording, cameraIDs []string, opts models.RecordingOptions, until time.Time) error {
 	log := s.log.With(
-		slog.String("op", op),
 		slog.String("camera_id", strings.Join(cameraIDs, ", ")),
-		slog.Int("user_id", userID),
+		slog.Int("user_id", rec.UserID),
+		slog.String("record_id", rec.RecordingID),
 	)
 
-	var cameras []*camera
-	for _, cameraID := range cameraIDs {
-		cameraIP, err := s.cameraProvider.CameraIP(cameraID)
+	if err := s.reserve(rec.RecordingID, cameraIDs, opts.Force, until.IsZero()); err != nil {
+		log.Error("cameras are busy", sl.Err(err))
+
+		return err
+	}
+	defer s.release(rec.RecordingID)
+
+	var spec recorder.Spec
+	var defaultProfile string
+	for i, cameraID := range cameraIDs {
+		cam, err := s.cameraProvider.Camera(cameraID)
 		if err != nil {
-			log.Error("failed to get camera ip", sl.Err(err))
+			log.Error("failed to get camera", sl.Err(err))
 
-			return "", fmt.Errorf("%s: %w", op, err)
+			return err
 		}
 
-		cameras = append(cameras, &camera{cameraIP: cameraIP})
+		if i == 0 && cam.ProfileID != nil {
+			defaultProfile = *cam.ProfileID
+		}
+
+		spec.Sources = append(spec.Sources, recorder.Source{URI: cam.CameraIP})
 	}
 
-	for _, cam := range cameras {
-		var err error
-		cam.audio, err = isCameraAvailable(cam.cameraIP)
+	var err error
+	for i := range spec.Sources {
+		spec.Sources[i].Audio, err = s.recorder.Probe(spec.Sources[i].URI)
 		if err != nil {
 			log.Error("camera is not available", sl.Err(err))
 
-			return "", fmt.Errorf("%s: %w", op, errs.ErrCameraIsNotAvailable)
+			s.publish(constants.EventCameraOffline, "", 0, cameraIDs[i:i+1], nil)
+
+			return errs.ErrCameraIsNotAvailable
 		}
 	}
 
-	rec := models.Recording{
-		RecordingID: uuid.New().String(),
-		UserID:      userID,
-		StartTime:   time.Now(),
+	spec.Audio, err = selectAudio(spec.Sources, cameraIDs, opts.AudioCameraID)
+	if err != nil {
+		log.Error("failed to select audio source", sl.Err(err))
+
+		return err
 	}
 
-	log.Info("start recording", slog.String("record_id", rec.RecordingID))
+	if len(spec.Sources) > 1 {
+		spec.Layout, err = s.resolveLayout(opts, len(spec.Sources))
+		if err != nil {
+			log.Error("failed to build layout", sl.Err(err))
+
+			return err
+		}
+	}
 
-	rec.FilePath = fmt.Sprintf("%s/%s/%s_%s.mkv", s.videosPath, cameraIDs[0], rec.RecordingID, rec.StartTime.Format("2006-01-02_15-04-05"))
+	spec.SegmentDuration = s.segmentDuration
+	if opts.SegmentMinutes > 0 {
+		spec.SegmentDuration = time.Duration(opts.SegmentMinutes) * time.Minute
+	}
 
-	parametres, err := recordingMode(cameras, rec.FilePath)
+	spec.Profile, err = s.resolveProfile(opts.ProfileID, defaultProfile)
 	if err != nil {
-		log.Error("failed to select recording mode", sl.Err(err))
+		log.Error("failed to get encoding profile", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		return err
+	}
+
+	// The backend keeps the chosen container or, when none is chosen, names
+	// the one it writes.
+	chosen := spec
+	chosen.Container = s.chooseContainer(opts, spec.Profile)
+	spec.Container = s.recorder.Container(chosen)
+
+	if err := checkContainer(spec.Container, spec.Profile); err != nil {
+		log.Error("unsupported container", sl.Err(err))
+
+		return err
+	}
+
+	if opts.PreRollSeconds > 0 {
+		if err := checkPreRollSpec(spec); err != nil {
+			log.Error("pre-roll can not be prepended", slog.Bool("profile", spec.Profile != nil), slog.String("container", spec.Container))
+
+			return err
+		}
+	}
+
+	if spec.Profile != nil && spec.Profile.AudioCodec == profile.NoAudio {
+		spec.Audio = recorder.NoAudio
+	}
+
+	if s.withProxy(opts) {
+		spec.Proxy = &recorder.Proxy{Profile: s.proxyProfile()}
 	}
 
-	cmd := exec.Command(parametres[0], parametres[1:]...)
-	if err := cmd.Start(); err != nil {
+	log.Info("start recording", slog.Int("audio_source", spec.Audio), slog.Bool("profile", spec.Profile != nil),
+		slog.String("container", spec.Container), slog.Bool("proxy", spec.Proxy != nil))
+
+	rec.Title = opts.Title
+	rec.Segmented = spec.SegmentDuration > 0
+	rec.Container = spec.Container
+	rec.MimeType = recorder.MIMEType(spec.Container)
+	rec.StartTime = time.Now()
+
+	// The pre-roll becomes the first file of the recording and the pipeline
+	// writes the live stream from the second one on.
+	var clip preroll.Clip
+	if opts.PreRollSeconds > 0 {
+		clip, err = s.takePreRoll(cameraIDs[0], opts.PreRollSeconds)
+		if err != nil {
+			log.Warn("recording without pre-roll", sl.Err(err))
+		} else {
+			rec.StartTime = clip.From
+		}
+	}
+
+	name := fmt.Sprintf("%s_%s", rec.RecordingID, rec.StartTime.Format("2006-01-02_15-04-05"))
+	if rec.Segmented {
+		name += "_" + recorder.SegmentIndex
+	}
+	rec.FilePath = fmt.Sprintf("%s/%s/%s.%s", s.videosPath, cameraIDs[0], name, spec.Container)
+
+	spec.FilePath = rec.FilePath
+
+	if len(clip.Chunks) > 0 {
+		if err := writePreRoll(clip, filePath(rec, 0)); err != nil {
+			log.Error("failed to write pre-roll", sl.Err(err))
+
+			clip, rec.StartTime = preroll.Clip{}, time.Now()
+		} else if rec.Segmented {
+			spec.SegmentStart = 1
+		} else {
+			spec.FilePath = filePath(rec, 1)
+		}
+	}
+
+	liveStart := time.Now()
+	if spec.Proxy != nil {
+		spec.Proxy.FilePath = recorder.ProxyPath(rec.FilePath)
+	}
+
+	output, err := s.openLog(rec)
+	if err != nil {
+		log.Error("failed to open pipeline log", sl.Err(err))
+	} else {
+		spec.Log = output
+	}
+
+	proc, err := s.recorder.Start(spec)
+	if err != nil {
 		log.Error("failed to start recording", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		if output != nil {
+			output.Close()
+		}
+
+		return err
 	}
 
-	s.commands[rec.RecordingID] = cmd
+	rec.PID = proc.PID()
+	rec.Status = constants.StatusRecording
+
+	// The session is complete before it is published, busy reads its
+	// recording under s.mu only.
+	sess := newSession(rec, cameraIDs, spec, until, proc)
+	sess.output = output
+
+	s.mu.Lock()
+	s.commands[rec.RecordingID] = sess
+	s.mu.Unlock()
 
 	if err := s.recordingSaver.Start(rec, cameraIDs[0]); err != nil {
 		log.Error("failed to write start data", sl.Err(err))
 
-		return rec.RecordingID, errs.ErrWriteToDB
+		// Without its row nothing could reach the recording, so the
+		// pipeline is not left running.
+		s.mu.Lock()
+		delete(s.commands, rec.RecordingID)
+		s.mu.Unlock()
+
+		sess.halt()
+		if err := proc.Stop(); err != nil {
+			log.Error("failed to stop pipeline", sl.Err(err))
+		}
+		proc.Wait(s.stopTimeout)
+		s.closeOutput(sess)
+
+		return errs.ErrWriteToDB
 	}
 
-	return rec.RecordingID, nil
+	// The pre-roll ends where the buffer stood, the live stream starts a
+	// moment later.
+	if len(clip.Chunks) > 0 {
+		if _, err := s.recordingSaver.OpenGap(rec.RecordingID, clip.To()); err != nil {
+			log.Error("failed to open gap", sl.Err(err))
+		} else if err := s.recordingSaver.CloseGaps(rec.RecordingID, liveStart); err != nil {
+			log.Error("failed to close gap", sl.Err(err))
+		}
+	}
+
+	for _, r := range renditions(rec, spec) {
+		if err := s.recordingSaver.SaveRendition(r); err != nil {
+			log.Error("failed to save rendition", slog.String("rendition", r.Name), sl.Err(err))
+		}
+	}
+
+	go s.supervise(sess)
+	go s.sampleSize(sess)
+
+	s.publish(constants.EventRecordingStarted, rec.RecordingID, rec.UserID, cameraIDs, nil)
+
+	if rec.Segmented {
+		go s.watchSegments(rec, spec.SegmentDuration)
+	}
+
+	return nil
+}
+
+// withProxy reports whether a proxy is recorded: as requested, or as
+// configured when the request doesn't say.
+func (s *RecordingService) withProxy(opts models.RecordingOptions) bool {
+	// There is no proxy of the pre-roll.
+	if opts.PreRollSeconds > 0 {
+		return false
+	}
+
+	if opts.Proxy != nil {
+		return *opts.Proxy
+	}
+
+	return s.proxy.Enabled
+}
+
+// proxyProfile is the encoding of the proxy. H.264 and AAC fit every
+// container.
+func (s *RecordingService) proxyProfile() models.Profile {
+	return models.Profile{
+		Name:         constants.RenditionProxy,
+		VideoCodec:   profile.H264,
+		VideoBitrate: s.proxy.VideoBitrate,
+		Preset:       "veryfast",
+		Width:        s.proxy.Width,
+		Height:       s.proxy.Height,
+		AudioCodec:   profile.AAC,
+		AudioBitrate: s.proxy.AudioBitrate,
+	}
+}
+
+// renditions lists the files written by the pipeline of spec.
+func renditions(rec models.Recording, spec recorder.Spec) []models.Rendition {
+	rs := []models.Rendition{{
+		RecordingID: rec.RecordingID,
+		Name:        constants.RenditionMaster,
+		FilePath:    rec.FilePath,
+		Container:   rec.Container,
+		MimeType:    rec.MimeType,
+	}}
+
+	if spec.Proxy != nil {
+		rs = append(rs, models.Rendition{
+			RecordingID: rec.RecordingID,
+			Name:        constants.RenditionProxy,
+			FilePath:    spec.Proxy.FilePath,
+			Container:   rec.Container,
+			MimeType:    rec.MimeType,
+		})
+	}
+
+	return rs
+}
+
+// checkOptions rejects options that can be checked without reaching the
+// cameras, so a bad schedule fails at request time.
+func (s *RecordingService) checkOptions(cameraIDs []string, opts models.RecordingOptions) error {
+	if opts.AudioCameraID != "" && indexOf(cameraIDs, opts.AudioCameraID) < 0 {
+		return fmt.Errorf("%w: %s", errs.ErrNotInRecording, opts.AudioCameraID)
+	}
+
+	if _, err := s.resolveLayout(opts, len(cameraIDs)); err != nil {
+		return err
+	}
+
+	if err := checkPreRoll(cameraIDs, opts); err != nil {
+		return err
+	}
+
+	p, err := s.resolveProfile(opts.ProfileID, "")
+	if err != nil {
+		return err
+	}
+
+	spec := recorder.Spec{Container: s.chooseContainer(opts, p), SegmentDuration: s.segmentDuration}
+	if opts.SegmentMinutes > 0 {
+		spec.SegmentDuration = time.Duration(opts.SegmentMinutes) * time.Minute
+	}
+
+	return checkContainer(recorder.DefaultContainer(spec), p)
+}
+
+// chooseContainer returns the requested container, or the configured one.
+// Without either MPEG-TS is used, so the pieces written after a pause or a
+// restart can be joined, unless the codecs of the profile don't fit in it.
+// A pre-roll is only joined to MPEG-TS.
+func (s *RecordingService) chooseContainer(opts models.RecordingOptions, p *models.Profile) string {
+	if opts.Container != "" {
+		return opts.Container
+	}
+
+	if opts.PreRollSeconds > 0 {
+		return constants.ContainerMPEGTS
+	}
+
+	if s.container != "" {
+		return s.container
+	}
+
+	if p != nil && profile.CheckContainer(*p, constants.ContainerMPEGTS) != nil {
+		return ""
+	}
+
+	return constants.ContainerMPEGTS
+}
+
+// checkContainer rejects unknown containers and ones that can not hold the
+// codecs of the profile.
+func checkContainer(container string, p *models.Profile) error {
+	if recorder.MIMEType(container) == "" {
+		return fmt.Errorf("%w: %s", errs.ErrUnknownContainer, container)
+	}
+
+	if p != nil {
+		return profile.CheckContainer(*p, container)
+	}
+
+	return nil
+}
+
+// resolveProfile returns the requested profile, or the default profile of
+// the recorded camera when none is requested. Nil keeps the built-in
+// encoding.
+func (s *RecordingService) resolveProfile(profileID, defaultID string) (*models.Profile, error) {
+	if profileID == "" {
+		profileID = defaultID
+	}
+
+	if profileID == "" {
+		return nil, nil
+	}
+
+	p, err := s.profileProvider.Profile(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// resolveLayout places n sources using the stored layout when one is
+// requested, or a built-in layout otherwise.
+func (s *RecordingService) resolveLayout(opts models.RecordingOptions, n int) (layout.Layout, error) {
+	if opts.LayoutID != "" {
+		custom, err := s.layoutProvider.Layout(opts.LayoutID)
+		if err != nil {
+			return layout.Layout{}, err
+		}
+
+		return layout.Custom(custom, n)
+	}
+
+	name := opts.Layout
+	if name == "" {
+		name = s.layout
+	}
+
+	return layout.Named(name, n, s.width, s.height)
+}
+
+// selectAudio returns the index of the source whose audio is recorded: the
+// requested camera, or the first camera with audio when none was requested.
+func selectAudio(sources []recorder.Source, cameraIDs []string, audioCameraID string) (int, error) {
+	if audioCameraID == "" {
+		for i, src := range sources {
+			if src.Audio {
+				return i, nil
+			}
+		}
+
+		return recorder.NoAudio, nil
+	}
+
+	i := indexOf(cameraIDs, audioCameraID)
+	if i < 0 {
+		return recorder.NoAudio, fmt.Errorf("%w: %s", errs.ErrNotInRecording, audioCameraID)
+	}
+
+	if !sources[i].Audio {
+		return recorder.NoAudio, fmt.Errorf("%w: %s", errs.ErrCameraHasNoAudio, audioCameraID)
+	}
+
+	return i, nil
+}
+
+func indexOf(ids []string, id string) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+
+	return -1
 }
 
 func (s *RecordingService) Stop(recordID string) error {
@@ -139,22 +653,72 @@ func (s *RecordingService) Stop(recordID string) error {
 
 	log.Info("stop recording", slog.String("record_id", recordID))
 
-	cmd, ok := s.commands[recordID]
+	s.mu.Lock()
+	sess, ok := s.commands[recordID]
+	s.mu.Unlock()
+
 	if !ok {
-		log.Error("record not found", slog.String("record_id", recordID))
+		rec, err := s.recordingProvider.Recording(recordID)
+		if err != nil {
+			log.Error("record not found", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Error("recording is not running", slog.String("status", rec.Status))
 
-		return fmt.Errorf("%s: %w", op, errs.ErrRecordNotFound)
+		return fmt.Errorf("%s: %w", op, checkTransition(rec.Status, constants.StatusFinalizing))
 	}
 
-	if err := cmd.Process.Kill(); err != nil {
-		log.Error("failed to stop recording", sl.Err(err))
+	// Waits for a pause, resume or restart in progress, so the pipeline
+	// stopped is the last one.
+	sess.pipeline.Lock()
+	defer sess.pipeline.Unlock()
 
-		return fmt.Errorf("%s: %w", op, err)
+	// A pipeline that exited on its own and was not restarted leaves the
+	// recording interrupted. A paused recording has no pipeline to stop.
+	proc, crashed, paused := sess.halt()
+	if !crashed && !paused {
+		// The session stays registered, so a pipeline that is still running
+		// can be stopped again.
+		if err := proc.Stop(); err != nil {
+			log.Error("failed to stop recording", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	s.mu.Lock()
+	if s.commands[recordID] != sess {
+		s.mu.Unlock()
+
+		log.Error("recording was stopped concurrently")
+
+		return fmt.Errorf("%s: %w", op, errs.ErrRecordingNotActive)
+	}
+	delete(s.commands, recordID)
+	s.mu.Unlock()
+
+	from := constants.StatusRecording
+	if paused {
+		from = constants.StatusPaused
+	}
+
+	now := time.Now()
+	err := s.recordingSaver.Stop(recordID, now, from, constants.StatusFinalizing)
+
+	if paused {
+		if err := s.recordingSaver.ClosePauses(recordID, now); err != nil {
+			log.Error("failed to close pause", sl.Err(err))
+		}
 	}
 
-	log.Info("record successfully stopped")
+	go func() {
+		s.finalize(sess.rec, sess.cameraIDs, proc, crashed)
+		s.closeOutput(sess)
+	}()
 
-	if err := s.recordingSaver.Stop(recordID, time.Now()); err != nil {
+	if err != nil {
 		log.Error("failed to write stop data", sl.Err(err))
 
 		return errs.ErrWriteToDB
@@ -163,50 +727,51 @@ func (s *RecordingService) Stop(recordID string) error {
 	return nil
 }
 
-func (s *RecordingService) Schedule(startTime time.Time, cameraID []string, duration string, userID int) error {
-	const op = "service.recordings.Schedule"
+func (s *RecordingService) finalize(rec models.Recording, cameraIDs []string, proc recorder.Process, crashed bool) {
+	const op = "service.recordings.finalize"
+
+	recordID := rec.RecordingID
 
 	log := s.log.With(
 		slog.String("op", op),
-		slog.String("camera_id", strings.Join(cameraID, ", ")),
-		slog.Int("user_id", userID),
+		slog.String("record_id", recordID),
 	)
 
-	log.Info("schedule recording", slog.Any("schedule", cameraID), slog.Any("start_time", startTime), slog.Any("duration", duration))
-
-	delay := time.Until(startTime)
-	if delay < 0 {
-		log.Error("invalid start time", slog.Any("start_time", startTime))
+	st, killed := proc.Wait(s.stopTimeout)
+	exitCode := st.ExitCode
+	if killed {
+		log.Warn("pipeline did not finish in time, killed", slog.Duration("timeout", s.stopTimeout))
+	}
 
-		return fmt.Errorf("%s: %w", op, errs.ErrInvalidStartTime)
+	status := constants.StatusStopped
+	switch {
+	case crashed:
+		status = constants.StatusInterrupted
+	case killed || exitCode > 0:
+		status = constants.StatusFailed
 	}
 
-	durationTime, err := time.ParseDuration(duration)
-	if err != nil {
-		log.Error("wrong duration format", sl.Err(err))
+	log.Info("record finalized", slog.String("status", status), slog.Int("exit_code", exitCode))
 
-		return fmt.Errorf("%s: %w", op, err)
+	if err := s.recordingSaver.CloseGaps(recordID, time.Now()); err != nil {
+		log.Error("failed to close gaps", sl.Err(err))
 	}
 
-	var recordID string
-
-	time.AfterFunc(delay, func() {
-		if recordID, err = s.Start(cameraID, userID); err != nil {
-			log.Error("failed to start recording", sl.Err(err))
+	if err := s.closeSegments(recordID); err != nil {
+		log.Error("failed to index segments", sl.Err(err))
+	}
 
-			return
-		}
+	if err := s.recordingSaver.Finish(recordID, exitCode, constants.StatusFinalizing, status); err != nil {
+		log.Error("failed to write finish data", sl.Err(err))
 
-		time.AfterFunc(durationTime, func() {
-			if err := s.Stop(recordID); err != nil {
-				log.Error("failed to stop recording", sl.Err(err))
+		return
+	}
 
-				return
-			}
-		})
-	})
+	if err := s.writeChapters(recordID); err != nil {
+		log.Error("failed to write chapters", sl.Err(err))
+	}
 
-	return nil
+	s.publish(finishEvent(status), recordID, rec.UserID, cameraIDs, map[string]int{"exit_code": exitCode})
 }
 
 func (s *RecordingService) CameraRecordings(cameraID string, limit, offset, userID int) ([]models.Recording, error) {
@@ -248,13 +813,44 @@ func (s *RecordingService) Move(recordingID string) error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.videoService.Move(rec); err != nil {
+	duration, err := s.recorded(rec)
+	if err != nil {
+		log.Error("failed to get recording duration", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	markers, err := s.recordingProvider.Markers(recordingID)
+	if err != nil {
+		log.Error("failed to get markers", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.setStatus(rec, constants.StatusUploading); err != nil {
+		log.Error("recording can't be moved", slog.String("status", rec.Status), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	cameraIDs := []string{rec.CameraID}
+	s.publish(constants.EventUploadStarted, recordingID, rec.UserID, cameraIDs, nil)
+
+	if err := s.videoService.Move(rec, s.files(rec), duration, markers); err != nil {
 		log.Error("failed to move recording", sl.Err(err))
 
+		s.publish(constants.EventUploadFailed, recordingID, rec.UserID, cameraIDs, nil)
+
+		if err := s.recordingSaver.SetStatus(recordingID, constants.StatusUploading, rec.Status); err != nil {
+			log.Error("failed to restore recording status", sl.Err(err))
+		}
+
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.recordingProvider.Move(recordingID); err != nil {
+	s.publish(constants.EventUploadFinished, recordingID, rec.UserID, cameraIDs, nil)
+
+	if err := s.recordingProvider.Move(recordingID, constants.StatusUploading, constants.StatusUploaded); err != nil {
 		log.Error("failed to write move data", sl.Err(err))
 
 		return errs.ErrWriteToDB
@@ -280,15 +876,44 @@ func (s *RecordingService) Delete(recordID string) error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if !rec.IsMoved {
-		if err = os.Remove(rec.FilePath); err != nil {
-			log.Error("failed to delete file", sl.Err(err))
+	if err := checkTransition(rec.Status, constants.StatusDeleted); err != nil {
+		log.Error("recording can't be deleted", slog.String("status", rec.Status), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rec.FilePath != "" {
+		for _, path := range pipelog.Files(logPath(rec)) {
+			if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Error("failed to delete log", sl.Err(err))
+			}
+		}
+
+		if err = os.Remove(chaptersPath(rec)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error("failed to delete chapters", sl.Err(err))
+		}
+	}
+
+	if !rec.IsMoved && rec.FilePath != "" {
+		rs, err := s.renditions(rec)
+		if err != nil {
+			log.Error("failed to get renditions", sl.Err(err))
 
 			return fmt.Errorf("%s: %w", op, err)
 		}
+
+		for _, r := range rs {
+			for _, path := range s.files(withRendition(rec, r)) {
+				if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Error("failed to delete file", sl.Err(err))
+
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
+		}
 	}
 
-	if err = s.recordingProvider.Delete(recordID); err != nil {
+	if err = s.setStatus(rec, constants.StatusDeleted); err != nil {
 		log.Error("failed to delete record", sl.Err(err))
 
 		return fmt.Errorf("%s: %w", op, err)
@@ -297,100 +922,313 @@ func (s *RecordingService) Delete(recordID string) error {
 	return nil
 }
 
-func (s *RecordingService) File(recordID string) (string, error) {
-	const op = "service.recordings.Download"
+// Files returns the files of the whole recording in playback order. An empty
+// rendition is the master.
+func (s *RecordingService) Files(recordID, rendition string) ([]string, error) {
+	const op = "service.recordings.Files"
 
 	log := s.log.With(
 		slog.String("op", op),
 		slog.String("record_id", recordID),
+		slog.String("rendition", rendition),
 	)
 
-	log.Info("get file", slog.String("record_id", recordID))
+	log.Info("get files", slog.String("record_id", recordID))
 
-	rec, err := s.recordingProvider.Recording(recordID)
+	rec, err := s.downloadable(log, recordID)
 	if err != nil {
-		log.Error("failed to get recording", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
+	r, err := s.rendition(rec, rendition)
+	if err != nil {
+		log.Error("failed to get rendition", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	files := s.files(withRendition(rec, r))
+	if len(files) == 0 {
+		log.Error("recording has no files")
+
+		return nil, fmt.Errorf("%s: %w", op, s.renditionMissing(log, rec, r))
+	}
+
+	for _, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			log.Error("file not found", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, s.renditionMissing(log, rec, r))
+		}
+	}
+
+	return files, nil
+}
+
+func (s *RecordingService) Segment(recordID, rendition string, index int) (string, error) {
+	const op = "service.recordings.Segment"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+		slog.String("rendition", rendition),
+		slog.Int("segment", index),
+	)
+
+	log.Info("get segment")
+
+	rec, err := s.downloadable(log, recordID)
+	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rec.IsMoved {
-		log.Error("file already moved")
+	r, err := s.rendition(rec, rendition)
+	if err != nil {
+		log.Error("failed to get rendition", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, errs.ErrFileAlreadyMoved)
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	if _, err := os.Stat(rec.FilePath); err != nil {
-		log.Error("file not found", sl.Err(err))
+	segs, err := s.recordingProvider.Segments(recordID)
+	if err != nil {
+		log.Error("failed to get segments", sl.Err(err))
 
-		if err = s.recordingProvider.Delete(recordID); err != nil {
-			log.Error("failed to delete record", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, seg := range segs {
+		if seg.Index != index {
+			continue
+		}
+
+		// Segments are indexed for the master, the proxy is cut at the same
+		// points.
+		path := seg.FilePath
+		if r.Name != constants.RenditionMaster {
+			path = recorder.SegmentPath(r.FilePath, index)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			log.Error("file not found", sl.Err(err))
 
-			return "", fmt.Errorf("%s: %w", op, errs.ErrFileNotFound)
+			return "", fmt.Errorf("%s: %w", op, s.renditionMissing(log, rec, r))
 		}
 
-		return "", fmt.Errorf("%s: %w", op, errs.ErrFileNotFound)
+		return path, nil
 	}
 
-	return rec.FilePath, nil
+	log.Error("segment not found")
+
+	return "", fmt.Errorf("%s: %w", op, errs.ErrSegmentNotFound)
 }
 
-func recordingMode(cameras []*camera, filePath string) ([]string, error) {
-	var parametres string
-	switch len(cameras) {
-	case 1:
-		if cameras[0].audio {
-			parametres = fmt.Sprintf("gst-launch-1.0 uridecodebin uri=%s name=dec ! queue ! videoconvert ! x264enc ! matroskamux name=mux ! filesink location=%s dec. ! queue ! audioconvert ! lamemp3enc ! mux.",
-				cameras[0].cameraIP, filePath)
-		} else {
-			parametres = fmt.Sprintf("gst-launch-1.0 rtspsrc location=%s ! rtph264depay ! h264parse ! matroskamux ! filesink location=\"%s\"",
-				cameras[0].cameraIP, filePath)
-		}
-	case 2:
-		if cameras[0].audio {
-			parametres = fmt.Sprintf("gst-launch-1.0 rtspsrc location=%s name=src ! rtph264depay ! h264parse ! queue ! mux. src. ! rtpmp4gdepay ! aacparse ! queue ! mux. matroskamux name=mux ! filesink location=\"%s\"",
-				cameras[0].cameraIP, filePath)
+// Rendition returns the rendition of a recording, the master when name is
+// empty.
+func (s *RecordingService) Rendition(recordID, name string) (models.Rendition, error) {
+	const op = "service.recordings.Rendition"
 
-		} else {
-			parametres = fmt.Sprintf("gst-launch-1.0 -e videomixer name=mix sink_0::xpos=0 sink_1::xpos=640 ! videoconvert ! x264enc ! queue ! mux. uridecodebin uri=%s ! videoconvert ! videoscale ! video/x-raw,width=640,height=480 ! mix.sink_0 uridecodebin uri=%s ! videoconvert ! videoscale ! video/x-raw,width=640,height=480 ! mix.sink_1 matroskamux name=mux ! filesink location=%s",
-				cameras[0].cameraIP, cameras[1].cameraIP, filePath)
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+		slog.String("rendition", name),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return models.Rendition{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r, err := s.rendition(rec, name)
+	if err != nil {
+		log.Error("failed to get rendition", sl.Err(err))
+
+		return models.Rendition{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return r, nil
+}
+
+func (s *RecordingService) Segments(recordID string) ([]models.Segment, error) {
+	const op = "service.recordings.Segments"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	if _, err := s.recordingProvider.Recording(recordID); err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	segs, err := s.recordingProvider.Segments(recordID)
+	if err != nil {
+		log.Error("failed to get segments", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segs, nil
+}
+
+// Details returns the recording with its pieces, the gaps between them and
+// its markers.
+func (s *RecordingService) Details(recordID string) (models.RecordingDetails, error) {
+	const op = "service.recordings.Details"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	segs, err := s.recordingProvider.Segments(recordID)
+	if err != nil {
+		log.Error("failed to get segments", sl.Err(err))
+
+		return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	gaps, err := s.recordingProvider.Gaps(recordID)
+	if err != nil {
+		log.Error("failed to get gaps", sl.Err(err))
+
+		return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pauses, err := s.recordingProvider.Pauses(recordID)
+	if err != nil {
+		log.Error("failed to get pauses", sl.Err(err))
+
+		return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	markers, err := s.recordingProvider.Markers(recordID)
+	if err != nil {
+		log.Error("failed to get markers", sl.Err(err))
+
+		return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var rs []models.Rendition
+	if rec.FilePath != "" {
+		if rs, err = s.renditions(rec); err != nil {
+			log.Error("failed to get renditions", sl.Err(err))
+
+			return models.RecordingDetails{}, fmt.Errorf("%s: %w", op, err)
 		}
-	default:
-		return nil, fmt.Errorf("too many arguments in camera_ips")
 	}
 
-	return strings.Split(parametres, " "), nil
+	return models.RecordingDetails{Recording: rec, Renditions: rs, Segments: segs, Gaps: gaps, Pauses: pauses, Markers: markers}, nil
 }
 
-func isCameraAvailable(rtspURL string) (bool, error) {
-	u, err := url.Parse(rtspURL)
+func (s *RecordingService) downloadable(log *slog.Logger, recordID string) (models.Recording, error) {
+	rec, err := s.recordingProvider.Recording(recordID)
 	if err != nil {
-		return false, err
+		log.Error("failed to get recording", sl.Err(err))
+
+		return rec, err
+	}
+
+	if rec.Status == constants.StatusDeleted {
+		log.Error("recording has no file", slog.String("status", rec.Status))
+
+		return rec, errs.ErrRecordNotFound
+	}
+
+	if rec.IsMoved {
+		log.Error("file already moved")
+
+		return rec, errs.ErrFileAlreadyMoved
 	}
 
-	conn := gortsplib.Client{ReadTimeout: 3 * time.Second, WriteTimeout: 3 * time.Second}
+	return rec, nil
+}
 
-	err = conn.Start(u.Scheme, u.Host)
+// renditions returns the renditions of a recording. Recordings made before
+// renditions were tracked only have the master, taken from the recording.
+func (s *RecordingService) renditions(rec models.Recording) ([]models.Rendition, error) {
+	rs, err := s.recordingProvider.Renditions(rec.RecordingID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	defer conn.Close()
 
-	tracks, _, _, err := conn.Describe(u)
+	if len(rs) == 0 {
+		rs = []models.Rendition{{
+			RecordingID: rec.RecordingID,
+			Name:        constants.RenditionMaster,
+			FilePath:    rec.FilePath,
+			Container:   rec.Container,
+			MimeType:    rec.MimeType,
+		}}
+	}
+
+	return rs, nil
+}
+
+func (s *RecordingService) rendition(rec models.Recording, name string) (models.Rendition, error) {
+	if name == "" {
+		name = constants.RenditionMaster
+	}
+
+	rs, err := s.renditions(rec)
 	if err != nil {
-		return false, err
+		return models.Rendition{}, err
 	}
 
-	audioFound := false
+	for _, r := range rs {
+		if r.Name == name {
+			return r, nil
+		}
+	}
 
-	for _, track := range tracks {
-		switch track.(type) {
-		case *gortsplib.TrackOpus, *gortsplib.TrackVorbis, *gortsplib.TrackG711, *gortsplib.TrackG722, *gortsplib.TrackMPEG2Audio, *gortsplib.TrackMPEG4Audio:
-			audioFound = true
+	return models.Rendition{}, fmt.Errorf("%w: %s", errs.ErrRenditionNotFound, name)
+}
 
-			return audioFound, nil
+// withRendition returns rec pointing to the files of r, so its pieces and
+// segments are found like those of the master.
+func withRendition(rec models.Recording, r models.Rendition) models.Recording {
+	rec.FilePath = r.FilePath
+	rec.Container = r.Container
+	rec.MimeType = r.MimeType
+
+	return rec
+}
+
+// renditionMissing handles a rendition whose files are gone. Only a missing
+// master makes the recording deleted, a proxy can be removed on its own.
+func (s *RecordingService) renditionMissing(log *slog.Logger, rec models.Recording, r models.Rendition) error {
+	if r.Name != constants.RenditionMaster {
+		return errs.ErrFileNotFound
+	}
+
+	return s.fileMissing(log, rec)
+}
+
+// fileMissing marks a finished recording whose files are gone as deleted.
+func (s *RecordingService) fileMissing(log *slog.Logger, rec models.Recording) error {
+	if !isActive(rec.Status) {
+		if err := s.setStatus(rec, constants.StatusDeleted); err != nil {
+			log.Error("failed to delete record", sl.Err(err))
 		}
 	}
 
-	return audioFound, nil
+	return errs.ErrFileNotFound
+}
+
+func (s *RecordingService) setStatus(rec models.Recording, to string) error {
+	if err := checkTransition(rec.Status, to); err != nil {
+		return err
+	}
+
+	return s.recordingSaver.SetStatus(rec.RecordingID, rec.Status, to)
 }
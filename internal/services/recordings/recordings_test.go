@@ -0,0 +1,1766 @@
+package recordingservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/opencast"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/pipelog"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/preroll"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/profile"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder/fake"
+)
+
+type memStorage struct {
+	mu         sync.Mutex
+	recs       map[string]models.Recording
+	segments   map[string][]models.Segment
+	renditions map[string][]models.Rendition
+	gaps       map[string][]models.Gap
+	pauses     map[string][]models.Pause
+	markers    map[string][]models.Marker
+	sessions   map[string]models.Session
+	events     map[string][]models.PipelineEvent
+	// startErr fails the next Start.
+	startErr error
+	// onStart is called by Start before the recording is saved.
+	onStart func(rec models.Recording)
+	// onSetStatus is called by SetStatus before the status is written.
+	onSetStatus func(recordID, from, to string)
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		recs:       make(map[string]models.Recording),
+		segments:   make(map[string][]models.Segment),
+		renditions: make(map[string][]models.Rendition),
+		gaps:       make(map[string][]models.Gap),
+		pauses:     make(map[string][]models.Pause),
+		markers:    make(map[string][]models.Marker),
+		sessions:   make(map[string]models.Session),
+		events:     make(map[string][]models.PipelineEvent),
+	}
+}
+
+func (m *memStorage) update(recordID, from, to string, fn func(*models.Recording)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.recs[recordID]
+	if !ok {
+		return errs.ErrRecordNotFound
+	}
+	if rec.Status != from {
+		return errs.ErrInvalidStatusTransition
+	}
+
+	rec.Status = to
+	if fn != nil {
+		fn(&rec)
+	}
+	m.recs[recordID] = rec
+
+	return nil
+}
+
+func (m *memStorage) Start(rec models.Recording, cameraID string) error {
+	if m.onStart != nil {
+		m.onStart(rec)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.startErr; err != nil {
+		m.startErr = nil
+
+		return err
+	}
+
+	rec.CameraID = cameraID
+	m.recs[rec.RecordingID] = rec
+
+	return nil
+}
+
+func (m *memStorage) Stop(recordID string, stopTime time.Time, from, to string) error {
+	return m.update(recordID, from, to, func(r *models.Recording) { r.StopTime = stopTime })
+}
+
+func (m *memStorage) Finish(recordID string, exitCode int, from, to string) error {
+	return m.update(recordID, from, to, func(r *models.Recording) { r.ExitCode = &exitCode })
+}
+
+func (m *memStorage) SetStatus(recordID, from, to string) error {
+	if m.onSetStatus != nil {
+		m.onSetStatus(recordID, from, to)
+	}
+
+	return m.update(recordID, from, to, nil)
+}
+
+func (m *memStorage) Move(recordID string, from, to string) error {
+	return m.update(recordID, from, to, func(r *models.Recording) { r.IsMoved = true })
+}
+
+func (m *memStorage) SaveSegment(seg models.Segment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.segments[seg.RecordingID] {
+		if existing.Index == seg.Index {
+			return nil
+		}
+	}
+	m.segments[seg.RecordingID] = append(m.segments[seg.RecordingID], seg)
+
+	return nil
+}
+
+func (m *memStorage) Segments(recordID string) ([]models.Segment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Segment(nil), m.segments[recordID]...), nil
+}
+
+func (m *memStorage) SaveRendition(rendition models.Rendition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.renditions[rendition.RecordingID] = append(m.renditions[rendition.RecordingID], rendition)
+
+	return nil
+}
+
+func (m *memStorage) Renditions(recordID string) ([]models.Rendition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Rendition(nil), m.renditions[recordID]...), nil
+}
+
+func (m *memStorage) SetPID(recordID string, pid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.recs[recordID]
+	rec.PID = pid
+	m.recs[recordID] = rec
+
+	return nil
+}
+
+func (m *memStorage) OpenGap(recordID string, from time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gaps[recordID] = append(m.gaps[recordID], models.Gap{ID: int64(len(m.gaps[recordID]) + 1), From: from})
+
+	return int64(len(m.gaps[recordID])), nil
+}
+
+func (m *memStorage) CloseGaps(recordID string, to time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, gap := range m.gaps[recordID] {
+		if gap.To.IsZero() {
+			m.gaps[recordID][i].To = to
+		}
+	}
+
+	return nil
+}
+
+func (m *memStorage) Gaps(recordID string) ([]models.Gap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Gap(nil), m.gaps[recordID]...), nil
+}
+
+func (m *memStorage) OpenPause(recordID string, from time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pauses[recordID] = append(m.pauses[recordID], models.Pause{ID: int64(len(m.pauses[recordID]) + 1), From: from})
+
+	return int64(len(m.pauses[recordID])), nil
+}
+
+func (m *memStorage) ClosePauses(recordID string, to time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, pause := range m.pauses[recordID] {
+		if pause.To.IsZero() {
+			m.pauses[recordID][i].To = to
+		}
+	}
+
+	return nil
+}
+
+func (m *memStorage) Pauses(recordID string) ([]models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Pause(nil), m.pauses[recordID]...), nil
+}
+
+func (m *memStorage) SaveMarker(marker models.Marker) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	marker.ID = int64(len(m.markers[marker.RecordingID]) + 1)
+	m.markers[marker.RecordingID] = append(m.markers[marker.RecordingID], marker)
+
+	return marker.ID, nil
+}
+
+func (m *memStorage) Markers(recordID string) ([]models.Marker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Marker(nil), m.markers[recordID]...), nil
+}
+
+func (m *memStorage) SaveSession(session models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.SessionID] = session
+
+	return nil
+}
+
+func (m *memStorage) DeleteSession(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, sessionID)
+
+	return nil
+}
+
+func (m *memStorage) Session(sessionID string) (models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return models.Session{}, errs.ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (m *memStorage) SessionRecordings(sessionID string) ([]models.Recording, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var recs []models.Recording
+	for _, rec := range m.recs {
+		if rec.SessionID == sessionID {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].SessionIndex < recs[j].SessionIndex })
+
+	return recs, nil
+}
+
+func (m *memStorage) SaveEvents(events []models.PipelineEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range events {
+		m.events[event.RecordingID] = append(m.events[event.RecordingID], event)
+	}
+
+	return nil
+}
+
+func (m *memStorage) Events(recordID, level string) ([]models.PipelineEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.PipelineEvent
+	for _, ev := range m.events[recordID] {
+		if level == "" || ev.Level == level {
+			events = append(events, ev)
+		}
+	}
+
+	return events, nil
+}
+
+func (m *memStorage) CameraRecordings(cameraID string, limit, offset, userID int) ([]models.Recording, error) {
+	return nil, nil
+}
+
+func (m *memStorage) Recording(recordID string) (models.Recording, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.recs[recordID]
+	if !ok {
+		return models.Recording{}, errs.ErrRecordNotFound
+	}
+
+	return rec, nil
+}
+
+func (m *memStorage) OpenRecordings() ([]models.Recording, error) {
+	return nil, nil
+}
+
+// stubCameras maps camera IDs to their default profile.
+type stubCameras map[string]string
+
+func (c stubCameras) Camera(cameraID string) (models.Camera, error) {
+	cam := models.Camera{CameraID: cameraID, CameraIP: "rtsp://" + cameraID}
+	if profileID, ok := c[cameraID]; ok {
+		cam.ProfileID = &profileID
+	}
+
+	return cam, nil
+}
+
+type stubLayouts struct{}
+
+func (stubLayouts) Layout(layoutID string) (models.Layout, error) {
+	return models.Layout{}, errs.ErrLayoutNotFound
+}
+
+type stubProfiles map[string]models.Profile
+
+func (p stubProfiles) Profile(profileID string) (models.Profile, error) {
+	found, ok := p[profileID]
+	if !ok {
+		return models.Profile{}, errs.ErrProfileNotFound
+	}
+
+	return found, nil
+}
+
+type stubVideoService struct {
+	moved     []string
+	durations []time.Duration
+	markers   []models.Marker
+	tracks    [][]string
+}
+
+func (v *stubVideoService) Move(rec models.Recording, files []string, duration time.Duration, markers []models.Marker) error {
+	v.moved = append(v.moved, rec.RecordingID)
+	v.durations = append(v.durations, duration)
+	v.markers = append(v.markers, markers...)
+
+	return nil
+}
+
+func (v *stubVideoService) MoveSession(session models.Session, files [][]string, duration time.Duration) error {
+	for _, angle := range session.Angles {
+		v.moved = append(v.moved, angle.RecordingID)
+	}
+	v.durations = append(v.durations, duration)
+	v.tracks = append(v.tracks, files...)
+
+	return nil
+}
+
+type stubPreRoll struct {
+	clip preroll.Clip
+}
+
+func (p stubPreRoll) Take(cameraID string, d time.Duration) (preroll.Clip, error) {
+	if len(p.clip.Chunks) == 0 {
+		return preroll.Clip{}, errs.ErrNoPreRoll
+	}
+
+	return p.clip, nil
+}
+
+type stubEvents struct {
+	mu     sync.Mutex
+	events []models.Event
+}
+
+func (e *stubEvents) Publish(event models.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events = append(e.events, event)
+}
+
+func (e *stubEvents) types(recordID string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var types []string
+	for _, ev := range e.events {
+		if ev.RecordingID == recordID {
+			types = append(types, ev.Type)
+		}
+	}
+
+	return types
+}
+
+func newTestService(t *testing.T) (*RecordingService, *memStorage, *stubVideoService) {
+	s, storage, videoService, _ := newTestServiceWithRecorder(t)
+
+	return s, storage, videoService
+}
+
+func newTestServiceWithRecorder(t *testing.T) (*RecordingService, *memStorage, *stubVideoService, *fake.Recorder) {
+	t.Helper()
+
+	videos := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(videos, "cam"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newMemStorage()
+	videoService := &stubVideoService{}
+	rec := fake.New()
+	rec.Interval = 5 * time.Millisecond
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Recording{
+		StaleAfter:   time.Minute,
+		StopTimeout:  time.Second,
+		Layout:       "grid",
+		Width:        640,
+		Height:       360,
+		RestartMin:   10 * time.Millisecond,
+		RestartMax:   40 * time.Millisecond,
+		StatusWindow: 50 * time.Millisecond,
+	}
+
+	s := New(log, storage, storage, stubCameras{}, stubLayouts{}, stubProfiles{}, videoService, rec, &stubEvents{}, nil, videos, cfg)
+
+	go s.WriteEvents()
+	t.Cleanup(s.Close)
+
+	return s, storage, videoService, rec
+}
+
+func waitStatus(t *testing.T, storage *memStorage, recordID, status string) models.Recording {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec, err := storage.Recording(recordID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Status == status {
+			return rec
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, want %s", rec.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecordingFlow(t *testing.T) {
+	s, storage, videoService := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+
+	if err := s.Move(recordID); !errors.Is(err, errs.ErrRecordingInProgress) {
+		t.Errorf("Move() while recording error = %v, want %v", err, errs.ErrRecordingInProgress)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	rec := waitStatus(t, storage, recordID, constants.StatusStopped)
+	if rec.ExitCode == nil || *rec.ExitCode != 0 {
+		t.Errorf("exit code = %v, want 0", rec.ExitCode)
+	}
+
+	if err := s.Stop(recordID); !errors.Is(err, errs.ErrRecordingNotActive) {
+		t.Errorf("second Stop() error = %v, want %v", err, errs.ErrRecordingNotActive)
+	}
+
+	files, err := s.Files(recordID, "")
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Files() returned %d files, want 1", len(files))
+	}
+
+	info, err := os.Stat(files[0])
+	if err != nil || info.Size() == 0 {
+		t.Fatalf("recording file is missing or empty: %v", err)
+	}
+
+	if err := s.Move(recordID); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusUploaded)
+
+	if len(videoService.moved) != 1 {
+		t.Errorf("moved %d recordings, want 1", len(videoService.moved))
+	}
+
+	want := []string{constants.EventRecordingStarted, constants.EventRecordingStopped, constants.EventUploadStarted, constants.EventUploadFinished}
+	if got := s.events.(*stubEvents).types(recordID); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	if err := s.Delete(recordID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusDeleted)
+
+	if err := s.Delete(recordID); !errors.Is(err, errs.ErrRecordingDeleted) {
+		t.Errorf("second Delete() error = %v, want %v", err, errs.ErrRecordingDeleted)
+	}
+}
+
+func TestStopRetry(t *testing.T) {
+	s, storage, _, rec := newTestServiceWithRecorder(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+
+	rec.StopErrors = 1
+	if err := s.Stop(recordID); err == nil {
+		t.Fatal("Stop() error = nil, want the interrupt error")
+	}
+
+	if got, _ := storage.Recording(recordID); got.Status != constants.StatusRecording {
+		t.Errorf("status after a failed stop = %s, want %s", got.Status, constants.StatusRecording)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("second Stop() error = %v, want the pipeline stopped", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+}
+
+func TestStartSaveFailure(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	storage.startErr = errors.New("connection refused")
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if !errors.Is(err, errs.ErrWriteToDB) {
+		t.Fatalf("Start() error = %v, want %v", err, errs.ErrWriteToDB)
+	}
+	if recordID != "" {
+		t.Errorf("Start() id = %q, want none with an error", recordID)
+	}
+
+	s.mu.Lock()
+	running := len(s.commands)
+	s.mu.Unlock()
+	if running != 0 {
+		t.Errorf("running sessions = %d, want the pipeline stopped", running)
+	}
+
+	// The camera is free again.
+	other, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() after a failed save error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusRecording)
+
+	if err := s.Stop(other); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusStopped)
+}
+
+func TestPipelineEventsDropped(t *testing.T) {
+	storage := newMemStorage()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(log, storage, storage, stubCameras{}, stubLayouts{}, stubProfiles{}, &stubVideoService{}, fake.New(), &stubEvents{}, nil, t.TempDir(), config.Recording{})
+
+	// Nothing is written yet, so the queue fills up without blocking.
+	for i := 0; i < eventQueueSize+5; i++ {
+		s.saveEvent("rec", pipelog.Event{Level: constants.LevelError, Message: fmt.Sprintf("error %d", i)})
+	}
+
+	if dropped := s.droppedEvents.Load(); dropped != 5 {
+		t.Errorf("dropped events = %d, want 5", dropped)
+	}
+
+	go s.WriteEvents()
+	s.Close()
+
+	events, err := storage.Events("rec", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != eventQueueSize || events[0].Message != "error 0" {
+		t.Errorf("saved %d events, want the %d queued in order", len(events), eventQueueSize)
+	}
+}
+
+func TestStartWithProfile(t *testing.T) {
+	s, _, _, rec := newTestServiceWithRecorder(t)
+	rec.Audio = true
+
+	s.cameraProvider = stubCameras{"cam": "hd"}
+	s.profileProvider = stubProfiles{
+		"hd":   {ProfileID: "hd", VideoCodec: profile.H264, AudioCodec: profile.AAC},
+		"mute": {ProfileID: "mute", VideoCodec: profile.H265, AudioCodec: profile.NoAudio},
+		"vp9":  {ProfileID: "vp9", VideoCodec: profile.VP9, AudioCodec: profile.Opus},
+	}
+
+	tests := []struct {
+		name    string
+		opts    models.RecordingOptions
+		profile string
+		audio   int
+	}{
+		{name: "camera default", profile: "hd", audio: 0},
+		{name: "override", opts: models.RecordingOptions{ProfileID: "vp9"}, profile: "vp9", audio: 0},
+		{name: "profile without audio", opts: models.RecordingOptions{ProfileID: "mute"}, profile: "mute", audio: recorder.NoAudio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordID, err := s.Start([]string{"cam"}, 1, tt.opts)
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer s.Stop(recordID)
+
+			s.mu.Lock()
+			spec := s.commands[recordID].spec
+			s.mu.Unlock()
+
+			if spec.Profile == nil || spec.Profile.ProfileID != tt.profile {
+				t.Errorf("spec profile = %+v, want %s", spec.Profile, tt.profile)
+			}
+			if spec.Audio != tt.audio {
+				t.Errorf("spec audio = %d, want %d", spec.Audio, tt.audio)
+			}
+		})
+	}
+
+	if _, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{ProfileID: "missing"}); !errors.Is(err, errs.ErrProfileNotFound) {
+		t.Errorf("Start() with unknown profile error = %v, want %v", err, errs.ErrProfileNotFound)
+	}
+
+	opts := models.RecordingOptions{ProfileID: "vp9", SegmentMinutes: 10}
+	if _, err := s.Start([]string{"cam"}, 1, opts); !errors.Is(err, errs.ErrInvalidProfile) {
+		t.Errorf("Start() with segmented vp9 error = %v, want %v", err, errs.ErrInvalidProfile)
+	}
+}
+
+func TestStartWithContainer(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{Container: constants.ContainerMP4})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Stop(recordID)
+
+	rec, err := storage.Recording(recordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Container != constants.ContainerMP4 || rec.MimeType != "video/mp4" || filepath.Ext(rec.FilePath) != ".mp4" {
+		t.Errorf("container = %s, mime type = %s, file = %s, want mp4", rec.Container, rec.MimeType, rec.FilePath)
+	}
+
+	if _, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{Container: "avi"}); !errors.Is(err, errs.ErrUnknownContainer) {
+		t.Errorf("Start() with unknown container error = %v, want %v", err, errs.ErrUnknownContainer)
+	}
+}
+
+func TestPreRoll(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	dir := t.TempDir()
+	now := time.Now()
+	clip := preroll.Clip{From: now.Add(-3 * time.Second)}
+	for i, content := range []string{"first\n", "second\n"} {
+		path := filepath.Join(dir, fmt.Sprintf("preroll_%05d.ts", i))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		clip.Chunks = append(clip.Chunks, preroll.Chunk{Path: path, End: now.Add(time.Duration(i-1) * time.Second)})
+	}
+	s.preRoll = stubPreRoll{clip: clip}
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{PreRollSeconds: 10})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	rec := waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	if rec.Container != constants.ContainerMPEGTS || !rec.StartTime.Equal(clip.From) {
+		t.Errorf("container = %s, start = %v, want ts starting at %v", rec.Container, rec.StartTime, clip.From)
+	}
+
+	files, err := s.Files(recordID, "")
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Files() = %v, want the pre-roll and the live piece", files)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("pre-roll = %q, want both chunks", data)
+	}
+
+	gaps, _ := storage.Gaps(recordID)
+	if len(gaps) != 1 || !gaps[0].From.Equal(clip.To()) || gaps[0].To.IsZero() {
+		t.Errorf("gaps = %+v, want one closed gap after the pre-roll", gaps)
+	}
+
+	for _, opts := range []models.RecordingOptions{
+		{PreRollSeconds: 10, Container: constants.ContainerMP4},
+		{PreRollSeconds: 10, ProfileID: "hd"},
+	} {
+		if _, err := s.Start([]string{"cam"}, 1, opts); !errors.Is(err, errs.ErrPreRollNotAllowed) {
+			t.Errorf("Start(%+v) error = %v, want %v", opts, err, errs.ErrPreRollNotAllowed)
+		}
+	}
+
+	if _, err := s.Start([]string{"cam", "cam2"}, 1, models.RecordingOptions{PreRollSeconds: 10}); !errors.Is(err, errs.ErrPreRollNotAllowed) {
+		t.Errorf("Start() with two cameras error = %v, want %v", err, errs.ErrPreRollNotAllowed)
+	}
+
+	// Without a container the pre-roll is recorded in MPEG-TS, whatever the
+	// configured container is.
+	s.container = constants.ContainerMatroska
+	recordID, err = s.Start([]string{"cam"}, 1, models.RecordingOptions{PreRollSeconds: 10})
+	if err != nil {
+		t.Fatalf("Start() with a configured container error = %v", err)
+	}
+	rec = waitStatus(t, storage, recordID, constants.StatusRecording)
+	if rec.Container != constants.ContainerMPEGTS || !rec.StartTime.Equal(clip.From) {
+		t.Errorf("container = %s, start = %v, want ts starting at %v", rec.Container, rec.StartTime, clip.From)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	// The default profile of the camera re-encodes the stream.
+	s.cameraProvider = stubCameras{"cam": "hd"}
+	s.profileProvider = stubProfiles{"hd": {ProfileID: "hd", VideoCodec: profile.H264, AudioCodec: profile.AAC}}
+	if _, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{PreRollSeconds: 10}); !errors.Is(err, errs.ErrPreRollNotAllowed) {
+		t.Errorf("Start() of a camera with a default profile error = %v, want %v", err, errs.ErrPreRollNotAllowed)
+	}
+}
+
+func TestDeleteRemovesFile(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	rec := waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	if err := s.Delete(recordID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if _, err := os.Stat(rec.FilePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file still exists after delete: %v", err)
+	}
+}
+
+func TestSegmentedRecording(t *testing.T) {
+	s, storage, _ := newTestService(t)
+	s.segmentDuration = 30 * time.Millisecond
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	segs, _ := storage.Segments(recordID)
+	if len(segs) == 0 {
+		t.Error("no segments indexed while recording")
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	files, err := s.Files(recordID, "")
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	segs, err = s.Segments(recordID)
+	if err != nil {
+		t.Fatalf("Segments() error = %v", err)
+	}
+
+	if len(files) < 3 || len(segs) != len(files) {
+		t.Fatalf("got %d files and %d segments, want the same number and at least 3", len(files), len(segs))
+	}
+
+	for i, seg := range segs {
+		if seg.Index != i || seg.FilePath != files[i] || seg.Size == 0 {
+			t.Errorf("segment %d = %+v, file %s", i, seg, files[i])
+		}
+		if seg.EndOffset < seg.StartOffset || (i > 0 && seg.StartOffset != segs[i-1].EndOffset) {
+			t.Errorf("segment %d offsets %.3f-%.3f don't follow the previous segment", i, seg.StartOffset, seg.EndOffset)
+		}
+	}
+
+	path, err := s.Segment(recordID, "", 1)
+	if err != nil || path != files[1] {
+		t.Errorf("Segment(1) = %s, %v, want %s", path, err, files[1])
+	}
+
+	if _, err := s.Segment(recordID, "", len(segs)); !errors.Is(err, errs.ErrSegmentNotFound) {
+		t.Errorf("Segment() past the end error = %v, want %v", err, errs.ErrSegmentNotFound)
+	}
+
+	if err := s.Delete(recordID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	for _, path := range files {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("segment %s still exists after delete: %v", path, err)
+		}
+	}
+}
+
+func TestRecordingWithProxy(t *testing.T) {
+	s, storage, _ := newTestService(t)
+	s.segmentDuration = 30 * time.Millisecond
+
+	proxy := true
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{Proxy: &proxy})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	details, err := s.Details(recordID)
+	if err != nil {
+		t.Fatalf("Details() error = %v", err)
+	}
+
+	if len(details.Renditions) != 2 || details.Renditions[1].Name != constants.RenditionProxy {
+		t.Fatalf("renditions = %+v, want master and proxy", details.Renditions)
+	}
+
+	master, err := s.Files(recordID, "")
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	proxies, err := s.Files(recordID, constants.RenditionProxy)
+	if err != nil {
+		t.Fatalf("Files(proxy) error = %v", err)
+	}
+
+	if len(proxies) != len(master) || proxies[0] != recorder.ProxyPath(master[0]) {
+		t.Errorf("proxy files = %v, want one next to each of %v", proxies, master)
+	}
+
+	path, err := s.Segment(recordID, constants.RenditionProxy, 1)
+	if err != nil || path != proxies[1] {
+		t.Errorf("Segment(proxy, 1) = %s, %v, want %s", path, err, proxies[1])
+	}
+
+	if err := s.Delete(recordID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	for _, path := range proxies {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("proxy %s still exists after delete: %v", path, err)
+		}
+	}
+}
+
+func TestRenditionNotFound(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	if _, err := s.Files(recordID, constants.RenditionProxy); !errors.Is(err, errs.ErrRenditionNotFound) {
+		t.Errorf("Files(proxy) error = %v, want %v", err, errs.ErrRenditionNotFound)
+	}
+
+	if r, err := s.Rendition(recordID, ""); err != nil || r.Name != constants.RenditionMaster {
+		t.Errorf("Rendition() = %+v, %v, want the master", r, err)
+	}
+}
+
+func TestPauseMoveToOpencast(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("presenter")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+		defer f.Close()
+
+		uploaded, _ = io.ReadAll(f)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	s.videoService = opencast.New(opencast.Config{Address: srv.URL}, &stubEvents{})
+
+	// Without a container chosen the recording is written in MPEG-TS, so
+	// the pieces around a pause can be joined.
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Pause(recordID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if err := s.Resume(recordID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	rec := waitStatus(t, storage, recordID, constants.StatusStopped)
+	if rec.Container != constants.ContainerMPEGTS {
+		t.Errorf("container = %s, want %s", rec.Container, constants.ContainerMPEGTS)
+	}
+
+	files, err := s.Files(recordID, "")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Files() = %v, %v, want two pieces", files, err)
+	}
+
+	if err := s.Move(recordID); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	var want []byte
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, data...)
+	}
+
+	if !bytes.Equal(uploaded, want) {
+		t.Errorf("uploaded %d bytes, want both pieces joined, %d bytes", len(uploaded), len(want))
+	}
+
+	// Matroska pieces can't be joined, so such a recording is not paused.
+	mkv, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{Container: constants.ContainerMatroska})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, mkv, constants.StatusRecording)
+
+	if err := s.Pause(mkv); !errors.Is(err, errs.ErrRecordingNotPausable) {
+		t.Errorf("Pause() of a Matroska recording error = %v, want %v", err, errs.ErrRecordingNotPausable)
+	}
+
+	if err := s.Stop(mkv); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, mkv, constants.StatusStopped)
+}
+
+func TestPauseResume(t *testing.T) {
+	s, storage, videoService := newTestService(t)
+	s.container = constants.ContainerMPEGTS
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Resume(recordID); !errors.Is(err, errs.ErrRecordingNotPaused) {
+		t.Errorf("Resume() while recording error = %v, want %v", err, errs.ErrRecordingNotPaused)
+	}
+
+	if err := s.Pause(recordID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	rec := waitStatus(t, storage, recordID, constants.StatusPaused)
+
+	if err := s.Pause(recordID); !errors.Is(err, errs.ErrRecordingNotActive) {
+		t.Errorf("second Pause() error = %v, want %v", err, errs.ErrRecordingNotActive)
+	}
+
+	// The supervisor must not take the finished piece for a dropout.
+	time.Sleep(30 * time.Millisecond)
+	if files := s.files(rec); len(files) != 1 {
+		t.Fatalf("paused recording has %d files, want 1", len(files))
+	}
+
+	if err := s.Resume(recordID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Pause(recordID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() while paused error = %v", err)
+	}
+	rec = waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	if files := s.files(rec); len(files) != 2 {
+		t.Errorf("recording has %d files, want 2", len(files))
+	}
+
+	if gaps, _ := storage.Gaps(recordID); len(gaps) != 0 {
+		t.Errorf("gaps = %+v, want none", gaps)
+	}
+
+	pauses, _ := storage.Pauses(recordID)
+	if len(pauses) != 2 || pauses[0].To.IsZero() || pauses[1].To.IsZero() {
+		t.Fatalf("pauses = %+v, want two closed pauses", pauses)
+	}
+
+	if err := s.Move(recordID); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	want := rec.StopTime.Sub(rec.StartTime)
+	for _, p := range pauses {
+		want -= p.To.Sub(p.From)
+	}
+	if len(videoService.durations) != 1 || videoService.durations[0] != want {
+		t.Errorf("video service got durations %v, want [%v]", videoService.durations, want)
+	}
+
+	if _, err := s.Chapters(recordID); !errors.Is(err, errs.ErrChaptersNotFound) {
+		t.Errorf("Chapters() without markers error = %v, want %v", err, errs.ErrChaptersNotFound)
+	}
+}
+
+func TestRecordedAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := start.Add(10 * time.Minute)
+	minute := func(m int) time.Time { return start.Add(time.Duration(m) * time.Minute) }
+
+	tests := []struct {
+		name   string
+		pauses []models.Pause
+		gaps   []models.Gap
+		want   time.Duration
+	}{
+		{name: "nothing left out", want: 10 * time.Minute},
+		{
+			name:   "pause and gap",
+			pauses: []models.Pause{{From: minute(1), To: minute(2)}},
+			gaps:   []models.Gap{{From: minute(5), To: minute(7)}},
+			want:   7 * time.Minute,
+		},
+		{
+			name:   "gap during a pause counted once",
+			pauses: []models.Pause{{From: minute(1), To: minute(4)}},
+			gaps:   []models.Gap{{From: minute(3), To: minute(5)}},
+			want:   6 * time.Minute,
+		},
+		{
+			name:   "open pause ends at at",
+			pauses: []models.Pause{{From: minute(8)}},
+			want:   8 * time.Minute,
+		},
+		{
+			name: "open gap ends at at",
+			gaps: []models.Gap{{From: minute(4)}, {From: minute(1), To: minute(2)}},
+			want: 3 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recordedAt(start, tt.pauses, tt.gaps, at); got != tt.want {
+				t.Errorf("recordedAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	s, storage, videoService := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := s.AddMarker(recordID, "intro", new(float64)); err != nil {
+		t.Fatalf("AddMarker(0) error = %v", err)
+	}
+
+	ahead := 3600.0
+	if _, err := s.AddMarker(recordID, "too late", &ahead); !errors.Is(err, errs.ErrInvalidMarker) {
+		t.Errorf("AddMarker() past the position error = %v, want %v", err, errs.ErrInvalidMarker)
+	}
+
+	m, err := s.AddMarker(recordID, "question from audience", nil)
+	if err != nil {
+		t.Fatalf("AddMarker() error = %v", err)
+	}
+	if m.Offset <= 0 {
+		t.Errorf("marker offset = %v, want the current position", m.Offset)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	rec := waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	if _, err := s.AddMarker(recordID, "after stop", nil); !errors.Is(err, errs.ErrRecordingNotActive) {
+		t.Errorf("AddMarker() after stop error = %v, want %v", err, errs.ErrRecordingNotActive)
+	}
+
+	var vtt []byte
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if vtt, err = os.ReadFile(chaptersPath(rec)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("chapters were not written: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !strings.HasPrefix(string(vtt), "WEBVTT\n") || !strings.Contains(string(vtt), "\nquestion from audience\n") {
+		t.Errorf("chapters = %q, want both markers", vtt)
+	}
+
+	if path, err := s.Chapters(recordID); err != nil || path != chaptersPath(rec) {
+		t.Errorf("Chapters() = %q, %v, want %q", path, err, chaptersPath(rec))
+	}
+
+	details, err := s.Details(recordID)
+	if err != nil {
+		t.Fatalf("Details() error = %v", err)
+	}
+	if len(details.Markers) != 2 {
+		t.Errorf("details have %d markers, want 2", len(details.Markers))
+	}
+
+	if err := s.Move(recordID); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if len(videoService.markers) != 2 {
+		t.Errorf("video service got %d markers, want 2", len(videoService.markers))
+	}
+}
+
+func TestSession(t *testing.T) {
+	s, storage, videoService := newTestService(t)
+	if err := os.MkdirAll(filepath.Join(s.videosPath, "slides"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := s.StartSession([]string{"cam", "slides"}, 1, models.RecordingOptions{Layout: "pip"})
+	if err != nil {
+		t.Fatalf("StartSession() error = %v", err)
+	}
+
+	if len(session.Angles) != 2 {
+		t.Fatalf("session has %d angles, want 2", len(session.Angles))
+	}
+
+	paths := make(map[string]bool)
+	for i, angle := range session.Angles {
+		if angle.CameraID != []string{"cam", "slides"}[i] {
+			t.Errorf("angle %d camera = %s", i, angle.CameraID)
+		}
+		if angle.SessionID != session.SessionID || angle.Status != constants.StatusRecording {
+			t.Errorf("angle %d = %+v, want a running recording of the session", i, angle.Recording)
+		}
+		if angle.Offset < 0 {
+			t.Errorf("angle %d offset = %v, want it after the session start", i, angle.Offset)
+		}
+
+		rec, _ := storage.Recording(angle.RecordingID)
+		paths[rec.FilePath] = true
+	}
+	if len(paths) != 2 {
+		t.Errorf("angles share files: %v", paths)
+	}
+
+	if err := s.MoveSession(session.SessionID); !errors.Is(err, errs.ErrRecordingInProgress) {
+		t.Errorf("MoveSession() while recording error = %v, want %v", err, errs.ErrRecordingInProgress)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.StopSession(session.SessionID); err != nil {
+		t.Fatalf("StopSession() error = %v", err)
+	}
+	for _, angle := range session.Angles {
+		waitStatus(t, storage, angle.RecordingID, constants.StatusStopped)
+	}
+
+	if err := s.StopSession(session.SessionID); !errors.Is(err, errs.ErrRecordingNotActive) {
+		t.Errorf("second StopSession() error = %v, want %v", err, errs.ErrRecordingNotActive)
+	}
+
+	if err := s.MoveSession(session.SessionID); err != nil {
+		t.Fatalf("MoveSession() error = %v", err)
+	}
+	if len(videoService.tracks) != 2 || len(videoService.tracks[0]) == 0 || len(videoService.tracks[1]) == 0 {
+		t.Errorf("video service got tracks %v, want one per angle", videoService.tracks)
+	}
+	for _, angle := range session.Angles {
+		waitStatus(t, storage, angle.RecordingID, constants.StatusUploaded)
+	}
+
+	if _, err := s.Session("missing"); !errors.Is(err, errs.ErrSessionNotFound) {
+		t.Errorf("Session() error = %v, want %v", err, errs.ErrSessionNotFound)
+	}
+
+	// A session none of whose angles started is not kept.
+	storage.startErr = errors.New("connection refused")
+	if _, err := s.StartSession([]string{"cam"}, 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrWriteToDB) {
+		t.Errorf("StartSession() with a failed save error = %v, want %v", err, errs.ErrWriteToDB)
+	}
+
+	storage.mu.Lock()
+	sessions := len(storage.sessions)
+	storage.mu.Unlock()
+	if sessions != 1 {
+		t.Errorf("sessions = %d, want only the first one", sessions)
+	}
+}
+
+func TestCameraConflict(t *testing.T) {
+	s, storage, _ := newTestService(t)
+	if err := os.MkdirAll(filepath.Join(s.videosPath, "slides"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+
+	_, err = s.Start([]string{"slides", "cam"}, 2, models.RecordingOptions{})
+
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, errs.ErrCameraBooked) {
+		t.Fatalf("Start() of a recorded camera error = %v, want a conflict", err)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].RecordingID != recordID || conflict.Conflicts[0].CameraID != "cam" {
+		t.Errorf("conflicts = %+v, want the running recording of cam", conflict.Conflicts)
+	}
+
+	if _, err := s.StartSession([]string{"slides", "cam"}, 2, models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("StartSession() of a recorded camera error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	forced, err := s.Start([]string{"cam"}, 2, models.RecordingOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced Start() error = %v", err)
+	}
+	waitStatus(t, storage, forced, constants.StatusRecording)
+
+	for _, id := range []string{recordID, forced} {
+		if err := s.Stop(id); err != nil {
+			t.Fatalf("Stop() error = %v", err)
+		}
+		waitStatus(t, storage, id, constants.StatusStopped)
+	}
+
+	other, err := s.Start([]string{"cam"}, 2, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() after stop error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusRecording)
+
+	if err := s.Stop(other); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusStopped)
+}
+
+func TestConflictWhileStarting(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	// The session is published before its row is saved, a conflict found
+	// meanwhile names the recording's owner and start.
+	found := make(chan []models.Conflict, 1)
+	storage.onStart = func(rec models.Recording) {
+		go func() {
+			var conflict *errs.ConflictError
+			if err := s.checkFree([]string{"cam"}, false); errors.As(err, &conflict) {
+				found <- conflict.Conflicts
+			}
+			close(found)
+		}()
+
+		// Give the check time to run without waiting for it, which would
+		// order it before the rest of Start.
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusRecording)
+
+	conflicts := <-found
+	if len(conflicts) != 1 || conflicts[0].RecordingID != recordID || conflicts[0].UserID != 1 || conflicts[0].StartTime.IsZero() {
+		t.Errorf("conflicts = %+v, want the recording of user 1 with its start", conflicts)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+}
+
+// stubBookings books cam and reports whether the service was locked while
+// the bookings were checked. bookLater is booked right after it is first
+// checked, as if the booking was saved concurrently.
+type stubBookings struct {
+	s         *RecordingService
+	locked    []bool
+	version   uint64
+	bookLater string
+	booked    []string
+}
+
+func (b *stubBookings) CheckBookings(cameraIDs []string) error {
+	locked := !b.s.mu.TryLock()
+	if !locked {
+		b.s.mu.Unlock()
+	}
+	b.locked = append(b.locked, locked)
+
+	for _, cameraID := range cameraIDs {
+		if cameraID == "cam" || slices.Contains(b.booked, cameraID) {
+			return &errs.ConflictError{Conflicts: []models.Conflict{{CameraID: cameraID, ScheduleID: "schedule"}}}
+		}
+	}
+
+	if slices.Contains(cameraIDs, b.bookLater) {
+		b.booked = append(b.booked, b.bookLater)
+		b.bookLater = ""
+		b.version++
+	}
+
+	return nil
+}
+
+func (b *stubBookings) BookingsVersion() uint64 {
+	return b.version
+}
+
+func TestBookingConflict(t *testing.T) {
+	s, storage, _ := newTestService(t)
+	if err := os.MkdirAll(filepath.Join(s.videosPath, "slides"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	bookings := &stubBookings{s: s}
+	s.SetBookings(bookings)
+
+	if _, err := s.Start([]string{"slides", "cam"}, 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("Start() of a booked camera error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+	if _, err := s.StartSession([]string{"slides", "cam"}, 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("StartSession() of a booked camera error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	for _, locked := range bookings.locked {
+		if locked {
+			t.Error("bookings checked while holding the service lock")
+		}
+	}
+
+	// The schedule starts the recording of its own booking.
+	scheduled, err := s.StartUntil([]string{"cam"}, 1, models.RecordingOptions{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("StartUntil() of a booked camera error = %v", err)
+	}
+	waitStatus(t, storage, scheduled, constants.StatusRecording)
+
+	if err := s.Stop(scheduled); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, scheduled, constants.StatusStopped)
+
+	checks := len(bookings.locked)
+
+	forced, err := s.Start([]string{"cam"}, 2, models.RecordingOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced Start() error = %v", err)
+	}
+	waitStatus(t, storage, forced, constants.StatusRecording)
+
+	if len(bookings.locked) != checks {
+		t.Error("bookings checked for a forced recording")
+	}
+
+	if err := s.Stop(forced); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, forced, constants.StatusStopped)
+}
+
+func TestBookingSavedWhileStarting(t *testing.T) {
+	s, _, _ := newTestService(t)
+	if err := os.MkdirAll(filepath.Join(s.videosPath, "slides"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	bookings := &stubBookings{s: s, bookLater: "slides"}
+	s.SetBookings(bookings)
+
+	if _, err := s.Start([]string{"slides"}, 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("Start() error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	if len(bookings.locked) != 2 {
+		t.Errorf("bookings checked %d times, want 2", len(bookings.locked))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.starting) != 0 {
+		t.Errorf("cameras claimed = %v, want none", s.starting)
+	}
+}
+
+func TestRestartAfterDropout(t *testing.T) {
+	s, storage, _, rec := newTestServiceWithRecorder(t)
+	rec.Failures = 1
+	rec.FailAfter = 30 * time.Millisecond
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		gaps, _ := storage.Gaps(recordID)
+		if len(gaps) == 1 && !gaps[0].To.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gaps = %+v, want one closed gap", gaps)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	details, err := s.Details(recordID)
+	if err != nil {
+		t.Fatalf("Details() error = %v", err)
+	}
+
+	if len(details.Segments) != 2 || len(details.Gaps) != 1 {
+		t.Fatalf("got %d pieces and %d gaps, want 2 and 1", len(details.Segments), len(details.Gaps))
+	}
+
+	gap := details.Gaps[0]
+	if gap.To.Before(gap.From) {
+		t.Errorf("gap ends at %v before it starts at %v", gap.To, gap.From)
+	}
+
+	if start := details.Segments[1].StartOffset; start != gap.To.Sub(details.StartTime).Seconds() {
+		t.Errorf("second piece starts at %.3f, want the end of the gap", start)
+	}
+
+	files, err := s.Files(recordID, "")
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	if len(files) != 2 || files[1] != piecePath(files[0], 1) {
+		t.Errorf("Files() = %v, want the first file and its second part", files)
+	}
+
+	// Events are saved in the background.
+	var events []models.PipelineEvent
+	for deadline := time.Now().Add(2 * time.Second); len(events) < 2 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+
+		if events, err = s.Events(recordID, constants.LevelError); err != nil {
+			t.Fatalf("Events() error = %v", err)
+		}
+	}
+
+	if len(events) != 2 || events[0].Source != "src0" || events[1].Source != sourceSupervisor {
+		t.Errorf("Events() = %+v, want the pipeline error and the exit", events)
+	}
+
+	logs, err := s.Log(recordID)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("Log() = %v, %v, want one file", logs, err)
+	}
+
+	if err := s.Delete(recordID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if _, err := os.Stat(logs[0]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("log still exists after delete: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s, storage, _ := newTestService(t)
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+
+	st, err := s.Status(recordID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	if !st.Alive || st.Status != constants.StatusRecording || st.Size == 0 || st.Bitrate <= 0 || st.Elapsed <= 0 {
+		t.Errorf("Status() = %+v, want a growing live recording", st)
+	}
+	if st.Stats != nil {
+		t.Errorf("Status().Stats = %+v, want none from a backend without packet statistics", st.Stats)
+	}
+
+	other, err := s.Start([]string{"cam"}, 2, models.RecordingOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusRecording)
+
+	// A recording that can't be read is left out of the list.
+	storage.mu.Lock()
+	lost := storage.recs[other]
+	delete(storage.recs, other)
+	storage.mu.Unlock()
+
+	if active := s.Active(); len(active) != 1 || active[0].RecordingID != recordID {
+		t.Fatalf("Active() = %+v, want the readable recording", active)
+	}
+
+	storage.mu.Lock()
+	storage.recs[other] = lost
+	storage.mu.Unlock()
+
+	if err := s.Stop(other); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, other, constants.StatusStopped)
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+
+	st, err = s.Status(recordID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	if st.Alive || st.Bitrate != 0 || st.Size == 0 {
+		t.Errorf("Status() after stop = %+v, want a finished recording", st)
+	}
+
+	if active := s.Active(); len(active) != 0 {
+		t.Errorf("Active() after stop = %+v, want none", active)
+	}
+}
+
+func TestStatusDuringResume(t *testing.T) {
+	s, storage, _ := newTestService(t)
+	s.container = constants.ContainerMPEGTS
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Pause(recordID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusPaused)
+
+	// The status is asked while Resume writes the recording status.
+	answered := make(chan error, 1)
+	storage.onSetStatus = func(_, from, _ string) {
+		if from != constants.StatusPaused {
+			return
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.Status(recordID)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			answered <- err
+		case <-time.After(time.Second):
+			answered <- errors.New("Status() blocked by Resume()")
+		}
+	}
+
+	if err := s.Resume(recordID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+
+	if err := <-answered; err != nil {
+		t.Errorf("Status() during Resume() error = %v", err)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+}
+
+func TestStatusStats(t *testing.T) {
+	s, storage, _, rec := newTestServiceWithRecorder(t)
+	rec.Stats = true
+
+	recordID, err := s.Start([]string{"cam"}, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	st, err := s.Status(recordID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	if st.Stats == nil || st.Stats.RTPPackets == 0 || st.Stats.VideoFrames == 0 || st.Stats.Bytes == 0 {
+		t.Fatalf("Status().Stats = %+v, want the packets of the pipeline", st.Stats)
+	}
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`"rtp_packets":`)) || !bytes.Contains(b, []byte(`"lost_packets":`)) {
+		t.Errorf("status JSON = %s, want the packet statistics", b)
+	}
+
+	if active := s.Active(); len(active) != 1 || active[0].Stats == nil {
+		t.Errorf("Active() = %+v, want the recording with its statistics", active)
+	}
+
+	if err := s.Stop(recordID); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitStatus(t, storage, recordID, constants.StatusStopped)
+}
@@ -0,0 +1,138 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+func (s *RecordingService) Reconcile() error {
+	const op = "service.recordings.Reconcile"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	recs, err := s.recordingProvider.OpenRecordings()
+	if err != nil {
+		log.Error("failed to get open recordings", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("reconcile open recordings", slog.Int("count", len(recs)))
+
+	for _, rec := range recs {
+		if err := s.reconcile(rec); err != nil {
+			log.Error("failed to reconcile recording", slog.String("record_id", rec.RecordingID), sl.Err(err))
+		}
+	}
+
+	return nil
+}
+
+func (s *RecordingService) reconcile(rec models.Recording) error {
+	log := s.log.With(
+		slog.String("record_id", rec.RecordingID),
+		slog.Int("pid", rec.PID),
+	)
+
+	stopTime := rec.StartTime
+	growing := false
+
+	last := s.lastFile(rec)
+
+	info, err := os.Stat(last)
+	if err == nil {
+		stopTime = info.ModTime()
+		growing = time.Since(stopTime) < s.staleAfter
+	}
+
+	// A restarted pipeline writes the last piece, a segmented one is started
+	// with the segment pattern.
+	if rec.Segmented {
+		last = rec.FilePath
+	}
+
+	proc, alive := s.recorder.Adopt(rec.PID, last)
+
+	// A paused recording has no pipeline to take over, it ends where the
+	// last piece ended.
+	if rec.Status == constants.StatusPaused {
+		defer func() {
+			if err := s.recordingSaver.ClosePauses(rec.RecordingID, stopTime); err != nil {
+				log.Error("failed to close pause", sl.Err(err))
+			}
+		}()
+	}
+
+	// Segments and chapters of a pipeline that is not taken over are final
+	// now.
+	if !alive || (rec.Status == constants.StatusRecording && !growing) {
+		defer func() {
+			if err := s.closeSegments(rec.RecordingID); err != nil {
+				log.Error("failed to index segments", sl.Err(err))
+			}
+
+			if err := s.writeChapters(rec.RecordingID); err != nil {
+				log.Error("failed to write chapters", sl.Err(err))
+			}
+		}()
+	}
+
+	if rec.Status == constants.StatusFinalizing {
+		if alive {
+			log.Info("pipeline is still finalizing, waiting for it")
+
+			go s.finalize(rec, []string{rec.CameraID}, proc, false)
+
+			return nil
+		}
+
+		log.Warn("pipeline is gone, finalization result is unknown")
+
+		return s.recordingSaver.Finish(rec.RecordingID, recorder.ExitCodeUnknown, rec.Status, constants.StatusInterrupted)
+	}
+
+	switch {
+	case alive && growing && rec.Status != constants.StatusPaused:
+		log.Info("pipeline is still running, adopting recording")
+
+		// The spec of an adopted pipeline is unknown, so it is not restarted
+		// when it exits.
+		sess := newSession(rec, []string{rec.CameraID}, recorder.Spec{}, time.Time{}, proc)
+
+		s.mu.Lock()
+		s.commands[rec.RecordingID] = sess
+		s.mu.Unlock()
+
+		go s.supervise(sess)
+		go s.sampleSize(sess)
+
+		if rec.Segmented {
+			go s.watchSegments(rec, maxSegmentPoll)
+		}
+
+		return nil
+	case alive:
+		log.Warn("pipeline is alive but file stopped growing, killing it")
+
+		proc.Wait(0)
+
+		return s.recordingSaver.Stop(rec.RecordingID, stopTime, rec.Status, constants.StatusFailed)
+	case info == nil || info.Size() == 0:
+		log.Warn("pipeline is gone and recording file is missing or empty")
+
+		return s.recordingSaver.Stop(rec.RecordingID, stopTime, rec.Status, constants.StatusFailed)
+	default:
+		log.Warn("pipeline is gone, closing recording at last file write", slog.Time("stop_time", stopTime))
+
+		return s.recordingSaver.Stop(rec.RecordingID, stopTime, rec.Status, constants.StatusInterrupted)
+	}
+}
@@ -0,0 +1,191 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+const maxSegmentPoll = 30 * time.Second
+
+// watchSegments indexes segments as the pipeline closes them, so a crash
+// mid-recording keeps everything written before the last segment.
+func (s *RecordingService) watchSegments(rec models.Recording, segmentDuration time.Duration) {
+	log := s.log.With(
+		slog.String("op", "service.recordings.watchSegments"),
+		slog.String("record_id", rec.RecordingID),
+	)
+
+	every := segmentDuration / 2
+	if every > maxSegmentPoll {
+		every = maxSegmentPoll
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		_, active := s.commands[rec.RecordingID]
+		s.mu.Unlock()
+
+		if !active {
+			return
+		}
+
+		if err := s.indexSegments(rec, false); err != nil {
+			log.Error("failed to index segments", sl.Err(err))
+		}
+	}
+}
+
+// closeSegments indexes all remaining segments once the pipeline is gone.
+// Pieces of a recording that is not segmented are indexed as segments too.
+func (s *RecordingService) closeSegments(recordID string) error {
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		return err
+	}
+
+	if rec.FilePath == "" {
+		return nil
+	}
+
+	return s.indexSegments(rec, true)
+}
+
+// indexSegments saves segments that are on disk but not in the index yet.
+// The pipeline writes only the newest segment, so every older one is closed;
+// the newest one is indexed only when final is set. Segment boundaries are
+// taken from file modification times; a segment written after a gap starts
+// where the gap ends.
+func (s *RecordingService) indexSegments(rec models.Recording, final bool) error {
+	s.segmentsMu.Lock()
+	defer s.segmentsMu.Unlock()
+
+	segs, err := s.recordingProvider.Segments(rec.RecordingID)
+	if err != nil {
+		return err
+	}
+
+	gaps, err := s.recordingProvider.Gaps(rec.RecordingID)
+	if err != nil {
+		return err
+	}
+
+	pauses, err := s.recordingProvider.Pauses(rec.RecordingID)
+	if err != nil {
+		return err
+	}
+
+	// A piece written after a gap or a pause starts when it ends.
+	var resumed []time.Time
+	for _, gap := range gaps {
+		if !gap.To.IsZero() {
+			resumed = append(resumed, gap.To)
+		}
+	}
+	for _, pause := range pauses {
+		if !pause.To.IsZero() {
+			resumed = append(resumed, pause.To)
+		}
+	}
+
+	next, offset := 0, 0.0
+	if n := len(segs); n > 0 {
+		next, offset = segs[n-1].Index+1, segs[n-1].EndOffset
+	}
+
+	var found []models.Segment
+	for i := next; ; i++ {
+		path := filePath(rec, i)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			break
+		}
+
+		found = append(found, models.Segment{
+			RecordingID: rec.RecordingID,
+			Index:       i,
+			FilePath:    path,
+			EndOffset:   info.ModTime().Sub(rec.StartTime).Seconds(),
+			Size:        info.Size(),
+		})
+	}
+
+	if !final && len(found) > 0 {
+		found = found[:len(found)-1]
+	}
+
+	for _, seg := range found {
+		seg.StartOffset = offset
+		for _, at := range resumed {
+			if end := at.Sub(rec.StartTime).Seconds(); end > seg.StartOffset && end < seg.EndOffset {
+				seg.StartOffset = end
+			}
+		}
+
+		if seg.EndOffset < offset {
+			seg.EndOffset = offset
+		}
+
+		if err := s.recordingSaver.SaveSegment(seg); err != nil {
+			return err
+		}
+
+		offset = seg.EndOffset
+	}
+
+	return nil
+}
+
+// files lists the recording files on disk in playback order.
+func (s *RecordingService) files(rec models.Recording) []string {
+	var files []string
+	for i := 0; ; i++ {
+		path := filePath(rec, i)
+		if _, err := os.Stat(path); err != nil {
+			return files
+		}
+
+		files = append(files, path)
+	}
+}
+
+// lastFile is the file the pipeline is writing to, or wrote to last.
+func (s *RecordingService) lastFile(rec models.Recording) string {
+	files := s.files(rec)
+	if len(files) == 0 {
+		return rec.FilePath
+	}
+
+	return files[len(files)-1]
+}
+
+// filePath is the path of the i-th segment, or of the i-th piece of a recording
+// that is not segmented. The pipeline writes a new piece after each restart.
+func filePath(rec models.Recording, i int) string {
+	if rec.Segmented {
+		return recorder.SegmentPath(rec.FilePath, i)
+	}
+
+	return piecePath(rec.FilePath, i)
+}
+
+func piecePath(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+
+	return fmt.Sprintf("%s_part%d%s", strings.TrimSuffix(path, ext), i, ext)
+}
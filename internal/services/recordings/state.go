@@ -0,0 +1,50 @@
+package recordingservice
+
+import (
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+)
+
+var transitions = map[string][]string{
+	constants.StatusRecording:   {constants.StatusPaused, constants.StatusFinalizing, constants.StatusInterrupted, constants.StatusFailed},
+	constants.StatusPaused:      {constants.StatusRecording, constants.StatusFinalizing, constants.StatusInterrupted, constants.StatusFailed},
+	constants.StatusFinalizing:  {constants.StatusStopped, constants.StatusInterrupted, constants.StatusFailed},
+	constants.StatusStopped:     {constants.StatusUploading, constants.StatusDeleted},
+	constants.StatusInterrupted: {constants.StatusUploading, constants.StatusDeleted},
+	constants.StatusFailed:      {constants.StatusDeleted},
+	constants.StatusUploading:   {constants.StatusUploaded, constants.StatusStopped, constants.StatusInterrupted},
+	constants.StatusUploaded:    {constants.StatusDeleted},
+	constants.StatusDeleted:     {},
+}
+
+func checkTransition(from, to string) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s -> %s", transitionErr(from, to), from, to)
+}
+
+func transitionErr(from, to string) error {
+	switch {
+	case from == constants.StatusDeleted:
+		return errs.ErrRecordingDeleted
+	case to == constants.StatusFinalizing, to == constants.StatusPaused:
+		return errs.ErrRecordingNotActive
+	case to == constants.StatusRecording:
+		return errs.ErrRecordingNotPaused
+	case isActive(from):
+		return errs.ErrRecordingInProgress
+	default:
+		return errs.ErrInvalidStatusTransition
+	}
+}
+
+func isActive(status string) bool {
+	return status == constants.StatusRecording || status == constants.StatusPaused || status == constants.StatusFinalizing ||
+		status == constants.StatusUploading
+}
@@ -0,0 +1,164 @@
+package recordingservice
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// statusSamples is how many size samples are taken per status window.
+const statusSamples = 10
+
+type sizeSample struct {
+	at   time.Time
+	size int64
+}
+
+// sampleSize records the size of a running recording, so the bitrate can be
+// averaged over the status window.
+func (s *RecordingService) sampleSize(sess *session) {
+	if s.statusWindow <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.statusWindow / statusSamples)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sess.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.addSample(sess, time.Now(), s.size(sess.rec))
+	}
+}
+
+// addSample keeps the samples of the last window plus the one just before
+// it, and returns the average bitrate over that span.
+func (s *RecordingService) addSample(sess *session, at time.Time, size int64) float64 {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	sess.samples = append(sess.samples, sizeSample{at: at, size: size})
+
+	from := at.Add(-s.statusWindow)
+	for len(sess.samples) > 2 && !sess.samples[1].at.After(from) {
+		sess.samples = sess.samples[1:]
+	}
+
+	first := sess.samples[0]
+	span := at.Sub(first.at).Seconds()
+	if span <= 0 {
+		return 0
+	}
+
+	return float64(size-first.size) * 8 / span
+}
+
+// size is the total size of the recording files on disk.
+func (s *RecordingService) size(rec models.Recording) int64 {
+	var total int64
+	for _, path := range s.files(rec) {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+
+	return total
+}
+
+func (s *RecordingService) Status(recordID string) (models.RecordingStatus, error) {
+	const op = "service.recordings.Status"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("record_id", recordID),
+	)
+
+	rec, err := s.recordingProvider.Recording(recordID)
+	if err != nil {
+		log.Error("failed to get recording", sl.Err(err))
+
+		return models.RecordingStatus{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	sess, running := s.commands[recordID]
+	s.mu.Unlock()
+
+	return s.status(rec, sess, running), nil
+}
+
+func (s *RecordingService) status(rec models.Recording, sess *session, running bool) models.RecordingStatus {
+	st := models.RecordingStatus{
+		RecordingID: rec.RecordingID,
+		CameraIP:    rec.CameraIP,
+		UserID:      rec.UserID,
+		Status:      rec.Status,
+		StartTime:   rec.StartTime,
+		Window:      s.statusWindow.Seconds(),
+	}
+
+	if rec.FilePath != "" {
+		st.Size = s.size(rec)
+	}
+
+	now := time.Now()
+
+	switch {
+	case running:
+		proc, _ := sess.process()
+		ps := proc.Status()
+		st.Alive = ps.Running
+		if ps.Stats != nil {
+			stats := models.StreamStats(*ps.Stats)
+			st.Stats = &stats
+		}
+		st.Elapsed = now.Sub(rec.StartTime).Seconds()
+		st.Bitrate = s.addSample(sess, now, st.Size)
+	case !rec.StopTime.IsZero():
+		st.Elapsed = rec.StopTime.Sub(rec.StartTime).Seconds()
+	}
+
+	return st
+}
+
+// Active returns the status of every recording this service is running. A
+// recording that can't be read is left out rather than failing the list.
+func (s *RecordingService) Active() []models.RecordingStatus {
+	log := s.log.With(
+		slog.String("op", "service.recordings.Active"),
+	)
+
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.commands))
+	for _, sess := range s.commands {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]models.RecordingStatus, 0, len(sessions))
+	for _, sess := range sessions {
+		rec, err := s.recordingProvider.Recording(sess.rec.RecordingID)
+		if err != nil {
+			log.Error("failed to get recording", slog.String("record_id", sess.rec.RecordingID), sl.Err(err))
+
+			continue
+		}
+
+		statuses = append(statuses, s.status(rec, sess, true))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StartTime.Before(statuses[j].StartTime)
+	})
+
+	return statuses
+}
@@ -0,0 +1,330 @@
+package recordingservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/pipelog"
+	"github.com/zanzhit/studio_recorder/internal/services/recordings/recorder"
+)
+
+var (
+	errSessionStopped = errors.New("recording is stopped")
+	errSessionPaused  = errors.New("recording is paused")
+)
+
+// session is a running recording. The supervisor replaces its pipeline when it
+// exits before the recording is stopped.
+type session struct {
+	rec       models.Recording
+	cameraIDs []string
+	spec      recorder.Spec
+	// until is the planned stop time, zero for recordings stopped by hand.
+	until time.Time
+	stop  chan struct{}
+	// resumed wakes the supervisor of a paused recording.
+	resumed chan struct{}
+	// output is the pipeline log, nil for adopted pipelines.
+	output *pipelog.Writer
+
+	// pipeline serializes what replaces or stops the pipeline: pause,
+	// resume, restart and stop. It is held while pipelines start and
+	// statuses are written, mu only while the fields below are read or set,
+	// so process() never waits for a pipeline to start.
+	pipeline sync.Mutex
+
+	mu      sync.Mutex
+	proc    recorder.Process
+	started time.Time
+	stopped bool
+	paused  bool
+	samples []sizeSample
+}
+
+func newSession(rec models.Recording, cameraIDs []string, spec recorder.Spec, until time.Time, proc recorder.Process) *session {
+	return &session{
+		rec:       rec,
+		cameraIDs: cameraIDs,
+		spec:      spec,
+		until:     until,
+		stop:      make(chan struct{}),
+		resumed:   make(chan struct{}, 1),
+		proc:      proc,
+		started:   time.Now(),
+	}
+}
+
+func (sess *session) process() (recorder.Process, time.Time) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	return sess.proc, sess.started
+}
+
+// halt marks the session as stopped so the supervisor leaves it alone. It
+// reports whether the pipeline had already exited on its own and whether the
+// recording was paused, when the pipeline exited on purpose.
+func (sess *session) halt() (proc recorder.Process, crashed, paused bool) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if !sess.stopped {
+		sess.stopped = true
+		close(sess.stop)
+	}
+
+	return sess.proc, !sess.paused && !sess.proc.Status().Running, sess.paused
+}
+
+// closeOutput closes the pipeline log once the pipeline is gone.
+func (s *RecordingService) closeOutput(sess *session) {
+	if sess.output == nil {
+		return
+	}
+
+	if err := sess.output.Close(); err != nil {
+		s.log.Error("failed to close pipeline log", slog.String("record_id", sess.rec.RecordingID), sl.Err(err))
+	}
+}
+
+// canRestart is false for pipelines adopted after a service restart, whose
+// spec is not known.
+func (sess *session) canRestart() bool {
+	return len(sess.spec.Sources) > 0
+}
+
+func (s *RecordingService) supervise(sess *session) {
+	log := s.log.With(
+		slog.String("op", "service.recordings.supervise"),
+		slog.String("record_id", sess.rec.RecordingID),
+	)
+
+	backoff := s.restartMin
+
+	for {
+		proc, started := sess.process()
+
+		select {
+		case <-sess.stop:
+			return
+		case <-proc.Done():
+		}
+
+		sess.mu.Lock()
+		stopped, paused, replaced := sess.stopped, sess.paused, sess.proc != proc
+		sess.mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		// A paused pipeline exits on purpose and a resumed one replaces it.
+		if replaced {
+			continue
+		}
+
+		if paused {
+			select {
+			case <-sess.stop:
+				return
+			case <-sess.resumed:
+			}
+
+			continue
+		}
+
+		from := time.Now()
+		if info, err := os.Stat(s.lastFile(sess.rec)); err == nil && info.ModTime().After(started) {
+			from = info.ModTime()
+		}
+
+		exitCode := proc.Status().ExitCode
+
+		log.Warn("pipeline exited unexpectedly", slog.Int("exit_code", exitCode), slog.Time("gap_start", from))
+
+		s.saveEvent(sess.rec.RecordingID, pipelog.Event{
+			Level:   constants.LevelError,
+			Source:  sourceSupervisor,
+			Message: fmt.Sprintf("pipeline exited with code %d", exitCode),
+		})
+
+		if err := s.indexSegments(sess.rec, true); err != nil {
+			log.Error("failed to index segments", sl.Err(err))
+		}
+
+		if _, err := s.recordingSaver.OpenGap(sess.rec.RecordingID, from); err != nil {
+			log.Error("failed to save gap", sl.Err(err))
+		}
+
+		if !sess.canRestart() {
+			s.interrupt(sess, from)
+
+			return
+		}
+
+		if time.Since(started) >= s.restartMax {
+			backoff = s.restartMin
+		}
+
+		if !s.restart(sess, &backoff) {
+			return
+		}
+
+		if err := s.recordingSaver.CloseGaps(sess.rec.RecordingID, time.Now()); err != nil {
+			log.Error("failed to close gap", sl.Err(err))
+		}
+	}
+}
+
+// restart retries the pipeline with exponential backoff until it starts, the
+// recording is stopped or its stop time comes. A recording left without a
+// pipeline is finished by Stop as interrupted.
+func (s *RecordingService) restart(sess *session, backoff *time.Duration) bool {
+	log := s.log.With(
+		slog.String("op", "service.recordings.restart"),
+		slog.String("record_id", sess.rec.RecordingID),
+	)
+
+	for {
+		if !sess.until.IsZero() && time.Now().Add(*backoff).After(sess.until) {
+			log.Warn("stop time is reached, pipeline is not restarted")
+
+			return false
+		}
+
+		select {
+		case <-sess.stop:
+			return false
+		case <-time.After(*backoff):
+		}
+
+		*backoff *= 2
+		if *backoff > s.restartMax {
+			*backoff = s.restartMax
+		}
+
+		err := s.startPiece(sess)
+		if err == nil || errors.Is(err, errSessionPaused) {
+			return true
+		}
+
+		if errors.Is(err, errSessionStopped) {
+			return false
+		}
+
+		log.Error("failed to restart pipeline", slog.Duration("retry_in", *backoff), sl.Err(err))
+	}
+}
+
+// startPiece starts a new pipeline that continues the recording in the next
+// file, or with the next segment number.
+func (s *RecordingService) startPiece(sess *session) error {
+	sess.pipeline.Lock()
+	defer sess.pipeline.Unlock()
+
+	sess.mu.Lock()
+	stopped, paused := sess.stopped, sess.paused
+	sess.mu.Unlock()
+
+	if stopped {
+		return errSessionStopped
+	}
+
+	if paused {
+		return errSessionPaused
+	}
+
+	next, err := s.nextPiece(sess)
+	if err != nil {
+		return err
+	}
+
+	s.log.Info("pipeline restarted", slog.String("record_id", sess.rec.RecordingID), slog.Int("piece", next))
+
+	s.saveEvent(sess.rec.RecordingID, pipelog.Event{
+		Level:   constants.LevelWarning,
+		Source:  sourceSupervisor,
+		Message: fmt.Sprintf("pipeline restarted, piece %d", next),
+	})
+
+	s.publish(constants.EventRecordingRestarted, sess.rec.RecordingID, sess.rec.UserID, sess.cameraIDs, map[string]int{"piece": next})
+
+	return nil
+}
+
+// nextPiece starts the pipeline of the next piece, swaps it in, which also
+// ends a pause, and saves its pid. The caller holds sess.pipeline, sess.mu
+// is only taken for the swap.
+func (s *RecordingService) nextPiece(sess *session) (int, error) {
+	spec := sess.spec
+	next := len(s.files(sess.rec))
+	if sess.rec.Segmented {
+		spec.SegmentStart = next
+	} else {
+		spec.FilePath = piecePath(sess.rec.FilePath, next)
+		if spec.Proxy != nil {
+			spec.Proxy = &recorder.Proxy{Profile: spec.Proxy.Profile, FilePath: piecePath(sess.spec.Proxy.FilePath, next)}
+		}
+	}
+
+	proc, err := s.recorder.Start(spec)
+	if err != nil {
+		return next, err
+	}
+
+	sess.mu.Lock()
+	sess.proc, sess.started = proc, time.Now()
+	sess.paused = false
+	sess.mu.Unlock()
+
+	if err := s.recordingSaver.SetPID(sess.rec.RecordingID, proc.PID()); err != nil {
+		s.log.Error("failed to save pid", slog.String("record_id", sess.rec.RecordingID), sl.Err(err))
+	}
+
+	return next, nil
+}
+
+// interrupt closes a recording whose pipeline can't be restarted.
+func (s *RecordingService) interrupt(sess *session, at time.Time) {
+	log := s.log.With(
+		slog.String("op", "service.recordings.interrupt"),
+		slog.String("record_id", sess.rec.RecordingID),
+	)
+
+	sess.mu.Lock()
+	if sess.stopped {
+		sess.mu.Unlock()
+
+		return
+	}
+	sess.stopped = true
+	close(sess.stop)
+	sess.mu.Unlock()
+
+	s.mu.Lock()
+	if s.commands[sess.rec.RecordingID] == sess {
+		delete(s.commands, sess.rec.RecordingID)
+	}
+	s.mu.Unlock()
+
+	log.Warn("pipeline can't be restarted, recording is interrupted")
+
+	if err := s.recordingSaver.Stop(sess.rec.RecordingID, at, constants.StatusRecording, constants.StatusInterrupted); err != nil {
+		log.Error("failed to write stop data", sl.Err(err))
+	} else {
+		s.publish(constants.EventRecordingInterrupted, sess.rec.RecordingID, sess.rec.UserID, sess.cameraIDs, nil)
+	}
+
+	if err := s.recordingSaver.CloseGaps(sess.rec.RecordingID, at); err != nil {
+		log.Error("failed to close gap", sl.Err(err))
+	}
+
+	s.closeOutput(sess)
+}
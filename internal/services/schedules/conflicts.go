@@ -0,0 +1,176 @@
+package scheduleservice
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/rrule"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// checkConflicts rejects bookings that overlap pending or running schedules,
+// upcoming occurrences of series or running recordings on one of their
+// cameras. except is the schedule being changed.
+func (s *ScheduleService) checkConflicts(bookings []models.Schedule, except string) error {
+	if len(bookings) == 0 {
+		return nil
+	}
+
+	from, to := bookings[0].StartTime, bookings[0].StopTime
+	for _, b := range bookings[1:] {
+		if b.StartTime.Before(from) {
+			from = b.StartTime
+		}
+		if b.StopTime.After(to) {
+			to = b.StopTime
+		}
+	}
+
+	others, err := s.Schedules(models.ScheduleFilter{From: from, To: to})
+	if err != nil {
+		return err
+	}
+
+	conflicts := overlapping(bookings, others, except)
+	conflicts = append(conflicts, s.recorded(bookings, others)...)
+
+	if len(conflicts) > 0 {
+		return &errs.ConflictError{Conflicts: conflicts}
+	}
+
+	return nil
+}
+
+// recorded returns the conflicts of the bookings with recordings that run
+// now. A recording without a stop time is in the way of every booking of its
+// cameras until it is stopped. Recordings of the schedules in others are
+// left to overlapping.
+func (s *ScheduleService) recorded(bookings, others []models.Schedule) []models.Conflict {
+	var cameraIDs []string
+	for _, b := range bookings {
+		for _, cameraID := range b.CameraIDs {
+			if !contains(cameraIDs, cameraID) {
+				cameraIDs = append(cameraIDs, cameraID)
+			}
+		}
+	}
+
+	scheduled := make(map[string]bool)
+	for _, other := range others {
+		if other.RecordingID != "" {
+			scheduled[other.RecordingID] = true
+		}
+	}
+
+	var conflicts []models.Conflict
+	for _, c := range s.recorder.Running(cameraIDs) {
+		if scheduled[c.RecordingID] {
+			continue
+		}
+
+		for _, b := range bookings {
+			if contains(b.CameraIDs, c.CameraID) && (c.StopTime == nil || b.StartTime.Before(*c.StopTime)) {
+				conflicts = append(conflicts, c)
+
+				break
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// CheckBookings rejects an ad-hoc recording of cameras that are booked now
+// or within the lead time. Later bookings don't keep the cameras from being
+// recorded until then.
+func (s *ScheduleService) CheckBookings(cameraIDs []string) error {
+	const op = "service.schedules.CheckBookings"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("camera_id", strings.Join(cameraIDs, ", ")),
+	)
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	now := time.Now()
+	rec := models.Schedule{CameraIDs: cameraIDs, StartTime: now, StopTime: now.Add(s.lead)}
+
+	if err := s.checkConflicts([]models.Schedule{rec}, ""); err != nil {
+		log.Error("cameras are booked", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// BookingsVersion changes whenever a booking is saved, changed or canceled,
+// so an ad-hoc recording can tell that the bookings it checked are stale.
+func (s *ScheduleService) BookingsVersion() uint64 {
+	return s.version.Load()
+}
+
+// overlapping returns the conflicts of the bookings with the others, one per
+// other schedule and shared camera.
+func overlapping(bookings, others []models.Schedule, except string) []models.Conflict {
+	var conflicts []models.Conflict
+
+	for _, other := range others {
+		if (except != "" && other.ScheduleID == except) ||
+			(other.Status != constants.SchedulePending && other.Status != constants.ScheduleStarted) {
+			continue
+		}
+
+		for _, b := range bookings {
+			if !b.StartTime.Before(other.StopTime) || !other.StartTime.Before(b.StopTime) {
+				continue
+			}
+
+			for _, cameraID := range other.CameraIDs {
+				if !contains(b.CameraIDs, cameraID) {
+					continue
+				}
+
+				stop := other.StopTime
+				conflicts = append(conflicts, models.Conflict{
+					CameraID:    cameraID,
+					ScheduleID:  other.ScheduleID,
+					SeriesID:    other.SeriesID,
+					RecordingID: other.RecordingID,
+					UserID:      other.UserID,
+					StartTime:   other.StartTime,
+					StopTime:    &stop,
+				})
+			}
+
+			break
+		}
+	}
+
+	return conflicts
+}
+
+// bookings returns the occurrences of a series up to the horizon, which is
+// how far ahead a new series is checked for conflicts.
+func (s *ScheduleService) bookings(series models.ScheduleSeries) ([]models.Schedule, error) {
+	r, err := rrule.Parse(series.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var bookings []models.Schedule
+	for _, start := range r.Between(series.StartTime, now, now.Add(s.horizon), series.ExDates) {
+		bookings = append(bookings, occurrence(series, start))
+	}
+
+	return bookings, nil
+}
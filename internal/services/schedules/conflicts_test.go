@@ -0,0 +1,272 @@
+package scheduleservice
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+func TestScheduleConflicts(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	booked, err := s.SaveSchedule(start, []string{"cam", "cam-2"}, "1h", 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	_, err = s.SaveSchedule(start.Add(30*time.Minute), []string{"cam-2"}, "1h", 2, models.RecordingOptions{})
+
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("SaveSchedule() of an overlapping booking error = %v, want a conflict", err)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].ScheduleID != booked.ScheduleID || conflict.Conflicts[0].CameraID != "cam-2" {
+		t.Errorf("conflicts = %+v, want the booking of cam-2", conflict.Conflicts)
+	}
+
+	tests := []struct {
+		name    string
+		start   time.Time
+		cameras []string
+		opts    models.RecordingOptions
+	}{
+		{name: "other camera", start: start, cameras: []string{"cam-3"}},
+		{name: "back to back", start: start.Add(time.Hour), cameras: []string{"cam"}},
+		{name: "forced", start: start, cameras: []string{"cam"}, opts: models.RecordingOptions{Force: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.SaveSchedule(tt.start, tt.cameras, "1h", 2, tt.opts); err != nil {
+				t.Errorf("SaveSchedule() error = %v", err)
+			}
+		})
+	}
+
+	if _, err := s.SaveSeries(start.Add(-24*time.Hour).Add(30*time.Minute), "", []string{"cam"}, "1h", "FREQ=DAILY;COUNT=3", nil, 2,
+		models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("SaveSeries() with an overlapping occurrence error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	// The schedule is not in the way of itself.
+	later := start.Add(15 * time.Minute)
+	if _, err := s.UpdateSchedule(booked.ScheduleID, 1, models.ScheduleUpdate{StartTime: &later, CameraIDs: []string{"cam-2"}}); err != nil {
+		t.Errorf("UpdateSchedule() error = %v", err)
+	}
+
+	other, err := s.SaveSchedule(start.Add(3*time.Hour), []string{"cam-2"}, "1h", 2, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	if _, err := s.UpdateSchedule(other.ScheduleID, 2, models.ScheduleUpdate{StartTime: &start}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("UpdateSchedule() into a booking error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	if err := s.CancelSchedule(booked.ScheduleID, 1); err != nil {
+		t.Fatalf("CancelSchedule() error = %v", err)
+	}
+
+	if _, err := s.UpdateSchedule(other.ScheduleID, 2, models.ScheduleUpdate{StartTime: &start}); err != nil {
+		t.Errorf("UpdateSchedule() into a canceled booking error = %v", err)
+	}
+}
+
+func TestUpdateForcedSchedule(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	if _, err := s.SaveSchedule(start, []string{"cam"}, "1h", 1, models.RecordingOptions{}); err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	forced, err := s.SaveSchedule(start, []string{"cam"}, "1h", 2, models.RecordingOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced SaveSchedule() error = %v", err)
+	}
+
+	// The owner's later change is checked, the earlier force doesn't carry
+	// over.
+	later := start.Add(15 * time.Minute)
+	if _, err := s.UpdateSchedule(forced.ScheduleID, 2, models.ScheduleUpdate{StartTime: &later}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("UpdateSchedule() of a forced booking error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+
+	moved := start.Add(2 * time.Hour)
+	if _, err := s.UpdateSchedule(forced.ScheduleID, 2, models.ScheduleUpdate{StartTime: &moved}); err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+	if storage.schedules[forced.ScheduleID].Options.Force {
+		t.Error("schedule is still forced after an update without force")
+	}
+
+	if _, err := s.UpdateSchedule(forced.ScheduleID, 2, models.ScheduleUpdate{StartTime: &later, Force: true}); err != nil {
+		t.Errorf("forced UpdateSchedule() error = %v", err)
+	}
+}
+
+func TestRecordingConflicts(t *testing.T) {
+	s, _, rec, _ := newTestService(t)
+
+	now := time.Now()
+
+	// An ad-hoc recording has no stop time, so it is in the way of every
+	// booking of its camera.
+	adHoc, err := rec.StartUntil([]string{"cam"}, 2, models.RecordingOptions{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.SaveSchedule(now.Add(7*24*time.Hour), []string{"cam", "cam-2"}, "1h", 1, models.RecordingOptions{})
+
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("SaveSchedule() of a recorded camera error = %v, want a conflict", err)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].RecordingID != adHoc || conflict.Conflicts[0].CameraID != "cam" {
+		t.Errorf("conflicts = %+v, want the recording of cam", conflict.Conflicts)
+	}
+
+	if _, err := s.SaveSchedule(now.Add(time.Hour), []string{"cam"}, "1h", 1, models.RecordingOptions{Force: true}); err != nil {
+		t.Errorf("forced SaveSchedule() error = %v", err)
+	}
+
+	// A recording with a stop time is only in the way until then.
+	if _, err := rec.StartUntil([]string{"cam-2"}, 2, models.RecordingOptions{}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SaveSchedule(now.Add(30*time.Minute), []string{"cam-2"}, "1h", 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("SaveSchedule() during a recording error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+	if _, err := s.SaveSchedule(now.Add(time.Hour), []string{"cam-2"}, "1h", 1, models.RecordingOptions{}); err != nil {
+		t.Errorf("SaveSchedule() after a recording error = %v", err)
+	}
+
+	if _, err := s.SaveSeries(now.Add(-24*time.Hour), "", []string{"cam"}, "1h", "FREQ=DAILY;COUNT=5", nil, 1,
+		models.RecordingOptions{}); !errors.Is(err, errs.ErrCameraBooked) {
+		t.Errorf("SaveSeries() of a recorded camera error = %v, want %v", err, errs.ErrCameraBooked)
+	}
+}
+
+func TestScheduledRecordingConflictsOnce(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	now := time.Now()
+
+	booked, err := s.SaveSchedule(now.Add(time.Minute), []string{"cam-3"}, "1h", 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+	s.tick(now.Add(2 * time.Minute))
+
+	_, err = s.SaveSchedule(now.Add(30*time.Minute), []string{"cam-3"}, "1h", 2, models.RecordingOptions{})
+
+	var conflict *errs.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("SaveSchedule() during a scheduled recording error = %v, want a conflict", err)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].ScheduleID != booked.ScheduleID {
+		t.Errorf("conflicts = %+v, want the schedule only", conflict.Conflicts)
+	}
+}
+
+func TestConcurrentBookings(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+	storage.latency = 10 * time.Millisecond
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	const n = 10
+
+	var booked atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := s.SaveSchedule(start, []string{"cam"}, "1h", 1, models.RecordingOptions{}); err == nil {
+				booked.Add(1)
+			} else if !errors.Is(err, errs.ErrCameraBooked) {
+				t.Errorf("SaveSchedule() error = %v, want %v", err, errs.ErrCameraBooked)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if booked.Load() != 1 {
+		t.Errorf("%d of %d overlapping bookings saved, want 1", booked.Load(), n)
+	}
+}
+
+func TestCheckBookings(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	now := time.Now()
+
+	if _, err := s.SaveSchedule(now.Add(5*time.Minute), []string{"cam"}, "1h", 1, models.RecordingOptions{}); err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+	if _, err := s.SaveSchedule(now.Add(7*24*time.Hour), []string{"cam-2"}, "1h", 1, models.RecordingOptions{}); err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+	if _, err := s.SaveSeries(now.Add(time.Hour), "", []string{"cam-3"}, "1h", "FREQ=WEEKLY", nil, 1, models.RecordingOptions{}); err != nil {
+		t.Fatalf("SaveSeries() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cameras []string
+		want    error
+	}{
+		{"booked within the lead", []string{"cam-2", "cam"}, errs.ErrCameraBooked},
+		{"booked next week", []string{"cam-2"}, nil},
+		{"weekly series", []string{"cam-3"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CheckBookings(tt.cameras); !errors.Is(err, tt.want) {
+				t.Errorf("CheckBookings() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTickBackToBack(t *testing.T) {
+	s, storage, rec, _ := newTestService(t)
+
+	now := time.Now()
+	first, err := s.SaveSchedule(now.Add(time.Minute), []string{"cam"}, "1h", 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	second, err := s.SaveSchedule(first.StopTime, []string{"cam"}, "1h", 2, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	s.tick(first.StartTime)
+	s.tick(second.StartTime)
+
+	if got := storage.get(first.ScheduleID).Status; got != constants.ScheduleCompleted {
+		t.Errorf("first schedule = %s, want %s", got, constants.ScheduleCompleted)
+	}
+	if sch := storage.get(second.ScheduleID); sch.Status != constants.ScheduleStarted {
+		t.Errorf("second schedule = %s (%q), want started once the first one stopped", sch.Status, sch.Error)
+	}
+	if len(rec.started) != 2 || len(rec.stopped) != 1 {
+		t.Errorf("started %v and stopped %v, want both started and the first stopped", rec.started, rec.stopped)
+	}
+}
@@ -0,0 +1,374 @@
+package scheduleservice
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/ical"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// feedHistory is how far back finished schedules are kept in the feed.
+const feedHistory = 90 * 24 * time.Hour
+
+const uidDomain = "@studio_recorder"
+
+// Import books the events of an iCalendar file for the user. The LOCATION
+// of an event names the room or the camera to record, SUMMARY becomes the
+// title of the recording. Events that can't be booked, or were imported
+// before, are skipped. A dry run only checks the events.
+func (s *ScheduleService) Import(r io.Reader, userID int, dryRun bool) (models.ImportResult, error) {
+	const op = "service.schedules.Import"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("user_id", userID),
+		slog.Bool("dry_run", dryRun),
+	)
+
+	events, err := ical.Parse(r, s.zone)
+	if err != nil {
+		log.Error("failed to read calendar", sl.Err(err))
+
+		return models.ImportResult{}, fmt.Errorf("%s: %w: %w", op, errs.ErrInvalidCalendar, err)
+	}
+
+	cams, err := s.cameras.Cameras()
+	if err != nil {
+		log.Error("failed to get cameras", sl.Err(err))
+
+		return models.ImportResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := models.ImportResult{
+		DryRun:    dryRun,
+		Schedules: make([]models.Schedule, 0),
+		Series:    make([]models.ScheduleSeries, 0),
+		Skipped:   make([]models.ImportSkip, 0),
+	}
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	seen := make(map[string]bool)
+	// booked holds the bookings of the file so far, which are checked for
+	// conflicts like saved ones, even on a dry run.
+	var booked []models.Schedule
+	for _, ev := range events {
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, models.ImportSkip{UID: ev.UID, Summary: ev.Summary, Reason: reason})
+		}
+
+		switch {
+		case ev.Err != nil:
+			skip(ev.Err.Error())
+
+			continue
+		case ev.Status == "CANCELLED":
+			skip("event is canceled")
+
+			continue
+		case !ev.RecurrenceID.IsZero():
+			skip("changes to single occurrences are not imported")
+
+			continue
+		}
+
+		if ev.UID != "" {
+			imported, err := s.scheduleProvider.HasUID(ev.UID)
+			if err != nil {
+				log.Error("failed to look up event", slog.String("uid", ev.UID), sl.Err(err))
+
+				return models.ImportResult{}, fmt.Errorf("%s: %w", op, err)
+			}
+
+			if imported || seen[ev.UID] {
+				skip("event is already imported")
+
+				continue
+			}
+			seen[ev.UID] = true
+		}
+
+		cameraIDs := camerasAt(cams, ev.Location)
+		if len(cameraIDs) == 0 {
+			skip(fmt.Sprintf("no camera at location %q", ev.Location))
+
+			continue
+		}
+
+		opts := models.RecordingOptions{Title: ev.Summary}
+		d := ev.End.Sub(ev.Start)
+
+		if ev.RRule == "" {
+			sch, err := s.newSchedule(ev.Start, cameraIDs, d, userID, opts)
+			if err != nil {
+				skip(err.Error())
+
+				continue
+			}
+			sch.UID = ev.UID
+
+			if conflicts := overlapping([]models.Schedule{sch}, booked, ""); len(conflicts) > 0 {
+				skip((&errs.ConflictError{Conflicts: conflicts}).Error())
+
+				continue
+			}
+			booked = append(booked, sch)
+
+			if !dryRun {
+				if err := s.scheduleSaver.SaveSchedule(sch); err != nil {
+					log.Error("failed to save schedule", slog.String("uid", ev.UID), sl.Err(err))
+
+					return models.ImportResult{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+				}
+			}
+
+			result.Schedules = append(result.Schedules, sch)
+
+			continue
+		}
+
+		series, err := s.newSeries(ev.Start, cameraIDs, d, ev.RRule, ev.ExDates, userID, opts)
+		if err != nil {
+			skip(err.Error())
+
+			continue
+		}
+		series.UID = ev.UID
+
+		occurrences, err := s.bookings(series)
+		if err != nil {
+			skip(err.Error())
+
+			continue
+		}
+
+		if conflicts := overlapping(occurrences, booked, ""); len(conflicts) > 0 {
+			skip((&errs.ConflictError{Conflicts: conflicts}).Error())
+
+			continue
+		}
+		booked = append(booked, occurrences...)
+
+		if !dryRun {
+			if err := s.seriesSaver.SaveSeries(series); err != nil {
+				log.Error("failed to save series", slog.String("uid", ev.UID), sl.Err(err))
+
+				return models.ImportResult{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+			}
+		}
+
+		result.Series = append(result.Series, series)
+	}
+
+	log.Info("calendar imported", slog.Int("schedules", len(result.Schedules)), slog.Int("series", len(result.Series)),
+		slog.Int("skipped", len(result.Skipped)))
+
+	if !dryRun {
+		s.notify()
+	}
+
+	return result, nil
+}
+
+// Feed returns the bookings of the user as a calendar. A userID of 0 returns
+// those of every user, a room keeps the bookings of its cameras. Series are
+// written with their rule, and their changed or canceled occurrences as
+// exceptions.
+func (s *ScheduleService) Feed(userID int, room string) (ical.Calendar, error) {
+	const op = "service.schedules.Feed"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("user_id", userID),
+		slog.String("room", room),
+	)
+
+	cams, err := s.cameras.Cameras()
+	if err != nil {
+		log.Error("failed to get cameras", sl.Err(err))
+
+		return ical.Calendar{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	locations := make(map[string]string, len(cams))
+	for _, cam := range cams {
+		locations[cam.CameraID] = cam.Location
+	}
+
+	inRoom := func(cameraIDs []string) bool {
+		if room == "" {
+			return true
+		}
+
+		for _, id := range cameraIDs {
+			if strings.EqualFold(strings.TrimSpace(locations[id]), strings.TrimSpace(room)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	event := func(uid string, cameraIDs []string, opts models.RecordingOptions, start, stop time.Time) ical.Event {
+		summary := opts.Title
+		if summary == "" {
+			summary = "Recording: " + strings.Join(cameraIDs, ", ")
+		}
+
+		return ical.Event{
+			UID:      uid,
+			Summary:  summary,
+			Location: cameraLocations(cameraIDs, locations),
+			Start:    start,
+			End:      stop,
+		}
+	}
+
+	allSeries, err := s.seriesProvider.UserSeries(userID)
+	if err != nil {
+		log.Error("failed to get series", sl.Err(err))
+
+		return ical.Calendar{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	schedules, err := s.scheduleProvider.Schedules(models.ScheduleFilter{UserID: userID, From: time.Now().Add(-feedHistory)})
+	if err != nil {
+		log.Error("failed to get schedules", sl.Err(err))
+
+		return ical.Calendar{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cal := ical.Calendar{Name: "Recordings"}
+	if room != "" {
+		cal.Name += ": " + room
+	}
+
+	// Occurrences are written with their series, by its place in the feed.
+	seriesAt := make(map[string]int)
+	seriesCameras := make(map[string][]string)
+	for _, series := range allSeries {
+		if !inRoom(series.CameraIDs) {
+			continue
+		}
+
+		ev := event(seriesUID(series), series.CameraIDs, series.Options, series.StartTime, series.StopTime)
+		ev.RRule = series.RRule
+		ev.ExDates = series.ExDates
+
+		seriesAt[series.SeriesID] = len(cal.Events)
+		seriesCameras[series.SeriesID] = series.CameraIDs
+		cal.Events = append(cal.Events, ev)
+	}
+
+	for _, sch := range schedules {
+		if sch.SeriesID == "" {
+			if sch.Status != constants.ScheduleCanceled && inRoom(sch.CameraIDs) {
+				cal.Events = append(cal.Events, event(scheduleUID(sch), sch.CameraIDs, sch.Options, sch.StartTime, sch.StopTime))
+			}
+
+			continue
+		}
+
+		i, ok := seriesAt[sch.SeriesID]
+		if !ok || sch.Occurrence == nil {
+			continue
+		}
+
+		parent := cal.Events[i]
+		if sch.Status == constants.ScheduleCanceled {
+			cal.Events[i].ExDates = append(cal.Events[i].ExDates, *sch.Occurrence)
+
+			continue
+		}
+
+		// An occurrence as the rule has it needs no exception.
+		if sch.StartTime.Equal(*sch.Occurrence) && sch.StopTime.Sub(sch.StartTime) == parent.End.Sub(parent.Start) &&
+			equalIDs(sch.CameraIDs, seriesCameras[sch.SeriesID]) {
+			continue
+		}
+
+		ev := event(parent.UID, sch.CameraIDs, sch.Options, sch.StartTime, sch.StopTime)
+		ev.RecurrenceID = sch.Occurrence.In(parent.Start.Location())
+		cal.Events = append(cal.Events, ev)
+	}
+
+	return cal, nil
+}
+
+// camerasAt returns the cameras a LOCATION names: the cameras of the room,
+// or a camera by its ID.
+func camerasAt(cams []models.Camera, location string) []string {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return nil
+	}
+
+	var ids []string
+	for _, cam := range cams {
+		if cam.CameraID == location {
+			return []string{cam.CameraID}
+		}
+
+		if strings.EqualFold(strings.TrimSpace(cam.Location), location) {
+			ids = append(ids, cam.CameraID)
+		}
+	}
+
+	return ids
+}
+
+func cameraLocations(cameraIDs []string, locations map[string]string) string {
+	var names []string
+	for _, id := range cameraIDs {
+		name := locations[id]
+		if name == "" {
+			name = id
+		}
+
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scheduleUID keeps the UID of an imported event, so calendars that have
+// both don't show the booking twice.
+func scheduleUID(sch models.Schedule) string {
+	if sch.UID != "" {
+		return sch.UID
+	}
+
+	return sch.ScheduleID + uidDomain
+}
+
+func seriesUID(series models.ScheduleSeries) string {
+	if series.UID != "" {
+		return series.UID
+	}
+
+	return series.SeriesID + uidDomain
+}
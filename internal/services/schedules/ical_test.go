@@ -0,0 +1,189 @@
+package scheduleservice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/ical"
+)
+
+func vevent(lines ...string) string {
+	return "BEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\n"
+}
+
+func calendar(events ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+}
+
+func TestImport(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Hour)
+	utc := func(t time.Time) string {
+		return t.Format("20060102T150405Z")
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inBerlin := func(t time.Time) string {
+		return "TZID=Europe/Berlin:" + t.In(berlin).Format("20060102T150405")
+	}
+
+	file := calendar(
+		vevent("UID:lecture", "SUMMARY:Linear algebra", "LOCATION:room 101",
+			"DTSTART;"+inBerlin(start), "DTEND;"+inBerlin(start.Add(90*time.Minute)), "RRULE:FREQ=WEEKLY;COUNT=10"),
+		vevent("UID:seminar", "SUMMARY:Seminar", "LOCATION:cam-3",
+			"DTSTART:"+utc(start.Add(3*time.Hour)), "DTEND:"+utc(start.Add(4*time.Hour))),
+		vevent("UID:lunch", "SUMMARY:Lunch", "LOCATION:Canteen",
+			"DTSTART:"+utc(start), "DTEND:"+utc(start.Add(time.Hour))),
+		vevent("UID:canceled", "LOCATION:Room 101", "STATUS:CANCELLED",
+			"DTSTART:"+utc(start), "DTEND:"+utc(start.Add(time.Hour))),
+		vevent("UID:past", "LOCATION:Room 101",
+			"DTSTART:"+utc(start.AddDate(0, 0, -7)), "DTEND:"+utc(start.AddDate(0, 0, -7).Add(time.Hour))),
+		vevent("UID:seminar", "LOCATION:Room 202",
+			"DTSTART:"+utc(start), "DTEND:"+utc(start.Add(time.Hour))),
+	)
+
+	preview, err := s.Import(strings.NewReader(file), 1, true)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if len(preview.Series) != 1 || len(preview.Schedules) != 1 || len(preview.Skipped) != 4 {
+		t.Fatalf("Import() = %d series, %d schedules, %d skipped, want 1, 1 and 4",
+			len(preview.Series), len(preview.Schedules), len(preview.Skipped))
+	}
+
+	if len(storage.schedules) != 0 || len(storage.series) != 0 {
+		t.Fatalf("dry run saved %d schedules and %d series, want none", len(storage.schedules), len(storage.series))
+	}
+
+	series := preview.Series[0]
+	if len(series.CameraIDs) != 2 || series.Options.Title != "Linear algebra" || series.UID != "lecture" {
+		t.Errorf("series = %+v, want both cameras of the room with the title", series)
+	}
+	if series.TimeZone != "Europe/Berlin" || !series.StartTime.Equal(start) {
+		t.Errorf("series starts %v in %s, want %v in the zone of its TZID", series.StartTime, series.TimeZone, start)
+	}
+
+	if sch := preview.Schedules[0]; len(sch.CameraIDs) != 1 || sch.CameraIDs[0] != "cam-3" {
+		t.Errorf("schedule cameras = %v, want the camera named by its ID", sch.CameraIDs)
+	}
+
+	if _, err := s.Import(strings.NewReader(file), 1, false); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if len(storage.schedules) != 1 || len(storage.series) != 1 {
+		t.Fatalf("Import() saved %d schedules and %d series, want 1 and 1", len(storage.schedules), len(storage.series))
+	}
+
+	again, err := s.Import(strings.NewReader(file), 1, false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if len(again.Series) != 0 || len(again.Schedules) != 0 {
+		t.Errorf("second Import() = %+v, want imported events skipped", again)
+	}
+
+	if _, err := s.Import(strings.NewReader("not a calendar"), 1, true); !errors.Is(err, errs.ErrInvalidCalendar) {
+		t.Errorf("Import() error = %v, want %v", err, errs.ErrInvalidCalendar)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	msk, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().In(msk).Add(24 * time.Hour).Truncate(time.Hour)
+
+	series, err := s.SaveSeries(start, "Europe/Moscow", []string{"cam"}, "1h", "FREQ=DAILY;COUNT=5", nil, 1,
+		models.RecordingOptions{Title: "Lecture"})
+	if err != nil {
+		t.Fatalf("SaveSeries() error = %v", err)
+	}
+
+	moved, err := s.Occurrence(series.SeriesID, start.AddDate(0, 0, 1), 1)
+	if err != nil {
+		t.Fatalf("Occurrence() error = %v", err)
+	}
+
+	later := moved.StartTime.Add(time.Hour)
+	if _, err := s.UpdateSchedule(moved.ScheduleID, 1, models.ScheduleUpdate{StartTime: &later}); err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+
+	canceled, err := s.Occurrence(series.SeriesID, start.AddDate(0, 0, 2), 1)
+	if err != nil {
+		t.Fatalf("Occurrence() error = %v", err)
+	}
+
+	if err := s.CancelSchedule(canceled.ScheduleID, 1); err != nil {
+		t.Fatalf("CancelSchedule() error = %v", err)
+	}
+
+	if _, err := s.SaveSchedule(start.Add(2*time.Hour), []string{"cam-3"}, "1h", 2, models.RecordingOptions{}); err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	cal, err := s.Feed(0, "")
+	if err != nil {
+		t.Fatalf("Feed() error = %v", err)
+	}
+
+	if len(cal.Events) != 3 {
+		t.Fatalf("Feed() = %d events, want the series, its moved occurrence and the schedule", len(cal.Events))
+	}
+
+	lecture := cal.Events[0]
+	if lecture.RRule != "FREQ=DAILY;COUNT=5" || lecture.Summary != "Lecture" || lecture.Location != "Room 101" {
+		t.Errorf("series event = %+v, want the rule, title and room", lecture)
+	}
+	if lecture.Start.Location().String() != "Europe/Moscow" {
+		t.Errorf("series event starts in %s, want the zone of the series", lecture.Start.Location())
+	}
+
+	if len(lecture.ExDates) != 1 || !lecture.ExDates[0].Equal(canceled.StartTime) {
+		t.Errorf("series exdates = %v, want the canceled occurrence", lecture.ExDates)
+	}
+
+	var override ical.Event
+	for _, ev := range cal.Events {
+		if !ev.RecurrenceID.IsZero() {
+			override = ev
+		}
+	}
+
+	if override.UID != lecture.UID || !override.RecurrenceID.Equal(start.AddDate(0, 0, 1)) || !override.Start.Equal(later) {
+		t.Errorf("moved occurrence = %+v, want it to override its occurrence of the series", override)
+	}
+
+	room, err := s.Feed(0, "room 202")
+	if err != nil {
+		t.Fatalf("Feed() error = %v", err)
+	}
+
+	if len(room.Events) != 1 || room.Events[0].Location != "Room 202" {
+		t.Errorf("Feed() of the room = %+v, want only its schedule", room.Events)
+	}
+
+	own, err := s.Feed(2, "")
+	if err != nil {
+		t.Fatalf("Feed() error = %v", err)
+	}
+
+	if len(own.Events) != 1 || own.Events[0].Summary != "Recording: cam-3" {
+		t.Errorf("Feed() of the user = %+v, want only their schedule", own.Events)
+	}
+
+}
@@ -0,0 +1,583 @@
+package scheduleservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// interruptedReason is left on a schedule whose recording was being started
+// when the service went down, so it is unknown whether it started.
+const interruptedReason = "service stopped while the recording was starting"
+
+type ScheduleService struct {
+	log              *slog.Logger
+	scheduleSaver    ScheduleSaver
+	scheduleProvider ScheduleProvider
+	seriesSaver      SeriesSaver
+	seriesProvider   SeriesProvider
+	cameras          CameraProvider
+	recorder         Recorder
+	events           Publisher
+	grace            time.Duration
+	poll             time.Duration
+	horizon          time.Duration
+	lead             time.Duration
+	zone             *time.Location
+	wake             chan struct{}
+	// booking serializes the conflict check of a booking with its save, so
+	// two overlapping bookings can't both pass the check.
+	booking sync.Mutex
+	// version counts the changes of the bookings, see BookingsVersion.
+	version atomic.Uint64
+}
+
+type ScheduleSaver interface {
+	SaveSchedule(schedule models.Schedule) error
+	UpdateSchedule(schedule models.Schedule) error
+	SetScheduleStatus(scheduleID, from, to, recordID, reason string) error
+}
+
+type ScheduleProvider interface {
+	Schedule(scheduleID string) (models.Schedule, error)
+	Schedules(filter models.ScheduleFilter) ([]models.Schedule, error)
+	Occurrence(seriesID string, occurrence time.Time) (models.Schedule, error)
+	OpenSchedules() ([]models.Schedule, error)
+	HasUID(uid string) (bool, error)
+}
+
+type SeriesSaver interface {
+	SaveSeries(series models.ScheduleSeries) error
+	SetSeriesExpanded(seriesID string, until time.Time) error
+	SetSeriesStatus(seriesID, from, to string) error
+}
+
+type SeriesProvider interface {
+	Series(seriesID string) (models.ScheduleSeries, error)
+	ActiveSeries() ([]models.ScheduleSeries, error)
+	UserSeries(userID int) ([]models.ScheduleSeries, error)
+}
+
+type CameraProvider interface {
+	Cameras() ([]models.Camera, error)
+}
+
+type Recorder interface {
+	CheckOptions(cameraIDs []string, opts models.RecordingOptions) error
+	StartUntil(cameraIDs []string, userID int, opts models.RecordingOptions, until time.Time) (string, error)
+	Stop(recordID string) error
+	Running(cameraIDs []string) []models.Conflict
+}
+
+type Publisher interface {
+	Publish(event models.Event)
+}
+
+func New(log *slog.Logger, scheduleSaver ScheduleSaver, scheduleProvider ScheduleProvider, seriesSaver SeriesSaver, seriesProvider SeriesProvider,
+	cameras CameraProvider, recorder Recorder, events Publisher, cfg config.Schedule) *ScheduleService {
+	zone, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		// The zone is checked when the config is loaded.
+		zone = time.UTC
+	}
+
+	return &ScheduleService{
+		log:              log,
+		scheduleSaver:    scheduleSaver,
+		scheduleProvider: scheduleProvider,
+		seriesSaver:      seriesSaver,
+		seriesProvider:   seriesProvider,
+		cameras:          cameras,
+		recorder:         recorder,
+		events:           events,
+		grace:            cfg.Grace,
+		poll:             cfg.Poll,
+		horizon:          cfg.Horizon,
+		lead:             cfg.Lead,
+		zone:             zone,
+		wake:             make(chan struct{}, 1),
+	}
+}
+
+// SaveSchedule books a recording of the cameras. It is started by Run, so it
+// survives restarts of the service.
+func (s *ScheduleService) SaveSchedule(startTime time.Time, cameraIDs []string, duration string, userID int, opts models.RecordingOptions) (models.Schedule, error) {
+	const op = "service.schedules.SaveSchedule"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("camera_id", strings.Join(cameraIDs, ", ")),
+		slog.Int("user_id", userID),
+	)
+
+	log.Info("schedule recording", slog.Any("start_time", startTime), slog.String("duration", duration))
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		log.Error("wrong duration format", slog.String("duration", duration))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w: %s", op, errs.ErrInvalidDuration, duration)
+	}
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	sch, err := s.newSchedule(startTime, cameraIDs, d, userID, opts)
+	if err != nil {
+		log.Error("invalid schedule", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.scheduleSaver.SaveSchedule(sch); err != nil {
+		log.Error("failed to save schedule", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	s.notify()
+
+	return sch, nil
+}
+
+// newSchedule checks a booking and returns it as a pending schedule. A
+// booking that is not forced must not overlap others on its cameras.
+func (s *ScheduleService) newSchedule(startTime time.Time, cameraIDs []string, d time.Duration, userID int, opts models.RecordingOptions) (models.Schedule, error) {
+	if time.Until(startTime) < 0 {
+		return models.Schedule{}, errs.ErrInvalidStartTime
+	}
+
+	if d <= 0 {
+		return models.Schedule{}, fmt.Errorf("%w: %s", errs.ErrInvalidDuration, d)
+	}
+
+	if err := s.recorder.CheckOptions(cameraIDs, opts); err != nil {
+		return models.Schedule{}, err
+	}
+
+	sch := models.Schedule{
+		ScheduleID: uuid.New().String(),
+		UserID:     userID,
+		CameraIDs:  cameraIDs,
+		StartTime:  startTime,
+		StopTime:   startTime.Add(d),
+		Options:    opts,
+		Status:     constants.SchedulePending,
+		CreatedAt:  time.Now(),
+	}
+
+	if !opts.Force {
+		if err := s.checkConflicts([]models.Schedule{sch}, ""); err != nil {
+			return models.Schedule{}, err
+		}
+	}
+
+	return sch, nil
+}
+
+// Schedules lists the schedules matching the filter, earliest first. It also
+// lists the occurrences of recurring schedules that have not been created yet
+// up to filter.To, or the horizon if the filter has no end. Those have no
+// schedule ID.
+func (s *ScheduleService) Schedules(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	const op = "service.schedules.Schedules"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("camera_id", filter.CameraID),
+		slog.Int("user_id", filter.UserID),
+	)
+
+	schedules, err := s.scheduleProvider.Schedules(filter)
+	if err != nil {
+		log.Error("failed to get schedules", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	upcoming, err := s.upcoming(filter)
+	if err != nil {
+		log.Error("failed to expand series", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(upcoming) == 0 {
+		return schedules, nil
+	}
+
+	schedules = append(schedules, upcoming...)
+	sort.SliceStable(schedules, func(i, j int) bool { return schedules[i].StartTime.Before(schedules[j].StartTime) })
+
+	return schedules, nil
+}
+
+// Schedule returns a schedule of the user. A userID of 0 reaches the
+// schedules of every user.
+func (s *ScheduleService) Schedule(scheduleID string, userID int) (models.Schedule, error) {
+	const op = "service.schedules.Schedule"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("schedule_id", scheduleID),
+		slog.Int("user_id", userID),
+	)
+
+	sch, err := s.scheduleProvider.Schedule(scheduleID)
+	if err != nil {
+		log.Error("failed to get schedule", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Schedules of other users are not revealed.
+	if userID != 0 && sch.UserID != userID {
+		log.Error("schedule belongs to another user", slog.Int("owner_id", sch.UserID))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrScheduleNotFound)
+	}
+
+	return sch, nil
+}
+
+// UpdateSchedule moves a pending schedule or changes its duration or
+// cameras. The recording options are checked again for the new cameras.
+func (s *ScheduleService) UpdateSchedule(scheduleID string, userID int, update models.ScheduleUpdate) (models.Schedule, error) {
+	const op = "service.schedules.UpdateSchedule"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("schedule_id", scheduleID),
+		slog.Int("user_id", userID),
+	)
+
+	log.Info("update schedule")
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	sch, err := s.Schedule(scheduleID, userID)
+	if err != nil {
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if sch.Status != constants.SchedulePending {
+		log.Error("schedule is not pending", slog.String("status", sch.Status))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrScheduleNotPending)
+	}
+
+	d := sch.StopTime.Sub(sch.StartTime)
+	if update.Duration != "" {
+		d, err = time.ParseDuration(update.Duration)
+		if err != nil || d <= 0 {
+			log.Error("wrong duration format", slog.String("duration", update.Duration))
+
+			return models.Schedule{}, fmt.Errorf("%s: %w: %s", op, errs.ErrInvalidDuration, update.Duration)
+		}
+	}
+
+	if update.StartTime != nil {
+		if time.Until(*update.StartTime) < 0 {
+			log.Error("invalid start time", slog.Any("start_time", *update.StartTime))
+
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrInvalidStartTime)
+		}
+
+		sch.StartTime = *update.StartTime
+	}
+	sch.StopTime = sch.StartTime.Add(d)
+
+	if len(update.CameraIDs) > 0 {
+		if err := s.recorder.CheckOptions(update.CameraIDs, sch.Options); err != nil {
+			log.Error("invalid recording options", sl.Err(err))
+
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sch.CameraIDs = update.CameraIDs
+	}
+
+	// Only a forced update skips the check. A booking forced before is
+	// checked like any other when it is changed, and is no longer forced
+	// when it starts.
+	sch.Options.Force = update.Force
+
+	if !update.Force {
+		if err := s.checkConflicts([]models.Schedule{sch}, sch.ScheduleID); err != nil {
+			log.Error("schedule conflicts with others", sl.Err(err))
+
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := s.scheduleSaver.UpdateSchedule(sch); err != nil {
+		log.Error("failed to update schedule", sl.Err(err))
+
+		if errors.Is(err, errs.ErrScheduleChanged) {
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrScheduleNotPending)
+		}
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	s.notify()
+
+	return sch, nil
+}
+
+// CancelSchedule cancels a schedule that has not started yet. It is kept with
+// the canceled status.
+func (s *ScheduleService) CancelSchedule(scheduleID string, userID int) error {
+	const op = "service.schedules.CancelSchedule"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("schedule_id", scheduleID),
+		slog.Int("user_id", userID),
+	)
+
+	log.Info("cancel schedule")
+
+	if _, err := s.Schedule(scheduleID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.scheduleSaver.SetScheduleStatus(scheduleID, constants.SchedulePending, constants.ScheduleCanceled, "", ""); err != nil {
+		log.Error("failed to cancel schedule", sl.Err(err))
+
+		if errors.Is(err, errs.ErrScheduleChanged) {
+			return fmt.Errorf("%s: %w", op, errs.ErrScheduleNotPending)
+		}
+
+		return fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Run fires schedules as they come due and stops their recordings at their
+// stop time. Schedules are reloaded from the database on every pass, so the
+// ones booked before a restart are picked up again. It runs until the
+// process exits.
+func (s *ScheduleService) Run() {
+	for {
+		wait := s.poll
+		if next := s.tick(time.Now()); !next.IsZero() {
+			wait = min(wait, time.Until(next))
+		}
+
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// notify wakes Run to pick up a changed schedule and tells ad-hoc
+// recordings that the bookings changed.
+func (s *ScheduleService) notify() {
+	s.version.Add(1)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// tick handles the schedules that are due at now and returns when the next
+// one is, or zero if there is none. Schedules that start together are
+// started concurrently.
+func (s *ScheduleService) tick(now time.Time) time.Time {
+	const op = "service.schedules.tick"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	occurrence := s.expand(now)
+
+	schedules, err := s.scheduleProvider.OpenSchedules()
+	if err != nil {
+		log.Error("failed to get schedules", sl.Err(err))
+
+		return time.Time{}
+	}
+
+	var next time.Time
+	due := func(at time.Time) bool {
+		if at.After(now) {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+
+			return false
+		}
+
+		return true
+	}
+
+	if !occurrence.IsZero() {
+		due(occurrence)
+	}
+
+	var fire []models.Schedule
+	for _, sch := range schedules {
+		switch sch.Status {
+		case constants.SchedulePending:
+			if !due(sch.StartTime) {
+				continue
+			}
+
+			if now.Sub(sch.StartTime) > s.grace || !now.Before(sch.StopTime) {
+				s.miss(sch)
+
+				continue
+			}
+
+			// Once started, the schedule is due again at its stop time.
+			due(sch.StopTime)
+
+			fire = append(fire, sch)
+		case constants.ScheduleStarted:
+			if sch.RecordingID == "" {
+				s.fail(sch, constants.ScheduleStarted, errors.New(interruptedReason))
+
+				continue
+			}
+
+			if due(sch.StopTime) {
+				s.complete(sch)
+			}
+		}
+	}
+
+	// Recordings that are due are started after those whose time is up are
+	// stopped, so back to back schedules of a camera don't conflict.
+	var wg sync.WaitGroup
+	for _, sch := range fire {
+		wg.Add(1)
+		go func(sch models.Schedule) {
+			defer wg.Done()
+
+			s.fire(sch)
+		}(sch)
+	}
+	wg.Wait()
+
+	return next
+}
+
+// fire starts the recording of a schedule. The schedule is marked as started
+// first, so it is never started twice.
+func (s *ScheduleService) fire(sch models.Schedule) {
+	log := s.log.With(
+		slog.String("op", "service.schedules.fire"),
+		slog.String("schedule_id", sch.ScheduleID),
+	)
+
+	if err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, constants.SchedulePending, constants.ScheduleStarted, "", ""); err != nil {
+		log.Error("failed to mark schedule as started", sl.Err(err))
+
+		return
+	}
+
+	log.Info("start scheduled recording")
+
+	recordID, err := s.recorder.StartUntil(sch.CameraIDs, sch.UserID, sch.Options, sch.StopTime)
+	if err != nil {
+		log.Error("failed to start scheduled recording", sl.Err(err))
+
+		s.fail(sch, constants.ScheduleStarted, err)
+
+		return
+	}
+
+	if err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, constants.ScheduleStarted, constants.ScheduleStarted, recordID, ""); err != nil {
+		log.Error("failed to link recording", slog.String("record_id", recordID), sl.Err(err))
+	}
+}
+
+// complete stops the recording of a schedule whose time is up. A recording
+// that was already stopped by hand is left as is. If the recording can't be
+// stopped the schedule stays started, so the next tick tries again.
+func (s *ScheduleService) complete(sch models.Schedule) {
+	log := s.log.With(
+		slog.String("op", "service.schedules.complete"),
+		slog.String("schedule_id", sch.ScheduleID),
+		slog.String("record_id", sch.RecordingID),
+	)
+
+	log.Info("stop scheduled recording")
+
+	err := s.recorder.Stop(sch.RecordingID)
+	if err != nil && !errors.Is(err, errs.ErrRecordingNotActive) && !errors.Is(err, errs.ErrRecordNotFound) {
+		log.Error("failed to stop scheduled recording", sl.Err(err))
+
+		return
+	}
+
+	if err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, constants.ScheduleStarted, constants.ScheduleCompleted, "", ""); err != nil {
+		log.Error("failed to mark schedule as completed", sl.Err(err))
+	}
+}
+
+// miss closes a schedule whose start passed while the service was down.
+func (s *ScheduleService) miss(sch models.Schedule) {
+	log := s.log.With(
+		slog.String("op", "service.schedules.miss"),
+		slog.String("schedule_id", sch.ScheduleID),
+	)
+
+	log.Warn("scheduled recording missed", slog.Any("start_time", sch.StartTime))
+
+	if err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, constants.SchedulePending, constants.ScheduleMissed, "", ""); err != nil {
+		log.Error("failed to mark schedule as missed", sl.Err(err))
+
+		return
+	}
+
+	sch.Status = constants.ScheduleMissed
+	s.publish(constants.EventScheduleMissed, sch)
+}
+
+func (s *ScheduleService) fail(sch models.Schedule, from string, cause error) {
+	log := s.log.With(
+		slog.String("op", "service.schedules.fail"),
+		slog.String("schedule_id", sch.ScheduleID),
+	)
+
+	if err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, from, constants.ScheduleFailed, "", cause.Error()); err != nil {
+		log.Error("failed to mark schedule as failed", sl.Err(err))
+
+		return
+	}
+
+	sch.Status, sch.Error = constants.ScheduleFailed, cause.Error()
+	s.publish(constants.EventScheduleFailed, sch)
+}
+
+func (s *ScheduleService) publish(eventType string, sch models.Schedule) {
+	s.events.Publish(models.Event{
+		Type:      eventType,
+		UserID:    sch.UserID,
+		CameraIDs: sch.CameraIDs,
+		Data:      sch,
+	})
+}
@@ -0,0 +1,574 @@
+package scheduleservice
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/config"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+)
+
+type memStorage struct {
+	mu        sync.Mutex
+	schedules map[string]models.Schedule
+	series    map[string]models.ScheduleSeries
+	// latency is slept after Schedules reads, like a database between the
+	// conflict check of a booking and its save.
+	latency time.Duration
+}
+
+func (m *memStorage) SaveSchedule(sch models.Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, saved := range m.schedules {
+		if sch.SeriesID != "" && saved.SeriesID == sch.SeriesID && saved.Occurrence.Equal(*sch.Occurrence) {
+			return nil
+		}
+	}
+
+	m.schedules[sch.ScheduleID] = sch
+
+	return nil
+}
+
+func (m *memStorage) UpdateSchedule(sch models.Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.schedules[sch.ScheduleID].Status != constants.SchedulePending {
+		return errs.ErrScheduleChanged
+	}
+
+	m.schedules[sch.ScheduleID] = sch
+
+	return nil
+}
+
+func (m *memStorage) SetScheduleStatus(scheduleID, from, to, recordID, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sch, ok := m.schedules[scheduleID]
+	if !ok || sch.Status != from {
+		return errs.ErrScheduleChanged
+	}
+
+	sch.Status, sch.Error = to, reason
+	if recordID != "" {
+		sch.RecordingID = recordID
+	}
+	m.schedules[scheduleID] = sch
+
+	return nil
+}
+
+func (m *memStorage) Schedule(scheduleID string) (models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sch, ok := m.schedules[scheduleID]
+	if !ok {
+		return models.Schedule{}, errs.ErrScheduleNotFound
+	}
+
+	return sch, nil
+}
+
+func (m *memStorage) Occurrence(seriesID string, occurrence time.Time) (models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sch := range m.schedules {
+		if sch.SeriesID == seriesID && sch.Occurrence.Equal(occurrence) {
+			return sch, nil
+		}
+	}
+
+	return models.Schedule{}, errs.ErrScheduleNotFound
+}
+
+func (m *memStorage) Schedules(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	defer time.Sleep(m.latency)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var schedules []models.Schedule
+	for _, sch := range m.schedules {
+		if (filter.UserID != 0 && sch.UserID != filter.UserID) || (filter.SeriesID != "" && sch.SeriesID != filter.SeriesID) {
+			continue
+		}
+
+		schedules = append(schedules, sch)
+	}
+
+	return schedules, nil
+}
+
+func (m *memStorage) OpenSchedules() ([]models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var open []models.Schedule
+	for _, sch := range m.schedules {
+		if sch.Status == constants.SchedulePending || sch.Status == constants.ScheduleStarted {
+			open = append(open, sch)
+		}
+	}
+
+	return open, nil
+}
+
+func (m *memStorage) HasUID(uid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sch := range m.schedules {
+		if sch.UID == uid {
+			return true, nil
+		}
+	}
+
+	for _, series := range m.series {
+		if series.UID == uid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memStorage) SaveSeries(series models.ScheduleSeries) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.series[series.SeriesID] = series
+
+	return nil
+}
+
+func (m *memStorage) SetSeriesExpanded(seriesID string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.series[seriesID]
+	series.ExpandedUntil = until
+	m.series[seriesID] = series
+
+	return nil
+}
+
+func (m *memStorage) SetSeriesStatus(seriesID, from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.series[seriesID]
+	if !ok || series.Status != from {
+		return errs.ErrScheduleChanged
+	}
+
+	series.Status = to
+	m.series[seriesID] = series
+
+	return nil
+}
+
+func (m *memStorage) Series(seriesID string) (models.ScheduleSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.series[seriesID]
+	if !ok {
+		return models.ScheduleSeries{}, errs.ErrSeriesNotFound
+	}
+
+	return series, nil
+}
+
+func (m *memStorage) ActiveSeries() ([]models.ScheduleSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var active []models.ScheduleSeries
+	for _, series := range m.series {
+		if series.Status == constants.SeriesActive {
+			active = append(active, series)
+		}
+	}
+
+	return active, nil
+}
+
+func (m *memStorage) UserSeries(userID int) ([]models.ScheduleSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []models.ScheduleSeries
+	for _, series := range m.series {
+		if series.Status != constants.SeriesCanceled && (userID == 0 || series.UserID == userID) {
+			list = append(list, series)
+		}
+	}
+
+	return list, nil
+}
+
+func (m *memStorage) get(scheduleID string) models.Schedule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.schedules[scheduleID]
+}
+
+type stubCameras []models.Camera
+
+func (c stubCameras) Cameras() ([]models.Camera, error) {
+	return c, nil
+}
+
+type stubRecorder struct {
+	mu       sync.Mutex
+	startErr error
+	stopErr  error
+	started  []string
+	stopped  []string
+	// running holds the recording of each camera, which a new one that is
+	// not forced conflicts with.
+	running map[string]string
+	// until holds the stop time of the running recordings that have one.
+	until map[string]time.Time
+}
+
+func (r *stubRecorder) CheckOptions(cameraIDs []string, opts models.RecordingOptions) error {
+	if opts.Container == "avi" {
+		return errs.ErrUnknownContainer
+	}
+
+	return nil
+}
+
+func (r *stubRecorder) StartUntil(cameraIDs []string, userID int, opts models.RecordingOptions, until time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.startErr != nil {
+		return "", r.startErr
+	}
+
+	if r.running == nil {
+		r.running = make(map[string]string)
+	}
+
+	for _, cameraID := range cameraIDs {
+		if recordID, ok := r.running[cameraID]; ok && !opts.Force {
+			return "", &errs.ConflictError{Conflicts: []models.Conflict{{CameraID: cameraID, RecordingID: recordID}}}
+		}
+	}
+
+	recordID := "rec-" + cameraIDs[0]
+	r.started = append(r.started, recordID)
+	for _, cameraID := range cameraIDs {
+		r.running[cameraID] = recordID
+	}
+
+	if !until.IsZero() {
+		if r.until == nil {
+			r.until = make(map[string]time.Time)
+		}
+		r.until[recordID] = until
+	}
+
+	return recordID, nil
+}
+
+func (r *stubRecorder) Running(cameraIDs []string) []models.Conflict {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var conflicts []models.Conflict
+	for _, cameraID := range cameraIDs {
+		recordID, ok := r.running[cameraID]
+		if !ok {
+			continue
+		}
+
+		c := models.Conflict{CameraID: cameraID, RecordingID: recordID}
+		if until, ok := r.until[recordID]; ok {
+			c.StopTime = &until
+		}
+
+		conflicts = append(conflicts, c)
+	}
+
+	return conflicts
+}
+
+func (r *stubRecorder) Stop(recordID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopErr != nil {
+		return r.stopErr
+	}
+
+	r.stopped = append(r.stopped, recordID)
+	for cameraID, id := range r.running {
+		if id == recordID {
+			delete(r.running, cameraID)
+		}
+	}
+
+	return nil
+}
+
+type stubEvents struct {
+	mu     sync.Mutex
+	events []models.Event
+}
+
+func (e *stubEvents) Publish(event models.Event) {
+	e.mu.Lock()
+	e.events = append(e.events, event)
+	e.mu.Unlock()
+}
+
+func newTestService(t *testing.T) (*ScheduleService, *memStorage, *stubRecorder, *stubEvents) {
+	t.Helper()
+
+	storage := &memStorage{schedules: make(map[string]models.Schedule), series: make(map[string]models.ScheduleSeries)}
+	rec := &stubRecorder{}
+	events := &stubEvents{}
+	cams := stubCameras{
+		{CameraID: "cam", Location: "Room 101"},
+		{CameraID: "cam-2", Location: "Room 101"},
+		{CameraID: "cam-3", Location: "Room 202"},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return New(log, storage, storage, storage, storage, cams, rec, events, config.Schedule{Grace: time.Minute, Poll: time.Minute, Horizon: 30 * 24 * time.Hour, Lead: 15 * time.Minute}), storage, rec, events
+}
+
+func TestSaveSchedule(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+
+	sch, err := s.SaveSchedule(start, []string{"cam"}, "90m", 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSchedule() error = %v", err)
+	}
+
+	saved := storage.get(sch.ScheduleID)
+	if saved.Status != constants.SchedulePending || !saved.StopTime.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("saved schedule = %+v, want a pending schedule of 90 minutes", saved)
+	}
+
+	tests := []struct {
+		name     string
+		start    time.Time
+		duration string
+		opts     models.RecordingOptions
+		want     error
+	}{
+		{"past start", time.Now().Add(-time.Minute), "1h", models.RecordingOptions{}, errs.ErrInvalidStartTime},
+		{"bad duration", start, "an hour", models.RecordingOptions{}, errs.ErrInvalidDuration},
+		{"zero duration", start, "0s", models.RecordingOptions{}, errs.ErrInvalidDuration},
+		{"bad options", start, "1h", models.RecordingOptions{Container: "avi"}, errs.ErrUnknownContainer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.SaveSchedule(tt.start, []string{"cam"}, tt.duration, 1, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("SaveSchedule() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSchedule(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+	storage.SaveSchedule(models.Schedule{ScheduleID: "sch", UserID: 1, CameraIDs: []string{"cam"}, StartTime: start, StopTime: start.Add(time.Hour), Status: constants.SchedulePending})
+
+	moved := start.Add(30 * time.Minute)
+
+	sch, err := s.UpdateSchedule("sch", 1, models.ScheduleUpdate{StartTime: &moved})
+	if err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+	if !sch.StartTime.Equal(moved) || !sch.StopTime.Equal(moved.Add(time.Hour)) {
+		t.Errorf("moved schedule = %v..%v, want it to keep its duration", sch.StartTime, sch.StopTime)
+	}
+
+	sch, err = s.UpdateSchedule("sch", 0, models.ScheduleUpdate{CameraIDs: []string{"cam1", "cam2"}, Duration: "2h"})
+	if err != nil {
+		t.Fatalf("UpdateSchedule() by an admin error = %v", err)
+	}
+	if saved := storage.get("sch"); len(saved.CameraIDs) != 2 || !saved.StopTime.Equal(moved.Add(2*time.Hour)) {
+		t.Errorf("saved schedule = %+v, want two cameras for two hours", saved)
+	}
+
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name   string
+		userID int
+		update models.ScheduleUpdate
+		want   error
+	}{
+		{"other user", 2, models.ScheduleUpdate{Duration: "1h"}, errs.ErrScheduleNotFound},
+		{"past start", 1, models.ScheduleUpdate{StartTime: &past}, errs.ErrInvalidStartTime},
+		{"bad duration", 1, models.ScheduleUpdate{Duration: "-1h"}, errs.ErrInvalidDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.UpdateSchedule("sch", tt.userID, tt.update); !errors.Is(err, tt.want) {
+				t.Errorf("UpdateSchedule() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	storage.SetScheduleStatus("sch", constants.SchedulePending, constants.ScheduleStarted, "rec", "")
+
+	if _, err := s.UpdateSchedule("sch", 1, models.ScheduleUpdate{Duration: "1h"}); !errors.Is(err, errs.ErrScheduleNotPending) {
+		t.Errorf("UpdateSchedule() of a started schedule error = %v, want %v", err, errs.ErrScheduleNotPending)
+	}
+}
+
+func TestCancelSchedule(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+	storage.SaveSchedule(models.Schedule{ScheduleID: "sch", UserID: 1, CameraIDs: []string{"cam"}, StartTime: start, StopTime: start.Add(time.Hour), Status: constants.SchedulePending})
+
+	if err := s.CancelSchedule("sch", 2); !errors.Is(err, errs.ErrScheduleNotFound) {
+		t.Errorf("CancelSchedule() by another user error = %v, want %v", err, errs.ErrScheduleNotFound)
+	}
+
+	if err := s.CancelSchedule("sch", 1); err != nil {
+		t.Fatalf("CancelSchedule() error = %v", err)
+	}
+	if got := storage.get("sch").Status; got != constants.ScheduleCanceled {
+		t.Errorf("schedule = %s, want %s", got, constants.ScheduleCanceled)
+	}
+
+	if err := s.CancelSchedule("sch", 1); !errors.Is(err, errs.ErrScheduleNotPending) {
+		t.Errorf("CancelSchedule() twice error = %v, want %v", err, errs.ErrScheduleNotPending)
+	}
+}
+
+func TestTick(t *testing.T) {
+	s, storage, rec, events := newTestService(t)
+
+	now := time.Now()
+	for _, sch := range []models.Schedule{
+		{ScheduleID: "due", CameraIDs: []string{"cam1"}, StartTime: now.Add(-time.Second), StopTime: now.Add(time.Hour), Status: constants.SchedulePending},
+		{ScheduleID: "later", CameraIDs: []string{"cam2"}, StartTime: now.Add(time.Hour), StopTime: now.Add(2 * time.Hour), Status: constants.SchedulePending},
+		{ScheduleID: "missed", CameraIDs: []string{"cam3"}, StartTime: now.Add(-time.Hour), StopTime: now.Add(time.Hour), Status: constants.SchedulePending},
+		{ScheduleID: "lost", CameraIDs: []string{"cam4"}, StartTime: now.Add(-time.Hour), StopTime: now.Add(time.Hour), Status: constants.ScheduleStarted},
+	} {
+		storage.SaveSchedule(sch)
+	}
+
+	if next := s.tick(now); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("tick() next = %v, want the start of the later schedule", next)
+	}
+
+	due := storage.get("due")
+	if due.Status != constants.ScheduleStarted || due.RecordingID != "rec-cam1" {
+		t.Errorf("due schedule = %s with recording %q, want started with rec-cam1", due.Status, due.RecordingID)
+	}
+	if got := storage.get("later").Status; got != constants.SchedulePending {
+		t.Errorf("later schedule = %s, want %s", got, constants.SchedulePending)
+	}
+	if got := storage.get("missed").Status; got != constants.ScheduleMissed {
+		t.Errorf("missed schedule = %s, want %s", got, constants.ScheduleMissed)
+	}
+	if lost := storage.get("lost"); lost.Status != constants.ScheduleFailed || lost.Error == "" {
+		t.Errorf("schedule started before a restart = %s (%q), want failed with a reason", lost.Status, lost.Error)
+	}
+	if len(events.events) != 2 {
+		t.Errorf("published %d events, want missed and failed", len(events.events))
+	}
+
+	// The first recording is stopped as the later one starts, which is due
+	// again at its stop.
+	if next := s.tick(now.Add(time.Hour)); !next.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("tick() next = %v, want the stop of the later schedule", next)
+	}
+
+	if got := storage.get("due").Status; got != constants.ScheduleCompleted {
+		t.Errorf("due schedule = %s, want %s", got, constants.ScheduleCompleted)
+	}
+	if len(rec.stopped) != 1 || rec.stopped[0] != "rec-cam1" {
+		t.Errorf("stopped = %v, want rec-cam1", rec.stopped)
+	}
+	if got := storage.get("later").Status; got != constants.ScheduleStarted {
+		t.Errorf("later schedule = %s, want %s", got, constants.ScheduleStarted)
+	}
+}
+
+func TestTickStopFailure(t *testing.T) {
+	s, storage, rec, _ := newTestService(t)
+
+	now := time.Now()
+	storage.SaveSchedule(models.Schedule{ScheduleID: "due", CameraIDs: []string{"cam"}, StartTime: now, StopTime: now.Add(time.Hour), Status: constants.SchedulePending})
+
+	s.tick(now)
+
+	rec.stopErr = errors.New("pipeline did not stop")
+	s.tick(now.Add(time.Hour))
+
+	if got := storage.get("due").Status; got != constants.ScheduleStarted {
+		t.Errorf("schedule whose recording did not stop = %s, want %s", got, constants.ScheduleStarted)
+	}
+
+	// The next tick tries again.
+	rec.stopErr = nil
+	s.tick(now.Add(time.Hour + time.Minute))
+
+	if got := storage.get("due").Status; got != constants.ScheduleCompleted {
+		t.Errorf("schedule = %s, want %s", got, constants.ScheduleCompleted)
+	}
+	if len(rec.stopped) != 1 || rec.stopped[0] != "rec-cam" {
+		t.Errorf("stopped = %v, want rec-cam", rec.stopped)
+	}
+
+	// A recording stopped by hand completes the schedule too.
+	storage.SaveSchedule(models.Schedule{ScheduleID: "stopped", CameraIDs: []string{"cam-2"}, StartTime: now, StopTime: now.Add(time.Hour),
+		Status: constants.ScheduleStarted, RecordingID: "rec-cam-2"})
+	rec.stopErr = errs.ErrRecordingNotActive
+	s.tick(now.Add(time.Hour + 2*time.Minute))
+
+	if got := storage.get("stopped").Status; got != constants.ScheduleCompleted {
+		t.Errorf("schedule of a stopped recording = %s, want %s", got, constants.ScheduleCompleted)
+	}
+}
+
+func TestTickStartFailure(t *testing.T) {
+	s, storage, rec, events := newTestService(t)
+
+	rec.startErr = errs.ErrCameraIsNotAvailable
+
+	now := time.Now()
+	storage.SaveSchedule(models.Schedule{ScheduleID: "due", CameraIDs: []string{"cam"}, StartTime: now, StopTime: now.Add(time.Hour), Status: constants.SchedulePending})
+
+	s.tick(now)
+
+	sch := storage.get("due")
+	if sch.Status != constants.ScheduleFailed || sch.Error != errs.ErrCameraIsNotAvailable.Error() {
+		t.Errorf("schedule = %s (%q), want failed with the start error", sch.Status, sch.Error)
+	}
+	if len(events.events) != 1 || events.events[0].Type != constants.EventScheduleFailed {
+		t.Errorf("events = %+v, want %s", events.events, constants.EventScheduleFailed)
+	}
+}
@@ -0,0 +1,439 @@
+package scheduleservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/rrule"
+	"github.com/zanzhit/studio_recorder/internal/lib/sl"
+)
+
+// SaveSeries books recordings of the cameras that recur by rule from
+// startTime on. Occurrences at exdates are skipped. The series may have
+// started already, only its occurrences after now are recorded. It recurs at
+// the wall clock of startTime in the IANA zone timezone, by default the zone
+// of the studio.
+func (s *ScheduleService) SaveSeries(startTime time.Time, timezone string, cameraIDs []string, duration, rule string, exdates []time.Time, userID int,
+	opts models.RecordingOptions) (models.ScheduleSeries, error) {
+	const op = "service.schedules.SaveSeries"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("camera_id", strings.Join(cameraIDs, ", ")),
+		slog.Int("user_id", userID),
+	)
+
+	log.Info("schedule recurring recording", slog.Any("start_time", startTime), slog.String("timezone", timezone),
+		slog.String("duration", duration), slog.String("rrule", rule))
+
+	zone := s.zone
+	if timezone != "" {
+		var err error
+		if zone, err = time.LoadLocation(timezone); err != nil {
+			log.Error("unknown time zone", slog.String("timezone", timezone))
+
+			return models.ScheduleSeries{}, fmt.Errorf("%s: %w: %s", op, errs.ErrInvalidTimeZone, timezone)
+		}
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		log.Error("wrong duration format", slog.String("duration", duration))
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w: %s", op, errs.ErrInvalidDuration, duration)
+	}
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	series, err := s.newSeries(startTime.In(zone), cameraIDs, d, rule, exdates, userID, opts)
+	if err != nil {
+		log.Error("invalid series", sl.Err(err))
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.seriesSaver.SaveSeries(series); err != nil {
+		log.Error("failed to save series", sl.Err(err))
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	s.notify()
+
+	return series, nil
+}
+
+// newSeries checks a recurring booking and returns it as an active series
+// recurring in the zone of startTime. Unless forced, its occurrences up to
+// the horizon must not overlap other bookings.
+func (s *ScheduleService) newSeries(startTime time.Time, cameraIDs []string, d time.Duration, rule string, exdates []time.Time, userID int,
+	opts models.RecordingOptions) (models.ScheduleSeries, error) {
+	if d <= 0 {
+		return models.ScheduleSeries{}, fmt.Errorf("%w: %s", errs.ErrInvalidDuration, d)
+	}
+
+	// The zone is stored by its IANA name. A fixed offset without one has no
+	// daylight saving, so it recurs the same in UTC.
+	if zone := startTime.Location().String(); zone == "" || zone == "Local" {
+		startTime = startTime.UTC()
+	} else if _, err := time.LoadLocation(zone); err != nil {
+		startTime = startTime.UTC()
+	}
+
+	r, err := rrule.Parse(rule)
+	if err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	now := time.Now()
+	if _, ok := r.After(startTime, now, exdates); !ok {
+		return models.ScheduleSeries{}, fmt.Errorf("%w: no occurrences after now", errs.ErrInvalidRRule)
+	}
+
+	if err := s.recorder.CheckOptions(cameraIDs, opts); err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	series := models.ScheduleSeries{
+		SeriesID:      uuid.New().String(),
+		UserID:        userID,
+		CameraIDs:     cameraIDs,
+		StartTime:     startTime,
+		StopTime:      startTime.Add(d),
+		TimeZone:      startTime.Location().String(),
+		RRule:         r.String(),
+		ExDates:       exdates,
+		Options:       opts,
+		Status:        constants.SeriesActive,
+		ExpandedUntil: now,
+		CreatedAt:     now,
+	}
+
+	if !opts.Force {
+		bookings, err := s.bookings(series)
+		if err != nil {
+			return models.ScheduleSeries{}, err
+		}
+
+		if err := s.checkConflicts(bookings, ""); err != nil {
+			return models.ScheduleSeries{}, err
+		}
+	}
+
+	return series, nil
+}
+
+// Series returns a series of the user. A userID of 0 reaches the series of
+// every user.
+func (s *ScheduleService) Series(seriesID string, userID int) (models.ScheduleSeries, error) {
+	const op = "service.schedules.Series"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("series_id", seriesID),
+		slog.Int("user_id", userID),
+	)
+
+	series, err := s.seriesProvider.Series(seriesID)
+	if err != nil {
+		log.Error("failed to get series", sl.Err(err))
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if userID != 0 && series.UserID != userID {
+		log.Error("series belongs to another user", slog.Int("owner_id", series.UserID))
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, errs.ErrSeriesNotFound)
+	}
+
+	return series, nil
+}
+
+// CancelSeries stops a series and cancels its occurrences that have not
+// started yet.
+func (s *ScheduleService) CancelSeries(seriesID string, userID int) error {
+	const op = "service.schedules.CancelSeries"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("series_id", seriesID),
+		slog.Int("user_id", userID),
+	)
+
+	log.Info("cancel series")
+
+	if _, err := s.Series(seriesID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.seriesSaver.SetSeriesStatus(seriesID, constants.SeriesActive, constants.SeriesCanceled); err != nil {
+		log.Error("failed to cancel series", sl.Err(err))
+
+		if errors.Is(err, errs.ErrScheduleChanged) {
+			return fmt.Errorf("%s: %w", op, errs.ErrSeriesNotActive)
+		}
+
+		return fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	schedules, err := s.scheduleProvider.Schedules(models.ScheduleFilter{SeriesID: seriesID})
+	if err != nil {
+		log.Error("failed to get occurrences", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, sch := range schedules {
+		if sch.Status != constants.SchedulePending {
+			continue
+		}
+
+		err := s.scheduleSaver.SetScheduleStatus(sch.ScheduleID, constants.SchedulePending, constants.ScheduleCanceled, "", "")
+		if err != nil && !errors.Is(err, errs.ErrScheduleChanged) {
+			log.Error("failed to cancel occurrence", slog.String("schedule_id", sch.ScheduleID), sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+		}
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Occurrence returns the schedule of the occurrence of a series that starts
+// at start, creating it if the series has not come to it yet. The schedule
+// can then be changed or canceled on its own.
+func (s *ScheduleService) Occurrence(seriesID string, start time.Time, userID int) (models.Schedule, error) {
+	const op = "service.schedules.Occurrence"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("series_id", seriesID),
+		slog.Any("occurrence", start),
+	)
+
+	series, err := s.Series(seriesID, userID)
+	if err != nil {
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sch, err := s.scheduleProvider.Occurrence(seriesID, start)
+	if err == nil {
+		return sch, nil
+	}
+	if !errors.Is(err, errs.ErrScheduleNotFound) {
+		log.Error("failed to get occurrence", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if series.Status != constants.SeriesActive {
+		log.Error("series is not active", slog.String("status", series.Status))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrSeriesNotActive)
+	}
+
+	r, err := rrule.Parse(series.RRule)
+	if err != nil {
+		log.Error("invalid recurrence rule", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !r.Includes(series.StartTime, start, series.ExDates) {
+		log.Error("time is not an occurrence")
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrNotAnOccurrence)
+	}
+
+	// Occurrences up to the expansion that have no schedule passed before
+	// the series was booked.
+	if !start.After(series.ExpandedUntil) {
+		log.Error("occurrence is in the past")
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrInvalidStartTime)
+	}
+
+	if err := s.scheduleSaver.SaveSchedule(occurrence(series, start)); err != nil {
+		log.Error("failed to save occurrence", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrWriteToDB)
+	}
+
+	// The scheduler may have created it first.
+	sch, err = s.scheduleProvider.Occurrence(seriesID, start)
+	if err != nil {
+		log.Error("failed to get occurrence", sl.Err(err))
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.notify()
+
+	return sch, nil
+}
+
+// upcoming returns the occurrences matching the filter that have not been
+// created as schedules yet.
+func (s *ScheduleService) upcoming(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	series, err := s.seriesProvider.ActiveSeries()
+	if err != nil {
+		return nil, err
+	}
+
+	to := filter.To
+	if to.IsZero() {
+		to = time.Now().Add(s.horizon)
+	}
+
+	var upcoming []models.Schedule
+	for _, sr := range series {
+		if (filter.SeriesID != "" && sr.SeriesID != filter.SeriesID) ||
+			(filter.UserID != 0 && sr.UserID != filter.UserID) ||
+			(filter.CameraID != "" && !contains(sr.CameraIDs, filter.CameraID)) {
+			continue
+		}
+
+		r, err := rrule.Parse(sr.RRule)
+		if err != nil {
+			return nil, err
+		}
+
+		// Occurrences overlapping From may start before it.
+		from := sr.ExpandedUntil.Add(time.Nanosecond)
+		if start := filter.From.Add(-sr.StopTime.Sub(sr.StartTime)); start.After(from) {
+			from = start.Add(time.Nanosecond)
+		}
+
+		starts := r.Between(sr.StartTime, from, to, sr.ExDates)
+		if len(starts) == 0 {
+			continue
+		}
+
+		created, err := s.scheduleProvider.Schedules(models.ScheduleFilter{SeriesID: sr.SeriesID})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, start := range starts {
+			if isCreated(created, start) {
+				continue
+			}
+
+			sch := occurrence(sr, start)
+			sch.ScheduleID = ""
+			upcoming = append(upcoming, sch)
+		}
+	}
+
+	return upcoming, nil
+}
+
+// expand creates the schedules of the occurrences that have come due by now
+// and returns when the next one does, or zero if there is none. Series
+// without further occurrences are completed.
+func (s *ScheduleService) expand(now time.Time) time.Time {
+	log := s.log.With(
+		slog.String("op", "service.schedules.expand"),
+	)
+
+	series, err := s.seriesProvider.ActiveSeries()
+	if err != nil {
+		log.Error("failed to get series", sl.Err(err))
+
+		return time.Time{}
+	}
+
+	var next time.Time
+	for _, sr := range series {
+		log := log.With(slog.String("series_id", sr.SeriesID))
+
+		r, err := rrule.Parse(sr.RRule)
+		if err != nil {
+			log.Error("invalid recurrence rule", sl.Err(err))
+
+			continue
+		}
+
+		saved := true
+		for _, start := range r.Between(sr.StartTime, sr.ExpandedUntil.Add(time.Nanosecond), now.Add(time.Nanosecond), sr.ExDates) {
+			if err := s.scheduleSaver.SaveSchedule(occurrence(sr, start)); err != nil {
+				log.Error("failed to save occurrence", slog.Any("occurrence", start), sl.Err(err))
+
+				saved = false
+
+				break
+			}
+		}
+
+		if !saved {
+			continue
+		}
+
+		if err := s.seriesSaver.SetSeriesExpanded(sr.SeriesID, now); err != nil {
+			log.Error("failed to save expansion", sl.Err(err))
+		}
+
+		at, ok := r.After(sr.StartTime, now, sr.ExDates)
+		if !ok {
+			log.Info("series is over")
+
+			if err := s.seriesSaver.SetSeriesStatus(sr.SeriesID, constants.SeriesActive, constants.SeriesCompleted); err != nil {
+				log.Error("failed to mark series as completed", sl.Err(err))
+			}
+
+			continue
+		}
+
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return next
+}
+
+func occurrence(series models.ScheduleSeries, start time.Time) models.Schedule {
+	return models.Schedule{
+		ScheduleID: uuid.New().String(),
+		UserID:     series.UserID,
+		CameraIDs:  series.CameraIDs,
+		StartTime:  start,
+		StopTime:   start.Add(series.StopTime.Sub(series.StartTime)),
+		Options:    series.Options,
+		Status:     constants.SchedulePending,
+		SeriesID:   series.SeriesID,
+		Occurrence: &start,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func isCreated(schedules []models.Schedule, start time.Time) bool {
+	for _, sch := range schedules {
+		if sch.Occurrence != nil && sch.Occurrence.Equal(start) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package scheduleservice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/lib/rrule"
+)
+
+func saveDailySeries(t *testing.T, storage *memStorage, start time.Time, rule string) {
+	t.Helper()
+
+	storage.SaveSeries(models.ScheduleSeries{
+		SeriesID:      "series",
+		UserID:        1,
+		CameraIDs:     []string{"cam"},
+		StartTime:     start,
+		StopTime:      start.Add(time.Hour),
+		RRule:         rule,
+		Status:        constants.SeriesActive,
+		ExpandedUntil: start.Add(-time.Minute),
+	})
+}
+
+func TestSaveSeries(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+
+	series, err := s.SaveSeries(start, "", []string{"cam"}, "90m", "freq=weekly;byday=tu,th", nil, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSeries() error = %v", err)
+	}
+
+	saved, _ := storage.Series(series.SeriesID)
+	if saved.Status != constants.SeriesActive || saved.RRule != "FREQ=WEEKLY;BYDAY=TU,TH" {
+		t.Errorf("saved series = %+v, want an active series with the rule normalized", saved)
+	}
+
+	until := start.Add(-24 * time.Hour).UTC().Format("20060102T150405Z")
+
+	tests := []struct {
+		name string
+		rule string
+		want error
+	}{
+		{"unsupported rule", "FREQ=MONTHLY", errs.ErrInvalidRRule},
+		{"no occurrences", "FREQ=WEEKLY;UNTIL=" + until, errs.ErrInvalidRRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.SaveSeries(start, "", []string{"cam"}, "1h", tt.rule, nil, 1, models.RecordingOptions{}); !errors.Is(err, tt.want) {
+				t.Errorf("SaveSeries() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.SaveSeries(start, "Mars/Olympus", []string{"cam-2"}, "1h", "FREQ=WEEKLY", nil, 1, models.RecordingOptions{}); !errors.Is(err, errs.ErrInvalidTimeZone) {
+		t.Errorf("SaveSeries() in an unknown zone error = %v, want %v", err, errs.ErrInvalidTimeZone)
+	}
+}
+
+func TestSeriesTimeZone(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The start comes in with a fixed offset, as JSON times do.
+	start := time.Now().In(berlin).AddDate(0, 0, 1)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 10, 0, 0, 0, berlin)
+	_, offset := start.Zone()
+	start = start.In(time.FixedZone("", offset))
+
+	series, err := s.SaveSeries(start, "Europe/Berlin", []string{"cam"}, "1h", "FREQ=WEEKLY;COUNT=30", nil, 1, models.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveSeries() error = %v", err)
+	}
+
+	if series.TimeZone != "Europe/Berlin" || series.StartTime.Location().String() != "Europe/Berlin" {
+		t.Errorf("series zone = %s, start in %s, want Europe/Berlin", series.TimeZone, series.StartTime.Location())
+	}
+
+	// Half a year of weekly occurrences crosses a daylight saving change,
+	// they all stay at 10:00 in Berlin.
+	r, err := rrule.Parse(series.RRule)
+	if err != nil {
+		t.Fatalf("rrule.Parse() error = %v", err)
+	}
+	for _, occ := range r.Between(series.StartTime, start, start.AddDate(0, 7, 0), nil) {
+		if h, m, _ := occ.In(berlin).Clock(); h != 10 || m != 0 {
+			t.Errorf("occurrence at %v, want 10:00 in Berlin", occ.In(berlin))
+		}
+	}
+}
+
+func TestTickSeries(t *testing.T) {
+	s, storage, rec, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+	saveDailySeries(t, storage, start, "FREQ=DAILY;COUNT=3")
+
+	if next := s.tick(start); !next.Equal(start.Add(time.Hour)) {
+		t.Errorf("tick() next = %v, want the stop of the first occurrence", next)
+	}
+
+	if next := s.tick(start.Add(time.Hour)); !next.Equal(start.Add(24 * time.Hour)) {
+		t.Errorf("tick() next = %v, want the start of the second occurrence", next)
+	}
+
+	s.tick(start.Add(24 * time.Hour))
+	s.tick(start.Add(48 * time.Hour))
+
+	if len(rec.started) != 3 {
+		t.Errorf("started %d recordings, want 3", len(rec.started))
+	}
+
+	schedules, _ := storage.Schedules(models.ScheduleFilter{SeriesID: "series"})
+	if len(schedules) != 3 {
+		t.Errorf("series has %d schedules, want one per occurrence", len(schedules))
+	}
+
+	if series, _ := storage.Series("series"); series.Status != constants.SeriesCompleted {
+		t.Errorf("series = %s, want %s", series.Status, constants.SeriesCompleted)
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+	saveDailySeries(t, storage, start, "FREQ=DAILY;COUNT=5")
+
+	third := start.Add(48 * time.Hour)
+
+	sch, err := s.Occurrence("series", third, 1)
+	if err != nil {
+		t.Fatalf("Occurrence() error = %v", err)
+	}
+	if sch.ScheduleID == "" || sch.Status != constants.SchedulePending || !sch.StopTime.Equal(third.Add(time.Hour)) {
+		t.Errorf("occurrence = %+v, want a pending schedule of an hour", sch)
+	}
+
+	again, err := s.Occurrence("series", third, 0)
+	if err != nil || again.ScheduleID != sch.ScheduleID {
+		t.Errorf("Occurrence() again = %s, %v, want the same schedule", again.ScheduleID, err)
+	}
+
+	moved := third.Add(2 * time.Hour)
+	if _, err := s.UpdateSchedule(sch.ScheduleID, 1, models.ScheduleUpdate{StartTime: &moved}); err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+
+	schedules, err := s.Schedules(models.ScheduleFilter{SeriesID: "series", To: start.Add(7 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Schedules() error = %v", err)
+	}
+	if len(schedules) != 5 {
+		t.Fatalf("Schedules() = %d, want the five occurrences", len(schedules))
+	}
+	for i, sch := range schedules {
+		want := start.Add(time.Duration(i) * 24 * time.Hour)
+		if i == 2 {
+			want = moved
+		}
+
+		if !sch.StartTime.Equal(want) {
+			t.Errorf("occurrence %d starts at %v, want %v", i, sch.StartTime, want)
+		}
+		if (sch.ScheduleID != "") != (i == 2) {
+			t.Errorf("occurrence %d has schedule ID %q, want only the changed one created", i, sch.ScheduleID)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		start  time.Time
+		userID int
+		want   error
+	}{
+		{"not an occurrence", start.Add(time.Hour), 1, errs.ErrNotAnOccurrence},
+		{"after the count", start.Add(5 * 24 * time.Hour), 1, errs.ErrNotAnOccurrence},
+		{"other user", start, 2, errs.ErrSeriesNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Occurrence("series", tt.start, tt.userID); !errors.Is(err, tt.want) {
+				t.Errorf("Occurrence() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelSeries(t *testing.T) {
+	s, storage, _, _ := newTestService(t)
+
+	start := time.Now().Add(time.Hour)
+	saveDailySeries(t, storage, start, "FREQ=DAILY")
+
+	sch, err := s.Occurrence("series", start, 1)
+	if err != nil {
+		t.Fatalf("Occurrence() error = %v", err)
+	}
+
+	if err := s.CancelSeries("series", 1); err != nil {
+		t.Fatalf("CancelSeries() error = %v", err)
+	}
+
+	if got := storage.get(sch.ScheduleID).Status; got != constants.ScheduleCanceled {
+		t.Errorf("occurrence = %s, want %s", got, constants.ScheduleCanceled)
+	}
+
+	schedules, _ := s.Schedules(models.ScheduleFilter{SeriesID: "series"})
+	if len(schedules) != 1 {
+		t.Errorf("Schedules() = %d, want only the canceled occurrence", len(schedules))
+	}
+
+	if err := s.CancelSeries("series", 1); !errors.Is(err, errs.ErrSeriesNotActive) {
+		t.Errorf("CancelSeries() twice error = %v, want %v", err, errs.ErrSeriesNotActive)
+	}
+}
@@ -117,3 +117,59 @@ func (s *AuthStorage) DeleteUser(email string) error {
 
 	return nil
 }
+
+// SaveFeedToken replaces the calendar feed token of the user, so the previous
+// one stops working.
+func (s *AuthStorage) SaveFeedToken(userID int, tokenHash []byte) error {
+	const op = "storage.postgres.auth.SaveFeedToken"
+
+	query := fmt.Sprintf(`INSERT INTO %s (user_id, token_hash) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()`, postgres.FeedTokensTable)
+
+	if _, err := s.db.Exec(query, userID, tokenHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) DeleteFeedToken(userID int) error {
+	const op = "storage.postgres.auth.DeleteFeedToken"
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1", postgres.FeedTokensTable)
+
+	if _, err := s.db.Exec(query, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// FeedUser returns the owner of a calendar feed token.
+func (s *AuthStorage) FeedUser(tokenHash []byte) (models.User, error) {
+	const op = "storage.postgres.auth.FeedUser"
+
+	query := fmt.Sprintf(`SELECT u.id, u.email, EXISTS (SELECT 1 FROM %s a WHERE a.user_id = u.id)
+		FROM %s f JOIN %s u ON u.id = f.user_id WHERE f.token_hash = $1`,
+		postgres.AdminsTable, postgres.FeedTokensTable, postgres.UsersTable)
+
+	var (
+		user    models.User
+		isAdmin bool
+	)
+
+	if err := s.db.QueryRow(query, tokenHash).Scan(&user.Id, &user.Email, &isAdmin); err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, fmt.Errorf("%s: %w", op, errs.ErrInvalidCredentials)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if isAdmin {
+		user.UserType = constants.Admin
+	} else {
+		user.UserType = constants.User
+	}
+
+	return user, nil
+}
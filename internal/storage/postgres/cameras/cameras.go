@@ -25,14 +25,18 @@ func New(db *sqlx.DB) *CameraStorage {
 func (s *CameraStorage) SaveCamera(cam models.Camera) (models.Camera, error) {
 	const op = "storage.postgres.cameras.Save"
 
-	query := fmt.Sprintf(`INSERT INTO %s (camera_id, camera_ip, location, has_audio) VALUES ($1, $2, $3, $4) RETURNING *`, postgres.CamerasTable)
+	query := fmt.Sprintf(`INSERT INTO %s (camera_id, camera_ip, location, has_audio, profile_id, pre_roll_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`, postgres.CamerasTable)
 
-	err := s.db.QueryRowx(query, cam.CameraID, cam.CameraIP, cam.Location, cam.HasAudio).StructScan(&cam)
+	err := s.db.QueryRowx(query, cam.CameraID, cam.CameraIP, cam.Location, cam.HasAudio, cam.ProfileID, cam.PreRollSeconds).StructScan(&cam)
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return cam, fmt.Errorf("%s: %w", op, errs.ErrCameraAlreadyExists)
 		}
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return cam, fmt.Errorf("%s: %w", op, errs.ErrProfileNotFound)
+		}
 
 		return cam, fmt.Errorf("%s: %w", op, err)
 	}
@@ -57,6 +61,23 @@ func (s *CameraStorage) CameraIP(cameraID string) (string, error) {
 	return cameraIP, nil
 }
 
+func (s *CameraStorage) Camera(cameraID string) (models.Camera, error) {
+	const op = "storage.postgres.cameras.Camera"
+
+	query := fmt.Sprintf(`SELECT * FROM %s WHERE camera_id = $1`, postgres.CamerasTable)
+
+	var cam models.Camera
+	err := s.db.Get(&cam, query, cameraID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return cam, fmt.Errorf("%s: %w", op, errs.ErrCameraNotFound)
+		}
+		return cam, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return cam, nil
+}
+
 func (s *CameraStorage) Cameras() ([]models.Camera, error) {
 	const op = "storage.postgres.cameras.Cameras"
 
@@ -71,18 +92,23 @@ func (s *CameraStorage) Cameras() ([]models.Camera, error) {
 	return cameras, nil
 }
 
-func (s *CameraStorage) UpdateCamera(cameraID, location string, hasAudio bool) (models.Camera, error) {
+func (s *CameraStorage) UpdateCamera(cameraID, location string, hasAudio bool, profileID string, preRollSeconds int) (models.Camera, error) {
 	const op = "storage.postgres.cameras.Update"
 
-	query := fmt.Sprintf(`UPDATE %s SET location = $1, has_audio = $2 WHERE camera_id = $3 RETURNING *`, postgres.CamerasTable)
+	query := fmt.Sprintf(`UPDATE %s SET location = $1, has_audio = $2, profile_id = NULLIF($3, ''), pre_roll_seconds = $4
+		WHERE camera_id = $5 RETURNING *`, postgres.CamerasTable)
 
 	var cam models.Camera
 
-	err := s.db.QueryRowx(query, location, hasAudio, cameraID).StructScan(&cam)
+	err := s.db.QueryRowx(query, location, hasAudio, profileID, preRollSeconds, cameraID).StructScan(&cam)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return cam, fmt.Errorf("%s: %w", op, errs.ErrCameraNotFound)
 		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return cam, fmt.Errorf("%s: %w", op, errs.ErrProfileNotFound)
+		}
 		return cam, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -0,0 +1,196 @@
+package layoutstorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
+)
+
+type LayoutStorage struct {
+	db *sqlx.DB
+}
+
+func New(db *sqlx.DB) *LayoutStorage {
+	return &LayoutStorage{
+		db: db,
+	}
+}
+
+func (s *LayoutStorage) SaveLayout(l models.Layout) (models.Layout, error) {
+	const op = "storage.postgres.layouts.Save"
+
+	query := fmt.Sprintf(`INSERT INTO %s (layout_id, name, width, height, background) VALUES ($1, $2, $3, $4, $5)`, postgres.LayoutsTable)
+
+	err := s.withTx(func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(query, l.LayoutID, l.Name, l.Width, l.Height, l.Background); err != nil {
+			return err
+		}
+
+		return saveSlots(tx, l)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return l, fmt.Errorf("%s: %w", op, errs.ErrLayoutExists)
+		}
+
+		return l, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return l, nil
+}
+
+func (s *LayoutStorage) UpdateLayout(l models.Layout) (models.Layout, error) {
+	const op = "storage.postgres.layouts.Update"
+
+	query := fmt.Sprintf(`UPDATE %s SET name = $1, width = $2, height = $3, background = $4 WHERE layout_id = $5`, postgres.LayoutsTable)
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE layout_id = $1`, postgres.LayoutSlotsTable)
+
+	err := s.withTx(func(tx *sqlx.Tx) error {
+		result, err := tx.Exec(query, l.Name, l.Width, l.Height, l.Background, l.LayoutID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return errs.ErrLayoutNotFound
+		}
+
+		if _, err := tx.Exec(deleteQuery, l.LayoutID); err != nil {
+			return err
+		}
+
+		return saveSlots(tx, l)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return l, fmt.Errorf("%s: %w", op, errs.ErrLayoutExists)
+		}
+
+		return l, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return l, nil
+}
+
+func (s *LayoutStorage) Layout(layoutID string) (models.Layout, error) {
+	const op = "storage.postgres.layouts.Layout"
+
+	query := fmt.Sprintf(`SELECT layout_id, name, width, height, background FROM %s WHERE layout_id = $1`, postgres.LayoutsTable)
+
+	var l models.Layout
+	if err := s.db.Get(&l, query, layoutID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return l, fmt.Errorf("%s: %w", op, errs.ErrLayoutNotFound)
+		}
+
+		return l, fmt.Errorf("%s: %w", op, err)
+	}
+
+	slots, err := s.slots(layoutID)
+	if err != nil {
+		return l, fmt.Errorf("%s: %w", op, err)
+	}
+	l.Slots = slots
+
+	return l, nil
+}
+
+func (s *LayoutStorage) Layouts() ([]models.Layout, error) {
+	const op = "storage.postgres.layouts.Layouts"
+
+	query := fmt.Sprintf(`SELECT layout_id, name, width, height, background FROM %s ORDER BY name`, postgres.LayoutsTable)
+
+	var layouts []models.Layout
+	if err := s.db.Select(&layouts, query); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range layouts {
+		slots, err := s.slots(layouts[i].LayoutID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		layouts[i].Slots = slots
+	}
+
+	return layouts, nil
+}
+
+func (s *LayoutStorage) DeleteLayout(layoutID string) error {
+	const op = "storage.postgres.layouts.Delete"
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE layout_id = $1`, postgres.LayoutsTable)
+
+	result, err := s.db.Exec(query, layoutID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, errs.ErrLayoutNotFound)
+	}
+
+	return nil
+}
+
+func (s *LayoutStorage) slots(layoutID string) ([]models.LayoutSlot, error) {
+	query := fmt.Sprintf(`SELECT x, y, width, height, z_order, border, border_color FROM %s
+		WHERE layout_id = $1 ORDER BY position`, postgres.LayoutSlotsTable)
+
+	var slots []models.LayoutSlot
+	if err := s.db.Select(&slots, query, layoutID); err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+func (s *LayoutStorage) withTx(fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveSlots(tx *sqlx.Tx, l models.Layout) error {
+	query := fmt.Sprintf(`INSERT INTO %s (layout_id, position, x, y, width, height, z_order, border, border_color)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, postgres.LayoutSlotsTable)
+
+	for i, slot := range l.Slots {
+		if _, err := tx.Exec(query, l.LayoutID, i, slot.X, slot.Y, slot.Width, slot.Height, slot.ZOrder, slot.Border, slot.BorderColor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package profilestorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
+)
+
+type ProfileStorage struct {
+	db *sqlx.DB
+}
+
+func New(db *sqlx.DB) *ProfileStorage {
+	return &ProfileStorage{
+		db: db,
+	}
+}
+
+func (s *ProfileStorage) SaveProfile(p models.Profile) (models.Profile, error) {
+	const op = "storage.postgres.profiles.Save"
+
+	query := fmt.Sprintf(`INSERT INTO %s (profile_id, name, video_codec, video_bitrate, preset, keyframe_interval,
+		width, height, framerate, audio_codec, audio_bitrate) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, postgres.ProfilesTable)
+
+	_, err := s.db.Exec(query, p.ProfileID, p.Name, p.VideoCodec, p.VideoBitrate, p.Preset, p.KeyframeInterval,
+		p.Width, p.Height, p.Framerate, p.AudioCodec, p.AudioBitrate)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return p, fmt.Errorf("%s: %w", op, errs.ErrProfileExists)
+		}
+
+		return p, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p, nil
+}
+
+func (s *ProfileStorage) UpdateProfile(p models.Profile) (models.Profile, error) {
+	const op = "storage.postgres.profiles.Update"
+
+	query := fmt.Sprintf(`UPDATE %s SET name = $1, video_codec = $2, video_bitrate = $3, preset = $4, keyframe_interval = $5,
+		width = $6, height = $7, framerate = $8, audio_codec = $9, audio_bitrate = $10 WHERE profile_id = $11`, postgres.ProfilesTable)
+
+	result, err := s.db.Exec(query, p.Name, p.VideoCodec, p.VideoBitrate, p.Preset, p.KeyframeInterval,
+		p.Width, p.Height, p.Framerate, p.AudioCodec, p.AudioBitrate, p.ProfileID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return p, fmt.Errorf("%s: %w", op, errs.ErrProfileExists)
+		}
+
+		return p, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return p, fmt.Errorf("%s: %w", op, errs.ErrProfileNotFound)
+	}
+
+	return p, nil
+}
+
+func (s *ProfileStorage) Profile(profileID string) (models.Profile, error) {
+	const op = "storage.postgres.profiles.Profile"
+
+	query := fmt.Sprintf(`SELECT * FROM %s WHERE profile_id = $1`, postgres.ProfilesTable)
+
+	var p models.Profile
+	if err := s.db.Get(&p, query, profileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return p, fmt.Errorf("%s: %w", op, errs.ErrProfileNotFound)
+		}
+
+		return p, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p, nil
+}
+
+func (s *ProfileStorage) Profiles() ([]models.Profile, error) {
+	const op = "storage.postgres.profiles.Profiles"
+
+	query := fmt.Sprintf(`SELECT * FROM %s ORDER BY name`, postgres.ProfilesTable)
+
+	var profiles []models.Profile
+	if err := s.db.Select(&profiles, query); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return profiles, nil
+}
+
+func (s *ProfileStorage) DeleteProfile(profileID string) error {
+	const op = "storage.postgres.profiles.Delete"
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE profile_id = $1`, postgres.ProfilesTable)
+
+	result, err := s.db.Exec(query, profileID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, errs.ErrProfileNotFound)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -22,106 +23,161 @@ func New(db *sqlx.DB) *RecordingStorage {
 	}
 }
 
-func (s *RecordingStorage) Start(rec models.Recording, cameraID string) error {
+func (s *RecordingStorage) Start(rec models.Recording, cameraID string) (err error) {
 	const op = "storage.postgres.recordings.Start"
 
-	query := fmt.Sprintf(`INSERT INTO %s (record_id, user_id, camera_id, start_time, file_path, is_moved) 
-		VALUES ($1, $2, $3, $4, $5, $6)`, postgres.RecordsTable)
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, user_id, camera_id, start_time, file_path, is_moved, status, pid, segmented, container, mime_type,
+		session_id, session_index, title)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, '')::uuid, $13, $14)`, postgres.RecordsTable)
 
-	_, err := s.db.Exec(query, rec.RecordingID, rec.UserID, cameraID, rec.StartTime, rec.FilePath, false)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
-}
-
-func (s *RecordingStorage) Stop(recordID string, stopTime time.Time) error {
-	const op = "storage.postgres.recordings.Stop"
-
-	query := fmt.Sprintf(`UPDATE %s SET stop_time = $1 WHERE record_id = $2`, postgres.RecordsTable)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
 
-	result, err := s.db.Exec(query, stopTime, recordID)
-	if err != nil {
+	if _, err = tx.Exec(query, rec.RecordingID, rec.UserID, cameraID, rec.StartTime, rec.FilePath, false, rec.Status, rec.PID, rec.Segmented, rec.Container, rec.MimeType,
+		rec.SessionID, rec.SessionIndex, rec.Title); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if err = saveTransition(tx, rec.RecordingID, "", rec.Status); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("%s: %w", op, errs.ErrRecordNotFound)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *RecordingStorage) Move(recordID string) error {
+func (s *RecordingStorage) SetStatus(recordID, from, to string) error {
+	const op = "storage.postgres.recordings.SetStatus"
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1 WHERE record_id = $2 AND status = $3`, postgres.RecordsTable)
+
+	return s.transition(op, recordID, from, to, query, to, recordID, from)
+}
+
+func (s *RecordingStorage) Stop(recordID string, stopTime time.Time, from, to string) error {
+	const op = "storage.postgres.recordings.Stop"
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, stop_time = $2 WHERE record_id = $3 AND status = $4`, postgres.RecordsTable)
+
+	return s.transition(op, recordID, from, to, query, to, stopTime, recordID, from)
+}
+
+func (s *RecordingStorage) Finish(recordID string, exitCode int, from, to string) error {
+	const op = "storage.postgres.recordings.Finish"
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, exit_code = $2 WHERE record_id = $3 AND status = $4`, postgres.RecordsTable)
+
+	return s.transition(op, recordID, from, to, query, to, exitCode, recordID, from)
+}
+
+func (s *RecordingStorage) Move(recordID string, from, to string) error {
 	const op = "storage.postgres.recordings.Move"
 
-	query := fmt.Sprintf(`UPDATE %s SET is_moved = true WHERE record_id = $1`, postgres.RecordsTable)
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, is_moved = true WHERE record_id = $2 AND status = $3`, postgres.RecordsTable)
+
+	return s.transition(op, recordID, from, to, query, to, recordID, from)
+}
 
-	result, err := s.db.Exec(query, recordID)
+// transition runs an update guarded by the expected current status and records
+// the change in the transitions table. A concurrent status change makes the
+// guard fail and is reported as an invalid transition.
+func (s *RecordingStorage) transition(op, recordID, from, to, query string, args ...interface{}) (err error) {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("%s: %w", op, errs.ErrRecordNotFound)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
-}
+	if rowsAffected == 0 {
+		var exists bool
+		existsQuery := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE record_id = $1)`, postgres.RecordsTable)
 
-func (s *RecordingStorage) Delete(recordID string) error {
-	const op = "storage.postgres.recordings.Delete"
+		if err = tx.QueryRow(existsQuery, recordID).Scan(&exists); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	query := fmt.Sprintf(`DELETE FROM %s WHERE record_id = $1`, postgres.RecordsTable)
+		if !exists {
+			err = errs.ErrRecordNotFound
+		} else {
+			err = errs.ErrInvalidStatusTransition
+		}
 
-	result, err := s.db.Exec(query, recordID)
-	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if err = saveTransition(tx, recordID, from, to); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("%s: %w", op, errs.ErrRecordNotFound)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
+func saveTransition(tx *sql.Tx, recordID, from, to string) error {
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, from_status, to_status) VALUES ($1, NULLIF($2, ''), $3)`, postgres.TransitionsTable)
+
+	_, err := tx.Exec(query, recordID, from, to)
+
+	return err
+}
+
 func (s *RecordingStorage) Recording(recordID string) (models.Recording, error) {
 	const op = "storage.postgres.recordings.Recording"
 
 	var rec models.Recording
 	var stopTime sql.NullTime
+	var exitCode sql.NullInt64
 
 	query := fmt.Sprintf(`
-		SELECT r.record_id, c.camera_ip, r.start_time, r.stop_time, r.file_path, r.is_moved
+		SELECT r.record_id, r.camera_id, c.camera_ip, r.user_id, r.start_time, r.stop_time, COALESCE(r.file_path, ''), r.is_moved, r.status, r.exit_code, r.segmented,
+			r.container, r.mime_type, COALESCE(r.session_id::text, ''), r.title
 		FROM %s r
 		JOIN %s c ON r.camera_id = c.camera_id
 		WHERE r.record_id = $1`, postgres.RecordsTable, postgres.CamerasTable)
 
 	row := s.db.QueryRow(query, recordID)
-	if err := row.Scan(&rec.RecordingID, &rec.CameraIP, &rec.StartTime, &stopTime, &rec.FilePath, &rec.IsMoved); err != nil {
+	if err := row.Scan(&rec.RecordingID, &rec.CameraID, &rec.CameraIP, &rec.UserID, &rec.StartTime, &stopTime, &rec.FilePath, &rec.IsMoved, &rec.Status, &exitCode, &rec.Segmented,
+		&rec.Container, &rec.MimeType, &rec.SessionID, &rec.Title); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.Recording{}, fmt.Errorf("%s: %w", op, errs.ErrRecordNotFound)
 		}
 		return models.Recording{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		rec.ExitCode = &code
+	}
+
 	if stopTime.Valid {
 		rec.StopTime = stopTime.Time
 
@@ -138,10 +194,11 @@ func (s *RecordingStorage) CameraRecordings(cameraID string, limit, offset, user
 
 	var recs []models.Recording
 	query := fmt.Sprintf(`
-		SELECT r.record_id, c.camera_ip, r.user_id, r.start_time, r.stop_time, r.is_moved
+		SELECT r.record_id, r.camera_id, c.camera_ip, r.user_id, r.start_time, r.stop_time, r.is_moved, r.status, r.exit_code, r.segmented,
+			r.container, r.mime_type, COALESCE(r.session_id::text, ''), r.title
 		FROM %s r
 		JOIN %s c ON r.camera_id = c.camera_id
-		WHERE r.camera_id = $1 AND r.user_id = $2
+		WHERE r.camera_id = $1 AND r.user_id = $2 AND r.status <> 'deleted'
 		LIMIT $3 OFFSET $4`, postgres.RecordsTable, postgres.CamerasTable)
 
 	rows, err := s.db.Query(query, cameraID, userID, limit, offset)
@@ -153,11 +210,18 @@ func (s *RecordingStorage) CameraRecordings(cameraID string, limit, offset, user
 	for rows.Next() {
 		var rec models.Recording
 		var stopTime sql.NullTime
+		var exitCode sql.NullInt64
 
-		if err := rows.Scan(&rec.RecordingID, &rec.CameraIP, &rec.UserID, &rec.StartTime, &stopTime, &rec.IsMoved); err != nil {
+		if err := rows.Scan(&rec.RecordingID, &rec.CameraID, &rec.CameraIP, &rec.UserID, &rec.StartTime, &stopTime, &rec.IsMoved, &rec.Status, &exitCode, &rec.Segmented,
+			&rec.Container, &rec.MimeType, &rec.SessionID, &rec.Title); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			rec.ExitCode = &code
+		}
+
 		if stopTime.Valid {
 			rec.StopTime = stopTime.Time
 		} else {
@@ -173,3 +237,278 @@ func (s *RecordingStorage) CameraRecordings(cameraID string, limit, offset, user
 
 	return recs, nil
 }
+
+func (s *RecordingStorage) OpenRecordings() ([]models.Recording, error) {
+	const op = "storage.postgres.recordings.OpenRecordings"
+
+	var recs []models.Recording
+	query := fmt.Sprintf(`
+		SELECT record_id, camera_id, user_id, start_time, COALESCE(file_path, '') AS file_path, status, COALESCE(pid, 0) AS pid, segmented,
+			container, mime_type, COALESCE(session_id::text, '') AS session_id, title
+		FROM %s
+		WHERE status IN ('recording', 'paused', 'finalizing')`, postgres.RecordsTable)
+
+	if err := s.db.Select(&recs, query); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return recs, nil
+}
+
+func (s *RecordingStorage) SaveSegment(seg models.Segment) error {
+	const op = "storage.postgres.recordings.SaveSegment"
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, segment_index, file_path, start_offset, end_offset, size)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (record_id, segment_index) DO NOTHING`, postgres.SegmentsTable)
+
+	if _, err := s.db.Exec(query, seg.RecordingID, seg.Index, seg.FilePath, seg.StartOffset, seg.EndOffset, seg.Size); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) Segments(recordID string) ([]models.Segment, error) {
+	const op = "storage.postgres.recordings.Segments"
+
+	query := fmt.Sprintf(`SELECT record_id, segment_index, file_path, start_offset, end_offset, size
+		FROM %s WHERE record_id = $1 ORDER BY segment_index`, postgres.SegmentsTable)
+
+	var segs []models.Segment
+	if err := s.db.Select(&segs, query, recordID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return segs, nil
+}
+
+func (s *RecordingStorage) SaveRendition(rendition models.Rendition) error {
+	const op = "storage.postgres.recordings.SaveRendition"
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, rendition, file_path, container, mime_type)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (record_id, rendition) DO NOTHING`, postgres.RenditionsTable)
+
+	if _, err := s.db.Exec(query, rendition.RecordingID, rendition.Name, rendition.FilePath, rendition.Container, rendition.MimeType); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) Renditions(recordID string) ([]models.Rendition, error) {
+	const op = "storage.postgres.recordings.Renditions"
+
+	query := fmt.Sprintf(`SELECT record_id, rendition, file_path, container, mime_type
+		FROM %s WHERE record_id = $1 ORDER BY rendition`, postgres.RenditionsTable)
+
+	var renditions []models.Rendition
+	if err := s.db.Select(&renditions, query, recordID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return renditions, nil
+}
+
+func (s *RecordingStorage) SetPID(recordID string, pid int) error {
+	const op = "storage.postgres.recordings.SetPID"
+
+	query := fmt.Sprintf(`UPDATE %s SET pid = $1 WHERE record_id = $2`, postgres.RecordsTable)
+
+	if _, err := s.db.Exec(query, pid, recordID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) OpenGap(recordID string, from time.Time) (int64, error) {
+	const op = "storage.postgres.recordings.OpenGap"
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, gap_start) VALUES ($1, $2) RETURNING id`, postgres.GapsTable)
+
+	var id int64
+	if err := s.db.QueryRow(query, recordID, from).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// CloseGaps ends every open gap of the recording at to.
+func (s *RecordingStorage) CloseGaps(recordID string, to time.Time) error {
+	const op = "storage.postgres.recordings.CloseGaps"
+
+	query := fmt.Sprintf(`UPDATE %s SET gap_end = GREATEST(gap_start, $1) WHERE record_id = $2 AND gap_end IS NULL`, postgres.GapsTable)
+
+	if _, err := s.db.Exec(query, to, recordID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) Gaps(recordID string) ([]models.Gap, error) {
+	const op = "storage.postgres.recordings.Gaps"
+
+	query := fmt.Sprintf(`SELECT id, gap_start, gap_end FROM %s WHERE record_id = $1 ORDER BY gap_start`, postgres.GapsTable)
+
+	rows, err := s.db.Query(query, recordID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var gaps []models.Gap
+	for rows.Next() {
+		var gap models.Gap
+		var to sql.NullTime
+
+		if err := rows.Scan(&gap.ID, &gap.From, &to); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if to.Valid {
+			gap.To = to.Time
+		}
+
+		gaps = append(gaps, gap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return gaps, nil
+}
+
+func (s *RecordingStorage) OpenPause(recordID string, from time.Time) (int64, error) {
+	const op = "storage.postgres.recordings.OpenPause"
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, pause_start) VALUES ($1, $2) RETURNING id`, postgres.PausesTable)
+
+	var id int64
+	if err := s.db.QueryRow(query, recordID, from).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// ClosePauses ends every open pause of the recording at to.
+func (s *RecordingStorage) ClosePauses(recordID string, to time.Time) error {
+	const op = "storage.postgres.recordings.ClosePauses"
+
+	query := fmt.Sprintf(`UPDATE %s SET pause_end = GREATEST(pause_start, $1) WHERE record_id = $2 AND pause_end IS NULL`, postgres.PausesTable)
+
+	if _, err := s.db.Exec(query, to, recordID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) Pauses(recordID string) ([]models.Pause, error) {
+	const op = "storage.postgres.recordings.Pauses"
+
+	query := fmt.Sprintf(`SELECT id, pause_start, pause_end FROM %s WHERE record_id = $1 ORDER BY pause_start`, postgres.PausesTable)
+
+	rows, err := s.db.Query(query, recordID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var pauses []models.Pause
+	for rows.Next() {
+		var pause models.Pause
+		var to sql.NullTime
+
+		if err := rows.Scan(&pause.ID, &pause.From, &to); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if to.Valid {
+			pause.To = to.Time
+		}
+
+		pauses = append(pauses, pause)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pauses, nil
+}
+
+func (s *RecordingStorage) SaveMarker(marker models.Marker) (int64, error) {
+	const op = "storage.postgres.recordings.SaveMarker"
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, label, marker_offset, created_at)
+		VALUES ($1, $2, $3, $4) RETURNING id`, postgres.MarkersTable)
+
+	var id int64
+	if err := s.db.QueryRow(query, marker.RecordingID, marker.Label, marker.Offset, marker.CreatedAt).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *RecordingStorage) Markers(recordID string) ([]models.Marker, error) {
+	const op = "storage.postgres.recordings.Markers"
+
+	query := fmt.Sprintf(`SELECT id, record_id, label, marker_offset, created_at
+		FROM %s WHERE record_id = $1 ORDER BY marker_offset, id`, postgres.MarkersTable)
+
+	var markers []models.Marker
+	if err := s.db.Select(&markers, query, recordID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return markers, nil
+}
+
+// SaveEvents saves a batch of pipeline events in one statement.
+func (s *RecordingStorage) SaveEvents(events []models.PipelineEvent) error {
+	const op = "storage.postgres.recordings.SaveEvents"
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, 5*len(events))
+	for i, ev := range events {
+		n := 5 * i
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, ev.RecordingID, ev.Time, ev.Level, ev.Source, ev.Message)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (record_id, event_time, level, source, message)
+		VALUES %s`, postgres.EventsTable, strings.Join(values, ", "))
+
+	if _, err := s.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Events returns the pipeline events of a recording, only those of the given
+// level unless it is empty.
+func (s *RecordingStorage) Events(recordID, level string) ([]models.PipelineEvent, error) {
+	const op = "storage.postgres.recordings.Events"
+
+	query := fmt.Sprintf(`SELECT record_id, event_time, level, source, message
+		FROM %s WHERE record_id = $1 AND ($2 = '' OR level = $2) ORDER BY id`, postgres.EventsTable)
+
+	var events []models.PipelineEvent
+	if err := s.db.Select(&events, query, recordID, level); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
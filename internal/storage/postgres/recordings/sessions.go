@@ -0,0 +1,102 @@
+package recordingstorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
+)
+
+func (s *RecordingStorage) SaveSession(session models.Session) error {
+	const op = "storage.postgres.recordings.SaveSession"
+
+	query := fmt.Sprintf(`INSERT INTO %s (session_id, user_id, start_time) VALUES ($1, $2, $3)`, postgres.SessionsTable)
+
+	if _, err := s.db.Exec(query, session.SessionID, session.UserID, session.StartTime); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RecordingStorage) Session(sessionID string) (models.Session, error) {
+	const op = "storage.postgres.recordings.Session"
+
+	query := fmt.Sprintf(`SELECT session_id, user_id, start_time FROM %s WHERE session_id = $1`, postgres.SessionsTable)
+
+	var session models.Session
+	if err := s.db.Get(&session, query, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", op, errs.ErrSessionNotFound)
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// DeleteSession removes a session, its recordings are kept on their own.
+func (s *RecordingStorage) DeleteSession(sessionID string) error {
+	const op = "storage.postgres.recordings.DeleteSession"
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE session_id = $1`, postgres.SessionsTable)
+
+	if _, err := s.db.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SessionRecordings returns the recordings of a session in the order their
+// cameras were given.
+func (s *RecordingStorage) SessionRecordings(sessionID string) ([]models.Recording, error) {
+	const op = "storage.postgres.recordings.SessionRecordings"
+
+	query := fmt.Sprintf(`
+		SELECT r.record_id, r.camera_id, c.camera_ip, r.user_id, r.start_time, r.stop_time, COALESCE(r.file_path, ''), r.is_moved, r.status, r.exit_code, r.segmented,
+			r.container, r.mime_type, COALESCE(r.session_id::text, ''), r.session_index, r.title
+		FROM %s r
+		JOIN %s c ON r.camera_id = c.camera_id
+		WHERE r.session_id = $1
+		ORDER BY r.session_index`, postgres.RecordsTable, postgres.CamerasTable)
+
+	rows, err := s.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var recs []models.Recording
+	for rows.Next() {
+		var rec models.Recording
+		var stopTime sql.NullTime
+		var exitCode sql.NullInt64
+
+		if err := rows.Scan(&rec.RecordingID, &rec.CameraID, &rec.CameraIP, &rec.UserID, &rec.StartTime, &stopTime, &rec.FilePath, &rec.IsMoved, &rec.Status, &exitCode, &rec.Segmented,
+			&rec.Container, &rec.MimeType, &rec.SessionID, &rec.SessionIndex, &rec.Title); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			rec.ExitCode = &code
+		}
+
+		if stopTime.Valid {
+			rec.StopTime = stopTime.Time
+		}
+
+		recs = append(recs, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return recs, nil
+}
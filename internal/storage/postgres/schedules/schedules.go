@@ -0,0 +1,252 @@
+package schedulestorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
+)
+
+const scheduleColumns = `schedule_id, user_id, camera_ids, start_time, stop_time, options, status, COALESCE(record_id::text, ''), error, COALESCE(series_id::text, ''), occurrence, uid, created_at`
+
+type ScheduleStorage struct {
+	db *sqlx.DB
+}
+
+func New(db *sqlx.DB) *ScheduleStorage {
+	return &ScheduleStorage{
+		db: db,
+	}
+}
+
+// SaveSchedule saves a new schedule. An occurrence of a series that has
+// already been created is left as is.
+func (s *ScheduleStorage) SaveSchedule(sch models.Schedule) error {
+	const op = "storage.postgres.schedules.SaveSchedule"
+
+	options, err := json.Marshal(sch.Options)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (schedule_id, user_id, camera_ids, start_time, stop_time, options, status, series_id, occurrence, uid)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10)
+		ON CONFLICT (series_id, occurrence) DO NOTHING`, postgres.SchedulesTable)
+
+	if _, err := s.db.Exec(query, sch.ScheduleID, sch.UserID, pq.Array(sch.CameraIDs), sch.StartTime, sch.StopTime, options, sch.Status,
+		sch.SeriesID, sch.Occurrence, sch.UID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateSchedule saves the new time and cameras of a schedule that is still
+// pending.
+func (s *ScheduleStorage) UpdateSchedule(sch models.Schedule) error {
+	const op = "storage.postgres.schedules.UpdateSchedule"
+
+	query := fmt.Sprintf(`UPDATE %s SET camera_ids = $1, start_time = $2, stop_time = $3
+		WHERE schedule_id = $4 AND status = $5`, postgres.SchedulesTable)
+
+	result, err := s.db.Exec(query, pq.Array(sch.CameraIDs), sch.StartTime, sch.StopTime, sch.ScheduleID, constants.SchedulePending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, errs.ErrScheduleChanged)
+	}
+
+	return nil
+}
+
+// SetScheduleStatus moves a schedule from one status to another. An empty
+// recordID keeps the linked recording. A schedule that is no longer in the
+// from status is left as is.
+func (s *ScheduleStorage) SetScheduleStatus(scheduleID, from, to, recordID, reason string) error {
+	const op = "storage.postgres.schedules.SetScheduleStatus"
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, record_id = COALESCE(NULLIF($2, '')::uuid, record_id), error = $3
+		WHERE schedule_id = $4 AND status = $5`, postgres.SchedulesTable)
+
+	result, err := s.db.Exec(query, to, recordID, reason, scheduleID, from)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, errs.ErrScheduleChanged)
+	}
+
+	return nil
+}
+
+func (s *ScheduleStorage) Schedule(scheduleID string) (models.Schedule, error) {
+	const op = "storage.postgres.schedules.Schedule"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE schedule_id = $1`, scheduleColumns, postgres.SchedulesTable)
+
+	sch, err := scanSchedule(s.db.QueryRow(query, scheduleID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrScheduleNotFound)
+		}
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sch, nil
+}
+
+// HasUID reports whether a schedule or a series was imported from the
+// iCalendar event uid.
+func (s *ScheduleStorage) HasUID(uid string) (bool, error) {
+	const op = "storage.postgres.schedules.HasUID"
+
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE uid = $1) OR EXISTS (SELECT 1 FROM %s WHERE uid = $1)`,
+		postgres.SchedulesTable, postgres.SeriesTable)
+
+	var exists bool
+	if err := s.db.QueryRow(query, uid).Scan(&exists); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return exists, nil
+}
+
+// Occurrence returns the schedule created for an occurrence of a series.
+func (s *ScheduleStorage) Occurrence(seriesID string, occurrence time.Time) (models.Schedule, error) {
+	const op = "storage.postgres.schedules.Occurrence"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE series_id = $1 AND occurrence = $2`, scheduleColumns, postgres.SchedulesTable)
+
+	sch, err := scanSchedule(s.db.QueryRow(query, seriesID, occurrence))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Schedule{}, fmt.Errorf("%s: %w", op, errs.ErrScheduleNotFound)
+		}
+
+		return models.Schedule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sch, nil
+}
+
+// Schedules returns the schedules matching the filter, earliest first.
+func (s *ScheduleStorage) Schedules(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	const op = "storage.postgres.schedules.Schedules"
+
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.CameraID != "" {
+		where("$%d = ANY(camera_ids)", filter.CameraID)
+	}
+	if filter.SeriesID != "" {
+		where("series_id = $%d", filter.SeriesID)
+	}
+	if filter.UserID != 0 {
+		where("user_id = $%d", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		where("stop_time > $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("start_time < $%d", filter.To)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s`, scheduleColumns, postgres.SchedulesTable)
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY start_time"
+
+	schedules, err := s.schedules(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return schedules, nil
+}
+
+// OpenSchedules returns the schedules that are still to start or to stop,
+// earliest first.
+func (s *ScheduleStorage) OpenSchedules() ([]models.Schedule, error) {
+	const op = "storage.postgres.schedules.OpenSchedules"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE status IN ($1, $2) ORDER BY start_time`, scheduleColumns, postgres.SchedulesTable)
+
+	schedules, err := s.schedules(query, constants.SchedulePending, constants.ScheduleStarted)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return schedules, nil
+}
+
+func (s *ScheduleStorage) schedules(query string, args ...interface{}) ([]models.Schedule, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]models.Schedule, 0)
+	for rows.Next() {
+		sch, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, sch)
+	}
+
+	return schedules, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSchedule(row scanner) (models.Schedule, error) {
+	var sch models.Schedule
+	var cameraIDs pq.StringArray
+	var options []byte
+
+	if err := row.Scan(&sch.ScheduleID, &sch.UserID, &cameraIDs, &sch.StartTime, &sch.StopTime, &options, &sch.Status, &sch.RecordingID,
+		&sch.Error, &sch.SeriesID, &sch.Occurrence, &sch.UID, &sch.CreatedAt); err != nil {
+		return models.Schedule{}, err
+	}
+
+	sch.CameraIDs = cameraIDs
+
+	if err := json.Unmarshal(options, &sch.Options); err != nil {
+		return models.Schedule{}, err
+	}
+
+	return sch, nil
+}
@@ -0,0 +1,178 @@
+package schedulestorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zanzhit/studio_recorder/internal/domain/constants"
+	"github.com/zanzhit/studio_recorder/internal/domain/errs"
+	"github.com/zanzhit/studio_recorder/internal/domain/models"
+	"github.com/zanzhit/studio_recorder/internal/storage/postgres"
+)
+
+const seriesColumns = `series_id, user_id, camera_ids, start_time, stop_time, timezone, rrule, exdates, options, status, expanded_until, uid, created_at`
+
+func (s *ScheduleStorage) SaveSeries(series models.ScheduleSeries) error {
+	const op = "storage.postgres.schedules.SaveSeries"
+
+	options, err := json.Marshal(series.Options)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	exdates, err := json.Marshal(series.ExDates)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (series_id, user_id, camera_ids, start_time, stop_time, timezone, rrule, exdates, options, status, expanded_until, uid)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`, postgres.SeriesTable)
+
+	if _, err := s.db.Exec(query, series.SeriesID, series.UserID, pq.Array(series.CameraIDs), series.StartTime, series.StopTime, series.TimeZone,
+		series.RRule, exdates, options, series.Status, series.ExpandedUntil, series.UID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *ScheduleStorage) Series(seriesID string) (models.ScheduleSeries, error) {
+	const op = "storage.postgres.schedules.Series"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE series_id = $1`, seriesColumns, postgres.SeriesTable)
+
+	series, err := scanSeries(s.db.QueryRow(query, seriesID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, errs.ErrSeriesNotFound)
+		}
+
+		return models.ScheduleSeries{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return series, nil
+}
+
+// ActiveSeries returns the series that still have occurrences to create.
+func (s *ScheduleStorage) ActiveSeries() ([]models.ScheduleSeries, error) {
+	const op = "storage.postgres.schedules.ActiveSeries"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE status = $1 ORDER BY start_time`, seriesColumns, postgres.SeriesTable)
+
+	series, err := s.seriesList(query, constants.SeriesActive)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return series, nil
+}
+
+// UserSeries returns the series of a user that were not canceled. A userID
+// of 0 returns those of every user.
+func (s *ScheduleStorage) UserSeries(userID int) ([]models.ScheduleSeries, error) {
+	const op = "storage.postgres.schedules.UserSeries"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE status <> $1 AND ($2 = 0 OR user_id = $2) ORDER BY start_time`,
+		seriesColumns, postgres.SeriesTable)
+
+	series, err := s.seriesList(query, constants.SeriesCanceled, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return series, nil
+}
+
+func (s *ScheduleStorage) seriesList(query string, args ...interface{}) ([]models.ScheduleSeries, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make([]models.ScheduleSeries, 0)
+	for rows.Next() {
+		sr, err := scanSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		series = append(series, sr)
+	}
+
+	return series, rows.Err()
+}
+
+// SetSeriesExpanded records that the occurrences of an active series
+// starting up to until have been created.
+func (s *ScheduleStorage) SetSeriesExpanded(seriesID string, until time.Time) error {
+	const op = "storage.postgres.schedules.SetSeriesExpanded"
+
+	query := fmt.Sprintf(`UPDATE %s SET expanded_until = $1 WHERE series_id = $2 AND status = $3`, postgres.SeriesTable)
+
+	if _, err := s.db.Exec(query, until, seriesID, constants.SeriesActive); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetSeriesStatus moves a series from one status to another. A series that
+// is no longer in the from status is left as is.
+func (s *ScheduleStorage) SetSeriesStatus(seriesID, from, to string) error {
+	const op = "storage.postgres.schedules.SetSeriesStatus"
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1 WHERE series_id = $2 AND status = $3`, postgres.SeriesTable)
+
+	result, err := s.db.Exec(query, to, seriesID, from)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, errs.ErrScheduleChanged)
+	}
+
+	return nil
+}
+
+func scanSeries(row scanner) (models.ScheduleSeries, error) {
+	var series models.ScheduleSeries
+	var cameraIDs pq.StringArray
+	var exdates, options []byte
+
+	if err := row.Scan(&series.SeriesID, &series.UserID, &cameraIDs, &series.StartTime, &series.StopTime, &series.TimeZone, &series.RRule,
+		&exdates, &options, &series.Status, &series.ExpandedUntil, &series.UID, &series.CreatedAt); err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	// The zone keeps the wall clock the series recurs at, which the database
+	// does not store.
+	zone, err := time.LoadLocation(series.TimeZone)
+	if err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	series.StartTime = series.StartTime.In(zone)
+	series.StopTime = series.StopTime.In(zone)
+	series.CameraIDs = cameraIDs
+
+	if err := json.Unmarshal(exdates, &series.ExDates); err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	if err := json.Unmarshal(options, &series.Options); err != nil {
+		return models.ScheduleSeries{}, err
+	}
+
+	return series, nil
+}
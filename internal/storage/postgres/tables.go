@@ -1,8 +1,25 @@
 package postgres
 
 const (
-	UsersTable   = "users"
-	AdminsTable  = "admins"
-	RecordsTable = "recordings"
-	CamerasTable = "cameras"
+	UsersTable      = "users"
+	AdminsTable     = "admins"
+	FeedTokensTable = "feed_tokens"
+	RecordsTable    = "recordings"
+	CamerasTable    = "cameras"
+	SessionsTable   = "sessions"
+	SchedulesTable  = "schedules"
+	SeriesTable     = "schedule_series"
+
+	TransitionsTable = "recording_transitions"
+	SegmentsTable    = "recording_segments"
+	GapsTable        = "recording_gaps"
+	PausesTable      = "recording_pauses"
+	MarkersTable     = "recording_markers"
+	EventsTable      = "pipeline_events"
+	RenditionsTable  = "recording_renditions"
+
+	LayoutsTable     = "layouts"
+	LayoutSlotsTable = "layout_slots"
+
+	ProfilesTable = "profiles"
 )
@@ -0,0 +1,2 @@
+ALTER TABLE recordings DROP COLUMN mime_type;
+ALTER TABLE recordings DROP COLUMN container;
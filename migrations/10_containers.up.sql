@@ -0,0 +1,4 @@
+ALTER TABLE recordings ADD COLUMN container TEXT NOT NULL DEFAULT 'mkv';
+ALTER TABLE recordings ADD COLUMN mime_type TEXT NOT NULL DEFAULT 'video/x-matroska';
+
+UPDATE recordings SET container = 'ts', mime_type = 'video/mp2t' WHERE file_path LIKE '%.ts';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS recording_renditions (
+    record_id UUID NOT NULL,
+    rendition TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    container TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    PRIMARY KEY (record_id, rendition),
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+INSERT INTO recording_renditions (record_id, rendition, file_path, container, mime_type)
+SELECT record_id, 'master', file_path, container, mime_type FROM recordings WHERE file_path <> '';
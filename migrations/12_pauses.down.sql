@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS recording_pauses_record_id_idx;
+
+DROP TABLE recording_pauses;
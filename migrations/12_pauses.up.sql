@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS recording_pauses (
+    id SERIAL PRIMARY KEY,
+    record_id UUID NOT NULL,
+    pause_start TIMESTAMP NOT NULL,
+    pause_end TIMESTAMP,
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recording_pauses_record_id_idx ON recording_pauses (record_id);
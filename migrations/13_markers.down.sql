@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS recording_markers_record_id_idx;
+
+DROP TABLE recording_markers;
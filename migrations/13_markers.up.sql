@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recording_markers (
+    id SERIAL PRIMARY KEY,
+    record_id UUID NOT NULL,
+    label TEXT NOT NULL,
+    marker_offset DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recording_markers_record_id_idx ON recording_markers (record_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS recordings_session_id_idx;
+
+ALTER TABLE recordings DROP COLUMN session_index;
+ALTER TABLE recordings DROP COLUMN session_id;
+
+DROP TABLE sessions;
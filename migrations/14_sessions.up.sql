@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE recordings ADD COLUMN session_id UUID REFERENCES sessions(session_id) ON DELETE SET NULL;
+ALTER TABLE recordings ADD COLUMN session_index INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS recordings_session_id_idx ON recordings (session_id);
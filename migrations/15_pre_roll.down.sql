@@ -0,0 +1 @@
+ALTER TABLE cameras DROP COLUMN pre_roll_seconds;
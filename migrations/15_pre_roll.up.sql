@@ -0,0 +1 @@
+ALTER TABLE cameras ADD COLUMN pre_roll_seconds INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+ALTER TABLE sessions ALTER COLUMN start_time TYPE TIMESTAMP;
+
+ALTER TABLE recording_markers ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE recording_pauses
+    ALTER COLUMN pause_start TYPE TIMESTAMP,
+    ALTER COLUMN pause_end TYPE TIMESTAMP;
+
+ALTER TABLE recording_gaps
+    ALTER COLUMN gap_start TYPE TIMESTAMP,
+    ALTER COLUMN gap_end TYPE TIMESTAMP;
+
+ALTER TABLE recordings
+    ALTER COLUMN start_time TYPE TIMESTAMP,
+    ALTER COLUMN stop_time TYPE TIMESTAMP;
+
+DROP INDEX IF EXISTS schedules_status_start_time_idx;
+
+DROP TABLE schedules;
@@ -0,0 +1,45 @@
+-- Schedule times are instants: TIMESTAMPTZ stores them in UTC, whatever
+-- zone they were booked with. The zone of a series is kept in its own
+-- column.
+CREATE TABLE IF NOT EXISTS schedules (
+    schedule_id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    camera_ids TEXT[] NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    stop_time TIMESTAMPTZ NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL,
+    record_id UUID,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS schedules_status_start_time_idx ON schedules (status, start_time);
+
+-- Scheduled recordings were only kept by in-memory timers, which are gone
+-- once this runs.
+INSERT INTO recording_transitions (record_id, from_status, to_status)
+    SELECT record_id, status, 'failed' FROM recordings WHERE status = 'scheduled';
+UPDATE recordings SET status = 'failed' WHERE status = 'scheduled';
+
+-- Recordings started by schedules are compared with them, so their times
+-- become instants too, along with the gaps, pauses, markers and sessions
+-- that are measured from them. The old values are the server's wall clock
+-- and are read in the zone of the session that runs this migration.
+ALTER TABLE recordings
+    ALTER COLUMN start_time TYPE TIMESTAMPTZ,
+    ALTER COLUMN stop_time TYPE TIMESTAMPTZ;
+
+ALTER TABLE recording_gaps
+    ALTER COLUMN gap_start TYPE TIMESTAMPTZ,
+    ALTER COLUMN gap_end TYPE TIMESTAMPTZ;
+
+ALTER TABLE recording_pauses
+    ALTER COLUMN pause_start TYPE TIMESTAMPTZ,
+    ALTER COLUMN pause_end TYPE TIMESTAMPTZ;
+
+ALTER TABLE recording_markers ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE sessions ALTER COLUMN start_time TYPE TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS schedules_series_id_occurrence_idx;
+
+ALTER TABLE schedules DROP COLUMN occurrence;
+ALTER TABLE schedules DROP COLUMN series_id;
+
+DROP INDEX IF EXISTS schedule_series_status_idx;
+
+DROP TABLE schedule_series;
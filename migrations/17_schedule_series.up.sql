@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS schedule_series (
+    series_id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    camera_ids TEXT[] NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    stop_time TIMESTAMPTZ NOT NULL,
+    -- timezone is the IANA zone the series recurs in.
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    rrule TEXT NOT NULL,
+    exdates JSONB NOT NULL DEFAULT '[]',
+    options JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL,
+    expanded_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS schedule_series_status_idx ON schedule_series (status);
+
+ALTER TABLE schedules ADD COLUMN series_id UUID REFERENCES schedule_series(series_id) ON DELETE CASCADE;
+ALTER TABLE schedules ADD COLUMN occurrence TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS schedules_series_id_occurrence_idx ON schedules (series_id, occurrence);
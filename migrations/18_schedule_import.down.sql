@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS schedule_series_uid_idx;
+DROP INDEX IF EXISTS schedules_uid_idx;
+
+ALTER TABLE schedule_series DROP COLUMN uid;
+ALTER TABLE schedules DROP COLUMN uid;
+
+ALTER TABLE recordings DROP COLUMN title;
@@ -0,0 +1,8 @@
+ALTER TABLE recordings ADD COLUMN title TEXT NOT NULL DEFAULT '';
+
+-- uid is the UID of the iCalendar event a booking was imported from.
+ALTER TABLE schedules ADD COLUMN uid TEXT NOT NULL DEFAULT '';
+ALTER TABLE schedule_series ADD COLUMN uid TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS schedules_uid_idx ON schedules (uid) WHERE uid <> '';
+CREATE INDEX IF NOT EXISTS schedule_series_uid_idx ON schedule_series (uid) WHERE uid <> '';
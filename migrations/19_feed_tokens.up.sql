@@ -0,0 +1,7 @@
+-- token_hash is the SHA-256 of the calendar feed token, the token itself is
+-- only shown once when it is issued.
+CREATE TABLE IF NOT EXISTS feed_tokens (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
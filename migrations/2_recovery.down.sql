@@ -0,0 +1,2 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS pid;
+ALTER TABLE recordings DROP COLUMN IF EXISTS status;
@@ -0,0 +1,4 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'recording';
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS pid INTEGER;
+
+UPDATE recordings SET status = 'stopped' WHERE stop_time IS NOT NULL;
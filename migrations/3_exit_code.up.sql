@@ -0,0 +1 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS exit_code INTEGER;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS recordings_status_idx;
+
+DROP TABLE recording_transitions;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recording_transitions (
+    id SERIAL PRIMARY KEY,
+    record_id UUID NOT NULL,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT now(),
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recordings_status_idx ON recordings (status);
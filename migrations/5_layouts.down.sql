@@ -0,0 +1,3 @@
+DROP TABLE layout_slots;
+
+DROP TABLE layouts;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS layouts (
+    layout_id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    background TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS layout_slots (
+    layout_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    x INTEGER NOT NULL,
+    y INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    z_order INTEGER NOT NULL DEFAULT 0,
+    border INTEGER NOT NULL DEFAULT 0,
+    border_color TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (layout_id, position),
+    FOREIGN KEY (layout_id) REFERENCES layouts(layout_id) ON DELETE CASCADE
+);
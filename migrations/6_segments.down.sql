@@ -0,0 +1,3 @@
+DROP TABLE recording_segments;
+
+ALTER TABLE recordings DROP COLUMN segmented;
@@ -0,0 +1,12 @@
+ALTER TABLE recordings ADD COLUMN segmented BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS recording_segments (
+    record_id UUID NOT NULL,
+    segment_index INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    start_offset DOUBLE PRECISION NOT NULL,
+    end_offset DOUBLE PRECISION NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (record_id, segment_index),
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS recording_gaps (
+    id SERIAL PRIMARY KEY,
+    record_id UUID NOT NULL,
+    gap_start TIMESTAMP NOT NULL,
+    gap_end TIMESTAMP,
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recording_gaps_record_id_idx ON recording_gaps (record_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS pipeline_events_record_id_idx;
+DROP TABLE IF EXISTS pipeline_events;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS pipeline_events (
+    id SERIAL PRIMARY KEY,
+    record_id UUID NOT NULL,
+    event_time TIMESTAMP NOT NULL,
+    level TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL,
+    FOREIGN KEY (record_id) REFERENCES recordings(record_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS pipeline_events_record_id_idx ON pipeline_events (record_id);
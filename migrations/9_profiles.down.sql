@@ -0,0 +1,3 @@
+ALTER TABLE cameras DROP COLUMN profile_id;
+
+DROP TABLE profiles;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS profiles (
+    profile_id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    video_codec TEXT NOT NULL,
+    video_bitrate INTEGER NOT NULL DEFAULT 0,
+    preset TEXT NOT NULL DEFAULT '',
+    keyframe_interval INTEGER NOT NULL DEFAULT 0,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    framerate INTEGER NOT NULL DEFAULT 0,
+    audio_codec TEXT NOT NULL,
+    audio_bitrate INTEGER NOT NULL DEFAULT 0
+);
+
+ALTER TABLE cameras ADD COLUMN profile_id TEXT REFERENCES profiles(profile_id) ON DELETE SET NULL;